@@ -0,0 +1,60 @@
+package args
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Smallest nonzero bandwidth limit accepted, in bytes per second, as in rsync.
+const minBwLimit = 512
+
+var bwLimitRegexp = regexp.MustCompile(`^(\d+(?:[.,]\d*)?|[.,]\d+)(?:([bkmgtp])(ib|b)?)?([+-]1)?$`)
+
+type bwLimitArgument string
+
+func (b bwLimitArgument) Validate() error {
+	_, err := ParseBwLimit(string(b))
+	return err
+}
+
+// ParseBwLimit parses a bandwidth limit in the units accepted by rsync's
+// --bwlimit, returning the limit in bytes per second, or 0 if unlimited.
+//
+// The value is a number with an optional suffix: "b" for bytes, "k", "m",
+// "g", "t" or "p" for powers of 1024 (default "k"), or "kb", "mb" etc. for
+// powers of 1000. A trailing "+1" or "-1" adjusts the value by one byte.
+func ParseBwLimit(value string) (int64, error) {
+	match := bwLimitRegexp.FindStringSubmatch(strings.ToLower(value))
+	if match == nil || (match[2] == "b" && match[3] != "") {
+		return 0, fmt.Errorf("invalid bandwidth limit: %q", value)
+	}
+
+	number, err := strconv.ParseFloat(strings.Replace(match[1], ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth limit: %q", value)
+	}
+
+	unit := match[2]
+	if unit == "" {
+		unit = "k"
+	}
+	base := 1024.0
+	if match[3] == "b" {
+		base = 1000.0
+	}
+
+	out := int64(number * math.Pow(base, float64(strings.Index("bkmgtp", unit))))
+	if match[4] != "" {
+		adjust, _ := strconv.Atoi(match[4])
+		out += int64(adjust)
+	}
+
+	if out != 0 && out < minBwLimit {
+		return 0, fmt.Errorf("bandwidth limit %q is too small, minimum is %d bytes", value, minBwLimit)
+	}
+
+	return out, nil
+}
@@ -2,6 +2,7 @@ package args
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"reflect"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/alecthomas/kong"
 	"github.com/go-playground/validator/v10"
+	"github.com/release-engineering/exodus-rsync/internal/filter"
 )
 
 const docsURL = "https://github.com/release-engineering/exodus-rsync"
@@ -16,27 +18,29 @@ const docsURL = "https://github.com/release-engineering/exodus-rsync"
 type filterArguments []string
 
 func (f filterArguments) Validate() error {
-	validRules := []string{"+", "-"}
-	validMods := []string{"", "/"}
-	validSeps := []string{" ", "_"}
-validation:
 	for _, arg := range f {
-		for _, rule := range validRules {
-			for _, mod := range validMods {
-				for _, sep := range validSeps {
-					prefix := rule + mod + sep
-					if strings.HasPrefix(arg, prefix) && strings.TrimLeft(arg, prefix) != "" {
-						continue validation
-					}
-				}
-			}
+		if _, err := filter.Parse(arg); err != nil {
+			return err
 		}
-		// Anything else is not supported
-		return fmt.Errorf("unsupported filter '%s'", arg)
 	}
 	return nil
 }
 
+// FilterArg is a single filter-related argument, in the order given on the
+// command-line.
+type FilterArg struct {
+	// Name of the argument: "filter", "exclude", "include", "exclude-from"
+	// or "include-from".
+	Name string
+
+	// Value of the argument.
+	Value string
+
+	// For "exclude-from" and "include-from", the patterns read from the
+	// file by ReadFilterFiles.
+	Patterns []string
+}
+
 // IgnoredConfig defines arguments which can be accepted for compatibility with rsync,
 // but are ignored by exodus-rsync.
 type IgnoredConfig struct {
@@ -59,12 +63,9 @@ type IgnoredConfig struct {
 	Crtimes         bool   `short:"N"`
 	OmitDirTimes    bool   `short:"O"`
 	Rsh             string `short:"e"`
-	Delete          bool
-	PruneEmptyDirs  bool `short:"m"`
+	PruneEmptyDirs  bool   `short:"m"`
 	Timeout         int
 	Compress        bool `short:"z"`
-	Stats           bool
-	ItemizeChanges  bool `short:"i"`
 }
 
 // ExodusConfig defines arguments which are specific to exodus-rsync and not supported
@@ -73,11 +74,37 @@ type IgnoredConfig struct {
 type ExodusConfig struct {
 	Conf string `help:"Force usage of this configuration file." validate:"max=2000"`
 
-	Publish string `help:"ID of existing exodus-gw publish to join." validate:"omitempty,uuid"`
+	Publish string `help:"ID of existing exodus-gw publish to join." xor:"publish" validate:"omitempty,uuid"`
 
 	Commit string `help:"Commit publish using this mode" validate:"omitempty,max=20"`
 
 	Diag bool `help:"Diagnostic mode, dumps various information about the environment."`
+
+	HashCache string `help:"Checksum cache mode: 'bypass' to ignore the cache, 'rebuild' to replace its content." validate:"omitempty,oneof=bypass rebuild"`
+
+	Resume bool `help:"Resume the previous run with the same arguments, if it was interrupted."`
+
+	ManifestOut string `placeholder:"FILE" help:"Write a JSON manifest of published content to FILE." validate:"max=2000"`
+
+	FromManifest string `placeholder:"FILE" help:"Publish the items listed in JSON manifest FILE rather than walking SRC." validate:"max=2000"`
+
+	NoWait bool `help:"Start the commit of the publish, print the ID of its task and exit without waiting for the commit to complete."`
+
+	Verify bool `help:"After committing the publish, fetch published content from the CDN and check that it matches what was published."`
+
+	AwaitTask string `placeholder:"ID" xor:"action" help:"Wait for the exodus-gw task with this ID to complete, rather than syncing. DEST, if given, selects the environment." validate:"omitempty,uuid"`
+
+	PublishAction string `placeholder:"ACTION" xor:"action" help:"Rather than syncing, manage the publish given by --exodus-publish: 'status', 'commit', 'abort' or 'items'. DEST, if given, selects the environment." validate:"omitempty,oneof=status commit abort items"`
+
+	NewPublish bool `help:"Rather than syncing, create a new publish and print its ID, to be joined with --exodus-publish. DEST, if given, selects the environment." xor:"publish,action"`
+
+	Plan bool `help:"Rather than publishing, report how publishing SRC would change content published under DEST." xor:"report"`
+
+	ContentTypeReport bool `help:"Rather than publishing, list the content type which would be published for each file in SRC." xor:"report"`
+
+	CheckConfig bool `help:"Rather than syncing, strictly load the config file, check every value and print the resolved values for each environment." xor:"publish,action"`
+
+	Output string `placeholder:"FORMAT" help:"Format of the output of --exodus-new-publish, --exodus-plan, --exodus-content-type-report and --exodus-check-config: 'text' (default) or 'json'." validate:"omitempty,oneof=text json"`
 }
 
 // Config contains the subset of arguments which are returned by the parser and
@@ -97,13 +124,31 @@ type Config struct {
 	// See comments where the argument is checked for the explanation why.
 	IgnoreExisting bool `hidden:"1"`
 
-	Filter    filterArguments `short:"f" placeholder:"RULE" help:"Add a file-filtering RULE"`
-	Exclude   []string        `placeholder:"PATTERN" help:"Exclude files matching this pattern" validate:"dive,max=2000"`
-	Include   []string        `placeholder:"PATTERN" help:"Don't exclude files matching this pattern" validate:"dive,max=2000"`
-	FilesFrom string          `placeholder:"FILE" help:"Read list of source-file names from FILE" validate:"max=2000"`
+	Delete bool `help:"Delete extraneous files from the destination"`
+
+	Stats          bool `help:"Give some file-transfer stats"`
+	ItemizeChanges bool `short:"i" help:"Output a change-summary for all updates"`
+
+	Progress bool     `help:"Show progress during transfer"`
+	Info     []string `placeholder:"FLAGS" help:"Fine-grained informational verbosity" validate:"dive,max=100"`
+
+	BwLimit bwLimitArgument `name:"bwlimit" placeholder:"RATE" help:"Limit upload bandwidth; KBytes per second" validate:"max=100"`
+
+	Filter          filterArguments `short:"f" sep:"none" placeholder:"RULE" help:"Add a file-filtering RULE"`
+	FilterShorthand int             `short:"F" type:"counter" help:"Same as --filter='dir-merge /.rsync-filter'; repeated: --filter='- .rsync-filter'"`
+	Exclude         []string        `sep:"none" placeholder:"PATTERN" help:"Exclude files matching this pattern" validate:"dive,max=2000"`
+	Include         []string        `sep:"none" placeholder:"PATTERN" help:"Don't exclude files matching this pattern" validate:"dive,max=2000"`
+	ExcludeFrom     []string        `sep:"none" placeholder:"FILE" help:"Read exclude patterns from FILE ('-' for stdin)" validate:"dive,max=2000"`
+	IncludeFrom     []string        `sep:"none" placeholder:"FILE" help:"Read include patterns from FILE ('-' for stdin)" validate:"dive,max=2000"`
+	FilesFrom       string          `placeholder:"FILE" help:"Read list of source-file names from FILE" validate:"max=2000"`
+	From0           bool            `name:"from0" short:"0" help:"All *-from/filter files are delimited by 0s"`
 
-	Src  string `arg:"1" placeholder:"SRC" help:"Local path to a file or directory for sync" validate:"max=2000"`
-	Dest string `arg:"1" placeholder:"[USER@]HOST:DEST" help:"Remote destination for sync" validate:"max=2000"`
+	// All of the above filter arguments, in the order they were given.
+	FilterArgs []FilterArg `kong:"-"`
+
+	// Both required when syncing; see Parse.
+	Src  string `arg:"1" optional:"1" placeholder:"SRC" help:"Local path to a file or directory for sync" validate:"max=2000"`
+	Dest string `arg:"1" optional:"1" placeholder:"[USER@]HOST:DEST" help:"Remote destination for sync" validate:"max=2000"`
 
 	IgnoredConfig `embed:"1" group:"ignored"`
 	ExodusConfig  `embed:"1" prefix:"exodus-"`
@@ -127,26 +172,156 @@ func (c *Config) ValidateConfig() (retErr error) {
 	return retErr
 }
 
-// processFilterArgs is a helper function that appends the appropriate patterns
-// (based on the given rule) from Filter arguments onto the given slice.
-func (c *Config) processFilterArgs(rule string, slice []string) []string {
-	for _, arg := range c.Filter {
-		if strings.HasPrefix(string(arg), rule) {
-			slice = append(slice, strings.TrimLeft(arg, "+-/ _"))
+// Filters returns the filter-related arguments in the order they were given
+// on the command-line, with -F expanded into the equivalent filter rules.
+//
+// If the order is unknown, as when a Config was not created by Parse, filters
+// come before excludes, which come before includes.
+func (c *Config) Filters() []FilterArg {
+	if c.FilterArgs != nil {
+		return c.FilterArgs
+	}
+
+	var out []FilterArg
+	for _, rule := range c.Filter {
+		out = append(out, FilterArg{Name: "filter", Value: rule})
+	}
+	for _, pattern := range c.Exclude {
+		out = append(out, FilterArg{Name: "exclude", Value: pattern})
+	}
+	for _, pattern := range c.Include {
+		out = append(out, FilterArg{Name: "include", Value: pattern})
+	}
+	for _, file := range c.ExcludeFrom {
+		out = append(out, FilterArg{Name: "exclude-from", Value: file})
+	}
+	for _, file := range c.IncludeFrom {
+		out = append(out, FilterArg{Name: "include-from", Value: file})
+	}
+	for i := 0; i < c.FilterShorthand; i++ {
+		out = append(out, shorthandFilter(i))
+	}
+	return out
+}
+
+// shorthandFilter returns the rule equivalent to the nth occurrence of -F.
+func shorthandFilter(n int) FilterArg {
+	if n == 0 {
+		return FilterArg{Name: "filter", Value: "dir-merge /.rsync-filter"}
+	}
+	return FilterArg{Name: "filter", Value: "exclude .rsync-filter"}
+}
+
+// orderFilters sets FilterArgs from the order in which flags appear in a
+// parsed command-line.
+func (c *Config) orderFilters(ctx *kong.Context) {
+	if ctx == nil {
+		return
+	}
+
+	values := map[string][]string{
+		"filter":       c.Filter,
+		"exclude":      c.Exclude,
+		"include":      c.Include,
+		"exclude-from": c.ExcludeFrom,
+		"include-from": c.IncludeFrom,
+	}
+	shorthand := 0
+
+	for _, p := range ctx.Path {
+		if p.Flag == nil {
+			continue
+		}
+
+		name := p.Flag.Name
+		if name == "filter-shorthand" {
+			c.FilterArgs = append(c.FilterArgs, shorthandFilter(shorthand))
+			shorthand++
+			continue
+		}
+
+		if remaining := values[name]; len(remaining) > 0 {
+			c.FilterArgs = append(c.FilterArgs, FilterArg{Name: name, Value: remaining[0]})
+			values[name] = remaining[1:]
+		}
+	}
+}
+
+// ReadFilterFiles reads the patterns from each --exclude-from and
+// --include-from file, with "-" meaning stdin, and stores them in FilterArgs.
+func (c *Config) ReadFilterFiles(stdin io.Reader) error {
+	filters := c.Filters()
+
+	for i, arg := range filters {
+		if arg.Name != "exclude-from" && arg.Name != "include-from" {
+			continue
+		}
+
+		var err error
+		if arg.Value == "-" {
+			filters[i].Patterns, err = ReadPatterns(stdin, c.From0)
+		} else {
+			filters[i].Patterns, err = readPatternsFile(arg.Value, c.From0)
+		}
+		if err != nil {
+			return fmt.Errorf("reading --%s %s: %w", arg.Name, arg.Value, err)
 		}
 	}
-	return slice
+
+	c.FilterArgs = filters
+	return nil
+}
+
+func readPatternsFile(name string, from0 bool) ([]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadPatterns(file, from0)
 }
 
-// Excluded extracts the pattern from Filter arguments and appends it onto Exclude.
-func (c *Config) Excluded() []string {
-	return c.processFilterArgs("-", c.Exclude)
+// ReadPatterns reads patterns from an --exclude-from or --include-from file,
+// one per line, or separated by NULs if from0 is true. As in rsync, blank
+// lines and lines starting with ';' or '#' are ignored.
+func ReadPatterns(r io.Reader, from0 bool) ([]string, error) {
+	out := []string{}
+
+	scanner := filter.NewScanner(r, from0)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	return out, scanner.Err()
 }
 
-// Included extracts the pattern from Filter arguments and appends it onto Include.
-func (c *Config) Included() []string {
-	return c.processFilterArgs("+", c.Include)
+// ReadFilesFrom returns the names listed in the --files-from file.
+//
+// Names are separated by newlines, or NULs with --from0, and are otherwise
+// used as-is, so they may contain leading or trailing spaces. Empty names are
+// ignored.
+func (c *Config) ReadFilesFrom() ([]string, error) {
+	file, err := os.Open(c.FilesFrom)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
+	out := []string{}
+
+	scanner := filter.NewScanner(file, c.From0)
+	for scanner.Scan() {
+		if name := scanner.Text(); name != "" {
+			out = append(out, name)
+		}
+	}
+
+	return out, scanner.Err()
 }
 
 // DestPath returns only the path portion of the destination argument passed
@@ -170,6 +345,37 @@ func (c *Config) DestPath() string {
 	return ""
 }
 
+// Syncing returns true if content is to be synced from SRC to DEST, which is
+// the case unless the command only manages existing publishes or tasks, or
+// checks the config.
+func (c *Config) Syncing() bool {
+	return c.AwaitTask == "" && c.PublishAction == "" && !c.NewPublish && !c.CheckConfig
+}
+
+// Reporting returns true if the command only reports on SRC, as requested by
+// --exodus-plan or --exodus-content-type-report, rather than publishing it.
+func (c *Config) Reporting() bool {
+	return c.Plan || c.ContentTypeReport
+}
+
+// ShowProgress returns true if progress of the transfer should be shown, as
+// requested by --progress or --info=progress2.
+//
+// Since files are uploaded concurrently, there's no per-file progress as with
+// rsync's --info=progress1; any progress level shows the overall progress.
+func (c *Config) ShowProgress() bool {
+	show := c.Progress
+	for _, flag := range c.Info {
+		switch strings.ToLower(flag) {
+		case "progress", "progress1", "progress2":
+			show = true
+		case "progress0", "noprogress":
+			show = false
+		}
+	}
+	return show
+}
+
 type argStringMapper struct{}
 
 // A custom string decoder for kong. We use this because the default decoder
@@ -203,7 +409,7 @@ func Parse(args []string, version string, exit func(int)) Config {
 
 	os.Args = args
 	out := Config{}
-	kong.Parse(&out,
+	ctx := kong.Parse(&out,
 		kong.Exit(exit),
 		kong.KindMapper(reflect.String, argStringMapper{}),
 		kong.Description(
@@ -221,6 +427,19 @@ func Parse(args []string, version string, exit func(int)) Config {
 		}),
 	)
 
+	if out.PublishAction != "" && out.Publish == "" {
+		ctx.Fatalf("--exodus-publish-action requires --exodus-publish")
+	}
+
+	if !out.Syncing() && out.Dest == "" {
+		// With a single positional argument, it's the destination.
+		out.Src, out.Dest = "", out.Src
+	} else if out.Syncing() && (out.Src == "" || out.Dest == "") {
+		ctx.Fatalf("expected \"<src> <dest>\"")
+	}
+
+	out.orderFilters(ctx)
+
 	// DevicesSpecials (-D) enables both --devices and --specials.
 	if out.DevicesSpecials {
 		out.Devices = true
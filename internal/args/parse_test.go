@@ -1,6 +1,7 @@
 package args
 
 import (
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -30,11 +31,8 @@ func TestParseOk(t *testing.T) {
 				"--crtimes",
 				"--omit-dir-times",
 				"--rsh", "abc",
-				"--delete",
 				"--prune-empty-dirs",
 				"--timeout", "123",
-				"--stats",
-				"--itemize-changes",
 				"x",
 				"y"},
 			want: Config{Src: "x", Dest: "y",
@@ -58,14 +56,45 @@ func TestParseOk(t *testing.T) {
 					Crtimes:         true,
 					OmitDirTimes:    true,
 					Rsh:             "abc",
-					Delete:          true,
 					PruneEmptyDirs:  true,
 					Timeout:         123,
 					Compress:        true,
-					Stats:           true,
-					ItemizeChanges:  true,
 				}}},
 
+		"stats": {
+			input: []string{
+				"exodus-rsync",
+				"--stats",
+				"-i",
+				"x",
+				"y"},
+			want: Config{Stats: true, ItemizeChanges: true, Src: "x", Dest: "y"}},
+
+		"progress": {
+			input: []string{
+				"exodus-rsync",
+				"--progress",
+				"--info=progress2,stats2",
+				"x",
+				"y"},
+			want: Config{Progress: true, Info: []string{"progress2", "stats2"}, Src: "x", Dest: "y"}},
+
+		"bwlimit": {
+			input: []string{
+				"exodus-rsync",
+				"--bwlimit=1.5m",
+				"x",
+				"y"},
+			want: Config{BwLimit: "1.5m", Src: "x", Dest: "y"}},
+
+		"delete": {
+			input: []string{
+				"exodus-rsync",
+				"--delete",
+				"x",
+				"y"},
+			want: Config{Delete: true, Src: "x", Dest: "y"}},
+
 		"verbose": {
 			input: []string{
 				"exodus-rsync",
@@ -99,7 +128,8 @@ func TestParseOk(t *testing.T) {
 				"*.conf",
 				"x",
 				"y"},
-			want: Config{Exclude: []string{".*", "*.conf"}, Src: "x", Dest: "y"}},
+			want: Config{Exclude: []string{".*", "*.conf"}, Src: "x", Dest: "y",
+				FilterArgs: []FilterArg{{Name: "exclude", Value: ".*"}, {Name: "exclude", Value: "*.conf"}}}},
 
 		"files-from": {
 			input: []string{
@@ -110,6 +140,18 @@ func TestParseOk(t *testing.T) {
 				"y"},
 			want: Config{FilesFrom: "sources.txt", Src: "x", Dest: "y"}},
 
+		"from0": {
+			input: []string{
+				"exodus-rsync",
+				"-0r",
+				"--from0",
+				"--files-from",
+				"sources.txt",
+				"x",
+				"y"},
+			want: Config{FilesFrom: "sources.txt", From0: true, Src: "x", Dest: "y",
+				IgnoredConfig: IgnoredConfig{Recursive: true}}},
+
 		"tolerable filter": {
 			input: []string{
 				"exodus-rsync",
@@ -117,7 +159,52 @@ func TestParseOk(t *testing.T) {
 				"--filter=-/_*",
 				"x",
 				"y"},
-			want: Config{Src: "x", Dest: "y", Filter: []string{"+ **/hi/**", "-/_*"}}},
+			want: Config{Src: "x", Dest: "y", Filter: []string{"+ **/hi/**", "-/_*"},
+				FilterArgs: []FilterArg{{Name: "filter", Value: "+ **/hi/**"}, {Name: "filter", Value: "-/_*"}}}},
+
+		"ordered filters": {
+			input: []string{
+				"exodus-rsync",
+				"--include", "keep,this",
+				"-F",
+				"--exclude=*.o",
+				"--filter", "merge,- rules",
+				"-FF",
+				"--include", "*/",
+				"x",
+				"y"},
+			want: Config{Src: "x", Dest: "y",
+				Filter:          []string{"merge,- rules"},
+				FilterShorthand: 3,
+				Exclude:         []string{"*.o"},
+				Include:         []string{"keep,this", "*/"},
+				FilterArgs: []FilterArg{
+					{Name: "include", Value: "keep,this"},
+					{Name: "filter", Value: "dir-merge /.rsync-filter"},
+					{Name: "exclude", Value: "*.o"},
+					{Name: "filter", Value: "merge,- rules"},
+					{Name: "filter", Value: "exclude .rsync-filter"},
+					{Name: "filter", Value: "exclude .rsync-filter"},
+					{Name: "include", Value: "*/"},
+				}}},
+
+		"exclude-from": {
+			input: []string{
+				"exodus-rsync",
+				"--include-from", "a,b",
+				"--exclude", "*.o",
+				"--exclude-from=-",
+				"x",
+				"y"},
+			want: Config{Src: "x", Dest: "y",
+				Exclude:     []string{"*.o"},
+				ExcludeFrom: []string{"-"},
+				IncludeFrom: []string{"a,b"},
+				FilterArgs: []FilterArg{
+					{Name: "include-from", Value: "a,b"},
+					{Name: "exclude", Value: "*.o"},
+					{Name: "exclude-from", Value: "-"},
+				}}},
 		"with publish": {
 			input: []string{
 				"exodus-rsync",
@@ -128,6 +215,44 @@ func TestParseOk(t *testing.T) {
 			},
 			want: Config{Src: "x", Dest: "y", ExodusConfig: ExodusConfig{Publish: "3e0a4539-be4a-437e-a45f-6d72f7192f17"}},
 		},
+		"no wait": {
+			input: []string{"exodus-rsync", "--exodus-no-wait", "x", "y"},
+			want:  Config{Src: "x", Dest: "y", ExodusConfig: ExodusConfig{NoWait: true}},
+		},
+		"await task": {
+			input: []string{"exodus-rsync", "--exodus-await-task", "3e0a4539-be4a-437e-a45f-6d72f7192f17"},
+			want:  Config{ExodusConfig: ExodusConfig{AwaitTask: "3e0a4539-be4a-437e-a45f-6d72f7192f17"}},
+		},
+		"publish action": {
+			input: []string{"exodus-rsync", "--exodus-publish", "3e0a4539-be4a-437e-a45f-6d72f7192f17",
+				"--exodus-publish-action", "status", "exodus:/dest"},
+			want: Config{Dest: "exodus:/dest", ExodusConfig: ExodusConfig{
+				Publish: "3e0a4539-be4a-437e-a45f-6d72f7192f17", PublishAction: "status"}},
+		},
+		"new publish": {
+			input: []string{"exodus-rsync", "--exodus-new-publish", "--exodus-output", "json", "exodus:/"},
+			want:  Config{Dest: "exodus:/", ExodusConfig: ExodusConfig{NewPublish: true, Output: "json"}},
+		},
+		"check config": {
+			input: []string{"exodus-rsync", "--exodus-check-config", "--exodus-conf", "test.conf"},
+			want:  Config{ExodusConfig: ExodusConfig{CheckConfig: true, Conf: "test.conf"}},
+		},
+		"content type report": {
+			input: []string{"exodus-rsync", "--exodus-content-type-report", "x", "y"},
+			want:  Config{Src: "x", Dest: "y", ExodusConfig: ExodusConfig{ContentTypeReport: true}},
+		},
+		"verify": {
+			input: []string{"exodus-rsync", "--exodus-verify", "x", "y"},
+			want:  Config{Src: "x", Dest: "y", ExodusConfig: ExodusConfig{Verify: true}},
+		},
+		"plan": {
+			input: []string{"exodus-rsync", "--exodus-plan", "--exodus-output", "json", "x", "y"},
+			want:  Config{Src: "x", Dest: "y", ExodusConfig: ExodusConfig{Plan: true, Output: "json"}},
+		},
+		"await task with dest": {
+			input: []string{"exodus-rsync", "--exodus-await-task", "3e0a4539-be4a-437e-a45f-6d72f7192f17", "y"},
+			want:  Config{Dest: "y", ExodusConfig: ExodusConfig{AwaitTask: "3e0a4539-be4a-437e-a45f-6d72f7192f17"}},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -145,7 +270,29 @@ func TestParseErrors(t *testing.T) {
 	}{
 		"missing src dest": {[]string{"exodus-rsync"}},
 
+		"missing dest": {[]string{"exodus-rsync", "x"}},
+
+		"publish action without publish": {[]string{"exodus-rsync", "--exodus-publish-action", "status"}},
+
+		"new publish with publish": {[]string{"exodus-rsync", "--exodus-new-publish",
+			"--exodus-publish", "3e0a4539-be4a-437e-a45f-6d72f7192f17"}},
+
+		"new publish with await": {[]string{"exodus-rsync", "--exodus-new-publish",
+			"--exodus-await-task", "3e0a4539-be4a-437e-a45f-6d72f7192f17"}},
+
+		"check config with new publish": {[]string{"exodus-rsync", "--exodus-check-config",
+			"--exodus-new-publish"}},
+
+		"plan with content type report": {[]string{"exodus-rsync", "--exodus-plan",
+			"--exodus-content-type-report", "x", "y"}},
+
 		"bad filter": {[]string{"exodus-rsync", "--filter", "quux", "x", "y"}},
+
+		"bad filter modifier": {[]string{"exodus-rsync", "--filter", "-z foo", "x", "y"}},
+
+		"bad bwlimit": {[]string{"exodus-rsync", "--bwlimit", "fast", "x", "y"}},
+
+		"small bwlimit": {[]string{"exodus-rsync", "--bwlimit", "100b", "x", "y"}},
 	}
 
 	for name, tc := range tests {
@@ -185,6 +332,184 @@ func TestDestPath(t *testing.T) {
 	}
 }
 
+func TestParseBwLimit(t *testing.T) {
+	tests := map[string]int64{
+		"0":       0,
+		"100":     102400,
+		"1.5m":    1572864,
+		"1,5M":    1572864,
+		"2MiB":    2097152,
+		"2mb":     2000000,
+		"512b":    512,
+		"1k+1":    1025,
+		"1kb-1":   999,
+		"1g":      1 << 30,
+		".5K":     512,
+		"0.5":     512,
+		"1P":      1 << 50,
+		"4096B+1": 4097,
+	}
+	for value, want := range tests {
+		got, err := ParseBwLimit(value)
+		if err != nil || got != want {
+			t.Errorf("ParseBwLimit(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "fast", "1x", "1bb", "1bib", "-1", "1+2", "511b", "0.1"} {
+		if _, err := ParseBwLimit(value); err == nil {
+			t.Errorf("ParseBwLimit(%q) unexpectedly succeeded", value)
+		}
+	}
+}
+
+func TestShowProgress(t *testing.T) {
+	tests := map[string]struct {
+		config Config
+		want   bool
+	}{
+		"default":   {Config{}, false},
+		"progress":  {Config{Progress: true}, true},
+		"progress2": {Config{Info: []string{"stats2", "PROGRESS2"}}, true},
+		"progress1": {Config{Info: []string{"progress1"}}, true},
+		"disabled":  {Config{Progress: true, Info: []string{"progress0"}}, false},
+		"other":     {Config{Info: []string{"stats2"}}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.config.ShowProgress(); got != tt.want {
+				t.Errorf("ShowProgress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilters(t *testing.T) {
+	// Without FilterArgs, as when not created by Parse, filters have a
+	// fixed order.
+	cfg := Config{
+		Filter:          []string{"- a"},
+		FilterShorthand: 2,
+		Exclude:         []string{"b"},
+		Include:         []string{"c"},
+	}
+
+	want := []FilterArg{
+		{Name: "filter", Value: "- a"},
+		{Name: "exclude", Value: "b"},
+		{Name: "include", Value: "c"},
+		{Name: "filter", Value: "dir-merge /.rsync-filter"},
+		{Name: "filter", Value: "exclude .rsync-filter"},
+	}
+	if got := cfg.Filters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Filters() = %v", got)
+	}
+
+	cfg.FilterArgs = []FilterArg{{Name: "include", Value: "c"}}
+	if got := cfg.Filters(); !reflect.DeepEqual(got, cfg.FilterArgs) {
+		t.Errorf("Filters() = %v", got)
+	}
+}
+
+func TestReadPatterns(t *testing.T) {
+	input := "# comment\n; comment\n\n*.o\r\n+ keep.o\n trailing \n!\nlast"
+
+	got, err := ReadPatterns(strings.NewReader(input), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"*.o", "+ keep.o", " trailing ", "!", "last"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadPatterns() = %q", got)
+	}
+
+	if got, _ := ReadPatterns(strings.NewReader(""), false); got == nil || len(got) != 0 {
+		t.Errorf("ReadPatterns() of empty input = %#v", got)
+	}
+
+	// With --from0, newlines are part of patterns.
+	got, err = ReadPatterns(strings.NewReader("# comment\x00a\nb\x00\x00c"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a\nb", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadPatterns() with from0 = %q", got)
+	}
+}
+
+func TestReadFilesFrom(t *testing.T) {
+	file := t.TempDir() + "/files"
+
+	tests := []struct {
+		name    string
+		content string
+		from0   bool
+		want    []string
+	}{
+		{"lines", "a\n b \r\n\n# not a comment\ndir/", false,
+			[]string{"a", " b ", "# not a comment", "dir/"}},
+		{"from0", "a\x00 new\nline \x00\x00last", true,
+			[]string{"a", " new\nline ", "last"}},
+		{"empty", "", false, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := Config{FilesFrom: file, From0: tt.from0}
+			got, err := cfg.ReadFilesFrom()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadFilesFrom() = %q", got)
+			}
+		})
+	}
+
+	cfg := Config{FilesFrom: "/no/such/file"}
+	if _, err := cfg.ReadFilesFrom(); err == nil {
+		t.Error("unexpectedly read missing file")
+	}
+}
+
+func TestReadFilterFiles(t *testing.T) {
+	file := t.TempDir() + "/patterns"
+	if err := os.WriteFile(file, []byte("*.tmp\n# comment\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		Exclude:     []string{"*.o"},
+		ExcludeFrom: []string{file},
+		IncludeFrom: []string{"-"},
+	}
+
+	if err := cfg.ReadFilterFiles(strings.NewReader("keep.tmp\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []FilterArg{
+		{Name: "exclude", Value: "*.o"},
+		{Name: "exclude-from", Value: file, Patterns: []string{"*.tmp"}},
+		{Name: "include-from", Value: "-", Patterns: []string{"keep.tmp"}},
+	}
+	if got := cfg.Filters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Filters() = %v", got)
+	}
+
+	cfg = Config{ExcludeFrom: []string{"/no/such/file"}}
+	err := cfg.ReadFilterFiles(strings.NewReader(""))
+	if err == nil || !strings.Contains(err.Error(), "reading --exclude-from /no/such/file") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
 func TestStringMapDecodeError(t *testing.T) {
 	err := argStringMapper{}.Decode(
 		&kong.DecodeContext{Value: &kong.Value{}, Scan: &kong.Scanner{}},
@@ -222,3 +547,14 @@ func TestConfigValidationErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestPublishActionValidationError(t *testing.T) {
+	config := Parse([]string{"exodus-rsync", "--exodus-publish", "3e0a4539-be4a-437e-a45f-6d72f7192f17",
+		"--exodus-publish-action", "explode"}, "", nil)
+
+	err := config.ValidateConfig()
+	expected := "Key: 'Config.ExodusConfig.PublishAction' Error:Field validation for 'PublishAction' failed on the 'oneof' tag"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("didn't get expected error, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+// Exit code when a task doesn't complete within gwtasktimeout, distinct from
+// a task which failed since it may yet complete. This matches rsync's exit
+// code for a timeout.
+const taskTimeoutExitCode = 30
+
+// taskExitCode returns the exit code for a publish task which didn't complete
+// successfully.
+func taskExitCode(err error) int {
+	timeoutErr := &gw.TaskTimeoutError{}
+	if errors.As(err, &timeoutErr) {
+		return taskTimeoutExitCode
+	}
+	return 71
+}
+
+// Await mode, waiting for a task started by an earlier run with
+// --exodus-no-wait to complete.
+func awaitMain(ctx context.Context, cfg conf.Config, args args.Config) int {
+	logger := log.FromContext(ctx)
+
+	gwClient, err := ext.gw.NewClient(ctx, cfg)
+	if err != nil {
+		logger.F("error", err).Error("can't initialize exodus-gw client")
+		return 101
+	}
+
+	task, err := gwClient.GetTask(ctx, args.AwaitTask)
+	if err != nil {
+		logger.F("error", err).Error("can't get task")
+		return 71
+	}
+
+	logger.F("task", task.ID()).Info("Awaiting task")
+
+	if err = task.Await(ctx); err != nil {
+		logger.F("error", err, "task", task.ID()).Error("can't await task")
+		return taskExitCode(err)
+	}
+
+	logger.Info("Completed successfully!")
+
+	return 0
+}
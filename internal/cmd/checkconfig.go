@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+// checkedSetting is the resolved value of a config key, for
+// --exodus-check-config.
+type checkedSetting struct {
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value"`
+	Inherited bool        `json:"inherited,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// checkedConfig holds the resolved values of the global config, or of one
+// environment, for --exodus-check-config.
+type checkedConfig struct {
+	// Prefix and source are only set for environments.
+	Prefix string `json:"prefix,omitempty"`
+	Source string `json:"source,omitempty"`
+
+	Settings []checkedSetting `json:"settings"`
+}
+
+// writeCheckedConfigs writes configs to stdout, either as a block per config
+// or as JSON.
+func writeCheckedConfigs(configs []checkedConfig, format string) error {
+	if format == "json" {
+		return json.NewEncoder(ext.stdout).Encode(configs)
+	}
+
+	for _, cfg := range configs {
+		header := "global"
+		if cfg.Prefix != "" {
+			header = fmt.Sprintf("environment '%s' from %s", cfg.Prefix, cfg.Source)
+		}
+		if _, err := fmt.Fprintln(ext.stdout, header); err != nil {
+			return err
+		}
+
+		for _, setting := range cfg.Settings {
+			line := fmt.Sprintf("  %s: %v", setting.Key, setting.Value)
+			if setting.Inherited {
+				line += " (inherited)"
+			}
+			if setting.Error != "" {
+				line += " # ERROR: " + setting.Error
+			}
+			if _, err := fmt.Fprintln(ext.stdout, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkConfig returns the resolved values of cfg, logging any problems with
+// them, along with the number of problems found.
+func checkConfig(ctx context.Context, cfg conf.Config, prefix string) ([]checkedSetting, int) {
+	logger := log.FromContext(ctx)
+
+	out := []checkedSetting{}
+	problems := 0
+	for _, setting := range cfg.Settings() {
+		checked := checkedSetting{Key: setting.Key, Value: setting.Value, Inherited: setting.Inherited}
+		if setting.Err != nil {
+			logger.F("prefix", prefix, "key", setting.Key, "error", setting.Err).Error("invalid config value")
+			checked.Error = setting.Err.Error()
+			problems++
+		}
+		out = append(out, checked)
+	}
+	return out, problems
+}
+
+// checkConfigMain checks every value in the loaded config, printing the
+// resolved values for each environment.
+//
+// Strict loading, detecting unknown keys, has already happened by the time
+// this is called.
+func checkConfigMain(ctx context.Context, cfg conf.Config, args args.Config) int {
+	logger := log.FromContext(ctx)
+
+	var global conf.GlobalConfig
+	switch c := cfg.(type) {
+	case conf.EnvironmentConfig:
+		global = c.Global()
+	case conf.GlobalConfig:
+		global = c
+	}
+
+	settings, problems := checkConfig(ctx, global, "")
+	configs := []checkedConfig{{Settings: settings}}
+
+	for _, env := range global.Environments() {
+		settings, envProblems := checkConfig(ctx, env, env.Prefix())
+		configs = append(configs, checkedConfig{Prefix: env.Prefix(), Source: env.Source(), Settings: settings})
+		problems += envProblems
+	}
+
+	if err := writeCheckedConfigs(configs, args.Output); err != nil {
+		logger.F("error", err).Error("can't write config")
+		return 11
+	}
+
+	if problems > 0 {
+		logger.F("problems", problems).Error("Config is invalid")
+		return 23
+	}
+
+	logger.F("environments", len(configs)-1).Info("Config is valid")
+	return 0
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"io"
+	"os"
 
 	"github.com/release-engineering/exodus-rsync/internal/args"
 	"github.com/release-engineering/exodus-rsync/internal/conf"
@@ -12,17 +14,19 @@ import (
 )
 
 var ext = struct {
-	conf  conf.Interface
-	rsync rsync.Interface
-	gw    gw.Interface
-	log   log.Interface
-	diag  diag.Interface
+	conf   conf.Interface
+	rsync  rsync.Interface
+	gw     gw.Interface
+	log    log.Interface
+	diag   diag.Interface
+	stdout io.Writer
 }{
 	conf.Package,
 	rsync.Package,
 	gw.Package,
 	log.Package,
 	diag.Package,
+	os.Stdout,
 }
 
 // This version should be written at build time, see Makefile.
@@ -37,8 +41,19 @@ func invalidMain(ctx context.Context, cfg conf.Config, _ args.Config) int {
 	return 95
 }
 
+func noReportMain(ctx context.Context, _ conf.Config, args args.Config) int {
+	logger := log.FromContext(ctx)
+
+	flag := "--exodus-plan"
+	if args.ContentTypeReport {
+		flag = "--exodus-content-type-report"
+	}
+	logger.F("dest", args.Dest).Errorf("%s requires DEST to be published via exodus", flag)
+	return 23
+}
+
 // Main is the top-level entry point to the exodus-rsync command.
-func Main(rawArgs []string) int {
+func Main(rawArgs []string) (exitCode int) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -63,11 +78,25 @@ func Main(rawArgs []string) int {
 		return 23
 	}
 
+	if err := parsedArgs.ReadFilterFiles(os.Stdin); err != nil {
+		logger.WithField("error", err).Error("can't read filter patterns")
+		return 23
+	}
+
 	ctx = log.NewContext(ctx, logger)
 
+	interrupted := handleSignals(ctx, cancel)
+	defer func() {
+		// Whatever failure occurred is most likely due to the interruption,
+		// so report that instead.
+		if interrupted() && exitCode != 0 {
+			exitCode = interruptedExitCode
+		}
+	}()
+
 	cfg, err := ext.conf.Load(ctx, parsedArgs)
 	if err != nil {
-		if _, ok := err.(*conf.MissingConfigFile); ok {
+		if _, ok := err.(*conf.MissingConfigFile); ok && parsedArgs.Syncing() {
 			// Failed to find any config files, fallback to rsync
 			logger.WithField("error", err).Debug("setting rsyncmode to 'rsync'")
 			return rsyncMain(ctx, nil, parsedArgs)
@@ -76,10 +105,32 @@ func Main(rawArgs []string) int {
 		return 23
 	}
 
-	var env conf.Config = cfg.EnvironmentForDest(ctx, parsedArgs.Dest)
+	matched, err := cfg.MatchEnvironment(ctx, parsedArgs.Dest)
+	if err != nil {
+		logger.F("dest", parsedArgs.Dest, "error", err).Error("can't select environment")
+		return 23
+	}
+
+	var env conf.Config = matched
 	var main mainFunc = invalidMain
 
-	if env == nil || env.RsyncMode() == "rsync" {
+	// Checking the config doesn't depend on the rsyncmode, and managing
+	// publishes and tasks only involves exodus-gw, whatever the rsyncmode.
+	if parsedArgs.CheckConfig {
+		main = checkConfigMain
+	} else if parsedArgs.AwaitTask != "" {
+		main = awaitMain
+	} else if parsedArgs.PublishAction != "" {
+		main = manageMain
+	} else if parsedArgs.NewPublish {
+		main = newPublishMain
+	} else if parsedArgs.Reporting() && env != nil && env.RsyncMode() != "rsync" {
+		// Only content published via exodus can be reported on, even in
+		// mixed mode.
+		main = exodusMain
+	} else if parsedArgs.Reporting() {
+		main = noReportMain
+	} else if env == nil || env.RsyncMode() == "rsync" {
 		main = rsyncMain
 	} else if env.RsyncMode() == "exodus" {
 		main = exodusMain
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+)
+
+func TestMainSyncNoWait(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	out := captureStdout(t)
+	logs := CaptureLogger(t)
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+
+	got := Main([]string{"rsync", "--exodus-no-wait", "--exodus-manifest-out", manifestPath,
+		srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// It should print the ID of the commit task, and not wait for it.
+	taskID := strings.TrimSpace(out.String())
+	if taskID != "00000000-0000-4000-8000-000000000002" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	if entry := FindEntry(logs, "Commit started, not waiting for it to complete"); entry == nil ||
+		entry.Fields["task"] != taskID {
+		t.Errorf("missing expected log entry: %v", entry)
+	}
+
+	publishes := srv.Publishes()
+	if len(publishes) != 1 || publishes[0].State != "COMMITTING" {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+	if published := srv.Published("best-env"); len(published) != 0 {
+		t.Errorf("content was published: %v", published)
+	}
+
+	// The manifest should record the task, but the publish isn't committed yet.
+	m := readManifest(t, manifestPath)
+	if m.Committed || m.TaskID != taskID || m.TaskState != "" {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+
+	// Awaiting the task should then complete the commit.
+	got = Main([]string{"rsync", "--exodus-await-task", taskID, "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("await returned %d", got)
+	}
+
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, justFilesPublished) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+	if publishes := srv.Publishes(); len(publishes) != 1 || publishes[0].State != "COMMITTED" {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+}
+
+func TestMainAwaitTaskFailed(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	out := captureStdout(t)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "--exodus-no-wait", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	srv.SetTaskState("FAILED")
+
+	// With no DEST, the task is awaited using the global config.
+	got = Main([]string{"rsync", "--exodus-await-task", strings.TrimSpace(out.String())})
+	if got != 71 {
+		t.Errorf("await returned %d", got)
+	}
+
+	if FindEntry(logs, "can't await task") == nil {
+		t.Error("missing expected log entry")
+	}
+	if publishes := srv.Publishes(); len(publishes) != 1 || publishes[0].State != "FAILED" {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+}
+
+func TestMainAwaitTaskTimeout(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+"gwtasktimeout: 1\n"+CONFIG)
+	out := captureStdout(t)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "--exodus-no-wait", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	srv.SetTaskState("IN_PROGRESS")
+
+	// A task still in progress exits differently from one which failed.
+	got = Main([]string{"rsync", "--exodus-await-task", strings.TrimSpace(out.String())})
+	if got != taskTimeoutExitCode {
+		t.Errorf("await returned %d", got)
+	}
+
+	if FindEntry(logs, "can't await task") == nil {
+		t.Error("missing expected log entry")
+	}
+}
+
+func TestMainAwaitTaskNotFound(t *testing.T) {
+	setupGw(t)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "--exodus-await-task", "3e0a4539-be4a-437e-a45f-6d72f7192f17", "exodus:/dest"})
+	if got != 71 {
+		t.Errorf("await returned %d", got)
+	}
+
+	if FindEntry(logs, "can't get task") == nil {
+		t.Error("missing expected log entry")
+	}
+}
+
+func TestMainNoWaitCommitFails(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	out := captureStdout(t)
+	logs := CaptureLogger(t)
+
+	srv.InjectFault(gwtest.Fault{Method: http.MethodPost, Path: "/best-env/publish/", Status: 400})
+
+	got := Main([]string{"rsync", "--exodus-no-wait", srcPath + "/", "exodus:/dest"})
+	if got != 71 {
+		t.Errorf("sync returned %d", got)
+	}
+
+	if FindEntry(logs, "can't commit publish") == nil {
+		t.Error("missing expected log entry")
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
@@ -22,6 +22,15 @@ environments:
   gwenv: test
 - prefix: exodus
   gwenv: test2
+`},
+		{"overlapping environments",
+			`
+environments:
+- prefix: exodus
+  gwenv: test
+- prefix: exo*
+  match: glob
+  gwenv: test2
 `},
 		{"invalid prefix stripped",
 			`
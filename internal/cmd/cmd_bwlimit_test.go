@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMainSyncBwLimit(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	got := Main([]string{"rsync", "--bwlimit=1m", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, justFilesPublished) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainBadBwLimitConfig(t *testing.T) {
+	SetConfig(t, "uploadbwlimit: fast\n"+CONFIG)
+	MockController(t)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", ".", "exodus:/dest"})
+	if got != 23 {
+		t.Errorf("sync returned %d", got)
+	}
+
+	if FindEntry(logs, "can't load config") == nil {
+		t.Error("missing expected log entry")
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMainCheckConfig(t *testing.T) {
+	srv, _ := setupGw(t)
+	SetConfig(t, srv.Config()+CONFIG)
+	out := captureStdout(t)
+	logs := CaptureLogger(t)
+
+	if got := Main([]string{"rsync", "--exodus-check-config"}); got != 0 {
+		t.Fatalf("check returned %d\n%s", got, out.String())
+	}
+
+	expected := []string{
+		"global",
+		"environment 'exodus' from exodus-rsync.conf",
+		"environment 'exodus-mixed' from exodus-rsync.conf",
+		"environment 'somehost:/cdn/root' from exodus-rsync.conf",
+		"environment 'otherhost:/foo/bar/baz' from exodus-rsync.conf",
+	}
+	if headers := outputLines(out, "^[a-z]"); !reflect.DeepEqual(headers, expected) {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+
+	// Each environment shows resolved values, and where they came from.
+	for _, line := range []string{
+		"  gwurl: " + srv.URL + " (inherited)",
+		"  rsyncmode: mixed",
+		"  strip: otherhost:/foo",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing line %q in output:\n%s", line, out.String())
+		}
+	}
+
+	entry := FindEntry(logs, "Config is valid")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	if entry.Fields["environments"] != 4 {
+		t.Errorf("unexpected environments: %v", entry.Fields["environments"])
+	}
+}
+
+func TestMainCheckConfigJSON(t *testing.T) {
+	srv, _ := setupGw(t)
+	SetConfig(t, srv.Config()+CONFIG)
+	out := captureStdout(t)
+
+	if got := Main([]string{"rsync", "--exodus-check-config", "--exodus-output", "json"}); got != 0 {
+		t.Fatalf("check returned %d\n%s", got, out.String())
+	}
+
+	var configs []checkedConfig
+	if err := json.Unmarshal(out.Bytes(), &configs); err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 5 || configs[0].Prefix != "" || configs[1].Prefix != "exodus" {
+		t.Fatalf("unexpected output: %v", configs)
+	}
+	if configs[1].Source != "exodus-rsync.conf" {
+		t.Errorf("unexpected source: %s", configs[1].Source)
+	}
+	for _, setting := range configs[1].Settings {
+		if setting.Key == "gwenv" && (setting.Value != "best-env" || setting.Inherited) {
+			t.Errorf("unexpected gwenv: %v", setting)
+		}
+		if setting.Key == "gwurl" && (setting.Value != srv.URL || !setting.Inherited) {
+			t.Errorf("unexpected gwurl: %v", setting)
+		}
+	}
+}
+
+func TestMainCheckConfigInvalid(t *testing.T) {
+	srv, _ := setupGw(t)
+	SetConfig(t, srv.Config()+`
+environments:
+- prefix: exodus
+  gwenv: best-env
+  rsyncmode: invalid
+  gwbatchsize: -5
+`)
+	out := captureStdout(t)
+	logs := CaptureLogger(t)
+
+	// Unlike when syncing, an invalid rsyncmode is found without a DEST.
+	if got := Main([]string{"rsync", "--exodus-check-config"}); got != 23 {
+		t.Errorf("check returned %d", got)
+	}
+
+	for _, line := range []string{
+		"  rsyncmode: invalid # ERROR: invalid 'rsyncmode': 'invalid', must be one of: exodus, rsync, mixed",
+		"  gwbatchsize: -5 # ERROR: invalid 'gwbatchsize': -5, must be at least 1",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("missing line %q in output:\n%s", line, out.String())
+		}
+	}
+
+	var keys []string
+	for _, entry := range logs.Entries {
+		if entry.Message == "invalid config value" {
+			keys = append(keys, entry.Fields["key"].(string))
+		}
+	}
+	if !reflect.DeepEqual(keys, []string{"gwbatchsize", "rsyncmode"}) {
+		t.Errorf("unexpected invalid keys: %v", keys)
+	}
+
+	entry := FindEntry(logs, "Config is invalid")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	if entry.Fields["problems"] != 2 {
+		t.Errorf("unexpected problems: %v", entry.Fields["problems"])
+	}
+}
+
+func TestMainCheckConfigUnknownKey(t *testing.T) {
+	SetConfig(t, "gwbatchsiz: 100\nenvironments:\n- prefix: exodus\n")
+	logs := CaptureLogger(t)
+
+	if got := Main([]string{"rsync", "--exodus-check-config"}); got != 23 {
+		t.Errorf("check returned %d", got)
+	}
+
+	entry := FindEntry(logs, "can't load config")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	if err := entry.Fields["error"].(error); !strings.Contains(err.Error(), "field gwbatchsiz not found") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMainCheckConfigMissing(t *testing.T) {
+	SetConfig(t, "")
+	logs := CaptureLogger(t)
+
+	// A missing config file doesn't fall back to rsync when checking it.
+	if got := Main([]string{"rsync", "--exodus-check-config", "--exodus-conf", "/not/exist.conf"}); got != 23 {
+		t.Errorf("check returned %d", got)
+	}
+	if FindEntry(logs, "can't load config") == nil {
+		t.Fatal("missing expected log entry")
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+)
+
+const CONTENT_TYPES_CONFIG string = `
+contenttypes:
+- pattern: subdir/*
+  type: application/x-custom
+- pattern: /dest/hello-copy-two
+  type: text/x-two; charset=utf-8
+`
+
+func TestMainContentTypes(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, CONTENT_TYPES_CONFIG+srv.Config()+CONFIG)
+
+	if got := Main([]string{"rsync", srcPath + "/", "exodus:/dest"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	types := make(map[string]string)
+	for _, item := range srv.Published("best-env") {
+		types[item.WebURI] = item.ContentType
+	}
+
+	// Content type is set by rules where they match, otherwise detected.
+	expected := map[string]string{
+		"/dest/hello-copy-one":     "text/plain; charset=utf-8",
+		"/dest/hello-copy-two":     "text/x-two; charset=utf-8",
+		"/dest/subdir/some-binary": "application/x-custom",
+	}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("unexpected content types: %v", types)
+	}
+}
+
+func TestMainContentTypeReport(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, CONTENT_TYPES_CONFIG+srv.Config()+CONFIG)
+	out := captureStdout(t)
+
+	got := Main([]string{"rsync", "--exodus-content-type-report", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("report returned %d", got)
+	}
+
+	expected := "/dest/hello-copy-one\ttext/plain; charset=utf-8\tdetected\n" +
+		"/dest/hello-copy-two\ttext/x-two; charset=utf-8\trule /dest/hello-copy-two\n" +
+		"/dest/subdir/some-binary\tapplication/x-custom\trule subdir/*\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	// Nothing should have been published.
+	if publishes := srv.Publishes(); len(publishes) != 0 {
+		t.Errorf("publish created by report: %v", publishes)
+	}
+}
+
+func TestMainContentTypeReportJSON(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, CONTENT_TYPES_CONFIG+srv.Config()+CONFIG)
+	out := captureStdout(t)
+
+	writeInputManifest(t,
+		manifest.Entry{WebURI: "/content/hello", SrcPath: "hello-copy-one"},
+		manifest.Entry{WebURI: "/content/subdir/binary", SrcPath: "subdir/some-binary"},
+		manifest.Entry{WebURI: "/content/other", SrcPath: "hello-copy-two", ContentType: "text/x-manifest"},
+		manifest.Entry{WebURI: "/content/latest", LinkTo: "/content/hello"},
+	)
+
+	got := Main([]string{"rsync", "--exodus-content-type-report", "--exodus-output", "json",
+		"--exodus-from-manifest", "input.json", srcPath, "exodus:/"})
+	if got != 0 {
+		t.Fatalf("report returned %d", got)
+	}
+
+	var entries []contentTypeEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("can't decode output %q: %v", out.String(), err)
+	}
+
+	// Links are omitted, and a content type from the manifest wins over
+	// rules.
+	expected := []contentTypeEntry{
+		{"/content/hello", "text/plain; charset=utf-8", "detected", ""},
+		{"/content/other", "text/x-manifest", "manifest", ""},
+		{"/content/subdir/binary", "application/x-custom", "rule", "subdir/*"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+}
+
+func TestMainContentTypeReportRsyncMode(t *testing.T) {
+	SetConfig(t, CONFIG)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "--exodus-content-type-report", ".", "somehost:/dest"})
+	if got != 23 {
+		t.Errorf("report returned %d", got)
+	}
+	if FindEntry(logs, "--exodus-content-type-report requires DEST to be published via exodus") == nil {
+		t.Error("missing expected log entry")
+	}
+}
+
+func TestMainContentTypesInvalid(t *testing.T) {
+	SetConfig(t, "contenttypes:\n- pattern: '*.repo'\n  type: 'not a type'\n"+CONFIG)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", ".", "exodus:/dest"})
+	if got != 23 {
+		t.Errorf("returned %d", got)
+	}
+	if FindEntry(logs, "can't load config") == nil {
+		t.Error("missing expected log entry")
+	}
+}
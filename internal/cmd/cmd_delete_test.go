@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+	"go.uber.org/mock/gomock"
+)
+
+// Items already published before each test.
+func publishedForDelete() []gw.ItemInput {
+	return []gw.ItemInput{
+		// Still present in source, should be kept.
+		{WebURI: "/some/target/hello-copy-one", ObjectKey: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+		// Missing from source, should be deleted.
+		{WebURI: "/some/target/old-file", ObjectKey: "abc123"},
+		{WebURI: "/some/target/subdir/old-link", LinkTo: "/some/target/old-file"},
+		// Missing from source but protected by --exclude.
+		{WebURI: "/some/target/keep.log", ObjectKey: "abc123"},
+		{WebURI: "/some/target/cache/data", ObjectKey: "abc123"},
+		// Outside of the destination tree.
+		{WebURI: "/some/target-other/file", ObjectKey: "abc123"},
+		{WebURI: "/some/other/file", ObjectKey: "abc123"},
+	}
+}
+
+func deletedURIs(items []gw.ItemInput) []string {
+	out := []string{}
+	for _, item := range items {
+		if item.ObjectKey == gw.AbsentObjectKey {
+			out = append(out, item.WebURI)
+		}
+	}
+	return out
+}
+
+func TestMainSyncDelete(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, CONFIG)
+	ctrl := MockController(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := FakeClient{blobs: make(map[string]string), published: publishedForDelete()}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	got := Main([]string{
+		"rsync",
+		"--delete",
+		"--exclude", "*.log",
+		"--exclude", "cache/",
+		srcPath + "/",
+		"exodus:/some/target",
+	})
+
+	if got != 0 {
+		t.Fatal("returned incorrect exit code", got)
+	}
+
+	p := client.publishes[0]
+
+	// It should have deleted exactly the stale, non-excluded items.
+	expected := []string{"/some/target/old-file", "/some/target/subdir/old-link"}
+	if deleted := deletedURIs(p.items); !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("unexpected deletions: %v", deleted)
+	}
+
+	// Deletions should be added before commit.
+	if p.committed != 1 {
+		t.Errorf("expected 1 commit, got %d", p.committed)
+	}
+}
+
+func TestMainSyncDeleteNoTrailingSlash(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, CONFIG)
+	ctrl := MockController(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := FakeClient{blobs: make(map[string]string), published: []gw.ItemInput{
+		{WebURI: "/some/target/just-files/old-file", ObjectKey: "abc123"},
+		{WebURI: "/some/target/sibling", ObjectKey: "abc123"},
+	}}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	got := Main([]string{"rsync", "--delete", srcPath, "exodus:/some/target"})
+
+	if got != 0 {
+		t.Fatal("returned incorrect exit code", got)
+	}
+
+	// Without a trailing slash, the source directory itself is synced,
+	// so only content beneath it is eligible for deletion.
+	expected := []string{"/some/target/just-files/old-file"}
+	if deleted := deletedURIs(client.publishes[0].items); !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("unexpected deletions: %v", deleted)
+	}
+}
+
+func TestMainSyncDeleteDryRun(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, CONFIG)
+	ctrl := MockController(t)
+	logs := CaptureLogger(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := FakeClient{blobs: make(map[string]string), published: publishedForDelete()}
+	mockGw.EXPECT().NewDryRunClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	got := Main([]string{"rsync", "--dry-run", "--delete", srcPath + "/", "exodus:/some/target"})
+
+	if got != 0 {
+		t.Fatal("returned incorrect exit code", got)
+	}
+
+	// It should have logged each path which would be deleted.
+	var logged []string
+	for _, entry := range logs.Entries {
+		if entry.Message == "Would delete" {
+			logged = append(logged, fmt.Sprint(entry.Fields["uri"]))
+		}
+	}
+
+	expected := []string{
+		"/some/target/old-file",
+		"/some/target/subdir/old-link",
+		"/some/target/keep.log",
+		"/some/target/cache/data",
+	}
+	if !reflect.DeepEqual(logged, expected) {
+		t.Errorf("unexpected logged deletions: %v", logged)
+	}
+}
+
+func TestMainSyncDeleteErrors(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	t.Run("list fails", func(t *testing.T) {
+		SetConfig(t, CONFIG)
+		ctrl := MockController(t)
+		logs := CaptureLogger(t)
+
+		mockGw := gw.NewMockInterface(ctrl)
+		ext.gw = mockGw
+
+		client := gw.NewMockClient(ctrl)
+		mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client, nil)
+
+		// Listing is checked before creating a publish, so nothing else
+		// should be called.
+		client.EXPECT().ListPublished(gomock.Any(), "/some/target/", gomock.Any()).
+			Return(fmt.Errorf("simulated error"))
+
+		got := Main([]string{"rsync", "--delete", srcPath + "/", "exodus:/some/target"})
+
+		if got != 51 {
+			t.Error("returned incorrect exit code", got)
+		}
+		entry := FindEntry(logs, "can't determine content to delete")
+		if entry == nil || fmt.Sprint(entry.Fields["error"]) != "simulated error" {
+			t.Errorf("missing expected log entry: %v", entry)
+		}
+	})
+
+	t.Run("list unsupported", func(t *testing.T) {
+		SetConfig(t, CONFIG)
+		ctrl := MockController(t)
+		logs := CaptureLogger(t)
+
+		mockGw := gw.NewMockInterface(ctrl)
+		ext.gw = mockGw
+
+		client := gw.NewMockClient(ctrl)
+		mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client, nil)
+
+		client.EXPECT().ListPublished(gomock.Any(), "/some/target/", gomock.Any()).
+			Return(fmt.Errorf("%w: simulated 404", gw.ErrListUnsupported))
+
+		got := Main([]string{"rsync", "--delete", srcPath + "/", "exodus:/some/target"})
+
+		if got != 51 {
+			t.Error("returned incorrect exit code", got)
+		}
+		if FindEntry(logs, "--delete is not supported by this exodus-gw") == nil {
+			t.Error("missing expected log entry")
+		}
+	})
+
+	t.Run("list fails after check", func(t *testing.T) {
+		SetConfig(t, CONFIG)
+		ctrl := MockController(t)
+		logs := CaptureLogger(t)
+
+		mockGw := gw.NewMockInterface(ctrl)
+		ext.gw = mockGw
+
+		client := gw.NewMockClient(ctrl)
+		publish := gw.NewMockPublish(ctrl)
+		mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client, nil)
+
+		client.EXPECT().NewPublish(gomock.Any()).Return(publish, nil)
+		publish.EXPECT().ID().Return("some-publish").AnyTimes()
+		client.EXPECT().EnsureUploadedStream(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_, items, _, _, _ interface{}) error {
+				drain(items.(<-chan walk.SyncItem))
+				return nil
+			})
+		publish.EXPECT().AddItems(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+		gomock.InOrder(
+			client.EXPECT().ListPublished(gomock.Any(), "/some/target/", gomock.Any()).Return(nil),
+			client.EXPECT().ListPublished(gomock.Any(), "/some/target/", gomock.Any()).
+				Return(fmt.Errorf("simulated error")),
+		)
+
+		got := Main([]string{"rsync", "--delete", srcPath + "/", "exodus:/some/target"})
+
+		if got != 51 {
+			t.Error("returned incorrect exit code", got)
+		}
+		entry := FindEntry(logs, "can't determine content to delete")
+		if entry == nil || fmt.Sprint(entry.Fields["error"]) != "simulated error" {
+			t.Errorf("missing expected log entry: %v", entry)
+		}
+	})
+
+	t.Run("files-from", func(t *testing.T) {
+		SetConfig(t, CONFIG)
+		MockController(t)
+		logs := CaptureLogger(t)
+
+		got := Main([]string{"rsync", "--delete", "--files-from", "sources.txt", srcPath + "/", "exodus:/some/target"})
+
+		if got != 23 {
+			t.Error("returned incorrect exit code", got)
+		}
+		if FindEntry(logs, "--delete is not supported with --files-from") == nil {
+			t.Error("missing expected log entry")
+		}
+	})
+}
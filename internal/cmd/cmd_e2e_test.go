@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+)
+
+// Tests in this file run against a fake exodus-gw server using the real
+// exodus-gw client, rather than a mock.
+
+// Items published by syncing the just-files tree to exodus:/dest.
+var justFilesPublished = map[string]string{
+	"/dest/hello-copy-one":     helloKey,
+	"/dest/hello-copy-two":     helloKey,
+	"/dest/subdir/some-binary": binaryKey,
+}
+
+// Sets up a fake exodus-gw server, and config pointing at it, for the
+// duration of the current test. Returns the server and the path of the
+// just-files source tree.
+func setupGw(t *testing.T) (*gwtest.Server, string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restores ext at the end of the test, though the real
+	// implementations are used.
+	MockController(t)
+
+	srv := gwtest.NewServer(t)
+	SetConfig(t, srv.Config()+CONFIG)
+
+	return srv, path.Clean(wd + "/../../test/data/srctrees/just-files")
+}
+
+// Returns a URI => key mapping of everything currently published.
+func publishedKeys(srv *gwtest.Server) map[string]string {
+	out := make(map[string]string)
+	for _, item := range srv.Published("best-env") {
+		out[item.WebURI] = item.ObjectKey
+	}
+	return out
+}
+
+func TestEndToEndSync(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	got := Main([]string{"rsync", "-vvv", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, justFilesPublished) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+
+	// Blobs should have been uploaded with the content of the files.
+	for uri, key := range justFilesPublished {
+		want, err := os.ReadFile(srcPath + uri[len("/dest"):])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blob, _ := srv.Blob("best-env", key); string(blob) != string(want) {
+			t.Errorf("blob for %s has wrong content", uri)
+		}
+	}
+	if keys := srv.BlobKeys("best-env"); len(keys) != 2 {
+		t.Errorf("unexpected blobs: %v", keys)
+	}
+
+	publishes := srv.Publishes()
+	if len(publishes) != 1 || publishes[0].State != "COMMITTED" {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+
+	// Syncing again should upload nothing, but publish everything again.
+	puts := 0
+	countPuts := func() {
+		for _, req := range srv.Requests() {
+			if req.Method == http.MethodPut && path.Dir(req.Path) == "/upload/best-env" {
+				puts++
+			}
+		}
+	}
+	countPuts()
+	before := puts
+
+	if got := Main([]string{"rsync", srcPath + "/", "exodus:/dest"}); got != 0 {
+		t.Fatalf("second sync returned %d", got)
+	}
+
+	puts = 0
+	countPuts()
+	if puts != before {
+		t.Errorf("second sync uploaded %d blobs", puts-before)
+	}
+	if publishes := srv.Publishes(); len(publishes) != 2 || len(publishes[1].Items) != 3 {
+		t.Errorf("unexpected publishes after second sync: %v", publishes)
+	}
+}
+
+func TestEndToEndRetry(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	srv.InjectFault(gwtest.Fault{Method: http.MethodPost, Path: "/best-env/publish", Status: 502, Count: 1})
+	srv.InjectFault(gwtest.Fault{Method: http.MethodPut, Path: "/upload/best-env/", Status: 503, Count: 2})
+	srv.InjectFault(gwtest.Fault{Method: http.MethodGet, Path: "/task/", Status: 504, Count: 1})
+
+	got := Main([]string{"rsync", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, justFilesPublished) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+	if publishes := srv.Publishes(); len(publishes) != 1 {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+}
+
+func TestEndToEndTaskFailed(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	logs := CaptureLogger(t)
+
+	srv.SetTaskState("FAILED")
+
+	got := Main([]string{"rsync", srcPath + "/", "exodus:/dest"})
+	if got != 71 {
+		t.Errorf("sync returned %d", got)
+	}
+
+	if FindEntry(logs, "can't commit publish") == nil {
+		t.Error("missing expected log entry")
+	}
+	if published := srv.Published("best-env"); len(published) != 0 {
+		t.Errorf("content was published: %v", published)
+	}
+	if publishes := srv.Publishes(); len(publishes) != 1 || publishes[0].State != "FAILED" {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+}
+
+func TestEndToEndHeadNotFound(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	// The blob is already stored, but exodus-gw claims otherwise, both
+	// by lacking the bulk presence API and on HEAD.
+	hello, err := os.ReadFile(srcPath + "/hello-copy-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.AddBlob("best-env", hello)
+	srv.InjectFault(gwtest.Fault{Path: "/best-env/blobs/present", Status: 404})
+	srv.InjectFault(gwtest.Fault{Method: http.MethodHead, Path: "/upload/best-env/" + helloKey, Status: 404})
+
+	got := Main([]string{"rsync", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// It should have uploaded the blob again.
+	uploaded := false
+	for _, req := range srv.Requests() {
+		if req.Method == http.MethodPut && req.Path == "/upload/best-env/"+helloKey {
+			uploaded = true
+		}
+	}
+	if !uploaded {
+		t.Error("blob reported missing was not uploaded")
+	}
+
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, justFilesPublished) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestEndToEndDelete(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	stale := srv.AddBlob("best-env", []byte("stale content"))
+	srv.AddPublished("best-env",
+		gwtest.Item{WebURI: "/dest/stale", ObjectKey: stale},
+		gwtest.Item{WebURI: "/dest/subdir/stale-link", LinkTo: "/dest/stale"},
+		gwtest.Item{WebURI: "/other/kept", ObjectKey: stale},
+	)
+
+	got := Main([]string{"rsync", "--delete", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	want := map[string]string{"/other/kept": stale}
+	for uri, key := range justFilesPublished {
+		want[uri] = key
+	}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, want) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestEndToEndMixed(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	logs := CaptureLogger(t)
+
+	ext.rsync = &fakeRsync{
+		delegate: ext.rsync,
+		prefix:   []string{"/bin/sh", "-c", "echo FAKE RSYNC", "--"},
+	}
+
+	got := Main([]string{"rsync", srcPath + "/", "exodus-mixed:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, justFilesPublished) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+
+	rsyncRan := false
+	for _, entry := range logs.Entries {
+		if _, ok := entry.Fields["rsync"]; ok && entry.Message == "FAKE RSYNC" {
+			rsyncRan = true
+		}
+	}
+	if !rsyncRan {
+		t.Error("rsync did not run")
+	}
+}
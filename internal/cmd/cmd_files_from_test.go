@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMainSyncFilesFromVariants(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   []string
+		content string
+		want    map[string]string
+	}{
+		{"from0",
+			[]string{"--from0"},
+			"hello-copy-one\x00subdir/some-binary\x00",
+			map[string]string{
+				"/dest/hello-copy-one":     helloKey,
+				"/dest/subdir/some-binary": binaryKey,
+			}},
+
+		// As in rsync, -a doesn't imply -r with --files-from.
+		{"directory",
+			[]string{"-a"},
+			"subdir\nhello-copy-two\n",
+			map[string]string{"/dest/hello-copy-two": helloKey}},
+
+		{"directory recursive",
+			[]string{"-r"},
+			"subdir\n",
+			map[string]string{"/dest/subdir/some-binary": binaryKey}},
+
+		{"empty",
+			nil,
+			"",
+			map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, srcPath := setupGw(t)
+
+			filesFrom := t.TempDir() + "/files"
+			if err := os.WriteFile(filesFrom, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			argv := append([]string{"rsync", "--files-from", filesFrom}, tt.flags...)
+			argv = append(argv, srcPath, "exodus:/dest")
+
+			if got := Main(argv); got != 0 {
+				t.Fatalf("sync returned %d", got)
+			}
+
+			if published := publishedKeys(srv); !reflect.DeepEqual(published, tt.want) {
+				t.Errorf("unexpected published content: %v", published)
+			}
+		})
+	}
+}
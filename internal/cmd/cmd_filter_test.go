@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+)
+
+func TestMainSyncFilterOrder(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	// The first matching rule wins, regardless of whether it came from
+	// --include or --exclude.
+	got := Main([]string{
+		"rsync",
+		"--include", "/hello-copy-one",
+		"--exclude", "hello-copy-*",
+		"--exclude", "/subdir/***",
+		"--include", "some-binary",
+		srcPath + "/",
+		"exodus:/dest",
+	})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	want := map[string]string{"/dest/hello-copy-one": helloKey}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, want) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainSyncFilterMergeFiles(t *testing.T) {
+	srv, _ := setupGw(t)
+
+	srcPath := t.TempDir()
+	files := map[string]string{
+		".rsync-filter":         "- *.tmp\n",
+		"keep.txt":              "keep",
+		"drop.tmp":              "drop",
+		"sub/.rsync-filter":     "+ keep.tmp\n- /local\n",
+		"sub/keep.tmp":          "keep",
+		"sub/drop.tmp":          "drop",
+		"sub/local":             "drop",
+		"sub/deeper/local":      "keep",
+		"sub/deeper/other.tmp":  "drop",
+		"other/.rsync-filter":   "!\n",
+		"other/kept.tmp":        "keep",
+		"rules/excludes":        "*.txt\n",
+		"rules/unused/keep.txt": "keep",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := Main([]string{
+		"rsync", "-FF",
+		"--filter", "merge,- " + srcPath + "/rules/excludes",
+		"--include", "/rules/***",
+		srcPath + "/",
+		"exodus:/dest",
+	})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	var published []string
+	for _, item := range srv.Published("best-env") {
+		published = append(published, item.WebURI)
+	}
+
+	// -F reads rules from .rsync-filter in each directory, and -FF
+	// excludes those files from the transfer.
+	want := []string{
+		"/dest/other/kept.tmp",
+		"/dest/rules/excludes",
+		"/dest/sub/deeper/local",
+		"/dest/sub/keep.tmp",
+	}
+	if !reflect.DeepEqual(published, want) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainSyncFilterMergeError(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	got := Main([]string{
+		"rsync",
+		"--filter", ". " + srcPath + "/no-such-rules",
+		srcPath + "/",
+		"exodus:/dest",
+	})
+	if got != 73 {
+		t.Errorf("sync returned %d", got)
+	}
+
+	if published := srv.Published("best-env"); len(published) != 0 {
+		t.Errorf("content was published: %v", published)
+	}
+}
+
+func TestMainDeleteFilter(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	stale := srv.AddBlob("best-env", []byte("stale content"))
+	srv.AddPublished("best-env",
+		gwtest.Item{WebURI: "/dest/stale.log", ObjectKey: stale},
+		gwtest.Item{WebURI: "/dest/keep.log", ObjectKey: stale},
+		gwtest.Item{WebURI: "/dest/protected/file", ObjectKey: stale},
+		gwtest.Item{WebURI: "/dest/hidden", ObjectKey: stale},
+	)
+
+	// "P" protects from deletion, "H" only affects the sender, and the
+	// first matching rule wins.
+	got := Main([]string{
+		"rsync", "--delete",
+		"--filter", "P /protected/",
+		"--filter", "H hidden",
+		"--include", "stale.log",
+		"--exclude", "*.log",
+		srcPath + "/",
+		"exodus:/dest",
+	})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	want := map[string]string{
+		"/dest/keep.log":       stale,
+		"/dest/protected/file": stale,
+	}
+	for uri, key := range justFilesPublished {
+		want[uri] = key
+	}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, want) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+// Replaces stdin with the given content for the duration of the test.
+func setStdin(t *testing.T, content string) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	oldStdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = oldStdin
+		r.Close()
+	})
+}
+
+func TestMainSyncFilterFromFiles(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	excludes := t.TempDir() + "/excludes"
+	if err := os.WriteFile(excludes, []byte("# comment\n\nhello-copy-*\nsubdir/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setStdin(t, "; comment\nhello-copy-two\n")
+
+	got := Main([]string{
+		"rsync",
+		"--include-from", "-",
+		"--exclude-from", excludes,
+		srcPath + "/",
+		"exodus:/dest",
+	})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	want := map[string]string{"/dest/hello-copy-two": helloKey}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, want) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainSyncFilterFromMissingFile(t *testing.T) {
+	SetConfig(t, CONFIG)
+	MockController(t)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "--exclude-from", "/no/such/file", ".", "exodus:/dest"})
+	if got != 23 {
+		t.Errorf("sync returned %d", got)
+	}
+
+	if FindEntry(logs, "can't read filter patterns") == nil {
+		t.Error("missing expected log entry")
+	}
+}
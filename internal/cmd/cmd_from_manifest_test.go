@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+	"go.uber.org/mock/gomock"
+)
+
+func writeInputManifest(t *testing.T, entries ...manifest.Entry) {
+	m := manifest.Manifest{}
+	m.Add(entries...)
+	if err := m.Write("input.json"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMainFromManifest(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, CONFIG)
+	ctrl := MockController(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := FakeClient{blobs: make(map[string]string)}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	writeInputManifest(t,
+		// Relative to SRC, with key and content type calculated.
+		manifest.Entry{WebURI: "/content/hello", SrcPath: "hello-copy-one"},
+		// Absolute path, with key and content type provided.
+		manifest.Entry{
+			WebURI:      "/elsewhere/some-binary",
+			SrcPath:     srcPath + "/subdir/some-binary",
+			ObjectKey:   binaryKey,
+			ContentType: "application/x-custom",
+		},
+		manifest.Entry{WebURI: "/content/latest", LinkTo: "/content/hello"},
+	)
+
+	// Destination path is irrelevant since every item provides its own,
+	// but still selects the environment.
+	got := Main([]string{"rsync", "--exodus-from-manifest", "input.json", srcPath, "exodus:/ignored"})
+	if got != 0 {
+		t.Fatal("returned incorrect exit code", got)
+	}
+
+	if len(client.publishes) != 1 {
+		t.Fatalf("unexpected publishes: %v", client.publishes)
+	}
+
+	items := map[string]gw.ItemInput{}
+	for _, item := range client.publishes[0].items {
+		items[item.WebURI] = item
+	}
+
+	expected := map[string]gw.ItemInput{
+		"/content/hello":         {WebURI: "/content/hello", ObjectKey: helloKey, ContentType: "text/plain; charset=utf-8"},
+		"/elsewhere/some-binary": {WebURI: "/elsewhere/some-binary", ObjectKey: binaryKey, ContentType: "application/x-custom"},
+		"/content/latest":        {WebURI: "/content/latest", LinkTo: "/content/hello"},
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("unexpected published items:\n%v\nexpected:\n%v", items, expected)
+	}
+
+	// Only the files should have been uploaded.
+	if len(client.blobs) != 2 || client.blobs[helloKey] != srcPath+"/hello-copy-one" {
+		t.Errorf("unexpected uploads: %v", client.blobs)
+	}
+	if client.publishes[0].committed != 1 {
+		t.Error("publish was not committed")
+	}
+}
+
+func TestMainFromManifestErrors(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	tests := []struct {
+		name     string
+		entries  []manifest.Entry
+		args     []string
+		src      string
+		code     int
+		message  string
+		errorMsg string
+	}{
+		{"relative web_uri",
+			[]manifest.Entry{{WebURI: "content/hello", SrcPath: "hello-copy-one"}},
+			nil, srcPath, 73, "can't read files for sync",
+			`web_uri must be an absolute path: "content/hello"`},
+
+		{"missing file",
+			[]manifest.Entry{{WebURI: "/content/hello", SrcPath: "nonexistent"}},
+			nil, srcPath, 73, "can't read files for sync",
+			"stat " + srcPath + "/nonexistent: no such file or directory"},
+
+		{"directory",
+			[]manifest.Entry{{WebURI: "/content/subdir", SrcPath: "subdir"}},
+			nil, srcPath, 73, "can't read files for sync",
+			srcPath + "/subdir: is a directory"},
+
+		{"no source",
+			[]manifest.Entry{{WebURI: "/content/hello"}},
+			nil, srcPath, 73, "can't read files for sync",
+			"/content/hello: entry has neither src_path nor link_to"},
+
+		{"invalid key",
+			[]manifest.Entry{{WebURI: "/content/hello", SrcPath: "hello-copy-one", ObjectKey: "abc"}},
+			nil, srcPath, 73, "can't read files for sync",
+			`/content/hello: object_key is not a SHA256 checksum: "abc"`},
+
+		{"src not a directory",
+			nil, nil, srcPath + "/hello-copy-one", 23,
+			"SRC must be a directory when using --exodus-from-manifest", ""},
+
+		{"with delete",
+			nil, []string{"--delete"}, srcPath, 23,
+			"--exodus-from-manifest is not supported with --files-from or --delete", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetConfig(t, CONFIG)
+			ctrl := MockController(t)
+			logs := CaptureLogger(t)
+
+			mockGw := gw.NewMockInterface(ctrl)
+			ext.gw = mockGw
+
+			client := FakeClient{blobs: make(map[string]string)}
+			mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil).AnyTimes()
+
+			writeInputManifest(t, tt.entries...)
+
+			args := []string{"rsync", "--exodus-from-manifest", "input.json"}
+			args = append(args, tt.args...)
+			args = append(args, tt.src, "exodus:/ignored")
+
+			if got := Main(args); got != tt.code {
+				t.Error("returned incorrect exit code", got)
+			}
+
+			entry := FindEntry(logs, tt.message)
+			if entry == nil {
+				t.Fatal("missing expected log message")
+			}
+			if tt.errorMsg != "" && entry.Fields["error"].(error).Error() != tt.errorMsg {
+				t.Errorf("unexpected error: %v", entry.Fields["error"])
+			}
+
+			// Nothing should have been published.
+			for _, publish := range client.publishes {
+				if publish.committed != 0 {
+					t.Error("publish was committed")
+				}
+			}
+		})
+	}
+}
+
+func TestMainFromManifestUnreadable(t *testing.T) {
+	SetConfig(t, CONFIG)
+	ctrl := MockController(t)
+	logs := CaptureLogger(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := FakeClient{blobs: make(map[string]string)}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+	got := Main([]string{"rsync", "--exodus-from-manifest", "nonexistent.json", ".", "exodus:/ignored"})
+	if got != 73 {
+		t.Error("returned incorrect exit code", got)
+	}
+	if FindEntry(logs, "can't read --exodus-from-manifest file") == nil {
+		t.Error("missing expected log message")
+	}
+	if len(client.publishes) != 0 {
+		t.Error("unexpectedly created publish")
+	}
+}
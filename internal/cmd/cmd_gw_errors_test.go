@@ -11,6 +11,12 @@ import (
 
 type mockClientConfigurator func(*gomock.Controller, *gw.MockClient)
 
+// Consumes every item sent to a mocked EnsureUploadedStream.
+func drain(items <-chan walk.SyncItem) {
+	for range items {
+	}
+}
+
 func setupFailedUpload(ctrl *gomock.Controller, client *gw.MockClient) {
 	// Creating a publish succeeds
 	publish := gw.NewMockPublish(ctrl)
@@ -18,7 +24,7 @@ func setupFailedUpload(ctrl *gomock.Controller, client *gw.MockClient) {
 
 	publish.EXPECT().ID().Return("3e0a4539-be4a-437e-a45f-6d72f7192f17").AnyTimes()
 
-	client.EXPECT().EnsureUploaded(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+	client.EXPECT().EnsureUploadedStream(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
 		Return(fmt.Errorf("simulated error"))
 }
 
@@ -27,9 +33,10 @@ func setupFailedNewPublish(_ *gomock.Controller, client *gw.MockClient) {
 }
 
 func setupFailedAddItems(ctrl *gomock.Controller, client *gw.MockClient) {
-	// EnsureUploaded succeeds, and (importantly) must add some items
-	client.EXPECT().EnsureUploaded(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
-		Do(func(_ interface{}, _ interface{}, onUploaded func(walk.SyncItem) error, onPresent func(walk.SyncItem) error, onDuplicate func(walk.SyncItem) error) {
+	// EnsureUploadedStream succeeds, and (importantly) must add some items
+	client.EXPECT().EnsureUploadedStream(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(_ interface{}, items <-chan walk.SyncItem, onUploaded func(walk.SyncItem) error, onPresent func(walk.SyncItem) error, onDuplicate func(walk.SyncItem) error) {
+			drain(items)
 			// Simulate that a couple of items were uploaded.
 			onUploaded(walk.SyncItem{SrcPath: "file1", Key: "abc123"})
 			onUploaded(walk.SyncItem{SrcPath: "file2", Key: "aabbcc"})
@@ -49,9 +56,10 @@ func setupFailedAddItems(ctrl *gomock.Controller, client *gw.MockClient) {
 }
 
 func setupFailedCommit(ctrl *gomock.Controller, client *gw.MockClient) {
-	// EnsureUploaded succeeds, and (importantly) must add some items
-	client.EXPECT().EnsureUploaded(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
-		Do(func(_ interface{}, _ interface{}, onUploaded func(walk.SyncItem) error, _ interface{}, _ interface{}) {
+	// EnsureUploadedStream succeeds, and (importantly) must add some items
+	client.EXPECT().EnsureUploadedStream(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Do(func(_ interface{}, items <-chan walk.SyncItem, onUploaded func(walk.SyncItem) error, _ interface{}, _ interface{}) {
+			drain(items)
 			// Simulate that a couple of items were uploaded.
 			onUploaded(walk.SyncItem{SrcPath: "file1", Key: "abc123"})
 			onUploaded(walk.SyncItem{SrcPath: "file2", Key: "aabbcc"})
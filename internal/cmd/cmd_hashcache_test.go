@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMainSyncHashCache(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	tests := []struct {
+		name        string
+		mode        string
+		expectSaved bool
+	}{
+		{"rebuild", "--exodus-hash-cache=rebuild", true},
+		{"bypass", "--exodus-hash-cache=bypass", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cachePath := filepath.Join(t.TempDir(), "cache")
+
+			SetConfig(t, CONFIG+"\nhashcache: "+cachePath+"\n")
+			ctrl := MockController(t)
+
+			mockGw := gw.NewMockInterface(ctrl)
+			ext.gw = mockGw
+
+			client := FakeClient{blobs: make(map[string]string)}
+			mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+			got := Main([]string{"rsync", tt.mode, srcPath + "/", "exodus:/some/target"})
+
+			// It should complete successfully.
+			if got != 0 {
+				t.Error("returned incorrect exit code", got)
+			}
+
+			// The checksums should have been calculated as usual.
+			if len(client.blobs) != 2 {
+				t.Errorf("unexpected blobs: %v", client.blobs)
+			}
+
+			_, err := os.Stat(cachePath)
+			if saved := err == nil; saved != tt.expectSaved {
+				t.Errorf("cache saved = %v, expected %v", saved, tt.expectSaved)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMainDropInConfig(t *testing.T) {
+	srv, srcPath := setupGw(t)
+
+	// The environment is only defined in a drop-in, sharing gateway settings
+	// from the main config file.
+	SetConfig(t, srv.Config())
+	if err := os.Mkdir("exodus-rsync.conf.d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile("exodus-rsync.conf.d/team.conf",
+		[]byte("environments:\n- prefix: team\n  gwenv: best-env\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Main([]string{"rsync", srcPath + "/", "team:/dest"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	expected := map[string]string{
+		"/dest/hello-copy-one":     helloKey,
+		"/dest/hello-copy-two":     helloKey,
+		"/dest/subdir/some-binary": binaryKey,
+	}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, expected) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainDropInConfigInvalid(t *testing.T) {
+	SetConfig(t, "environments:\n- prefix: exodus\n")
+	if err := os.Mkdir("exodus-rsync.conf.d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("exodus-rsync.conf.d/team.conf", []byte("environments: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logs := CaptureLogger(t)
+
+	if got := Main([]string{"rsync", "src", "exodus:/dest"}); got != 23 {
+		t.Errorf("unexpected exit code %d", got)
+	}
+	if FindEntry(logs, "can't load config") == nil {
+		t.Error("missing expected log entry")
+	}
+}
+
+func TestMainDropInConfigUnknownKey(t *testing.T) {
+	SetConfig(t, "environments:\n- prefix: exodus\n  rsyncmode: rsync\n")
+	if err := os.Mkdir("exodus-rsync.conf.d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("exodus-rsync.conf.d/team.conf", []byte("gwenv: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logs := CaptureLogger(t)
+
+	// Keys other than environments are ignored in drop-ins, as in the main
+	// config file, but reported when checking the config.
+	if got := Main([]string{"rsync", "--exodus-check-config"}); got != 23 {
+		t.Errorf("unexpected exit code %d", got)
+	}
+	if FindEntry(logs, "can't load config") == nil {
+		t.Error("missing expected log entry")
+	}
+}
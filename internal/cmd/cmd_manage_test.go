@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+)
+
+// Syncs the just-files tree to exodus:/dest without committing, returning the
+// ID of the publish left pending.
+func pendingPublish(t *testing.T, srv *gwtest.Server, srcPath string) string {
+	if got := Main([]string{"rsync", "--exodus-commit", "none", srcPath + "/", "exodus:/dest"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	publishes := srv.Publishes()
+	if len(publishes) != 1 || publishes[0].State != "PENDING" {
+		t.Fatalf("unexpected publishes: %v", publishes)
+	}
+	return publishes[0].ID
+}
+
+func TestMainManagePublish(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	id := pendingPublish(t, srv, srcPath)
+
+	manage := func(action string, extraArgs ...string) (int, string) {
+		out := captureStdout(t)
+		rawArgs := append([]string{"rsync", "--exodus-publish", id, "--exodus-publish-action", action},
+			extraArgs...)
+		got := Main(append(rawArgs, "exodus:/dest"))
+		return got, out.String()
+	}
+
+	if got, out := manage("status"); got != 0 || out != "PENDING\n" {
+		t.Errorf("status returned %d, output %q", got, out)
+	}
+
+	got, out := manage("items")
+	if got != 0 {
+		t.Errorf("items returned %d", got)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	sort.Strings(lines)
+	expected := []string{
+		"/dest/hello-copy-one\t" + helloKey + "\t",
+		"/dest/hello-copy-two\t" + helloKey + "\t",
+		"/dest/subdir/some-binary\t" + binaryKey + "\t",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("unexpected items output: %q", out)
+	}
+	for i := range lines {
+		if !strings.HasPrefix(lines[i], expected[i]) {
+			t.Errorf("unexpected item %q, want prefix %q", lines[i], expected[i])
+		}
+	}
+
+	// A dry-run commit doesn't do anything.
+	if got, _ := manage("commit", "-n"); got != 0 {
+		t.Errorf("dry-run commit returned %d", got)
+	}
+	if publishes := srv.Publishes(); publishes[0].State != "PENDING" {
+		t.Errorf("publish committed in dry-run mode: %v", publishes)
+	}
+
+	if got, _ := manage("commit"); got != 0 {
+		t.Errorf("commit returned %d", got)
+	}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, justFilesPublished) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+
+	if got, out := manage("status"); got != 0 || out != "COMMITTED\n" {
+		t.Errorf("status returned %d, output %q", got, out)
+	}
+
+	// A committed publish can't be aborted.
+	logs := CaptureLogger(t)
+	if got, _ := manage("abort"); got != 71 {
+		t.Errorf("abort returned %d", got)
+	}
+	if FindEntry(logs, "can't abort publish") == nil {
+		t.Error("missing expected log entry")
+	}
+}
+
+func TestMainManagePublishAbort(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	id := pendingPublish(t, srv, srcPath)
+
+	got := Main([]string{"rsync", "--exodus-publish", id, "--exodus-publish-action", "abort", "exodus:/dest"})
+	if got != 0 {
+		t.Errorf("abort returned %d", got)
+	}
+
+	if publishes := srv.Publishes(); publishes[0].State != "FAILED" {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+	if published := srv.Published("best-env"); len(published) != 0 {
+		t.Errorf("content was published: %v", published)
+	}
+}
+
+func TestMainManagePublishCommitNoWait(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	id := pendingPublish(t, srv, srcPath)
+	out := captureStdout(t)
+
+	got := Main([]string{"rsync", "--exodus-publish", id, "--exodus-publish-action", "commit",
+		"--exodus-commit", "phase1", "--exodus-no-wait", "exodus:/dest"})
+	if got != 0 {
+		t.Errorf("commit returned %d", got)
+	}
+
+	publishes := srv.Publishes()
+	if publishes[0].State != "COMMITTING" || publishes[0].CommitMode != "phase1" {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+
+	// The task can then be awaited.
+	taskID := strings.TrimSpace(out.String())
+	if got := Main([]string{"rsync", "--exodus-await-task", taskID}); got != 0 {
+		t.Errorf("await returned %d", got)
+	}
+	if publishes := srv.Publishes(); publishes[0].State != "COMMITTED" {
+		t.Errorf("unexpected publishes: %v", publishes)
+	}
+}
+
+func TestMainManagePublishErrors(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	id := pendingPublish(t, srv, srcPath)
+
+	tests := []struct {
+		name    string
+		publish string
+		action  string
+		fault   *gwtest.Fault
+		code    int
+		message string
+	}{
+		{"missing publish", "3e0a4539-be4a-437e-a45f-6d72f7192f17", "status", nil, 67, "can't get publish"},
+		{"commit fails", id, "commit",
+			&gwtest.Fault{Method: http.MethodPost, Path: "/best-env/publish/" + id + "/commit", Status: 400, Count: 1},
+			71, "can't commit publish"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := CaptureLogger(t)
+			if tt.fault != nil {
+				srv.InjectFault(*tt.fault)
+			}
+
+			got := Main([]string{"rsync", "--exodus-publish", tt.publish, "--exodus-publish-action", tt.action,
+				"exodus:/dest"})
+			if got != tt.code {
+				t.Errorf("returned %d, want %d", got, tt.code)
+			}
+			if FindEntry(logs, tt.message) == nil {
+				t.Error("missing expected log entry")
+			}
+		})
+	}
+}
+
+func TestMainNewPublish(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	out := captureStdout(t)
+
+	got := Main([]string{"rsync", "--exodus-new-publish", "exodus:/"})
+	if got != 0 {
+		t.Fatalf("new publish returned %d", got)
+	}
+
+	// Only the ID should be printed, and the publish left open.
+	publishes := srv.Publishes()
+	if len(publishes) != 1 || publishes[0].State != "PENDING" {
+		t.Fatalf("unexpected publishes: %v", publishes)
+	}
+	id := publishes[0].ID
+	if out.String() != id+"\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	// The publish can then be joined and committed.
+	if got := Main([]string{"rsync", "--exodus-publish", id, srcPath + "/", "exodus:/dest"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+	if got := Main([]string{"rsync", "--exodus-publish", id, "--exodus-publish-action", "commit", "exodus:/"}); got != 0 {
+		t.Fatalf("commit returned %d", got)
+	}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, justFilesPublished) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainNewPublishJSON(t *testing.T) {
+	srv, _ := setupGw(t)
+	out := captureStdout(t)
+
+	got := Main([]string{"rsync", "--exodus-new-publish", "--exodus-output", "json", "exodus:/"})
+	if got != 0 {
+		t.Fatalf("new publish returned %d", got)
+	}
+
+	publishes := srv.Publishes()
+	if len(publishes) != 1 {
+		t.Fatalf("unexpected publishes: %v", publishes)
+	}
+
+	expected := `{"id":"` + publishes[0].ID + `","env":"best-env"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestMainNewPublishDryRun(t *testing.T) {
+	srv, _ := setupGw(t)
+	out := captureStdout(t)
+
+	got := Main([]string{"rsync", "--exodus-new-publish", "--dry-run", "exodus:/"})
+	if got != 0 {
+		t.Fatalf("new publish returned %d", got)
+	}
+
+	if publishes := srv.Publishes(); len(publishes) != 0 {
+		t.Errorf("publish created in dry-run mode: %v", publishes)
+	}
+	if out.String() != "abcd1234\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestMainNewPublishFails(t *testing.T) {
+	srv, _ := setupGw(t)
+	out := captureStdout(t)
+	logs := CaptureLogger(t)
+
+	srv.InjectFault(gwtest.Fault{Method: http.MethodPost, Path: "/best-env/publish", Status: 400})
+
+	got := Main([]string{"rsync", "--exodus-new-publish", "exodus:/"})
+	if got != 62 {
+		t.Errorf("new publish returned %d", got)
+	}
+
+	if FindEntry(logs, "can't create publish") == nil {
+		t.Error("missing expected log entry")
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	helloKey  = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	binaryKey = "c66f610d98b2c9fe0175a3e99ba64d7fc7de45046515ff325be56329a9347dd6"
+)
+
+func readManifest(t *testing.T, path string) *manifest.Manifest {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &manifest.Manifest{}
+	if err := json.Unmarshal(content, out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// A publish which fails to commit, as if the commit task failed.
+type failedCommitPublish struct {
+	*FakePublish
+}
+
+func (p *failedCommitPublish) Commit(ctx context.Context, mode string) error {
+	return &gw.TaskError{ID: "some-task", State: "FAILED"}
+}
+
+func TestMainManifestOut(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, CONFIG)
+	ctrl := MockController(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := FakeClient{
+		blobs:     map[string]string{binaryKey: "existing"},
+		published: []gw.ItemInput{{WebURI: "/some/target/stale", ObjectKey: "abc"}},
+	}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	got := Main([]string{"rsync", "--delete", "--exodus-commit=phase2",
+		"--exodus-manifest-out", "manifest.json", srcPath + "/", "exodus:/some/target"})
+	if got != 0 {
+		t.Fatal("returned incorrect exit code", got)
+	}
+
+	m := readManifest(t, "manifest.json")
+
+	if m.PublishID != client.publishes[0].id || m.Env != "best-env" {
+		t.Errorf("unexpected publish in manifest: %v %v", m.PublishID, m.Env)
+	}
+	if !m.Committed || m.CommitMode != "phase2" || m.TaskState != "COMPLETE" {
+		t.Errorf("unexpected commit in manifest: %v %v %v", m.Committed, m.CommitMode, m.TaskState)
+	}
+
+	expected := []manifest.Entry{
+		{
+			WebURI:      "/some/target/hello-copy-one",
+			ObjectKey:   helloKey,
+			ContentType: "text/plain; charset=utf-8",
+			SrcPath:     srcPath + "/hello-copy-one",
+			Size:        6,
+			Outcome:     manifest.Uploaded,
+		},
+		{
+			WebURI:      "/some/target/hello-copy-two",
+			ObjectKey:   helloKey,
+			ContentType: "text/plain; charset=utf-8",
+			SrcPath:     srcPath + "/hello-copy-two",
+			Size:        6,
+			Outcome:     manifest.Duplicate,
+		},
+		{
+			WebURI:    "/some/target/stale",
+			ObjectKey: gw.AbsentObjectKey,
+		},
+		{
+			WebURI:      "/some/target/subdir/some-binary",
+			ObjectKey:   binaryKey,
+			ContentType: "application/octet-stream",
+			SrcPath:     srcPath + "/subdir/some-binary",
+			Size:        200,
+			Outcome:     manifest.Present,
+		},
+	}
+	if !reflect.DeepEqual(m.Items, expected) {
+		t.Errorf("unexpected manifest items:\n%v\nexpected:\n%v", m.Items, expected)
+	}
+}
+
+func TestMainManifestOutCommitFailed(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, CONFIG)
+	ctrl := MockController(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := &singlePublishClient{
+		FakeClient: &FakeClient{blobs: make(map[string]string)},
+		publish:    &failedCommitPublish{&FakePublish{id: "some-publish"}},
+	}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client, nil)
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	got := Main([]string{"rsync", "--exodus-manifest-out", "manifest.json", srcPath + "/", "exodus:/some/target"})
+	if got != 71 {
+		t.Fatal("returned incorrect exit code", got)
+	}
+
+	// Manifest should still be written, recording the failure.
+	m := readManifest(t, "manifest.json")
+	if m.Committed || m.TaskState != "FAILED" || len(m.Items) != 3 {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+}
+
+func TestMainManifestOutError(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, CONFIG)
+	ctrl := MockController(t)
+	logs := CaptureLogger(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := FakeClient{blobs: make(map[string]string)}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	got := Main([]string{"rsync", "--exodus-manifest-out", "no-such-dir/manifest.json",
+		srcPath + "/", "exodus:/some/target"})
+	if got != 11 {
+		t.Error("returned incorrect exit code", got)
+	}
+
+	// Publish should have been committed regardless.
+	if client.publishes[0].committed != 1 {
+		t.Error("publish was not committed")
+	}
+	if FindEntry(logs, "can't write manifest") == nil {
+		t.Error("missing expected log message")
+	}
+}
+
+func TestTaskState(t *testing.T) {
+	if got := taskState(nil); got != "COMPLETE" {
+		t.Errorf("unexpected state for success: %v", got)
+	}
+	if got := taskState(&gw.TaskError{State: "FAILED"}); got != "FAILED" {
+		t.Errorf("unexpected state for failed task: %v", got)
+	}
+	if got := taskState(os.ErrClosed); got != "" {
+		t.Errorf("unexpected state for other error: %v", got)
+	}
+}
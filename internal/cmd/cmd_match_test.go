@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+const MATCH_CONFIG string = `
+environments:
+- prefix: upload1.example.com
+  aliases: [upload2.example.com]
+  gwenv: best-env
+
+- prefix: mirror*.example.com:/pub
+  match: glob
+  gwenv: best-env
+
+- prefix: 'mirror[0-9]\.example\.com:/pub'
+  match: regex
+  gwenv: best-env
+`
+
+func TestMainMatchAlias(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+MATCH_CONFIG)
+
+	if got := Main([]string{"rsync", srcPath + "/", "upload2.example.com:/some/dest"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// The matched alias is stripped from the destination.
+	expected := map[string]string{
+		"/some/dest/hello-copy-one":     helloKey,
+		"/some/dest/hello-copy-two":     helloKey,
+		"/some/dest/subdir/some-binary": binaryKey,
+	}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, expected) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainMatchGlob(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+MATCH_CONFIG)
+
+	if got := Main([]string{"rsync", srcPath + "/", "mirror-x.example.com:/pub/dest"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// The whole prefix matched by the glob is stripped from the destination.
+	expected := map[string]string{
+		"/dest/hello-copy-one":     helloKey,
+		"/dest/hello-copy-two":     helloKey,
+		"/dest/subdir/some-binary": binaryKey,
+	}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, expected) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainMatchAmbiguous(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+MATCH_CONFIG)
+	logs := CaptureLogger(t)
+
+	if got := Main([]string{"rsync", srcPath + "/", "mirror1.example.com:/pub/dest"}); got != 23 {
+		t.Errorf("sync returned %d", got)
+	}
+
+	entry := FindEntry(logs, "can't select environment")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	expected := `destination 'mirror1.example.com:/pub/dest' matches environments ` +
+		`'mirror*.example.com:/pub', 'mirror[0-9]\.example\.com:/pub' equally`
+	if got := entry.Fields["error"].(error).Error(); got != expected {
+		t.Errorf("unexpected error: %s", got)
+	}
+	if published := publishedKeys(srv); len(published) != 0 {
+		t.Errorf("unexpectedly published content: %v", published)
+	}
+}
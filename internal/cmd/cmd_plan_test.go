@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		uris []string
+		want string
+	}{
+		{nil, "/"},
+		{[]string{"/dest/file"}, "/dest"},
+		{[]string{"/dest/a/file", "/dest/a/other"}, "/dest/a"},
+		{[]string{"/dest/a/file", "/dest/b/file", "/dest/a/c/file"}, "/dest"},
+		{[]string{"/dest/ab/file", "/dest/a/file"}, "/dest"},
+		{[]string{"/dest/file", "/other/file"}, "/"},
+	}
+
+	for _, tt := range tests {
+		if got := commonDir(tt.uris); got != tt.want {
+			t.Errorf("commonDir(%v) = %q, want %q", tt.uris, got, tt.want)
+		}
+	}
+}
+
+func TestListPrefixes(t *testing.T) {
+	tests := []struct {
+		uris []string
+		want []string
+	}{
+		{nil, []string{}},
+		{[]string{"/dest/a/file", "/dest/b/file"}, []string{"/dest/"}},
+		{[]string{"/dest/a/file", "/other/b/file", "/dest/a/c/file"}, []string{"/dest/a/", "/other/b/"}},
+		{[]string{"/dest/file", "/top-file"}, []string{"/dest/", "/top-file"}},
+	}
+
+	for _, tt := range tests {
+		if got := listPrefixes(tt.uris); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("listPrefixes(%v) = %q, want %q", tt.uris, got, tt.want)
+		}
+	}
+}
+
+func TestPlanItem(t *testing.T) {
+	item := walk.SyncItem{SrcPath: "src/file"}
+
+	tests := []struct {
+		name    string
+		input   gw.ItemInput
+		current *gw.ItemInput
+		want    planStatus
+	}{
+		{"new file", gw.ItemInput{WebURI: "/f", ObjectKey: "abc"}, nil, planAdded},
+		{"same file", gw.ItemInput{WebURI: "/f", ObjectKey: "abc"},
+			&gw.ItemInput{WebURI: "/f", ObjectKey: "abc"}, planUnchanged},
+		{"different file", gw.ItemInput{WebURI: "/f", ObjectKey: "abc"},
+			&gw.ItemInput{WebURI: "/f", ObjectKey: "def"}, planChanged},
+		{"same link", gw.ItemInput{WebURI: "/f", LinkTo: "/a"},
+			&gw.ItemInput{WebURI: "/f", LinkTo: "/a"}, planUnchanged},
+		{"different link", gw.ItemInput{WebURI: "/f", LinkTo: "/a"},
+			&gw.ItemInput{WebURI: "/f", LinkTo: "/b"}, planLinkChanged},
+		{"file to link", gw.ItemInput{WebURI: "/f", LinkTo: "/a"},
+			&gw.ItemInput{WebURI: "/f", ObjectKey: "abc"}, planChanged},
+		{"link to file", gw.ItemInput{WebURI: "/f", ObjectKey: "abc"},
+			&gw.ItemInput{WebURI: "/f", LinkTo: "/a"}, planChanged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planItem(item, tt.input, tt.current)
+			if got.Status != tt.want {
+				t.Errorf("got status %q, want %q", got.Status, tt.want)
+			}
+			if got.SrcPath != "src/file" || got.WebURI != "/f" {
+				t.Errorf("unexpected entry: %v", got)
+			}
+		})
+	}
+}
+
+func TestMainPlan(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	logs := CaptureLogger(t)
+
+	srv.AddPublished("best-env",
+		gwtest.Item{WebURI: "/dest/hello-copy-one", ObjectKey: helloKey},
+		gwtest.Item{WebURI: "/dest/hello-copy-two", ObjectKey: binaryKey},
+		gwtest.Item{WebURI: "/dest/old-file", ObjectKey: helloKey},
+		gwtest.Item{WebURI: "/other/file", ObjectKey: helloKey},
+	)
+	before := srv.Published("best-env")
+
+	out := captureStdout(t)
+	got := Main([]string{"rsync", "-v", "--exodus-plan", "--delete", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("plan returned %d", got)
+	}
+
+	expected := "unchanged    /dest/hello-copy-one\n" +
+		"changed      /dest/hello-copy-two\n" +
+		"deleted      /dest/old-file\n" +
+		"added        /dest/subdir/some-binary\n" +
+		"Plan: 1 added, 1 changed, 0 link-changed, 1 unchanged, 1 deleted\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	// Nothing should have been published.
+	if publishes := srv.Publishes(); len(publishes) != 0 {
+		t.Errorf("publish created by plan: %v", publishes)
+	}
+	if published := srv.Published("best-env"); !reflect.DeepEqual(published, before) {
+		t.Errorf("published content changed by plan: %v", published)
+	}
+	if keys := srv.BlobKeys("best-env"); len(keys) != 0 {
+		t.Errorf("blobs uploaded by plan: %v", keys)
+	}
+
+	entry := FindEntry(logs, "Completed plan, nothing was published")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	if entry.Fields["added"] != 1 || entry.Fields["deleted"] != 1 {
+		t.Errorf("unexpected log fields: %v", entry.Fields)
+	}
+}
+
+func TestMainPlanJSON(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	pendingPublish(t, srv, srcPath)
+
+	// Once everything has been published, the plan is empty of changes.
+	if got := Main([]string{"rsync", "--exodus-publish", srv.Publishes()[0].ID,
+		"--exodus-publish-action", "commit", "exodus:/dest"}); got != 0 {
+		t.Fatalf("commit returned %d", got)
+	}
+
+	out := captureStdout(t)
+	got := Main([]string{"rsync", "--exodus-plan", "--exodus-output", "json", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("plan returned %d", got)
+	}
+
+	var plan syncPlan
+	if err := json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatalf("can't decode output %q: %v", out.String(), err)
+	}
+
+	expectedSummary := map[planStatus]int{
+		planAdded: 0, planChanged: 0, planLinkChanged: 0, planUnchanged: 3, planDeleted: 0,
+	}
+	if !reflect.DeepEqual(plan.Summary, expectedSummary) {
+		t.Errorf("unexpected summary: %v", plan.Summary)
+	}
+
+	if len(plan.Items) != 3 {
+		t.Fatalf("unexpected items: %v", plan.Items)
+	}
+	first := plan.Items[0]
+	if first.WebURI != "/dest/hello-copy-one" || first.ObjectKey != helloKey ||
+		first.OldObjectKey != helloKey || first.SrcPath != srcPath+"/hello-copy-one" {
+		t.Errorf("unexpected item: %v", first)
+	}
+}
+
+func TestMainPlanLinks(t *testing.T) {
+	srv, _ := setupGw(t)
+
+	srcPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcPath, "file"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", filepath.Join(srcPath, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.AddPublished("best-env",
+		gwtest.Item{WebURI: "/dest/file", ObjectKey: helloKey},
+		gwtest.Item{WebURI: "/dest/link", LinkTo: "/dest/old-file"},
+	)
+
+	out := captureStdout(t)
+	got := Main([]string{"rsync", "-rl", "--exodus-plan", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("plan returned %d", got)
+	}
+
+	expected := "unchanged    /dest/file\n" +
+		"link-changed /dest/link -> /dest/file\n" +
+		"Plan: 0 added, 0 changed, 1 link-changed, 1 unchanged, 0 deleted\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestMainPlanRewritten(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+"rewrite:\n- prefix: /dest/subdir\n  replace: /other/subdir\n"+CONFIG)
+
+	srv.AddPublished("best-env",
+		gwtest.Item{WebURI: "/dest/hello-copy-one", ObjectKey: helloKey},
+		gwtest.Item{WebURI: "/other/subdir/some-binary", ObjectKey: binaryKey},
+	)
+
+	out := captureStdout(t)
+	got := Main([]string{"rsync", "--exodus-plan", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("plan returned %d", got)
+	}
+
+	expected := "unchanged    /dest/hello-copy-one\n" +
+		"added        /dest/hello-copy-two\n" +
+		"unchanged    /other/subdir/some-binary\n" +
+		"Plan: 1 added, 0 changed, 0 link-changed, 2 unchanged, 0 deleted\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	// Content should have been listed under each top-level directory,
+	// rather than listing everything.
+	var prefixes []string
+	for _, req := range srv.Requests() {
+		if req.Path == "/best-env/items" {
+			prefixes = append(prefixes, req.Query)
+		}
+	}
+	if !reflect.DeepEqual(prefixes, []string{"prefix=%2Fdest%2F", "prefix=%2Fother%2Fsubdir%2F"}) {
+		t.Errorf("unexpected listings: %v", prefixes)
+	}
+}
+
+func TestMainPlanListFails(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	logs := CaptureLogger(t)
+
+	srv.InjectFault(gwtest.Fault{Method: http.MethodGet, Path: "/best-env/items", Status: 500})
+
+	got := Main([]string{"rsync", "--exodus-plan", srcPath + "/", "exodus:/dest"})
+	if got != 51 {
+		t.Errorf("plan returned %d", got)
+	}
+	if FindEntry(logs, "can't list published content") == nil {
+		t.Error("missing expected log entry")
+	}
+}
+
+func TestMainPlanRsyncMode(t *testing.T) {
+	SetConfig(t, CONFIG)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "--exodus-plan", ".", "somehost:/dest"})
+	if got != 23 {
+		t.Errorf("plan returned %d", got)
+	}
+	if FindEntry(logs, "--exodus-plan requires DEST to be published via exodus") == nil {
+		t.Error("missing expected log entry")
+	}
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+func TestFormatRate(t *testing.T) {
+	tests := map[float64]string{
+		0:              "0.00kB/s",
+		512:            "0.50kB/s",
+		1536 * 1024:    "1.50MB/s",
+		3 << 30:        "3.00GB/s",
+		2048 * 1 << 30: "2048.00GB/s",
+	}
+	for rate, want := range tests {
+		if got := formatRate(rate); got != want {
+			t.Errorf("formatRate(%v) = %q, want %q", rate, got, want)
+		}
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                                "0:00:00",
+		1500 * time.Millisecond:          "0:00:02",
+		65 * time.Second:                 "0:01:05",
+		26*time.Hour + 3*time.Minute + 4: "26:03:00",
+	}
+	for d, want := range tests {
+		if got := formatETA(d); got != want {
+			t.Errorf("formatETA(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestUploadProgressTerminal(t *testing.T) {
+	out := &bytes.Buffer{}
+	ctx := log.NewContext(context.Background(), log.Package.NewLogger(args.Config{}))
+
+	p := newUploadProgress(ctx, out, false)
+	p.tty = true
+
+	info, err := os.Stat("../../test/data/srctrees/just-files/subdir/some-binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := walk.SyncItem{Key: "big", Info: info}
+	present := walk.SyncItem{Key: "present", Info: info}
+	link := walk.SyncItem{LinkTo: "elsewhere"}
+
+	// Not started, so nothing but the calls below produces output.
+	start := time.Now()
+	p.start = start
+	p.lastTime = start
+
+	p.walked(big)
+	p.walked(present)
+	p.walked(link)
+	p.done(link, "")
+	p.done(present, manifest.Present)
+	p.sentBytes.Add(100)
+
+	p.update(start.Add(time.Second), false)
+
+	want := "\r            300  75%    0.10kB/s     0:00:01 (xfr#0, ir-chk=1/3)"
+	if got := out.String(); got != want {
+		t.Errorf("unexpected progress:\n%q\nwant:\n%q", got, want)
+	}
+
+	out.Reset()
+	p.finishedWalk()
+	p.sentBytes.Add(100)
+	p.done(big, manifest.Uploaded)
+	p.update(start.Add(2*time.Second), true)
+
+	want = "\r            400 100%    0.10kB/s     0:00:00 (xfr#1, to-chk=0/3)\n"
+	if got := out.String(); got != want {
+		t.Errorf("unexpected progress:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestUploadProgressNil(t *testing.T) {
+	var p *uploadProgress
+
+	ctx := context.Background()
+	if got := p.begin(ctx); got != ctx {
+		t.Error("unexpected context from nil progress")
+	}
+
+	// These should all do nothing rather than crash.
+	p.walked(walk.SyncItem{})
+	p.done(walk.SyncItem{}, manifest.Uploaded)
+	p.finishedWalk()
+	p.stop()
+}
+
+func TestMainSyncProgress(t *testing.T) {
+	for _, flag := range []string{"--progress", "--info=progress2"} {
+		t.Run(flag, func(t *testing.T) {
+			_, srcPath := setupGw(t)
+			out := captureStdout(t)
+			logs := CaptureLogger(t)
+
+			got := Main([]string{"rsync", flag, srcPath + "/", "exodus:/dest"})
+			if got != 0 {
+				t.Fatalf("sync returned %d", got)
+			}
+
+			// Output isn't a terminal, so progress is logged instead.
+			if strings.Contains(out.String(), "\r") {
+				t.Errorf("unexpected progress output: %q", out.String())
+			}
+
+			entry := FindEntry(logs, "Upload progress")
+			if entry == nil {
+				t.Fatal("missing progress log")
+			}
+
+			// Only one of the duplicate hello files is uploaded, but both
+			// are counted.
+			for key, want := range map[string]int64{
+				"bytes":       212,
+				"total_bytes": 212,
+				"files":       3,
+				"total_files": 3,
+			} {
+				if got := entry.Fields[key]; got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMainSyncProgressDryRun(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "-n", "--progress", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	if published := srv.Published("best-env"); len(published) != 0 {
+		t.Errorf("content was published: %v", published)
+	}
+
+	// Nothing was read for upload, but everything still counts as done.
+	entry := FindEntry(logs, "Upload progress")
+	if entry == nil {
+		t.Fatal("missing progress log")
+	}
+	if got := entry.Fields["bytes"]; got != int64(212) {
+		t.Errorf("bytes = %v", got)
+	}
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+)
+
+func TestCommaNum(t *testing.T) {
+	tests := map[int64]string{
+		0:          "0",
+		12:         "12",
+		123:        "123",
+		1234:       "1,234",
+		123456:     "123,456",
+		1234567:    "1,234,567",
+		-987654321: "-987,654,321",
+	}
+	for n, want := range tests {
+		if got := commaNum(n); got != want {
+			t.Errorf("commaNum(%d) = %q, want %q", n, got, want)
+		}
+	}
+
+	if got := commaFloat(1234.567); got != "1,234.57" {
+		t.Errorf("commaFloat() = %q", got)
+	}
+}
+
+// Captures anything written to stdout for the duration of a test.
+func captureStdout(t *testing.T) *bytes.Buffer {
+	out := &bytes.Buffer{}
+	ext.stdout = out
+	return out
+}
+
+// Returns the lines of output matching a regular expression.
+func outputLines(out *bytes.Buffer, pattern string) []string {
+	var lines []string
+	re := regexp.MustCompile(pattern)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if re.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestMainSyncItemizeStats(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	out := captureStdout(t)
+
+	stale := srv.AddBlob("best-env", []byte("stale content"))
+	srv.AddPublished("best-env", gwtest.Item{WebURI: "/dest/stale", ObjectKey: stale})
+
+	got := Main([]string{"rsync", "-i", "--stats", "--delete", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// Both hello files have the same content, so only one is uploaded.
+	if lines := outputLines(out, `^<f\+{9} hello-copy-(one|two)$`); len(lines) != 1 {
+		t.Errorf("unexpected itemized hello files: %v", lines)
+	}
+	for _, want := range []string{
+		"<f+++++++++ subdir/some-binary",
+		"*deleting   stale",
+		"Number of files: 3 (reg: 3)",
+		"Number of deleted files: 1",
+		"Number of regular files transferred: 2",
+		"Total file size: 212 bytes",
+		"Total transferred file size: 206 bytes",
+		"Literal data: 206 bytes",
+		"Total bytes sent: 206",
+		"total size is 212  speedup is 1.03",
+	} {
+		if lines := outputLines(out, "^"+regexp.QuoteMeta(want)+"$"); len(lines) != 1 {
+			t.Errorf("missing output %q in:\n%s", want, out)
+		}
+	}
+	if lines := outputLines(out, `^sent 206 bytes  received 0 bytes  [0-9,]+\.[0-9]{2} bytes/sec$`); len(lines) != 1 {
+		t.Errorf("missing summary in:\n%s", out)
+	}
+
+	// Syncing again transfers nothing.
+	out.Reset()
+	if got := Main([]string{"rsync", "-i", "--stats", srcPath + "/", "exodus:/dest"}); got != 0 {
+		t.Fatalf("second sync returned %d", got)
+	}
+	if lines := outputLines(out, `^<f`); len(lines) != 0 {
+		t.Errorf("unexpected itemized files: %v", lines)
+	}
+	if lines := outputLines(out, `^Number of regular files transferred: 0$`); len(lines) != 1 {
+		t.Errorf("missing stats in:\n%s", out)
+	}
+}
+
+func TestMainSyncItemizeLinks(t *testing.T) {
+	_, _ = setupGw(t)
+	out := captureStdout(t)
+
+	srcPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcPath, "target"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target", filepath.Join(srcPath, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a trailing slash, names include the source directory.
+	got := Main([]string{"rsync", "-l", "--itemize-changes", "--stats", srcPath, "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	base := filepath.Base(srcPath)
+	for _, want := range []string{
+		"<f+++++++++ " + base + "/target",
+		"cL+++++++++ " + base + "/link -> target",
+		"Number of files: 2 (reg: 1, link: 1)",
+	} {
+		if lines := outputLines(out, "^"+regexp.QuoteMeta(want)+"$"); len(lines) != 1 {
+			t.Errorf("missing output %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMainSyncNoItemize(t *testing.T) {
+	_, srcPath := setupGw(t)
+	out := captureStdout(t)
+
+	if got := Main([]string{"rsync", srcPath + "/", "exodus:/dest"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// Output is only written on request.
+	if out.Len() != 0 {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestMainSyncItemizeRewritten(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+
+		"rewrite:\n"+
+		"- prefix: /dest/subdir\n  replace: /other/subdir\n"+
+		"- prefix: /dest\n  replace: /cdn/dest\n"+
+		CONFIG)
+	out := captureStdout(t)
+
+	got := Main([]string{"rsync", "-i", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// Names are relative to the rewritten destination, other than for
+	// items rewritten elsewhere.
+	if lines := outputLines(out, `^<f\+{9} hello-copy-(one|two)$`); len(lines) != 1 {
+		t.Errorf("unexpected itemized hello files in:\n%s", out)
+	}
+	if lines := outputLines(out, `^<f\+{9} /other/subdir/some-binary$`); len(lines) != 1 {
+		t.Errorf("missing rewritten file in:\n%s", out)
+	}
+
+	// Deletions are found under the rewritten destination, and named
+	// relative to it.
+	SetConfig(t, srv.Config()+"rewrite:\n- prefix: /dest\n  replace: /cdn/dest\n"+CONFIG)
+	stale := srv.AddBlob("best-env", []byte("stale content"))
+	srv.AddPublished("best-env", gwtest.Item{WebURI: "/cdn/dest/stale", ObjectKey: stale})
+
+	out.Reset()
+	if got := Main([]string{"rsync", "-i", "--delete", srcPath + "/", "exodus:/dest"}); got != 0 {
+		t.Fatalf("second sync returned %d", got)
+	}
+	if lines := outputLines(out, `^\*deleting   stale$`); len(lines) != 1 {
+		t.Errorf("missing deletion in:\n%s", out)
+	}
+}
@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/journal"
+	"go.uber.org/mock/gomock"
+)
+
+const resumeConfig = `
+gwbatchsize: 1
+journaldir: journal
+
+environments:
+- prefix: exodus
+  gwenv: best-env
+`
+
+// A publish which fails on one particular call to AddItems.
+type flakyPublish struct {
+	*FakePublish
+	calls  int
+	failAt int
+}
+
+func (p *flakyPublish) AddItems(ctx context.Context, items []gw.ItemInput) error {
+	p.calls++
+	if p.calls == p.failAt {
+		return fmt.Errorf("simulated error")
+	}
+	return p.FakePublish.AddItems(ctx, items)
+}
+
+// A client which always uses the same publish.
+type singlePublishClient struct {
+	*FakeClient
+	publish  gw.Publish
+	gotIDs   []string
+	newCount int
+}
+
+func (c *singlePublishClient) NewPublish(context.Context) (gw.Publish, error) {
+	c.newCount++
+	return c.publish, nil
+}
+
+func (c *singlePublishClient) GetPublish(_ context.Context, id string) (gw.Publish, error) {
+	c.gotIDs = append(c.gotIDs, id)
+	return c.publish, nil
+}
+
+func journalFiles(t *testing.T) []string {
+	out, err := filepath.Glob("journal/*.journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestMainResume(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, resumeConfig)
+	ctrl := MockController(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+	args := []string{"rsync", srcPath + "/", "exodus:/some/target"}
+
+	publish := &flakyPublish{FakePublish: &FakePublish{id: "3e0a4539-be4a-437e-a45f-6d72f7192f17"}, failAt: 2}
+
+	// First run fails partway through adding items.
+	client1 := &singlePublishClient{FakeClient: &FakeClient{blobs: make(map[string]string)}, publish: publish}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client1, nil)
+
+	if got := Main(args); got != 51 {
+		t.Fatal("first run returned incorrect exit code", got)
+	}
+	if len(publish.items) != 1 {
+		t.Fatalf("expected 1 item added in first run, got %v", publish.items)
+	}
+	if len(journalFiles(t)) != 1 {
+		t.Fatalf("journal not left in place after failure: %v", journalFiles(t))
+	}
+
+	// Second run resumes.
+	client2 := &singlePublishClient{FakeClient: &FakeClient{blobs: make(map[string]string)}, publish: publish}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client2, nil)
+
+	if got := Main(append([]string{"rsync", "--exodus-resume"}, args[1:]...)); got != 0 {
+		t.Fatal("resumed run returned incorrect exit code", got)
+	}
+
+	// It should have joined the same publish rather than creating a new one.
+	if client2.newCount != 0 || len(client2.gotIDs) != 1 || client2.gotIDs[0] != publish.id {
+		t.Errorf("did not rejoin publish: created %d, joined %v", client2.newCount, client2.gotIDs)
+	}
+
+	// Every blob was confirmed uploaded by the first run, so nothing
+	// should have been uploaded again.
+	if len(client2.blobs) != 0 {
+		t.Errorf("resumed run uploaded blobs again: %v", client2.blobs)
+	}
+
+	// It should have added only the items not accepted by the first run.
+	uris := map[string]int{}
+	for _, item := range publish.items {
+		uris[item.WebURI]++
+	}
+	for _, uri := range []string{
+		"/some/target/hello-copy-one",
+		"/some/target/hello-copy-two",
+		"/some/target/subdir/some-binary",
+	} {
+		if uris[uri] != 1 {
+			t.Errorf("%s added %d time(s)", uri, uris[uri])
+		}
+	}
+
+	if publish.committed != 1 {
+		t.Errorf("expected 1 commit, got %d", publish.committed)
+	}
+
+	// The journal is no longer needed once complete.
+	if files := journalFiles(t); len(files) != 0 {
+		t.Errorf("journal not removed after completion: %v", files)
+	}
+}
+
+func TestMainResumeWalk(t *testing.T) {
+	// Not the checksum of the file, so that it's clear when the key was
+	// taken from the journal rather than calculated again.
+	journaledKey := strings.Repeat("a", 64)
+
+	for _, complete := range []bool{true, false} {
+		t.Run(fmt.Sprintf("complete=%v", complete), func(t *testing.T) {
+			SetConfig(t, resumeConfig)
+			ctrl := MockController(t)
+
+			mockGw := gw.NewMockInterface(ctrl)
+			ext.gw = mockGw
+
+			srcPath := t.TempDir()
+			for _, name := range []string{"one", "two"} {
+				if err := os.WriteFile(filepath.Join(srcPath, name), []byte(name+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			args := []string{"rsync", srcPath + "/", "exodus:/some/target"}
+
+			publish := &flakyPublish{FakePublish: &FakePublish{id: "3e0a4539-be4a-437e-a45f-6d72f7192f17"}, failAt: 1}
+
+			// First run fails before adding anything.
+			client1 := &singlePublishClient{FakeClient: &FakeClient{blobs: make(map[string]string)}, publish: publish}
+			mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client1, nil)
+
+			if got := Main(args); got != 51 {
+				t.Fatal("first run returned incorrect exit code", got)
+			}
+			files := journalFiles(t)
+			if len(files) != 1 {
+				t.Fatalf("journal not left in place after failure: %v", files)
+			}
+
+			// Replace the journal so it's known exactly what was walked.
+			j, err := journal.Create(files[0], publish.id, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			onePath := filepath.Join(srcPath, "one")
+			info, err := os.Stat(onePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Walked(journal.File{SrcPath: onePath, Key: journaledKey, Size: info.Size(), Mtime: info.ModTime().UnixNano()}); err != nil {
+				t.Fatal(err)
+			}
+			if complete {
+				twoPath := filepath.Join(srcPath, "two")
+				if err := j.Walked(journal.File{SrcPath: twoPath, Key: strings.Repeat("b", 64)}); err != nil {
+					t.Fatal(err)
+				}
+				if err := j.FinishedWalk(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := j.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// A file created since, which is only found if the tree is walked.
+			if err := os.WriteFile(filepath.Join(srcPath, "three"), []byte("three\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			client2 := &singlePublishClient{FakeClient: &FakeClient{blobs: make(map[string]string)}, publish: publish}
+			mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client2, nil)
+
+			if got := Main(append([]string{"rsync", "--exodus-resume"}, args[1:]...)); got != 0 {
+				t.Fatal("resumed run returned incorrect exit code", got)
+			}
+
+			keys := map[string]string{}
+			for _, item := range publish.items {
+				keys[path.Base(item.WebURI)] = item.ObjectKey
+			}
+
+			// The journaled key of the unchanged file is used without
+			// checksumming it again.
+			if keys["one"] != journaledKey {
+				t.Errorf("unexpected key for 'one': %v", keys)
+			}
+
+			// A file without size and mtime is checksummed again.
+			if keys["two"] != "27dd8ed44a83ff94d557f9fd0412ed5a8cbca69ea04922d88c01184a07300a5a" {
+				t.Errorf("unexpected key for 'two': %v", keys)
+			}
+
+			// The tree is walked only if the first run didn't finish walking it.
+			if _, walked := keys["three"]; walked == complete {
+				t.Errorf("unexpected items: %v", keys)
+			}
+			if len(publish.items) != len(keys) {
+				t.Errorf("items added more than once: %v", publish.items)
+			}
+		})
+	}
+}
+
+func TestMainResumeNothingToResume(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetConfig(t, resumeConfig)
+	ctrl := MockController(t)
+	logs := CaptureLogger(t)
+
+	mockGw := gw.NewMockInterface(ctrl)
+	ext.gw = mockGw
+
+	client := FakeClient{blobs: make(map[string]string)}
+	mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(&client, nil)
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	got := Main([]string{"rsync", "--exodus-resume", srcPath + "/", "exodus:/some/target"})
+
+	// It should just carry on as a new run.
+	if got != 0 {
+		t.Error("returned incorrect exit code", got)
+	}
+	if len(client.publishes) != 1 || len(client.publishes[0].items) != 3 {
+		t.Errorf("unexpected publishes: %v", client.publishes)
+	}
+	if FindEntry(logs, "No interrupted run to resume") == nil {
+		t.Error("missing expected log message")
+	}
+}
+
+func TestMainResumeNotConfigured(t *testing.T) {
+	SetConfig(t, CONFIG)
+	MockController(t)
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "--exodus-resume", ".", "exodus:/some/target"})
+
+	if got != 23 {
+		t.Error("returned incorrect exit code", got)
+	}
+	if FindEntry(logs, "--exodus-resume requires 'journaldir' to be configured") == nil {
+		t.Error("missing expected log message")
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+)
+
+const REWRITE_CONFIG string = `
+environments:
+- prefix: legacy
+  gwenv: best-env
+  rewrite:
+  - prefix: /pub/mirror
+    replace: /content/dist
+  - regex: ^/pub/beta/([^/]+)/(.*)$
+    replace: /content/beta/$1/os/$2
+`
+
+func TestMainRewrite(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+REWRITE_CONFIG)
+
+	for _, dest := range []string{"legacy:/pub/mirror/X", "legacy:/pub/beta/X", "legacy:/pub/other"} {
+		if got := Main([]string{"rsync", srcPath + "/", dest}); got != 0 {
+			t.Fatalf("sync to %s returned %d", dest, got)
+		}
+	}
+
+	expected := map[string]string{}
+	for _, prefix := range []string{"/content/dist/X", "/content/beta/X/os", "/pub/other"} {
+		expected[prefix+"/hello-copy-one"] = helloKey
+		expected[prefix+"/hello-copy-two"] = helloKey
+		expected[prefix+"/subdir/some-binary"] = binaryKey
+	}
+	if published := publishedKeys(srv); !reflect.DeepEqual(published, expected) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainRewriteLinks(t *testing.T) {
+	srv, _ := setupGw(t)
+	SetConfig(t, srv.Config()+REWRITE_CONFIG)
+
+	srcPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcPath, "file"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../beta/X/file", filepath.Join(srcPath, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := Main([]string{"rsync", "-rl", srcPath + "/", "legacy:/pub/mirror/X"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// Link targets are rewritten in the same way as the links themselves.
+	expected := []gwtest.Item{
+		{WebURI: "/content/dist/X/file", ObjectKey: helloKey, ContentType: "text/plain; charset=utf-8"},
+		{WebURI: "/content/dist/X/link", LinkTo: "/content/beta/X/os/file"},
+	}
+	if published := srv.Published("best-env"); !reflect.DeepEqual(published, expected) {
+		t.Errorf("unexpected published content: %v", published)
+	}
+}
+
+func TestMainRewriteDelete(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+REWRITE_CONFIG)
+
+	srv.AddPublished("best-env",
+		gwtest.Item{WebURI: "/content/dist/X/old-file", ObjectKey: helloKey},
+		gwtest.Item{WebURI: "/pub/mirror/X/old-file", ObjectKey: helloKey},
+	)
+
+	// Deletions happen under the rewritten path.
+	if got := Main([]string{"rsync", "--delete", srcPath + "/", "legacy:/pub/mirror/X"}); got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	published := publishedKeys(srv)
+	if _, ok := published["/content/dist/X/old-file"]; ok {
+		t.Errorf("rewritten path not deleted: %v", published)
+	}
+	if _, ok := published["/pub/mirror/X/old-file"]; !ok {
+		t.Errorf("path outside of DEST deleted: %v", published)
+	}
+}
+
+func TestMainRewriteDeleteOutside(t *testing.T) {
+	srv, srcPath := setupGw(t)
+	SetConfig(t, srv.Config()+REWRITE_CONFIG)
+	logs := CaptureLogger(t)
+
+	srv.AddPublished("best-env", gwtest.Item{WebURI: "/pub/beta/old-file", ObjectKey: helloKey})
+
+	// Content under /pub/beta is moved elsewhere, so what's missing from the
+	// source can't be determined.
+	got := Main([]string{"rsync", "-r", "--delete", srcPath + "/", "legacy:/pub/beta"})
+	if got != 51 {
+		t.Errorf("sync returned %d", got)
+	}
+	if FindEntry(logs, "can't determine content to delete") == nil {
+		t.Error("missing expected log entry")
+	}
+	if _, ok := publishedKeys(srv)["/pub/beta/old-file"]; !ok {
+		t.Error("content was deleted")
+	}
+}
@@ -48,7 +48,7 @@ func TestMainExecRsync(t *testing.T) {
 
 	// Make it return an empty Config with no environments
 	mockConf.EXPECT().Load(gomock.Any(), gomock.Any()).Return(emptyConfig, nil)
-	emptyConfig.EXPECT().EnvironmentForDest(gomock.Any(), gomock.Any()).Return(nil)
+	emptyConfig.EXPECT().MatchEnvironment(gomock.Any(), gomock.Any()).Return(nil, nil)
 	emptyConfig.EXPECT().LogLevel().AnyTimes().Return("info")
 	emptyConfig.EXPECT().Logger().AnyTimes().Return("auto")
 	emptyConfig.EXPECT().Diag().AnyTimes().Return(false)
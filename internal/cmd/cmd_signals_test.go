@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/syncutil"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+	"go.uber.org/mock/gomock"
+)
+
+// Replaces signal handling for the duration of a test, returning a channel
+// through which signals can be delivered. Exiting fails the test.
+func FakeSignals(t *testing.T) func() chan<- os.Signal {
+	oldSignals := signals
+	t.Cleanup(func() { signals = oldSignals })
+
+	notified := make(chan chan<- os.Signal, 1)
+
+	signals.notify = func(ch chan<- os.Signal, _ ...os.Signal) { notified <- ch }
+	signals.stop = func(chan<- os.Signal) {}
+	signals.exit = func(code int) { t.Errorf("unexpectedly exited with %d", code) }
+
+	var ch chan<- os.Signal
+	return func() chan<- os.Signal {
+		if ch == nil {
+			ch = <-notified
+		}
+		return ch
+	}
+}
+
+// A client which is interrupted while uploading.
+type interruptedClient struct {
+	*singlePublishClient
+	signal func() chan<- os.Signal
+}
+
+func (c *interruptedClient) EnsureUploadedStream(ctx context.Context, items <-chan walk.SyncItem,
+	_ func(walk.SyncItem) error,
+	_ func(walk.SyncItem) error,
+	_ func(walk.SyncItem) error,
+) error {
+	c.signal() <- syscall.SIGINT
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHandleSignals(t *testing.T) {
+	signal := FakeSignals(t)
+
+	ctx, cancel := context.WithCancel(testContext())
+	defer cancel()
+
+	exited := make(chan int, 1)
+	signals.exit = func(code int) { exited <- code }
+
+	stop := handleSignals(ctx, cancel)
+
+	// First signal cancels the context.
+	signal() <- syscall.SIGTERM
+	<-ctx.Done()
+
+	// Cleanup can proceed after that...
+	cleanupCtx, cleanupCancel := syncutil.CleanupContext(ctx, time.Hour)
+	defer cleanupCancel()
+	if cleanupCtx.Err() != nil {
+		t.Error("cleanup context unexpectedly cancelled")
+	}
+
+	// ...until a second signal exits immediately.
+	signal() <- syscall.SIGINT
+	if code := <-exited; code != interruptedExitCode {
+		t.Errorf("exited with %d", code)
+	}
+
+	if !stop() {
+		t.Error("not reported as interrupted")
+	}
+}
+
+func TestHandleSignalsNotInterrupted(t *testing.T) {
+	FakeSignals(t)
+
+	ctx, cancel := context.WithCancel(testContext())
+	defer cancel()
+
+	stop := handleSignals(ctx, cancel)
+
+	if stop() {
+		t.Error("unexpectedly reported as interrupted")
+	}
+	if ctx.Err() != nil {
+		t.Error("context unexpectedly cancelled")
+	}
+}
+
+func TestMainInterrupted(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srcPath := path.Clean(wd + "/../../test/data/srctrees/just-files")
+
+	tests := []struct {
+		name            string
+		config          string
+		extraArgs       []string
+		expectAbandoned int
+		expectLog       string
+	}{
+		{"created publish", CONFIG, nil, 1, "Interrupted, cleaning up (interrupt again to exit immediately)"},
+
+		{"joined publish", CONFIG, []string{"--exodus-publish", "3e0a4539-be4a-437e-a45f-6d72f7192f17"}, 0, ""},
+
+		{"resumable publish", resumeConfig, nil, 0, "Leaving publish open so the run can be resumed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetConfig(t, tt.config)
+			ctrl := MockController(t)
+			logs := CaptureLogger(t)
+			signal := FakeSignals(t)
+
+			mockGw := gw.NewMockInterface(ctrl)
+			ext.gw = mockGw
+
+			publish := &FakePublish{id: "3e0a4539-be4a-437e-a45f-6d72f7192f17"}
+			client := &interruptedClient{
+				singlePublishClient: &singlePublishClient{
+					FakeClient: &FakeClient{blobs: make(map[string]string)},
+					publish:    publish,
+				},
+				signal: signal,
+			}
+			mockGw.EXPECT().NewClient(gomock.Any(), EnvMatcher{"best-env"}).Return(client, nil)
+
+			args := []string{"rsync"}
+			args = append(args, tt.extraArgs...)
+			args = append(args, srcPath+"/", "exodus:/some/target")
+
+			if got := Main(args); got != interruptedExitCode {
+				t.Error("returned incorrect exit code", got)
+			}
+
+			if publish.committed != 0 {
+				t.Error("publish was committed")
+			}
+			if publish.abandoned != tt.expectAbandoned {
+				t.Errorf("publish abandoned %d time(s)", publish.abandoned)
+			}
+			if tt.expectLog != "" && FindEntry(logs, tt.expectLog) == nil {
+				t.Error("missing expected log message")
+			}
+		})
+	}
+}
+
+func TestCleanupInterruptedAbandonFails(t *testing.T) {
+	logs := CaptureLogger(t)
+
+	cleanupInterrupted(testContext(), &BrokenPublish{id: "some-publish"}, true, nil)
+
+	if FindEntry(logs, "Can't abandon publish, it remains open") == nil {
+		t.Error("missing expected log message")
+	}
+}
+
+func TestCleanupInterruptedAbandonUnsupported(t *testing.T) {
+	logs := CaptureLogger(t)
+	ctrl := MockController(t)
+
+	publish := gw.NewMockPublish(ctrl)
+	publish.EXPECT().ID().Return("some-publish").AnyTimes()
+	publish.EXPECT().Abandon(gomock.Any()).Return(gw.ErrAbandonUnsupported)
+
+	cleanupInterrupted(testContext(), publish, true, nil)
+
+	if FindEntry(logs, "exodus-gw does not support abandoning publishes, it remains open") == nil {
+		t.Error("missing expected log message")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/release-engineering/exodus-rsync/internal/conf"
@@ -52,11 +53,13 @@ func (m EnvMatcher) String() string {
 type FakeClient struct {
 	blobs     map[string]string
 	publishes []FakePublish
+	published []gw.ItemInput
 }
 
 type FakePublish struct {
 	items       []gw.ItemInput
 	committed   int
+	abandoned   int
 	commitmodes []string
 	frozen      bool
 	id          string
@@ -66,6 +69,18 @@ type BrokenPublish struct {
 	id string
 }
 
+type FakeTask struct {
+	id string
+}
+
+func (t *FakeTask) ID() string {
+	return t.id
+}
+
+func (t *FakeTask) Await(ctx context.Context) error {
+	return ctx.Err()
+}
+
 func (c *FakeClient) EnsureUploaded(ctx context.Context, items []walk.SyncItem,
 	onUploaded func(walk.SyncItem) error,
 	onExisting func(walk.SyncItem) error,
@@ -91,6 +106,18 @@ func (c *FakeClient) EnsureUploaded(ctx context.Context, items []walk.SyncItem,
 	return nil
 }
 
+func (c *FakeClient) EnsureUploadedStream(ctx context.Context, items <-chan walk.SyncItem,
+	onUploaded func(walk.SyncItem) error,
+	onExisting func(walk.SyncItem) error,
+	onDuplicate func(walk.SyncItem) error,
+) error {
+	var all []walk.SyncItem
+	for item := range items {
+		all = append(all, item)
+	}
+	return c.EnsureUploaded(ctx, all, onUploaded, onExisting, onDuplicate)
+}
+
 func (c *FakeClient) NewPublish(ctx context.Context) (gw.Publish, error) {
 	c.publishes = append(c.publishes, FakePublish{id: "3e0a4539-be4a-437e-a45f-6d72f7192f17"})
 	return &c.publishes[len(c.publishes)-1], nil
@@ -106,6 +133,21 @@ func (c *FakeClient) GetPublish(ctx context.Context, id string) (gw.Publish, err
 	return nil, fmt.Errorf("publish not found: '%s'", id)
 }
 
+func (c *FakeClient) ListPublished(ctx context.Context, prefix string, fn func(gw.ItemInput) error) error {
+	for _, item := range c.published {
+		if strings.HasPrefix(item.WebURI, prefix) {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *FakeClient) GetTask(ctx context.Context, id string) (gw.Task, error) {
+	return &FakeTask{id: id}, nil
+}
+
 func (c *FakeClient) WhoAmI(context.Context) (map[string]interface{}, error) {
 	out := make(map[string]interface{})
 	out["whoami"] = "fake-info"
@@ -137,10 +179,55 @@ func (p *FakePublish) Commit(ctx context.Context, mode string) error {
 	return nil
 }
 
+func (p *BrokenPublish) StartCommit(_ context.Context, _ string) (gw.Task, error) {
+	return nil, fmt.Errorf("invalid publish")
+}
+
+func (p *FakePublish) StartCommit(ctx context.Context, mode string) (gw.Task, error) {
+	p.commitmodes = append(p.commitmodes, mode)
+	return &FakeTask{id: "c1a4ba3a-94e6-4e3e-8d0b-3b5c1d2b6f11"}, nil
+}
+
+func (p *BrokenPublish) Abandon(_ context.Context) error {
+	return fmt.Errorf("invalid publish")
+}
+
+func (p *FakePublish) Abandon(ctx context.Context) error {
+	p.abandoned++
+	return nil
+}
+
 func (p *FakePublish) ID() string {
 	return p.id
 }
 
+func (p *FakePublish) State() string {
+	if p.frozen {
+		return "COMMITTED"
+	}
+	if p.abandoned > 0 {
+		return "FAILED"
+	}
+	return "PENDING"
+}
+
+func (p *BrokenPublish) State() string {
+	return "PENDING"
+}
+
+func (p *FakePublish) ListItems(ctx context.Context, fn func(gw.ItemInput) error) error {
+	for _, item := range p.items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *BrokenPublish) ListItems(_ context.Context, _ func(gw.ItemInput) error) error {
+	return fmt.Errorf("invalid publish")
+}
+
 func (p *BrokenPublish) ID() string {
 	return p.id
 }
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+)
+
+// cdnStandIn serves content published to a fake exodus-gw, as the CDN would.
+type cdnStandIn struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	requests []string
+
+	// Content served instead of the published content, by web URI.
+	override map[string]string
+
+	// Web URIs which are not served at all.
+	missing map[string]bool
+}
+
+func newCDNStandIn(t *testing.T, srv *gwtest.Server) *cdnStandIn {
+	cdn := &cdnStandIn{override: make(map[string]string), missing: make(map[string]bool)}
+
+	cdn.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdn.mutex.Lock()
+		cdn.requests = append(cdn.requests, r.URL.Path)
+		override, overridden := cdn.override[r.URL.Path]
+		missing := cdn.missing[r.URL.Path]
+		cdn.mutex.Unlock()
+
+		if missing {
+			http.NotFound(w, r)
+			return
+		}
+
+		if overridden {
+			w.Write([]byte(override))
+			return
+		}
+
+		for _, item := range srv.Published("best-env") {
+			if item.WebURI != r.URL.Path {
+				continue
+			}
+			if item.LinkTo != "" {
+				http.Redirect(w, r, item.LinkTo, http.StatusFound)
+				return
+			}
+			if blob, ok := srv.Blob("best-env", item.ObjectKey); ok {
+				w.Write(blob)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(cdn.Close)
+
+	return cdn
+}
+
+func (c *cdnStandIn) Requests() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]string{}, c.requests...)
+}
+
+// Sets up a fake exodus-gw and a CDN serving its content, with config
+// enabling verification.
+func setupVerify(t *testing.T, extraConfig string) (*gwtest.Server, *cdnStandIn, string) {
+	srv, srcPath := setupGw(t)
+	cdn := newCDNStandIn(t, srv)
+	SetConfig(t, "cdnurl: "+cdn.URL+"/\n"+extraConfig+srv.Config()+CONFIG)
+	return srv, cdn, srcPath
+}
+
+func TestMainVerify(t *testing.T) {
+	_, cdn, srcPath := setupVerify(t, "")
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "-v", "--exodus-verify", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	entry := FindEntry(logs, "Verified published content")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	if entry.Fields["checked"] != 3 || entry.Fields["failed"] != 0 {
+		t.Errorf("unexpected log fields: %v", entry.Fields)
+	}
+	if requests := cdn.Requests(); len(requests) != 3 {
+		t.Errorf("unexpected requests: %v", requests)
+	}
+}
+
+func TestMainVerifyMismatch(t *testing.T) {
+	_, cdn, srcPath := setupVerify(t, "")
+	logs := CaptureLogger(t)
+
+	cdn.override["/dest/hello-copy-two"] = "stale content"
+
+	got := Main([]string{"rsync", "--exodus-verify", srcPath + "/", "exodus:/dest"})
+	if got != 77 {
+		t.Errorf("sync returned %d", got)
+	}
+
+	entry := FindEntry(logs, "Published content failed verification")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	if entry.Fields["uri"] != "/dest/hello-copy-two" {
+		t.Errorf("unexpected log fields: %v", entry.Fields)
+	}
+	if FindEntry(logs, "published content failed verification") == nil {
+		t.Error("missing expected log entry")
+	}
+}
+
+func TestMainVerifyMissing(t *testing.T) {
+	_, cdn, srcPath := setupVerify(t, "")
+	logs := CaptureLogger(t)
+
+	cdn.missing["/dest/subdir/some-binary"] = true
+
+	got := Main([]string{"rsync", "--exodus-verify", srcPath + "/", "exodus:/dest"})
+	if got != 77 {
+		t.Errorf("sync returned %d", got)
+	}
+
+	entry := FindEntry(logs, "Published content failed verification")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	if err, _ := entry.Fields["error"].(error); err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("unexpected log fields: %v", entry.Fields)
+	}
+}
+
+func TestMainVerifyLinks(t *testing.T) {
+	srv, cdn, _ := setupVerify(t, "")
+
+	srcPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcPath, "file"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"link": "file", "outside": "../other/file"} {
+		if err := os.Symlink(target, filepath.Join(srcPath, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Target of a link which isn't part of the sync.
+	srv.AddPublished("best-env", gwtest.Item{WebURI: "/other/file", ObjectKey: srv.AddBlob("best-env", []byte("other\n"))})
+
+	got := Main([]string{"rsync", "-rl", "--exodus-verify", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	// A link serving the wrong content fails verification.
+	logs := CaptureLogger(t)
+	cdn.override["/dest/outside"] = "hello\n"
+
+	got = Main([]string{"rsync", "-rl", "--exodus-verify", srcPath + "/", "exodus:/dest"})
+	if got != 77 {
+		t.Errorf("sync returned %d", got)
+	}
+	entry := FindEntry(logs, "Published content failed verification")
+	if entry == nil {
+		t.Fatal("missing expected log entry")
+	}
+	if entry.Fields["uri"] != "/dest/outside" {
+		t.Errorf("unexpected log fields: %v", entry.Fields)
+	}
+}
+
+func TestMainVerifySample(t *testing.T) {
+	_, cdn, srcPath := setupVerify(t, "verifysample: 1\n")
+
+	got := Main([]string{"rsync", "--exodus-verify", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	if requests := cdn.Requests(); len(requests) != 1 {
+		t.Errorf("unexpected requests: %v", requests)
+	}
+}
+
+func TestMainVerifyDryRun(t *testing.T) {
+	_, cdn, srcPath := setupVerify(t, "")
+	logs := CaptureLogger(t)
+
+	got := Main([]string{"rsync", "-n", "--exodus-verify", srcPath + "/", "exodus:/dest"})
+	if got != 0 {
+		t.Fatalf("sync returned %d", got)
+	}
+
+	if FindEntry(logs, "Would verify published content") == nil {
+		t.Error("missing expected log entry")
+	}
+	if requests := cdn.Requests(); len(requests) != 0 {
+		t.Errorf("unexpected requests: %v", requests)
+	}
+}
+
+func TestMainVerifyInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		message string
+	}{
+		{"no cdnurl", "", nil, "--exodus-verify requires 'cdnurl' to be configured"},
+		{"no wait", "cdnurl: https://cdn.example.com\n", []string{"--exodus-no-wait"},
+			"--exodus-verify requires waiting for the publish to be committed"},
+		{"no commit", "cdnurl: https://cdn.example.com\n", []string{"--exodus-commit", "none"},
+			"--exodus-verify requires waiting for the publish to be committed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, srcPath := setupGw(t)
+			SetConfig(t, tt.config+srv.Config()+CONFIG)
+			logs := CaptureLogger(t)
+
+			rawArgs := append([]string{"rsync", "--exodus-verify"}, tt.args...)
+			got := Main(append(rawArgs, srcPath+"/", "exodus:/dest"))
+			if got != 23 {
+				t.Errorf("returned %d", got)
+			}
+			if FindEntry(logs, tt.message) == nil {
+				t.Error("missing expected log entry")
+			}
+			if publishes := srv.Publishes(); len(publishes) != 0 {
+				t.Errorf("unexpected publishes: %v", publishes)
+			}
+		})
+	}
+}
+
+func TestVerifySample(t *testing.T) {
+	all := &verifySample{}
+	for _, uri := range []string{"/c", "/a", "/b"} {
+		all.add(gw.ItemInput{WebURI: uri})
+	}
+	if items := all.sorted(); len(items) != 3 || items[0].WebURI != "/a" || items[2].WebURI != "/c" {
+		t.Errorf("unexpected items: %v", items)
+	}
+
+	// Only size items are held, however many are added.
+	some := &verifySample{size: 2}
+	for i := 0; i < 100; i++ {
+		some.add(gw.ItemInput{WebURI: fmt.Sprintf("/%03d", i)})
+	}
+	if some.seen != 100 || len(some.items) != 2 {
+		t.Errorf("unexpected sample: seen %d, items %v", some.seen, some.items)
+	}
+	if items := some.sorted(); items[0].WebURI >= items[1].WebURI {
+		t.Errorf("unexpected items: %v", items)
+	}
+
+	more := &verifySample{size: 10}
+	more.add(gw.ItemInput{WebURI: "/a"})
+	if len(more.items) != 1 {
+		t.Errorf("unexpected items: %v", more.items)
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// contentTypeEntry describes the effective content type of a single item, for
+// --exodus-content-type-report.
+type contentTypeEntry struct {
+	WebURI      string `json:"web_uri"`
+	ContentType string `json:"content_type"`
+
+	// Where the content type came from: "rule", "manifest" or "detected".
+	Source string `json:"source"`
+
+	// Pattern of the rule setting the content type, if any.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// writeContentTypes writes entries to stdout, either as a line per item or as JSON.
+func writeContentTypes(entries []contentTypeEntry, format string) error {
+	if format == "json" {
+		return json.NewEncoder(ext.stdout).Encode(entries)
+	}
+
+	for _, entry := range entries {
+		source := entry.Source
+		if entry.Pattern != "" {
+			source += " " + entry.Pattern
+		}
+		if _, err := fmt.Fprintf(ext.stdout, "%s\t%s\t%s\n", entry.WebURI, entry.ContentType, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runContentTypeReport writes the content type which would be published for
+// every file in the source tree, without publishing anything.
+func runContentTypeReport(
+	ctx context.Context,
+	cfg conf.Config,
+	args args.Config,
+	destTree string,
+	srcIsDir bool,
+	walkSrc walkFunc,
+) int {
+	logger := log.FromContext(ctx)
+	rules := cfg.ContentTypes()
+
+	entries := []contentTypeEntry{}
+	err := walkSrc(ctx, func(item walk.SyncItem) error {
+		input := itemInput(ctx, cfg, item, args.Src, destTree, srcIsDir)
+		if input.LinkTo != "" {
+			// Links are published without a content type.
+			return nil
+		}
+
+		entry := contentTypeEntry{WebURI: input.WebURI, ContentType: input.ContentType, Source: "detected"}
+		if item.ContentType != "" {
+			entry.Source = "manifest"
+		} else if _, rule := rules.Match(input.WebURI); rule != nil {
+			entry.Source = "rule"
+			entry.Pattern = rule.PatternRaw
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		logger.F("src", args.Src, "error", err).Error("can't read files for sync")
+		return 73
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].WebURI < entries[j].WebURI })
+
+	if err := writeContentTypes(entries, args.Output); err != nil {
+		logger.F("error", err).Error("can't write content type report")
+		return 11
+	}
+
+	logger.F("items", len(entries)).Info("Completed content type report, nothing was published")
+	return 0
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/filter"
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// srcRootURI returns the web URI corresponding to the top of the source
+// directory tree, following the same rules as webURI.
+func srcRootURI(srcTree string, destTree string) string {
+	if srcTree != "." && !strings.HasSuffix(srcTree, "/") {
+		return path.Join(destTree, filepath.Base(srcTree))
+	}
+	return path.Join(destTree)
+}
+
+// errListingChecked stops listing published content once it's known to work.
+var errListingChecked = errors.New("listing checked")
+
+// checkCanDelete checks that content published under rootURI can be listed,
+// as needed to determine content to delete, by fetching the first item.
+//
+// This is done before anything is uploaded or published, so that a run with
+// --delete against an exodus-gw without support for it fails early.
+func checkCanDelete(ctx context.Context, client gw.Client, rootURI string) error {
+	prefix := strings.TrimSuffix(rootURI, "/") + "/"
+
+	err := client.ListPublished(ctx, prefix, func(gw.ItemInput) error {
+		return errListingChecked
+	})
+	if errors.Is(err, errListingChecked) {
+		return nil
+	}
+	return err
+}
+
+// findDeletions returns items deleting every path published under rootURI
+// which is not present in srcURIs, as with rsync --delete.
+//
+// Like rsync, paths excluded by filter rules are protected from deletion.
+// If rewrite rules have moved any source path outside of rootURI, deletions
+// can't be determined safely and an error is returned.
+func findDeletions(
+	ctx context.Context,
+	client gw.Client,
+	args args.Config,
+	rootURI string,
+	srcURIs map[string]struct{},
+) ([]gw.ItemInput, error) {
+	logger := log.FromContext(ctx)
+
+	prefix := strings.TrimSuffix(rootURI, "/") + "/"
+
+	for uri := range srcURIs {
+		if !strings.HasPrefix(uri, prefix) && uri != rootURI {
+			return nil, fmt.Errorf("%s is outside of %s, can't determine content to delete", uri, rootURI)
+		}
+	}
+
+	msg := "Deleting"
+	if args.DryRun || args.Plan {
+		msg = "Would delete"
+	}
+
+	rules, err := walk.NewFilter(args, filter.Receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []gw.ItemInput
+
+	err = client.ListPublished(ctx, prefix, func(item gw.ItemInput) error {
+		if item.ObjectKey == gw.AbsentObjectKey || !strings.HasPrefix(item.WebURI, prefix) {
+			return nil
+		}
+
+		if _, ok := srcURIs[item.WebURI]; ok {
+			return nil
+		}
+
+		excluded, err := rules.Excluded(ctx, strings.TrimPrefix(item.WebURI, prefix))
+		if err != nil {
+			return err
+		}
+		if excluded {
+			logger.F("uri", item.WebURI).Debug("Not deleting excluded path")
+			return nil
+		}
+
+		logger.F("uri", item.WebURI).Info(msg)
+		out = append(out, gw.ItemInput{WebURI: item.WebURI, ObjectKey: gw.AbsentObjectKey})
+		return nil
+	})
+
+	return out, err
+}
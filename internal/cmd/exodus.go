@@ -1,8 +1,8 @@
 package cmd
 
 import (
-	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -13,7 +13,10 @@ import (
 	"github.com/release-engineering/exodus-rsync/internal/args"
 	"github.com/release-engineering/exodus-rsync/internal/conf"
 	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/hashcache"
+	"github.com/release-engineering/exodus-rsync/internal/journal"
 	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
 	"github.com/release-engineering/exodus-rsync/internal/walk"
 )
 
@@ -80,9 +83,140 @@ func commitMode(cfg conf.Config, args args.Config) (bool, string) {
 	return true, mode
 }
 
+// openHashCache returns the checksum cache to be used for the current run,
+// or nil if the cache is disabled or can't be used.
+func openHashCache(ctx context.Context, cfg conf.Config, args args.Config) *hashcache.Cache {
+	logger := log.FromContext(ctx)
+
+	path := cfg.HashCache()
+	if path == "" || args.HashCache == "bypass" {
+		return nil
+	}
+
+	cache, err := hashcache.Open(path, cfg.HashCacheSize(), args.HashCache == "rebuild")
+	if err != nil {
+		// The cache is only an optimization, so carry on without it.
+		logger.F("path", path, "error", err).Warn("Can't open checksum cache")
+		return nil
+	}
+
+	logger.F("path", path, "entries", cache.Len()).Debug("Opened checksum cache")
+
+	return cache
+}
+
+// itemInput converts a sync item into an item for publish. Calculated web URIs
+// and link targets are rewritten by the rules in cfg.
+func itemInput(
+	ctx context.Context,
+	cfg conf.Config,
+	item walk.SyncItem,
+	srcTree string,
+	destTree string,
+	srcIsDir bool,
+) gw.ItemInput {
+	gwItem := itemTarget(cfg, item, srcTree, destTree, srcIsDir)
+
+	if gwItem.LinkTo == "" {
+		// The content type may be given along with the destination, e.g. via
+		// --exodus-from-manifest.
+		if item.WebURI != "" {
+			gwItem.ContentType = item.ContentType
+		}
+		if gwItem.ContentType == "" {
+			gwItem.ContentType = contentType(ctx, cfg, gwItem.WebURI, item.SrcPath)
+		}
+	}
+
+	return gwItem
+}
+
+// itemTarget is like itemInput, but leaves the content type unset, for use
+// where it isn't needed as detecting it means reading the file.
+func itemTarget(
+	cfg conf.Config,
+	item walk.SyncItem,
+	srcTree string,
+	destTree string,
+	srcIsDir bool,
+) gw.ItemInput {
+	if item.WebURI != "" {
+		// Destination was given explicitly, e.g. via --exodus-from-manifest.
+		gwItem := gw.ItemInput{WebURI: item.WebURI, LinkTo: item.LinkTo}
+		if item.LinkTo == "" {
+			gwItem.ObjectKey = item.Key
+		}
+		return gwItem
+	}
+
+	rewrite := cfg.Rewrite()
+	gwItem := gw.ItemInput{WebURI: rewrite.Apply(webURI(item.SrcPath, srcTree, destTree, srcIsDir))}
+
+	if item.LinkTo != "" {
+		linkSrcDirRelative := path.Dir(getRelPath(item.SrcPath, srcTree))
+		linkSrcDirFull := path.Join(destTree, linkSrcDirRelative)
+		gwItem.LinkTo = rewrite.Apply(path.Join(linkSrcDirFull, "/", item.LinkTo))
+	} else {
+		gwItem.ObjectKey = item.Key
+	}
+
+	return gwItem
+}
+
+// contentType returns the content type of a file published at uri, from the
+// first matching rule in cfg, or else detected from the file at path.
+func contentType(ctx context.Context, cfg conf.Config, uri string, path string) string {
+	if ctype, _ := cfg.ContentTypes().Match(uri); ctype != "" {
+		return ctype
+	}
+	return detectContentType(ctx, path)
+}
+
+// detectContentType returns the MIME type of the file at path.
+func detectContentType(ctx context.Context, path string) string {
+	logger := log.FromContext(ctx)
+
+	// mimetype will return "application/octet-stream" type if it
+	// can't make a determination or encounters an error.
+	mtype, err := mimetype.DetectFile(path)
+	logger.F(
+		"file", path,
+		"MIME type", mtype.String(),
+		"error", err,
+	).Debug("MIME type detection attempted")
+
+	return mtype.String()
+}
+
 func exodusMain(ctx context.Context, cfg conf.Config, args args.Config) int {
 	logger := log.FromContext(ctx)
 
+	if args.Delete && args.FilesFrom != "" {
+		logger.Error("--delete is not supported with --files-from")
+		return 23
+	}
+
+	if args.FromManifest != "" && (args.FilesFrom != "" || args.Delete) {
+		logger.Error("--exodus-from-manifest is not supported with --files-from or --delete")
+		return 23
+	}
+
+	if args.Resume && cfg.JournalDir() == "" {
+		logger.Error("--exodus-resume requires 'journaldir' to be configured")
+		return 23
+	}
+
+	if args.Verify && !args.Plan {
+		if cfg.CDNURL() == "" {
+			logger.Error("--exodus-verify requires 'cdnurl' to be configured")
+			return 23
+		}
+		if shouldCommit, _ := commitMode(cfg, args); !shouldCommit || args.NoWait {
+			logger.Error("--exodus-verify requires waiting for the publish to be committed")
+			return 23
+		}
+	}
+
 	clientCtor := ext.gw.NewClient
 	if args.DryRun {
 		clientCtor = ext.gw.NewDryRunClient
@@ -93,10 +227,7 @@ func exodusMain(ctx context.Context, cfg conf.Config, args args.Config) int {
 		return 101
 	}
 
-	var (
-		onlyThese []string
-		items     []walk.SyncItem
-	)
+	var onlyThese []string
 
 	if args.FilesFrom != "" {
 		args.Relative = true
@@ -107,17 +238,15 @@ func exodusMain(ctx context.Context, cfg conf.Config, args args.Config) int {
 			args.Src += "/"
 		}
 
-		f, err := os.Open(args.FilesFrom)
+		names, err := args.ReadFilesFrom()
 		if err != nil {
 			logger.F("src", args.Src, "error", err).Error("can't read --files-from file")
 			return 73
 		}
-		defer f.Close()
 
-		scanner := bufio.NewScanner(f)
-		for scanner.Scan() {
-			path := filepath.Join(args.Src, strings.TrimSpace(scanner.Text()))
-			onlyThese = append(onlyThese, path)
+		onlyThese = make([]string, 0, len(names))
+		for _, name := range names {
+			onlyThese = append(onlyThese, filepath.Join(args.Src, name))
 		}
 	}
 
@@ -128,41 +257,108 @@ func exodusMain(ctx context.Context, cfg conf.Config, args args.Config) int {
 	}
 	srcIsDir := fileStat.IsDir()
 
-	logger.Info("Walking directory tree")
-	err = walk.Walk(ctx, args, onlyThese, func(item walk.SyncItem) error {
-		if args.IgnoreExisting {
-			// This argument is not (properly) supported, so bail out.
-			//
-			// We only check the argument here (after we've found an item) because we want
-			// the argument to be accepted if we're running over a directory tree with no
-			// files.
-			//
-			// The story with this is that some tools use an approach somewhat like this
-			// to implement a "remote mkdir":
-			//
-			//   mkdir empty
-			//   rsync --ignore-existing empty host:/dest/some/dir/which/should/be/created
-			//
-			// Since directories don't actually exist in exodus and there is no need to
-			// create a directory before writing to a particular path, this should be a
-			// no-op which successfully does nothing.  But any *other* attempted usage of
-			// --ignore-existing would be dangerous to ignore, as we can't actually deliver
-			// the requested semantics, so make it an error.
-			return fmt.Errorf("--ignore-existing is not supported")
+	var fromManifest *manifest.Manifest
+	if args.FromManifest != "" {
+		if !srcIsDir {
+			logger.F("src", args.Src).Error("SRC must be a directory when using --exodus-from-manifest")
+			return 23
+		}
+
+		fromManifest, err = manifest.Read(args.FromManifest)
+		if err != nil {
+			logger.F("error", err).Error("can't read --exodus-from-manifest file")
+			return 73
+		}
+	}
+
+	strip := cfg.Strip()
+	destTree := cleanDestTree(args.DestPath(), strip)
+
+	walkSrc := func(ctx context.Context, handler walk.SyncItemHandler) error {
+		cache := openHashCache(ctx, cfg, args)
+		if cache != nil {
+			ctx = hashcache.NewContext(ctx, cache)
+
+			defer func() {
+				if err := cache.Save(); err != nil {
+					logger.F("path", cache.Path(), "error", err).Warn("Can't save checksum cache")
+				}
+			}()
+		}
+
+		handleItem := func(item walk.SyncItem) error {
+			if args.IgnoreExisting {
+				// This argument is not (properly) supported, so bail out.
+				//
+				// We only check the argument here (after we've found an item) because we want
+				// the argument to be accepted if we're running over a directory tree with no
+				// files.
+				//
+				// The story with this is that some tools use an approach somewhat like this
+				// to implement a "remote mkdir":
+				//
+				//   mkdir empty
+				//   rsync --ignore-existing empty host:/dest/some/dir/which/should/be/created
+				//
+				// Since directories don't actually exist in exodus and there is no need to
+				// create a directory before writing to a particular path, this should be a
+				// no-op which successfully does nothing.  But any *other* attempted usage of
+				// --ignore-existing would be dangerous to ignore, as we can't actually deliver
+				// the requested semantics, so make it an error.
+				return fmt.Errorf("--ignore-existing is not supported")
+			}
+			return handler(item)
+		}
+
+		if fromManifest != nil {
+			logger.F("path", args.FromManifest, "items", len(fromManifest.Items)).Info("Reading items from manifest")
+			return walkManifest(ctx, fromManifest, args.Src, handleItem)
+		}
+
+		logger.Info("Walking directory tree")
+		return walk.Walk(ctx, args, onlyThese, handleItem)
+	}
+
+	if args.ContentTypeReport {
+		return runContentTypeReport(ctx, cfg, args, destTree, srcIsDir, walkSrc)
+	}
+
+	if args.Plan {
+		return runPlan(ctx, gwClient, cfg, args, destTree, srcIsDir, walkSrc)
+	}
+
+	if args.Delete && srcIsDir {
+		if err := checkCanDelete(ctx, gwClient, cfg.Rewrite().Apply(srcRootURI(args.Src, destTree))); err != nil {
+			if errors.Is(err, gw.ErrListUnsupported) {
+				logger.F("error", err).Error("--delete is not supported by this exodus-gw")
+			} else {
+				logger.F("error", err).Error("can't determine content to delete")
+			}
+			return 51
 		}
-		items = append(items, item)
-		return nil
-	})
-	if err != nil {
-		logger.F("src", args.Src, "error", err).Error("can't read files for sync")
-		return 73
 	}
 
 	var publish gw.Publish
+	var runJournal *journal.Journal
 
-	logger.F("items", len(items)).Info("Preparing to publish items")
+	jPath := journalPath(cfg, args)
+	if args.Resume && jPath != "" {
+		runJournal = loadJournal(ctx, jPath)
+	}
 
-	if args.Publish == "" {
+	if runJournal != nil {
+		// Resuming an interrupted run, so continue with the same publish.
+		publish, err = gwClient.GetPublish(ctx, runJournal.PublishID())
+		if err != nil {
+			logger.F("publish", runJournal.PublishID(), "error", err).Error("can't join publish of interrupted run")
+			return 67
+		}
+		if err = runJournal.Continue(); err != nil {
+			logger.F("path", runJournal.Path(), "error", err).Warn(
+				"Can't write run journal, this run will not be resumable")
+		}
+		logger.F("publish", publish.ID(), "created", runJournal.Created()).Info("Resuming interrupted run")
+	} else if args.Publish == "" {
 		// No publish provided, then create a new one.
 		publish, err = gwClient.NewPublish(ctx)
 		if err != nil {
@@ -179,79 +375,165 @@ func exodusMain(ctx context.Context, cfg conf.Config, args args.Config) int {
 		logger.F("publish", publish.ID()).Info("Joining publish")
 	}
 
-	logger.F("items", len(items)).Info("Preparing to upload items")
+	if runJournal == nil && jPath != "" {
+		runJournal = createJournal(ctx, jPath, publish.ID(), args.Publish == "")
+	}
 
-	uploadCount := 0
-	existingCount := 0
-	duplicateCount := 0
+	completed := false
+	defer func() { finishJournal(ctx, runJournal, completed) }()
 
-	err = gwClient.EnsureUploaded(ctx, items,
-		func(uploadedItem walk.SyncItem) error {
-			uploadCount++
-			return nil
-		},
-		func(existingItem walk.SyncItem) error {
-			existingCount++
-			return nil
-		},
-		func(duplicateItem walk.SyncItem) error {
-			duplicateCount++
-			return nil
-		},
-	)
+	created := runJournal.Created() || (runJournal == nil && args.Publish == "")
+	defer func() {
+		if !completed && ctx.Err() != nil {
+			cleanupInterrupted(ctx, publish, created, runJournal)
+		}
+	}()
 
-	if err != nil {
-		logger.F("error", err).Error("can't upload files")
-		return 25
+	// Web URIs of all items from the source, if needed for --delete.
+	var srcURIs map[string]struct{}
+	if args.Delete {
+		srcURIs = make(map[string]struct{})
 	}
 
-	logger.F("uploaded", uploadCount, "existing", existingCount, "duplicate", duplicateCount).Info("Completed uploads")
+	pipeline := publishPipeline{
+		client:    gwClient,
+		publish:   publish,
+		batchSize: cfg.GwBatchSize(),
+		journal:   runJournal,
+		toInput: func(item walk.SyncItem) gw.ItemInput {
+			out := itemInput(ctx, cfg, item, args.Src, destTree, srcIsDir)
+			if srcURIs != nil {
+				srcURIs[out.WebURI] = struct{}{}
+			}
+			return out
+		},
+	}
 
-	publishItems := []gw.ItemInput{}
+	// Output for --itemize-changes and --stats, naming items as published.
+	report := newTransferReport(ext.stdout, args.ItemizeChanges, args.Stats, cfg.Rewrite().Apply(destTree))
 
-	strip := cfg.Strip()
-	destTree := cleanDestTree(args.DestPath(), strip)
+	if args.ShowProgress() {
+		pipeline.progress = newUploadProgress(ctx, ext.stdout, args.DryRun)
+	}
 
-	for _, item := range items {
-		gwItem := gw.ItemInput{WebURI: webURI(item.SrcPath, args.Src, destTree, srcIsDir)}
-
-		if item.LinkTo != "" {
-			linkSrcDirRelative := path.Dir(getRelPath(item.SrcPath, args.Src))
-			linkSrcDirFull := path.Join(destTree, linkSrcDirRelative)
-			gwItem.LinkTo = path.Join(linkSrcDirFull, "/", item.LinkTo)
-		} else {
-			// Try to detect MIME type of file.
-			// mimetype will return "application/octet-stream" type if it
-			// can't make a determination or encounters an error.
-			mtype, err := mimetype.DetectFile(item.SrcPath)
-			logger.F(
-				"file", item.SrcPath,
-				"MIME type", mtype.String(),
-				"error", err,
-			).Debug("MIME type detection attempted")
+	// Record of everything published, if requested.
+	var published *manifest.Manifest
+	if args.ManifestOut != "" {
+		published = &manifest.Manifest{PublishID: publish.ID(), Env: cfg.GwEnv()}
+	}
 
-			gwItem.ObjectKey = item.Key
-			gwItem.ContentType = mtype.String()
+	// Sample of everything published, if it should be verified after commit.
+	toVerify := &verifySample{size: cfg.VerifySample()}
+
+	pipeline.onAdded = func(item walk.SyncItem, input gw.ItemInput, outcome manifest.Outcome) {
+		report.added(item, input, outcome)
+		if args.Verify {
+			toVerify.add(input)
+		}
+		if published != nil {
+			published.Add(manifestEntry(item, input, outcome))
 		}
+	}
+
+	logger.F("publish", publish.ID()).Info("Preparing to upload and publish items")
 
-		publishItems = append(publishItems, gwItem)
+	// Items from a manifest are cheap to read again, so only walks of the
+	// source tree are journaled.
+	walkFn := walkSrc
+	if fromManifest == nil {
+		walkFn = pipeline.journaledWalk(walkSrc)
 	}
 
-	err = publish.AddItems(ctx, publishItems)
-	if err != nil {
-		logger.F("error", err).Error("can't add items to publish")
-		return 51
+	failure := pipeline.run(pipeline.progress.begin(ctx), walkFn)
+	pipeline.progress.stop()
+	if failure != nil {
+		entry := logger.F("error", failure.err)
+		if failure.code == 73 {
+			entry = logger.F("src", args.Src, "error", failure.err)
+		}
+		entry.Error(failure.message)
+		return failure.code
 	}
 
-	logger.F("publish", publish.ID(), "items", len(publishItems)).Info("Added publish items")
+	logger.F("uploaded", pipeline.uploaded, "existing", pipeline.present,
+		"duplicate", pipeline.duplicate, "resumed", pipeline.resumedUploads,
+		"resumed_walk", pipeline.resumedWalk).Info("Completed uploads")
+
+	logger.F("publish", publish.ID(), "items", pipeline.added,
+		"resumed", pipeline.resumedItems).Info("Added publish items")
+
+	if args.Delete && srcIsDir {
+		deletions, err := findDeletions(ctx, gwClient, args, cfg.Rewrite().Apply(srcRootURI(args.Src, destTree)), srcURIs)
+		if err != nil {
+			logger.F("error", err).Error("can't determine content to delete")
+			return 51
+		}
+
+		if err := publish.AddItems(ctx, deletions); err != nil {
+			logger.F("error", err).Error("can't add deletions to publish")
+			return 51
+		}
+
+		logger.F("publish", publish.ID(), "items", len(deletions)).Info("Added deletions to publish")
+		report.deleting(deletions)
+
+		if published != nil {
+			for _, item := range deletions {
+				published.Add(manifest.Entry{WebURI: item.WebURI, ObjectKey: item.ObjectKey})
+			}
+		}
+	}
 
 	shouldCommit, mode := commitMode(cfg, args)
-	if shouldCommit {
+	var commitTask gw.Task
+	if shouldCommit && args.NoWait {
+		logger.F("publish", publish.ID(), "mode", mode).Info("Starting commit of publish")
+		commitTask, err = publish.StartCommit(ctx, mode)
+		if err != nil {
+			logger.F("error", err).Error("can't commit publish")
+			writeManifest(ctx, args.ManifestOut, published)
+			return 71
+		}
+		if published != nil {
+			published.CommitMode = mode
+			published.TaskID = commitTask.ID()
+		}
+		logger.F("publish", publish.ID(), "task", commitTask.ID()).Info(
+			"Commit started, not waiting for it to complete")
+	} else if shouldCommit {
 		logger.F("publish", publish.ID(), "mode", mode).Info("Preparing to commit publish")
 		err = publish.Commit(ctx, mode)
+		if published != nil {
+			published.Committed = err == nil
+			published.CommitMode = mode
+			published.TaskState = taskState(err)
+		}
 		if err != nil {
 			logger.F("error", err).Error("can't commit publish")
-			return 71
+			writeManifest(ctx, args.ManifestOut, published)
+			return taskExitCode(err)
+		}
+	}
+
+	completed = true
+
+	if !writeManifest(ctx, args.ManifestOut, published) {
+		return 11
+	}
+
+	report.finish()
+
+	if commitTask != nil {
+		// Printed last, so that the task can easily be awaited by scripts.
+		fmt.Fprintln(ext.stdout, commitTask.ID())
+	}
+
+	if args.Verify && args.DryRun {
+		logger.F("items", len(toVerify.items)).Info("Would verify published content")
+	} else if args.Verify {
+		if failed := verifyPublished(ctx, cfg, toVerify); failed > 0 {
+			logger.F("failed", failed).Error("published content failed verification")
+			return 77
 		}
 	}
 
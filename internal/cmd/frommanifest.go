@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+var objectKeyRegexp = regexp.MustCompile("^[0-9a-f]{64}$")
+
+// manifestItem returns the sync item for a single manifest entry.
+//
+// Relative source paths are resolved against srcDir. If the entry doesn't
+// provide the key, it is calculated from the file content.
+func manifestItem(ctx context.Context, entry manifest.Entry, srcDir string) (walk.SyncItem, error) {
+	if !strings.HasPrefix(entry.WebURI, "/") {
+		return walk.SyncItem{}, fmt.Errorf("web_uri must be an absolute path: %q", entry.WebURI)
+	}
+
+	srcPath := entry.SrcPath
+	if srcPath != "" && !filepath.IsAbs(srcPath) {
+		srcPath = filepath.Join(srcDir, srcPath)
+	}
+
+	out := walk.SyncItem{
+		SrcPath:     srcPath,
+		WebURI:      entry.WebURI,
+		ContentType: entry.ContentType,
+	}
+
+	if entry.LinkTo != "" {
+		out.LinkTo = entry.LinkTo
+		return out, nil
+	}
+
+	if srcPath == "" {
+		return out, fmt.Errorf("%s: entry has neither src_path nor link_to", entry.WebURI)
+	}
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return out, err
+	}
+	if info.IsDir() {
+		return out, fmt.Errorf("%s: is a directory", srcPath)
+	}
+	out.Info = info
+
+	if entry.ObjectKey != "" {
+		if !objectKeyRegexp.MatchString(entry.ObjectKey) {
+			return out, fmt.Errorf("%s: object_key is not a SHA256 checksum: %q", entry.WebURI, entry.ObjectKey)
+		}
+		out.Key = entry.ObjectKey
+		return out, nil
+	}
+
+	out.Key, err = walk.FileKey(ctx, srcPath)
+	if err != nil {
+		return out, fmt.Errorf("checksum %s: %w", srcPath, err)
+	}
+
+	return out, nil
+}
+
+// walkManifest invokes handler for every entry in a manifest, in the same
+// manner as walk.Walk would for every file in a source tree.
+func walkManifest(ctx context.Context, m *manifest.Manifest, srcDir string, handler walk.SyncItemHandler) error {
+	logger := log.FromContext(ctx)
+
+	for _, entry := range m.Items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		item, err := manifestItem(ctx, entry, srcDir)
+		if err != nil {
+			return err
+		}
+
+		logger.F("item", item).Debug("got item from manifest")
+
+		if err := handler(item); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
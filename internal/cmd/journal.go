@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/journal"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// journalPath returns the path of the journal for the current run, or an
+// empty string if journals are disabled.
+func journalPath(cfg conf.Config, args args.Config) string {
+	dir := cfg.JournalDir()
+	if dir == "" || args.DryRun {
+		return ""
+	}
+
+	// Runs are considered the same if they sync the same source to the same
+	// destination, in the same publish.
+	src, err := filepath.Abs(args.Src)
+	if err != nil {
+		src = args.Src
+	}
+
+	identity := []string{cfg.GwURL(), cfg.GwEnv(), src, args.Dest, args.Publish}
+	if args.FromManifest != "" {
+		fromManifest, err := filepath.Abs(args.FromManifest)
+		if err != nil {
+			fromManifest = args.FromManifest
+		}
+		identity = append(identity, fromManifest)
+	}
+
+	return journal.PathFor(dir, identity...)
+}
+
+// loadJournal returns the journal of a previous interrupted run which should
+// be resumed, or nil if there is none.
+func loadJournal(ctx context.Context, path string) *journal.Journal {
+	logger := log.FromContext(ctx)
+
+	prev, err := journal.Load(path)
+	if err != nil {
+		// Not fatal since we can always start again from scratch, which
+		// is correct, just slower.
+		logger.F("path", path, "error", err).Warn("Can't read run journal, not resuming")
+		return nil
+	}
+	if prev == nil {
+		logger.F("path", path).Info("No interrupted run to resume")
+		return nil
+	}
+
+	return prev
+}
+
+// createJournal starts a new journal for the current run, or returns nil
+// if it can't be created.
+func createJournal(ctx context.Context, path string, publishID string, created bool) *journal.Journal {
+	logger := log.FromContext(ctx)
+
+	out, err := journal.Create(path, publishID, created)
+	if err != nil {
+		logger.F("path", path, "error", err).Warn("Can't create run journal, this run will not be resumable")
+		return nil
+	}
+
+	logger.F("path", path).Debug("Created run journal")
+	return out
+}
+
+// finishJournal removes the journal if the run completed, or otherwise
+// leaves it in place so the run can be resumed.
+func finishJournal(ctx context.Context, j *journal.Journal, completed bool) {
+	logger := log.FromContext(ctx)
+
+	if j == nil {
+		return
+	}
+
+	if !completed {
+		j.Close()
+		logger.F("path", j.Path(), "publish", j.PublishID()).Info(
+			"Run did not complete, use --exodus-resume to resume it")
+		return
+	}
+
+	if err := j.Remove(); err != nil {
+		logger.F("path", j.Path(), "error", err).Warn("Can't remove run journal")
+	}
+}
+
+// journalFile returns the journal record of a walked item.
+func journalFile(item walk.SyncItem) journal.File {
+	out := journal.File{SrcPath: item.SrcPath, Key: item.Key, LinkTo: item.LinkTo}
+
+	// The key of a followed symlink is that of its target, which the walked
+	// info doesn't describe, so it's always calculated again when resuming.
+	if item.Key != "" && item.Info != nil && item.Info.Mode().IsRegular() {
+		out.Size = item.Info.Size()
+		out.Mtime = item.Info.ModTime().UnixNano()
+	}
+
+	return out
+}
+
+// resumedItem returns the sync item for a file walked by an interrupted run,
+// reusing its key if the file is unchanged. Returns false if the file no
+// longer exists.
+func resumedItem(ctx context.Context, file journal.File) (walk.SyncItem, bool, error) {
+	out := walk.SyncItem{SrcPath: file.SrcPath, LinkTo: file.LinkTo}
+
+	info, err := os.Lstat(file.SrcPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.FromContext(ctx).F("path", file.SrcPath).Debug("Skipping file removed since interrupted run")
+		return out, false, nil
+	}
+	if err != nil {
+		return out, false, err
+	}
+	out.Info = info
+
+	switch {
+	case file.LinkTo != "":
+		if out.LinkTo, err = os.Readlink(file.SrcPath); err != nil {
+			return out, false, err
+		}
+	case info.Mode().IsRegular() && file.Size == info.Size() && file.Mtime == info.ModTime().UnixNano():
+		out.Key = file.Key
+	default:
+		if out.Key, err = walk.FileKey(ctx, file.SrcPath); err != nil {
+			return out, false, fmt.Errorf("checksum %s: %w", file.SrcPath, err)
+		}
+	}
+
+	return out, true, nil
+}
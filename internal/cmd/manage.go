@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+// printItem writes a single item of a publish to stdout, one line per item.
+func printItem(item gw.ItemInput) error {
+	var err error
+	if item.LinkTo != "" {
+		_, err = fmt.Fprintf(ext.stdout, "%s\t-> %s\n", item.WebURI, item.LinkTo)
+	} else {
+		_, err = fmt.Fprintf(ext.stdout, "%s\t%s\t%s\n", item.WebURI, item.ObjectKey, item.ContentType)
+	}
+	return err
+}
+
+// Publish management mode, operating on an existing publish rather than
+// syncing any content.
+func manageMain(ctx context.Context, cfg conf.Config, args args.Config) int {
+	logger := log.FromContext(ctx)
+
+	// Only actions which modify the publish are affected by dry-run mode.
+	dryRun := args.DryRun && (args.PublishAction == "commit" || args.PublishAction == "abort")
+
+	clientCtor := ext.gw.NewClient
+	if dryRun {
+		clientCtor = ext.gw.NewDryRunClient
+	}
+	gwClient, err := clientCtor(ctx, cfg)
+	if err != nil {
+		logger.F("error", err).Error("can't initialize exodus-gw client")
+		return 101
+	}
+
+	publish, err := gwClient.GetPublish(ctx, args.Publish)
+	if err != nil {
+		logger.F("publish", args.Publish, "error", err).Error("can't get publish")
+		return 67
+	}
+
+	switch args.PublishAction {
+	case "status":
+		logger.F("publish", publish.ID(), "state", publish.State()).Info("Got publish")
+		fmt.Fprintln(ext.stdout, publish.State())
+
+	case "items":
+		count := 0
+		err = publish.ListItems(ctx, func(item gw.ItemInput) error {
+			count++
+			return printItem(item)
+		})
+		if err != nil {
+			logger.F("publish", publish.ID(), "error", err).Error("can't list items of publish")
+			return 51
+		}
+		logger.F("publish", publish.ID(), "items", count).Info("Listed items of publish")
+
+	case "commit":
+		// An explicit request to commit overrides 'auto' or 'none' in config.
+		mode := cfg.GwCommit()
+		if mode == "auto" || mode == "none" {
+			mode = ""
+		}
+
+		logger.F("publish", publish.ID(), "mode", mode).Info("Preparing to commit publish")
+		if args.NoWait {
+			var task gw.Task
+			if task, err = publish.StartCommit(ctx, mode); err == nil {
+				logger.F("publish", publish.ID(), "task", task.ID()).Info(
+					"Commit started, not waiting for it to complete")
+				fmt.Fprintln(ext.stdout, task.ID())
+			}
+		} else {
+			err = publish.Commit(ctx, mode)
+		}
+		if err != nil {
+			logger.F("publish", publish.ID(), "error", err).Error("can't commit publish")
+			return 71
+		}
+
+	case "abort":
+		if err = publish.Abandon(ctx); err != nil {
+			logger.F("publish", publish.ID(), "error", err).Error("can't abort publish")
+			return 71
+		}
+	}
+
+	msg := "Completed successfully!"
+	if dryRun {
+		msg = "Completed successfully (in dry-run mode - no changes written)"
+	}
+	logger.Info(msg)
+
+	return 0
+}
+
+// New publish mode, creating a publish to be joined by later runs and
+// printing its ID.
+func newPublishMain(ctx context.Context, cfg conf.Config, args args.Config) int {
+	logger := log.FromContext(ctx)
+
+	clientCtor := ext.gw.NewClient
+	if args.DryRun {
+		clientCtor = ext.gw.NewDryRunClient
+	}
+	gwClient, err := clientCtor(ctx, cfg)
+	if err != nil {
+		logger.F("error", err).Error("can't initialize exodus-gw client")
+		return 101
+	}
+
+	publish, err := gwClient.NewPublish(ctx)
+	if err != nil {
+		logger.F("error", err).Error("can't create publish")
+		return 62
+	}
+	logger.F("publish", publish.ID(), "env", cfg.GwEnv()).Info("Created publish")
+
+	if args.Output == "json" {
+		out := struct {
+			ID  string `json:"id"`
+			Env string `json:"env"`
+		}{publish.ID(), cfg.GwEnv()}
+		err = json.NewEncoder(ext.stdout).Encode(&out)
+	} else {
+		_, err = fmt.Fprintln(ext.stdout, publish.ID())
+	}
+	if err != nil {
+		logger.F("error", err).Error("can't write publish ID")
+		return 11
+	}
+
+	return 0
+}
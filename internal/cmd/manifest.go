@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// manifestEntry returns the manifest entry for an item added onto a publish.
+func manifestEntry(item walk.SyncItem, input gw.ItemInput, outcome manifest.Outcome) manifest.Entry {
+	out := manifest.Entry{
+		WebURI:      input.WebURI,
+		ObjectKey:   input.ObjectKey,
+		ContentType: input.ContentType,
+		LinkTo:      input.LinkTo,
+		SrcPath:     item.SrcPath,
+		Outcome:     outcome,
+	}
+	if item.Info != nil && item.LinkTo == "" {
+		out.Size = item.Info.Size()
+	}
+	return out
+}
+
+// taskState returns the final state of a commit task, given the result of
+// committing, or an empty string if unknown.
+func taskState(err error) string {
+	if err == nil {
+		return "COMPLETE"
+	}
+
+	taskErr := &gw.TaskError{}
+	if errors.As(err, &taskErr) {
+		return taskErr.State
+	}
+
+	timeoutErr := &gw.TaskTimeoutError{}
+	if errors.As(err, &timeoutErr) {
+		return timeoutErr.State
+	}
+
+	return ""
+}
+
+// writeManifest writes the manifest of the current run to path, if requested.
+// Returns false if the manifest could not be written.
+func writeManifest(ctx context.Context, path string, m *manifest.Manifest) bool {
+	logger := log.FromContext(ctx)
+
+	if m == nil {
+		return true
+	}
+
+	if err := m.Write(path); err != nil {
+		logger.F("path", path, "error", err).Error("can't write manifest")
+		return false
+	}
+
+	logger.F("path", path, "items", len(m.Items)).Info("Wrote manifest")
+	return true
+}
@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/journal"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// Capacity of the channels connecting each stage of the publish pipeline.
+// Together with the batch size, this bounds the number of items held in
+// memory at any time, regardless of the size of the source tree.
+const pipelineBuffer = 1000
+
+// pipelineError describes the first failure of any stage in a publish pipeline,
+// along with the message and exit code which should be used to report it.
+type pipelineError struct {
+	message string
+	code    int
+	err     error
+}
+
+// pendingItem is an item ready to be added onto a publish, along with the
+// outcome of its upload (empty for items without content, e.g. symlinks).
+type pendingItem struct {
+	walk.SyncItem
+	outcome manifest.Outcome
+}
+
+// walkFunc walks a source tree, invoking handler for each item found.
+type walkFunc func(ctx context.Context, handler walk.SyncItemHandler) error
+
+// publishPipeline streams items from a source tree through upload and onto
+// a publish, with every stage running concurrently:
+//
+//	walk --> EnsureUploadedStream --> AddItems
+//
+// Symlinks have no content to upload, so they bypass the upload stage.
+//
+// If a journal is provided, progress is recorded there, and any progress
+// previously recorded is skipped.
+type publishPipeline struct {
+	client    gw.Client
+	publish   gw.Publish
+	batchSize int
+	journal   *journal.Journal
+
+	// Converts a sync item into an item for publish.
+	toInput func(walk.SyncItem) gw.ItemInput
+
+	// If set, invoked for each item once it's on the publish, including
+	// items added by a previous run per the journal.
+	onAdded func(walk.SyncItem, gw.ItemInput, manifest.Outcome)
+
+	// If set, updated as items are walked and uploaded.
+	progress *uploadProgress
+
+	// Counters for each outcome; only valid once run has returned.
+	uploaded  int
+	present   int
+	duplicate int
+	added     int
+
+	// Counters for progress skipped due to the journal.
+	resumedWalk    int
+	resumedUploads int
+	resumedItems   int
+
+	cancel      context.CancelFunc
+	failOnce    sync.Once
+	failure     *pipelineError
+	journalOnce sync.Once
+}
+
+// fail records a failure, if none was previously recorded, and stops all stages.
+func (p *publishPipeline) fail(message string, code int, err error) {
+	p.failOnce.Do(func() {
+		p.failure = &pipelineError{message, code, err}
+	})
+	p.cancel()
+}
+
+// journaled handles the result of writing to the journal. Since the journal
+// only serves to speed up a later run, failing to write it is not fatal.
+func (p *publishPipeline) journaled(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+	p.journalOnce.Do(func() {
+		log.FromContext(ctx).F("path", p.journal.Path(), "error", err).Warn(
+			"Can't write run journal, this run will not be resumable")
+	})
+}
+
+func journalItem(item gw.ItemInput) journal.Item {
+	return journal.Item{WebURI: item.WebURI, ObjectKey: item.ObjectKey, LinkTo: item.LinkTo}
+}
+
+// journaledWalk returns walkFn wrapped so that every file walked is recorded
+// in the journal, if any.
+//
+// When resuming, files walked by the interrupted run are replayed from the
+// journal first, without checksumming unchanged files again. Then, unless the
+// interrupted run walked the entire tree, walkFn continues to look for the
+// remaining files, skipping those replayed.
+func (p *publishPipeline) journaledWalk(walkFn walkFunc) walkFunc {
+	if p.journal == nil {
+		return walkFn
+	}
+
+	return func(ctx context.Context, handler walk.SyncItemHandler) error {
+		logger := log.FromContext(ctx)
+
+		resumed := p.journal.WalkedFiles()
+		if len(resumed) > 0 {
+			logger.F("files", len(resumed), "complete", p.journal.WalkDone()).Info(
+				"Replaying files walked by interrupted run")
+		}
+		for _, file := range resumed {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			item, ok, err := resumedItem(ctx, file)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			p.resumedWalk++
+			if err := handler(item); err != nil {
+				return err
+			}
+		}
+
+		if p.journal.WalkDone() {
+			return nil
+		}
+
+		err := walkFn(walk.WithSkip(ctx, p.journal.IsWalked), func(item walk.SyncItem) error {
+			p.journaled(ctx, p.journal.Walked(journalFile(item)))
+			return handler(item)
+		})
+		if err == nil {
+			p.journaled(ctx, p.journal.FinishedWalk())
+		}
+		return err
+	}
+}
+
+// run walks the source tree via walkFn, ensures every item is uploaded and
+// adds it onto the publish. It returns nil if and only if every stage succeeded.
+func (p *publishPipeline) run(ctx context.Context, walkFn walkFunc) *pipelineError {
+	parentCtx := ctx
+	ctx, p.cancel = context.WithCancel(ctx)
+	defer p.cancel()
+
+	toUpload := make(chan walk.SyncItem, pipelineBuffer)
+	toAdd := make(chan pendingItem, pipelineBuffer)
+
+	send := func(ch chan<- walk.SyncItem, item walk.SyncItem) error {
+		select {
+		case ch <- item:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	sendAdd := func(item walk.SyncItem, outcome manifest.Outcome) error {
+		select {
+		case toAdd <- pendingItem{item, outcome}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	producers := sync.WaitGroup{}
+	producers.Add(2)
+
+	go func() {
+		defer producers.Done()
+		defer close(toUpload)
+
+		err := walkFn(ctx, func(item walk.SyncItem) error {
+			p.progress.walked(item)
+			if item.Key == "" && item.LinkTo != "" {
+				p.progress.done(item, "")
+				return sendAdd(item, "")
+			}
+			if p.journal.IsUploaded(item.Key) {
+				// A previous run confirmed the blob is present.
+				p.resumedUploads++
+				p.progress.done(item, manifest.Present)
+				return sendAdd(item, manifest.Present)
+			}
+			return send(toUpload, item)
+		})
+		p.progress.finishedWalk()
+		if err != nil {
+			p.fail("can't read files for sync", 73, err)
+		}
+	}()
+
+	go func() {
+		defer producers.Done()
+
+		// Duplicates are handled by some other item, so only the outcome
+		// of that other item is journaled.
+		forward := func(counter *int, outcome manifest.Outcome) func(walk.SyncItem) error {
+			return func(item walk.SyncItem) error {
+				*counter++
+				p.progress.done(item, outcome)
+				if outcome != manifest.Duplicate {
+					p.journaled(ctx, p.journal.Uploaded(item.Key))
+				}
+				return sendAdd(item, outcome)
+			}
+		}
+
+		err := p.client.EnsureUploadedStream(ctx, toUpload,
+			forward(&p.uploaded, manifest.Uploaded),
+			forward(&p.present, manifest.Present),
+			forward(&p.duplicate, manifest.Duplicate))
+		if err != nil {
+			p.fail("can't upload files", 25, err)
+		}
+	}()
+
+	go func() {
+		producers.Wait()
+		close(toAdd)
+	}()
+
+	// Only returns once both producers are done, so everything they wrote
+	// is visible after this point.
+	p.addItems(ctx, toAdd)
+
+	if p.failure == nil && parentCtx.Err() != nil {
+		p.fail("can't add items to publish", 51, parentCtx.Err())
+	}
+
+	return p.failure
+}
+
+// addItems adds items onto the publish in batches, as they arrive.
+// If anything fails, remaining items are drained and discarded.
+func (p *publishPipeline) addItems(ctx context.Context, items <-chan pendingItem) {
+	var batch []gw.ItemInput
+	var journalBatch []journal.Item
+	var pending []pendingItem
+
+	added := func(item pendingItem, input gw.ItemInput) {
+		if p.onAdded != nil {
+			p.onAdded(item.SyncItem, input, item.outcome)
+		}
+	}
+
+	flush := func() {
+		if len(batch) == 0 || ctx.Err() != nil {
+			return
+		}
+		if err := p.publish.AddItems(ctx, batch); err != nil {
+			p.fail("can't add items to publish", 51, err)
+			return
+		}
+		p.journaled(ctx, p.journal.Added(journalBatch))
+		for i := range pending {
+			added(pending[i], batch[i])
+		}
+		p.added += len(batch)
+		batch = nil
+		journalBatch = nil
+		pending = nil
+	}
+
+	for item := range items {
+		if ctx.Err() != nil {
+			continue
+		}
+
+		input := p.toInput(item.SyncItem)
+		jItem := journalItem(input)
+		if p.journal.IsAdded(jItem) {
+			p.resumedItems++
+			added(item, input)
+			continue
+		}
+
+		batch = append(batch, input)
+		journalBatch = append(journalBatch, jItem)
+		pending = append(pending, item)
+		if len(batch) >= p.batchSize {
+			flush()
+		}
+	}
+
+	flush()
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+	"go.uber.org/mock/gomock"
+)
+
+// Returns a walkFunc which emits the given items.
+func walkItems(items ...walk.SyncItem) walkFunc {
+	return func(ctx context.Context, handler walk.SyncItemHandler) error {
+		for _, item := range items {
+			if err := handler(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func testInput(item walk.SyncItem) gw.ItemInput {
+	return gw.ItemInput{WebURI: "/" + item.SrcPath, ObjectKey: item.Key, LinkTo: item.LinkTo}
+}
+
+func TestPipelineBatches(t *testing.T) {
+	ctrl := MockController(t)
+	publish := gw.NewMockPublish(ctrl)
+
+	var added []gw.ItemInput
+	publish.EXPECT().AddItems(gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, items []gw.ItemInput) error {
+			if len(items) > 2 {
+				t.Errorf("batch too large: %v", items)
+			}
+			added = append(added, items...)
+			return nil
+		})
+
+	p := publishPipeline{
+		client:    &FakeClient{blobs: map[string]string{"key2": "existing"}},
+		publish:   publish,
+		batchSize: 2,
+		toInput:   testInput,
+	}
+
+	failure := p.run(testContext(), walkItems(
+		walk.SyncItem{SrcPath: "file1", Key: "key1"},
+		walk.SyncItem{SrcPath: "link", LinkTo: "file1"},
+		walk.SyncItem{SrcPath: "file2", Key: "key2"},
+		walk.SyncItem{SrcPath: "file3", Key: "key1"},
+	))
+
+	if failure != nil {
+		t.Fatalf("unexpected failure: %v", failure.err)
+	}
+
+	// Every item should have been added, including the link which
+	// was never uploaded.
+	if len(added) != 4 || p.added != 4 {
+		t.Errorf("unexpected added items: %v", added)
+	}
+	if p.uploaded != 1 || p.present != 1 || p.duplicate != 1 {
+		t.Errorf("unexpected counts: uploaded %d, present %d, duplicate %d",
+			p.uploaded, p.present, p.duplicate)
+	}
+}
+
+func TestPipelineFailures(t *testing.T) {
+	simulated := fmt.Errorf("simulated error")
+
+	tests := []struct {
+		name      string
+		walkErr   error
+		uploadErr error
+		addErr    error
+		message   string
+		code      int
+	}{
+		{"walk", simulated, nil, nil, "can't read files for sync", 73},
+		{"upload", nil, simulated, nil, "can't upload files", 25},
+		{"add", nil, nil, simulated, "can't add items to publish", 51},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := MockController(t)
+			client := gw.NewMockClient(ctrl)
+			publish := gw.NewMockPublish(ctrl)
+
+			client.EXPECT().EnsureUploadedStream(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, items <-chan walk.SyncItem, onUploaded func(walk.SyncItem) error, _, _ interface{}) error {
+					for item := range items {
+						if tt.uploadErr != nil {
+							return tt.uploadErr
+						}
+						if err := onUploaded(item); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+			publish.EXPECT().AddItems(gomock.Any(), gomock.Any()).Return(tt.addErr).AnyTimes()
+
+			p := publishPipeline{
+				client:    client,
+				publish:   publish,
+				batchSize: 1,
+				toInput:   testInput,
+			}
+
+			walked := 0
+			failure := p.run(testContext(), func(ctx context.Context, handler walk.SyncItemHandler) error {
+				// Keep walking until something fails, as with an unbounded tree.
+				for {
+					walked++
+					if walked == 3 && tt.walkErr != nil {
+						return tt.walkErr
+					}
+					if err := handler(walk.SyncItem{SrcPath: "file", Key: fmt.Sprint(walked)}); err != nil {
+						return err
+					}
+				}
+			})
+
+			if failure == nil {
+				t.Fatal("unexpectedly succeeded")
+			}
+
+			// It should report the first failure, not any resulting cancellation.
+			if failure.message != tt.message || failure.code != tt.code || failure.err != simulated {
+				t.Errorf("unexpected failure: %v, %v, %v", failure.message, failure.code, failure.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// planStatus describes how publishing an item would change the CDN.
+type planStatus string
+
+const (
+	planAdded       planStatus = "added"
+	planChanged     planStatus = "changed"
+	planUnchanged   planStatus = "unchanged"
+	planLinkChanged planStatus = "link-changed"
+	planDeleted     planStatus = "deleted"
+)
+
+// Order in which statuses are summarized.
+var planStatuses = []planStatus{planAdded, planChanged, planLinkChanged, planUnchanged, planDeleted}
+
+// planEntry describes a single web URI in a plan.
+type planEntry struct {
+	WebURI  string     `json:"web_uri"`
+	Status  planStatus `json:"status"`
+	SrcPath string     `json:"src_path,omitempty"`
+
+	// The item as it would be published.
+	ObjectKey string `json:"object_key,omitempty"`
+	LinkTo    string `json:"link_to,omitempty"`
+
+	// The item as currently published, if it is.
+	OldObjectKey string `json:"old_object_key,omitempty"`
+	OldLinkTo    string `json:"old_link_to,omitempty"`
+}
+
+// syncPlan describes the changes a sync would make to published content.
+type syncPlan struct {
+	Items   []planEntry        `json:"items"`
+	Summary map[planStatus]int `json:"summary"`
+}
+
+// planItem returns the entry for publishing item, given the currently
+// published item at the same URI, if any.
+func planItem(item walk.SyncItem, input gw.ItemInput, current *gw.ItemInput) planEntry {
+	out := planEntry{
+		WebURI:    input.WebURI,
+		SrcPath:   item.SrcPath,
+		ObjectKey: input.ObjectKey,
+		LinkTo:    input.LinkTo,
+		Status:    planAdded,
+	}
+
+	if current == nil {
+		return out
+	}
+
+	out.OldObjectKey = current.ObjectKey
+	out.OldLinkTo = current.LinkTo
+
+	switch {
+	case input.LinkTo == current.LinkTo && input.ObjectKey == current.ObjectKey:
+		out.Status = planUnchanged
+	case input.LinkTo != "" && current.LinkTo != "":
+		out.Status = planLinkChanged
+	default:
+		out.Status = planChanged
+	}
+
+	return out
+}
+
+// commonDir returns the deepest directory containing all of the given URIs.
+func commonDir(uris []string) string {
+	if len(uris) == 0 {
+		return "/"
+	}
+
+	out := path.Dir(uris[0])
+	for _, uri := range uris[1:] {
+		for out != "/" && !strings.HasPrefix(uri, strings.TrimSuffix(out, "/")+"/") {
+			out = path.Dir(out)
+		}
+	}
+	return out
+}
+
+// listPrefixes returns the prefixes under which to list published content
+// which might be replaced by items at the given URIs.
+//
+// URIs are grouped by their top-level directory, and the deepest directory
+// containing each group is listed, so that even if URIs are spread across
+// the CDN (e.g. by rewrite rules), the whole environment is never listed.
+func listPrefixes(uris []string) []string {
+	groups := make(map[string][]string)
+	var tops []string
+
+	for _, uri := range uris {
+		top := strings.SplitN(strings.TrimPrefix(uri, "/"), "/", 2)[0]
+		if _, ok := groups[top]; !ok {
+			tops = append(tops, top)
+		}
+		groups[top] = append(groups[top], uri)
+	}
+	sort.Strings(tops)
+
+	out := []string{}
+	for _, top := range tops {
+		if dir := commonDir(groups[top]); dir != "/" {
+			out = append(out, dir+"/")
+		} else {
+			// A file at the top level, which is the only URI to list.
+			out = append(out, "/"+top)
+		}
+	}
+	return out
+}
+
+// writePlan writes the plan to stdout, either as a line per item followed by
+// a summary, or as JSON.
+func writePlan(plan *syncPlan, format string) error {
+	if format == "json" {
+		return json.NewEncoder(ext.stdout).Encode(plan)
+	}
+
+	for _, entry := range plan.Items {
+		line := fmt.Sprintf("%-12s %s", entry.Status, entry.WebURI)
+		if entry.Status == planLinkChanged {
+			line += " -> " + entry.LinkTo
+		}
+		if _, err := fmt.Fprintln(ext.stdout, line); err != nil {
+			return err
+		}
+	}
+
+	var counts []string
+	for _, status := range planStatuses {
+		counts = append(counts, fmt.Sprintf("%d %s", plan.Summary[status], status))
+	}
+	_, err := fmt.Fprintf(ext.stdout, "Plan: %s\n", strings.Join(counts, ", "))
+	return err
+}
+
+// runPlan compares the items which would be published from the source tree
+// against the content currently published in exodus-gw, and writes a report
+// of the differences, without uploading or publishing anything.
+func runPlan(
+	ctx context.Context,
+	client gw.Client,
+	cfg conf.Config,
+	args args.Config,
+	destTree string,
+	srcIsDir bool,
+	walkSrc walkFunc,
+) int {
+	logger := log.FromContext(ctx)
+
+	type srcItem struct {
+		item  walk.SyncItem
+		input gw.ItemInput
+	}
+
+	var items []srcItem
+	var uris []string
+	srcURIs := make(map[string]struct{})
+
+	err := walkSrc(ctx, func(item walk.SyncItem) error {
+		// Content types aren't part of the plan, so there's no need to
+		// detect them.
+		input := itemTarget(cfg, item, args.Src, destTree, srcIsDir)
+		items = append(items, srcItem{item, input})
+		uris = append(uris, input.WebURI)
+		srcURIs[input.WebURI] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		logger.F("src", args.Src, "error", err).Error("can't read files for sync")
+		return 73
+	}
+
+	// Everything currently published which might be replaced by the source.
+	current := make(map[string]gw.ItemInput)
+	for _, prefix := range listPrefixes(uris) {
+		err = client.ListPublished(ctx, prefix, func(item gw.ItemInput) error {
+			if item.ObjectKey != gw.AbsentObjectKey {
+				current[item.WebURI] = item
+			}
+			return nil
+		})
+		if err != nil {
+			logger.F("prefix", prefix, "error", err).Error("can't list published content")
+			return 51
+		}
+	}
+
+	plan := &syncPlan{Items: []planEntry{}, Summary: make(map[planStatus]int)}
+	for _, status := range planStatuses {
+		plan.Summary[status] = 0
+	}
+
+	for _, src := range items {
+		var published *gw.ItemInput
+		if item, ok := current[src.input.WebURI]; ok {
+			published = &item
+		}
+		plan.Items = append(plan.Items, planItem(src.item, src.input, published))
+	}
+
+	if args.Delete && srcIsDir {
+		deletions, err := findDeletions(ctx, client, args, cfg.Rewrite().Apply(srcRootURI(args.Src, destTree)), srcURIs)
+		if err != nil {
+			logger.F("error", err).Error("can't determine content to delete")
+			return 51
+		}
+		for _, item := range deletions {
+			entry := planEntry{WebURI: item.WebURI, Status: planDeleted}
+			if published, ok := current[item.WebURI]; ok {
+				entry.OldObjectKey = published.ObjectKey
+				entry.OldLinkTo = published.LinkTo
+			}
+			plan.Items = append(plan.Items, entry)
+		}
+	}
+
+	sort.Slice(plan.Items, func(i, j int) bool { return plan.Items[i].WebURI < plan.Items[j].WebURI })
+	for _, entry := range plan.Items {
+		plan.Summary[entry.Status]++
+	}
+
+	if err := writePlan(plan, args.Output); err != nil {
+		logger.F("error", err).Error("can't write plan")
+		return 11
+	}
+
+	logger.F("added", plan.Summary[planAdded], "changed", plan.Summary[planChanged],
+		"link-changed", plan.Summary[planLinkChanged], "unchanged", plan.Summary[planUnchanged],
+		"deleted", plan.Summary[planDeleted]).Info("Completed plan, nothing was published")
+
+	return 0
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// How often progress is updated, on a terminal or in the log respectively.
+var (
+	progressTTYInterval = 200 * time.Millisecond
+	progressLogInterval = 10 * time.Second
+)
+
+// uploadProgress reports the overall progress of a publish for --progress and
+// --info=progress2.
+//
+// On a terminal, progress is shown as a single line in the format of rsync's
+// --info=progress2, updated in place. Otherwise, it's logged periodically.
+//
+// Totals only include items found by the walk so far, so they grow until the
+// walk has completed. Content which didn't need to be uploaded counts as done
+// as soon as that's known.
+//
+// All methods are safe to call on a nil *uploadProgress, doing nothing.
+type uploadProgress struct {
+	out    io.Writer
+	tty    bool
+	dryRun bool
+	logger *log.Logger
+
+	totalFiles  atomic.Int64
+	totalBytes  atomic.Int64
+	doneFiles   atomic.Int64
+	transferred atomic.Int64
+	sentBytes   atomic.Int64 // read from files for upload
+	skipped     atomic.Int64 // bytes which didn't need uploading
+	walkDone    atomic.Bool
+
+	start    time.Time
+	lastTime time.Time
+	lastSent int64
+	rate     float64
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// isTerminal returns true if w is a terminal.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func newUploadProgress(ctx context.Context, out io.Writer, dryRun bool) *uploadProgress {
+	return &uploadProgress{
+		out:    out,
+		tty:    isTerminal(out),
+		dryRun: dryRun,
+		logger: log.FromContext(ctx),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// begin starts reporting progress, returning a context which counts bytes
+// uploaded by any gw client using it.
+func (p *uploadProgress) begin(ctx context.Context) context.Context {
+	if p == nil {
+		return ctx
+	}
+
+	p.start = time.Now()
+	p.lastTime = p.start
+
+	interval := progressLogInterval
+	if p.tty {
+		interval = progressTTYInterval
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.update(time.Now(), false)
+			case <-p.stopCh:
+				return
+			}
+		}
+	}()
+
+	return gw.WithProgress(ctx, func(n int64) { p.sentBytes.Add(n) })
+}
+
+// stop stops reporting progress, after reporting the final state.
+func (p *uploadProgress) stop() {
+	if p == nil {
+		return
+	}
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+		p.wg.Wait()
+		p.update(time.Now(), true)
+	})
+}
+
+// walked records an item found by the walk.
+func (p *uploadProgress) walked(item walk.SyncItem) {
+	if p == nil {
+		return
+	}
+	p.totalFiles.Add(1)
+	p.totalBytes.Add(contentSize(item))
+}
+
+// finishedWalk records that the walk has completed, so totals are final.
+func (p *uploadProgress) finishedWalk() {
+	if p == nil {
+		return
+	}
+	p.walkDone.Store(true)
+}
+
+// done records an item which no longer needs any upload.
+func (p *uploadProgress) done(item walk.SyncItem, outcome manifest.Outcome) {
+	if p == nil {
+		return
+	}
+	p.doneFiles.Add(1)
+
+	// Content of uploaded items was counted as it was read, unless nothing
+	// was actually read due to dry-run.
+	if outcome != manifest.Uploaded || p.dryRun {
+		p.skipped.Add(contentSize(item))
+	}
+	if outcome == manifest.Uploaded {
+		p.transferred.Add(1)
+	}
+}
+
+// contentSize returns the size of any content to be uploaded for an item.
+func contentSize(item walk.SyncItem) int64 {
+	if item.Key == "" || item.Info == nil {
+		return 0
+	}
+	return item.Info.Size()
+}
+
+// update reports progress as of now. If final, the average rate over the
+// whole upload is reported rather than the current rate.
+//
+// Only called from one goroutine at a time.
+func (p *uploadProgress) update(now time.Time, final bool) {
+	sent := p.sentBytes.Load()
+
+	if final {
+		if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+			p.rate = float64(sent) / elapsed
+		}
+	} else if elapsed := now.Sub(p.lastTime).Seconds(); elapsed > 0 {
+		p.rate = float64(sent-p.lastSent) / elapsed
+	}
+	p.lastTime = now
+	p.lastSent = sent
+
+	doneBytes := sent + p.skipped.Load()
+	totalBytes := p.totalBytes.Load()
+	doneFiles := p.doneFiles.Load()
+	totalFiles := p.totalFiles.Load()
+
+	percent := int64(100)
+	if totalBytes > 0 {
+		percent = min(doneBytes*100/totalBytes, 100)
+	}
+
+	var eta time.Duration
+	if p.rate > 0 && !final {
+		eta = time.Duration(float64(max(totalBytes-doneBytes, 0)) / p.rate * float64(time.Second))
+	}
+
+	if !p.tty {
+		p.logger.F(
+			"bytes", doneBytes,
+			"total_bytes", totalBytes,
+			"files", doneFiles,
+			"total_files", totalFiles,
+			"rate", formatRate(p.rate),
+			"eta", formatETA(eta),
+		).Info("Upload progress")
+		return
+	}
+
+	// Like rsync, "ir-chk" indicates the total is still growing.
+	chk := "to-chk"
+	if !p.walkDone.Load() {
+		chk = "ir-chk"
+	}
+
+	line := fmt.Sprintf("%15s %3d%% %11s %11s (xfr#%d, %s=%d/%d)",
+		commaNum(doneBytes), percent, formatRate(p.rate), formatETA(eta),
+		p.transferred.Load(), chk, totalFiles-doneFiles, totalFiles)
+
+	end := ""
+	if final {
+		end = "\n"
+	}
+	fmt.Fprintf(p.out, "\r%s%s", line, end)
+}
+
+// formatRate formats a rate in bytes/sec as rsync does, e.g. "1.23MB/s".
+func formatRate(rate float64) string {
+	units := []string{"kB/s", "MB/s", "GB/s"}
+	rate /= 1024
+	unit := 0
+	for rate >= 1024 && unit < len(units)-1 {
+		rate /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.2f%s", rate, units[unit])
+}
+
+// formatETA formats a duration as rsync does, e.g. "0:01:05".
+func formatETA(d time.Duration) string {
+	secs := int64(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+}
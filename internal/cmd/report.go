@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/manifest"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// transferReport writes rsync-format output describing a publish: a line per
+// change with --itemize-changes, and a summary at the end with --stats.
+//
+// Since exodus has no directories and exodus-gw doesn't tell us whether a path
+// was previously published, only uploaded files, symlinks and deletions are
+// itemized, as new items.
+type transferReport struct {
+	out      io.Writer
+	itemize  bool
+	stats    bool
+	destTree string
+	start    time.Time
+
+	regular         int64
+	links           int64
+	deleted         int64
+	transferred     int64
+	totalSize       int64
+	transferredSize int64
+}
+
+func newTransferReport(out io.Writer, itemize bool, stats bool, destTree string) *transferReport {
+	return &transferReport{
+		out:      out,
+		itemize:  itemize,
+		stats:    stats,
+		destTree: destTree,
+		start:    time.Now(),
+	}
+}
+
+// name returns the path printed for an item, which like rsync is relative to
+// the destination. destTree and webURI are both as rewritten by any rewrite
+// rules, so an item moved outside of the destination is printed with its full
+// web URI.
+func (r *transferReport) name(webURI string) string {
+	name := strings.TrimPrefix(webURI, strings.TrimSuffix(r.destTree, "/")+"/")
+	if webURI == r.destTree {
+		name = path.Base(webURI)
+	}
+	return name
+}
+
+// added records an item once it's on the publish.
+func (r *transferReport) added(item walk.SyncItem, input gw.ItemInput, outcome manifest.Outcome) {
+	if input.LinkTo != "" {
+		r.links++
+		if r.itemize {
+			fmt.Fprintf(r.out, "cL+++++++++ %s -> %s\n", r.name(input.WebURI), item.LinkTo)
+		}
+		return
+	}
+
+	var size int64
+	if item.Info != nil {
+		size = item.Info.Size()
+	}
+
+	r.regular++
+	r.totalSize += size
+
+	if outcome == manifest.Uploaded {
+		r.transferred++
+		r.transferredSize += size
+		if r.itemize {
+			fmt.Fprintf(r.out, "<f+++++++++ %s\n", r.name(input.WebURI))
+		}
+	}
+}
+
+// deleting records items deleted from the publish.
+func (r *transferReport) deleting(items []gw.ItemInput) {
+	r.deleted += int64(len(items))
+	if r.itemize {
+		for _, item := range items {
+			fmt.Fprintf(r.out, "*deleting   %s\n", r.name(item.WebURI))
+		}
+	}
+}
+
+// finish writes the summary, if requested.
+func (r *transferReport) finish() {
+	if !r.stats {
+		return
+	}
+
+	var kinds []string
+	if r.regular > 0 {
+		kinds = append(kinds, "reg: "+commaNum(r.regular))
+	}
+	if r.links > 0 {
+		kinds = append(kinds, "link: "+commaNum(r.links))
+	}
+	files := commaNum(r.regular + r.links)
+	if len(kinds) > 0 {
+		files += " (" + strings.Join(kinds, ", ") + ")"
+	}
+
+	// Content is the only data sent; nothing comparable to rsync's
+	// protocol overhead is counted.
+	sent := r.transferredSize
+	total := sent
+	if total == 0 {
+		total = 1
+	}
+	elapsed := time.Since(r.start).Seconds()
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	rate := float64(sent) / elapsed
+
+	fmt.Fprintf(r.out, "\nNumber of files: %s\n", files)
+	fmt.Fprintf(r.out, "Number of deleted files: %s\n", commaNum(r.deleted))
+	fmt.Fprintf(r.out, "Number of regular files transferred: %s\n", commaNum(r.transferred))
+	fmt.Fprintf(r.out, "Total file size: %s bytes\n", commaNum(r.totalSize))
+	fmt.Fprintf(r.out, "Total transferred file size: %s bytes\n", commaNum(r.transferredSize))
+	fmt.Fprintf(r.out, "Literal data: %s bytes\n", commaNum(r.transferredSize))
+	fmt.Fprintf(r.out, "Matched data: 0 bytes\n")
+	fmt.Fprintf(r.out, "Total bytes sent: %s\n", commaNum(sent))
+	fmt.Fprintf(r.out, "Total bytes received: 0\n")
+	fmt.Fprintf(r.out, "\nsent %s bytes  received 0 bytes  %s bytes/sec\n", commaNum(sent), commaFloat(rate))
+	fmt.Fprintf(r.out, "total size is %s  speedup is %.2f\n", commaNum(r.totalSize), float64(r.totalSize)/float64(total))
+}
+
+// commaNum formats n with thousands separators, as rsync does.
+func commaNum(n int64) string {
+	if n < 0 {
+		return "-" + commaNum(-n)
+	}
+	digits := fmt.Sprint(n)
+
+	var out strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out.WriteByte(',')
+		}
+		out.WriteRune(digit)
+	}
+	return out.String()
+}
+
+// commaFloat formats f with two decimal places and thousands separators.
+func commaFloat(f float64) string {
+	cents := int64(f*100 + 0.5)
+	return fmt.Sprintf("%s.%02d", commaNum(cents/100), cents%100)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/journal"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/syncutil"
+)
+
+// Exit code used when interrupted by a signal, the same as rsync.
+const interruptedExitCode = 20
+
+// How long to spend abandoning a publish after being interrupted.
+const abandonTimeout = 30 * time.Second
+
+// Functions for receiving signals and exiting, replaceable in tests.
+var signals = struct {
+	notify func(chan<- os.Signal, ...os.Signal)
+	stop   func(chan<- os.Signal)
+	exit   func(int)
+}{
+	signal.Notify,
+	signal.Stop,
+	os.Exit,
+}
+
+// handleSignals cancels the current run upon SIGINT or SIGTERM, so that it
+// can clean up as it unwinds. A second signal exits immediately, without
+// waiting for cleanup or anything else still running.
+//
+// The returned function stops handling signals and returns true if the run
+// was interrupted.
+func handleSignals(ctx context.Context, cancel context.CancelFunc) func() bool {
+	logger := log.FromContext(ctx)
+
+	ch := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	var interrupted atomic.Bool
+
+	signals.notify(ch, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for {
+			select {
+			case sig := <-ch:
+				if interrupted.Swap(true) {
+					logger.F("signal", sig).Error("Interrupted again, exiting immediately")
+					signals.exit(interruptedExitCode)
+					return
+				}
+				logger.F("signal", sig).Warn(
+					"Interrupted, cleaning up (interrupt again to exit immediately)")
+				cancel()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() bool {
+		signals.stop(ch)
+		close(done)
+		return interrupted.Load()
+	}
+}
+
+// cleanupInterrupted cleans up a publish after the run was interrupted
+// before committing.
+//
+// A publish created by this run is abandoned, so that partial content isn't
+// left behind in exodus-gw, unless the run can be resumed from its journal.
+// A publish joined by this run belongs to someone else and is left alone.
+func cleanupInterrupted(ctx context.Context, publish gw.Publish, created bool, runJournal *journal.Journal) {
+	logger := log.FromContext(ctx)
+
+	if !created {
+		return
+	}
+
+	if runJournal != nil {
+		logger.F("publish", publish.ID()).Info("Leaving publish open so the run can be resumed")
+		return
+	}
+
+	// The run's context is already cancelled, but cleanup still needs to
+	// talk to exodus-gw.
+	ctx, cancel := syncutil.CleanupContext(ctx, abandonTimeout)
+	defer cancel()
+
+	err := publish.Abandon(ctx)
+	if errors.Is(err, gw.ErrAbandonUnsupported) {
+		logger.F("publish", publish.ID()).Warn("exodus-gw does not support abandoning publishes, it remains open")
+	} else if err != nil {
+		logger.F("publish", publish.ID(), "error", err).Warn("Can't abandon publish, it remains open")
+	}
+}
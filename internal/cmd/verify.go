@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/syncutil"
+)
+
+// verifyTimeout limits how long fetching a single item from the CDN may take.
+const verifyTimeout = 5 * time.Minute
+
+// verifier checks that published content is served correctly by the CDN.
+type verifier struct {
+	client  *http.Client
+	baseURL string
+
+	// Object keys of sampled files, by web URI.
+	keys map[string]string
+}
+
+// verifySample holds up to size published items chosen at random, or every
+// item if size is 0, without holding on to the items not chosen.
+type verifySample struct {
+	size int
+
+	// Number of items added so far.
+	seen int
+
+	items []gw.ItemInput
+}
+
+// add offers item to the sample. Once the sample is full, each later item
+// replaces a random one with probability size/seen, so every item is
+// equally likely to be chosen.
+func (s *verifySample) add(item gw.ItemInput) {
+	s.seen++
+	if s.size == 0 || len(s.items) < s.size {
+		s.items = append(s.items, item)
+		return
+	}
+	if i := rand.Intn(s.seen); i < s.size {
+		s.items[i] = item
+	}
+}
+
+// sorted returns the sampled items sorted by web URI.
+func (s *verifySample) sorted() []gw.ItemInput {
+	out := make([]gw.ItemInput, len(s.items))
+	copy(out, s.items)
+	sort.Slice(out, func(i, j int) bool { return out[i].WebURI < out[j].WebURI })
+	return out
+}
+
+// digest fetches uri from the CDN and returns the SHA256 checksum of the
+// content served, following any redirects.
+func (v *verifier) digest(ctx context.Context, uri string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.baseURL+uri, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching %s: %s", req.URL, resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", fmt.Errorf("fetching %s: %w", req.URL, err)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// check returns an error if item is not served correctly by the CDN.
+// A file must be served with content matching its object key, and a link
+// must be served with the same content as its target.
+func (v *verifier) check(ctx context.Context, item gw.ItemInput) error {
+	want := item.ObjectKey
+	if item.LinkTo != "" {
+		var ok bool
+		if want, ok = v.keys[item.LinkTo]; !ok {
+			// Target wasn't sampled from this run, so compare against
+			// whatever the CDN serves for it.
+			var err error
+			if want, err = v.digest(ctx, item.LinkTo); err != nil {
+				return fmt.Errorf("link target %s: %w", item.LinkTo, err)
+			}
+		}
+	}
+
+	got, err := v.digest(ctx, item.WebURI)
+	if err != nil {
+		return err
+	}
+
+	if got != want {
+		if item.LinkTo != "" {
+			return fmt.Errorf("served content %s does not match link target %s (%s)", got, item.LinkTo, want)
+		}
+		return fmt.Errorf("served content %s does not match object key %s", got, want)
+	}
+	return nil
+}
+
+// verifyPublished fetches the sampled items from the CDN and checks that the
+// expected content is served. Returns the number of items which failed
+// verification, each of which is logged.
+func verifyPublished(ctx context.Context, cfg conf.Config, published *verifySample) int {
+	logger := log.FromContext(ctx)
+
+	v := verifier{
+		client:  &http.Client{Timeout: verifyTimeout},
+		baseURL: strings.TrimSuffix(cfg.CDNURL(), "/"),
+		keys:    make(map[string]string),
+	}
+
+	sample := published.sorted()
+	for _, item := range sample {
+		if item.LinkTo == "" {
+			v.keys[item.WebURI] = item.ObjectKey
+		}
+	}
+
+	logger.F("url", v.baseURL, "items", len(sample), "published", published.seen).Info("Verifying published content")
+
+	toCheck := make(chan gw.ItemInput)
+	go func() {
+		defer close(toCheck)
+		for _, item := range sample {
+			toCheck <- item
+		}
+	}()
+
+	var mutex sync.Mutex
+	failed := 0
+
+	syncutil.RunWithGroup(cfg.VerifyThreads(), func() {
+		for item := range toCheck {
+			if err := v.check(ctx, item); err != nil {
+				logger.F("uri", item.WebURI, "error", err).Error("Published content failed verification")
+
+				mutex.Lock()
+				failed++
+				mutex.Unlock()
+			}
+		}
+	}, func() {})
+
+	logger.F("checked", len(sample), "failed", failed).Info("Verified published content")
+	return failed
+}
@@ -0,0 +1,282 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	apexLog "github.com/apex/log"
+)
+
+// Setting is the resolved value of a single config key, as reported by
+// --exodus-check-config.
+type Setting struct {
+	Key   string
+	Value interface{}
+
+	// True for an environment if the key isn't set in that environment, so
+	// the value was inherited from the global config (or is the default).
+	Inherited bool
+
+	// Problem with the value, if any.
+	Err error
+}
+
+// settingDef describes how to resolve and check a single config key.
+type settingDef struct {
+	key   string
+	value func(Config) interface{}
+	check func(Config) error
+}
+
+// publishes returns true if cfg is used to publish content via exodus-gw,
+// in which case the exodus-gw settings must be valid. The global config is
+// only used where no environment matches, so never publishes.
+func publishes(cfg Config) bool {
+	_, isEnv := cfg.(EnvironmentConfig)
+	return isEnv && cfg.RsyncMode() != "rsync"
+}
+
+func checkRequired(key string, value func(Config) string) func(Config) error {
+	return func(cfg Config) error {
+		if publishes(cfg) && value(cfg) == "" {
+			return fmt.Errorf("'%s' must be set to publish via exodus-gw", key)
+		}
+		return nil
+	}
+}
+
+func checkReadable(key string, value func(Config) string) func(Config) error {
+	required := checkRequired(key, value)
+	return func(cfg Config) error {
+		path := value(cfg)
+		if path == "" {
+			return required(cfg)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("can't read '%s': %w", key, err)
+		}
+		return file.Close()
+	}
+}
+
+func checkURL(key string, value func(Config) string, required bool) func(Config) error {
+	return func(cfg Config) error {
+		raw := value(cfg)
+		if raw == "" {
+			if required {
+				return checkRequired(key, value)(cfg)
+			}
+			return nil
+		}
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("invalid '%s': %w", key, err)
+		}
+		if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return fmt.Errorf("invalid '%s': '%s' is not an http(s) URL", key, raw)
+		}
+		return nil
+	}
+}
+
+func checkOneOf(key string, value func(Config) string, valid ...string) func(Config) error {
+	return func(cfg Config) error {
+		got := value(cfg)
+		for _, v := range valid {
+			if got == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid '%s': '%s', must be one of: %s", key, got, strings.Join(valid, ", "))
+	}
+}
+
+// checkMin returns a check that the int value of key is at least min. Since
+// zero values select the default, only explicitly set values can fail.
+func checkMin(key string, value func(Config) int, min int) func(Config) error {
+	return func(cfg Config) error {
+		if got := value(cfg); got < min {
+			return fmt.Errorf("invalid '%s': %d, must be at least %d", key, got, min)
+		}
+		return nil
+	}
+}
+
+// commitModeRegex matches commit modes which can be passed to exodus-gw, such
+// as "phase1", as well as "auto" and "none".
+var commitModeRegex = regexp.MustCompile(`^[a-z0-9_-]*$`)
+
+func checkCommit(cfg Config) error {
+	if mode := cfg.GwCommit(); !commitModeRegex.MatchString(mode) {
+		return fmt.Errorf("invalid 'gwcommit': '%s' is not a valid commit mode", mode)
+	}
+	return nil
+}
+
+func checkLogLevel(cfg Config) error {
+	level := cfg.LogLevel()
+	if level == "none" || level == "trace" {
+		return nil
+	}
+	if _, err := apexLog.ParseLevel(level); err != nil {
+		return fmt.Errorf("invalid 'loglevel': '%s'", level)
+	}
+	return nil
+}
+
+func checkLogger(cfg Config) error {
+	logger := cfg.Logger()
+	switch {
+	case logger == "auto", logger == "journald", logger == "syslog":
+		return nil
+	case strings.HasPrefix(logger, "file:"):
+		if strings.TrimPrefix(logger, "file:") == "" {
+			return fmt.Errorf("invalid 'logger': '%s' requires a path", logger)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid 'logger': '%s', must be one of: auto, journald, syslog, file:PATH", logger)
+}
+
+var settingDefs = []settingDef{
+	{"gwurl",
+		func(c Config) interface{} { return c.GwURL() },
+		checkURL("gwurl", Config.GwURL, true)},
+	{"gwenv",
+		func(c Config) interface{} { return c.GwEnv() },
+		checkRequired("gwenv", Config.GwEnv)},
+	{"gwcert",
+		func(c Config) interface{} { return c.GwCert() },
+		checkReadable("gwcert", Config.GwCert)},
+	{"gwkey",
+		func(c Config) interface{} { return c.GwKey() },
+		checkReadable("gwkey", Config.GwKey)},
+	{"gwcacert",
+		func(c Config) interface{} { return c.GwCACert() },
+		func(c Config) error {
+			if c.GwCACert() == "" {
+				return nil
+			}
+			return checkReadable("gwcacert", Config.GwCACert)(c)
+		}},
+	{"gwpollinterval",
+		func(c Config) interface{} { return c.GwPollInterval() },
+		checkMin("gwpollinterval", Config.GwPollInterval, 1)},
+	{"gwbatchsize",
+		func(c Config) interface{} { return c.GwBatchSize() },
+		checkMin("gwbatchsize", Config.GwBatchSize, 1)},
+	{"gwcommit",
+		func(c Config) interface{} { return c.GwCommit() },
+		checkCommit},
+	{"gwmaxattempts",
+		func(c Config) interface{} { return c.GwMaxAttempts() },
+		checkMin("gwmaxattempts", Config.GwMaxAttempts, 1)},
+	{"gwmaxbackoff",
+		func(c Config) interface{} { return c.GwMaxBackoff() },
+		checkMin("gwmaxbackoff", Config.GwMaxBackoff, 1)},
+	{"gwtasktimeout",
+		func(c Config) interface{} { return c.GwTaskTimeout() },
+		checkMin("gwtasktimeout", Config.GwTaskTimeout, 0)},
+	{"rsyncmode",
+		func(c Config) interface{} { return c.RsyncMode() },
+		checkOneOf("rsyncmode", Config.RsyncMode, "exodus", "rsync", "mixed")},
+	{"loglevel",
+		func(c Config) interface{} { return c.LogLevel() },
+		checkLogLevel},
+	{"logger",
+		func(c Config) interface{} { return c.Logger() },
+		checkLogger},
+	{"diag",
+		func(c Config) interface{} { return c.Diag() },
+		nil},
+	{"strip",
+		func(c Config) interface{} { return c.Strip() },
+		nil},
+	{"uploadthreads",
+		func(c Config) interface{} { return c.UploadThreads() },
+		checkMin("uploadthreads", Config.UploadThreads, 1)},
+	{"presencethreads",
+		func(c Config) interface{} { return c.PresenceThreads() },
+		checkMin("presencethreads", Config.PresenceThreads, 1)},
+	// Already validated when loaded.
+	{"uploadbwlimit",
+		func(c Config) interface{} { return c.UploadBwLimit() },
+		nil},
+	{"hashcache",
+		func(c Config) interface{} { return c.HashCache() },
+		nil},
+	{"hashcachesize",
+		func(c Config) interface{} { return c.HashCacheSize() },
+		checkMin("hashcachesize", Config.HashCacheSize, 1)},
+	{"journaldir",
+		func(c Config) interface{} { return c.JournalDir() },
+		nil},
+	{"cdnurl",
+		func(c Config) interface{} { return c.CDNURL() },
+		checkURL("cdnurl", Config.CDNURL, false)},
+	{"verifysample",
+		func(c Config) interface{} { return c.VerifySample() },
+		checkMin("verifysample", Config.VerifySample, 0)},
+	{"verifythreads",
+		func(c Config) interface{} { return c.VerifyThreads() },
+		checkMin("verifythreads", Config.VerifyThreads, 1)},
+	{"rewrite",
+		func(c Config) interface{} {
+			out := []string{}
+			for _, rule := range c.Rewrite() {
+				out = append(out, rule.String())
+			}
+			return out
+		},
+		nil},
+	{"contenttypes",
+		func(c Config) interface{} {
+			out := []string{}
+			for _, rule := range c.ContentTypes() {
+				out = append(out, rule.String())
+			}
+			return out
+		},
+		nil},
+}
+
+// isSet returns true if key is explicitly set in shared.
+func isSet(shared *sharedConfig, key string) bool {
+	value := reflect.ValueOf(shared).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		if value.Type().Field(i).Tag.Get("yaml") == key {
+			return !value.Field(i).IsZero()
+		}
+	}
+	return false
+}
+
+// settings resolves and checks every key for cfg. Where shared is an
+// environment's own config, keys not set in it are marked as inherited.
+func settings(cfg Config, shared *sharedConfig, isEnv bool) []Setting {
+	out := []Setting{}
+	for _, def := range settingDefs {
+		setting := Setting{Key: def.key, Value: def.value(cfg)}
+		if isEnv {
+			setting.Inherited = !isSet(shared, def.key)
+		}
+		if def.check != nil {
+			setting.Err = def.check(cfg)
+		}
+		out = append(out, setting)
+	}
+	return out
+}
+
+func (g *globalConfig) Settings() []Setting {
+	return settings(g, &g.sharedConfig, false)
+}
+
+func (e *environment) Settings() []Setting {
+	return settings(e, &e.sharedConfig, true)
+}
@@ -0,0 +1,158 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/stretchr/testify/assert"
+)
+
+// settingsByKey returns settings keyed by name.
+func settingsByKey(settings []Setting) map[string]Setting {
+	out := map[string]Setting{}
+	for _, setting := range settings {
+		out[setting.Key] = setting
+	}
+	return out
+}
+
+// settingErrors returns the error messages of settings keyed by name.
+func settingErrors(settings []Setting) map[string]string {
+	out := map[string]string{}
+	for _, setting := range settings {
+		if setting.Err != nil {
+			out[setting.Key] = setting.Err.Error()
+		}
+	}
+	return out
+}
+
+func TestSettingsValid(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"cert", "key"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := loadMatchConfig(t, `
+gwurl: https://exodus-gw.example.com
+gwcert: `+dir+`/cert
+gwkey: `+dir+`/key
+gwenv: live
+loglevel: trace
+logger: file:/var/log/exodus-rsync.log
+
+environments:
+- prefix: dest
+  gwenv: pre
+  gwcommit: phase1
+  rsyncmode: mixed
+  cdnurl: http://cdn.example.com:8080
+
+- prefix: rsync-only
+  rsyncmode: rsync
+  gwurl: ''
+`)
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	assert.Empty(t, settingErrors(cfg.Settings()))
+
+	global := settingsByKey(cfg.Settings())
+	assert.Equal(t, "live", global["gwenv"].Value)
+	assert.Equal(t, 5000, global["gwpollinterval"].Value)
+	assert.False(t, global["gwenv"].Inherited)
+
+	envs := cfg.Environments()
+	assert.Empty(t, settingErrors(envs[0].Settings()))
+	assert.Empty(t, settingErrors(envs[1].Settings()))
+
+	// Resolved values say whether they're set for the environment.
+	env := settingsByKey(envs[0].Settings())
+	assert.Equal(t, Setting{Key: "gwenv", Value: "pre"}, env["gwenv"])
+	assert.Equal(t, Setting{Key: "gwurl", Value: "https://exodus-gw.example.com", Inherited: true}, env["gwurl"])
+	assert.Equal(t, Setting{Key: "gwcommit", Value: "phase1"}, env["gwcommit"])
+	assert.Equal(t, Setting{Key: "rewrite", Value: []string{}, Inherited: true}, env["rewrite"])
+}
+
+func TestSettingsInvalid(t *testing.T) {
+	cfg, err := loadMatchConfig(t, `
+gwbatchsize: -1
+loglevel: loud
+logger: 'file:'
+
+environments:
+- prefix: dest
+  gwurl: exodus-gw.example.com
+  gwcert: /not/exist/cert
+  gwcacert: /not/exist/ca
+  gwcommit: Phase 1
+  rsyncmode: exodus-only
+  uploadthreads: -2
+  verifysample: -3
+  verifythreads: -1
+  cdnurl: ftp://cdn.example.com
+  logger: stdout
+`)
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	assert.Equal(t, map[string]string{
+		"gwbatchsize": "invalid 'gwbatchsize': -1, must be at least 1",
+		"loglevel":    "invalid 'loglevel': 'loud'",
+		"logger":      "invalid 'logger': 'file:' requires a path",
+	}, settingErrors(cfg.Settings()))
+
+	// The environment is checked with the values it inherits, and since
+	// it's not in rsync mode, gateway settings are required.
+	assert.Equal(t, map[string]string{
+		"gwurl":         "invalid 'gwurl': 'exodus-gw.example.com' is not an http(s) URL",
+		"gwenv":         "'gwenv' must be set to publish via exodus-gw",
+		"gwcert":        "can't read 'gwcert': open /not/exist/cert: no such file or directory",
+		"gwkey":         "'gwkey' must be set to publish via exodus-gw",
+		"gwcacert":      "can't read 'gwcacert': open /not/exist/ca: no such file or directory",
+		"gwbatchsize":   "invalid 'gwbatchsize': -1, must be at least 1",
+		"gwcommit":      "invalid 'gwcommit': 'Phase 1' is not a valid commit mode",
+		"rsyncmode":     "invalid 'rsyncmode': 'exodus-only', must be one of: exodus, rsync, mixed",
+		"loglevel":      "invalid 'loglevel': 'loud'",
+		"logger":        "invalid 'logger': 'stdout', must be one of: auto, journald, syslog, file:PATH",
+		"uploadthreads": "invalid 'uploadthreads': -2, must be at least 1",
+		"verifysample":  "invalid 'verifysample': -3, must be at least 0",
+		"verifythreads": "invalid 'verifythreads': -1, must be at least 1",
+		"cdnurl":        "invalid 'cdnurl': 'ftp://cdn.example.com' is not an http(s) URL",
+	}, settingErrors(cfg.Environments()[0].Settings()))
+}
+
+func TestLoadStrict(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.conf")
+	err := os.WriteFile(filename, []byte(`
+gwbatchsiz: 100
+environments:
+- prefix: dest
+  gwenvv: live
+`), 0644)
+	if err != nil {
+		t.Fatalf("could not write config file for test: %v", err)
+	}
+
+	// Unknown keys are ignored by default...
+	_, err = loadFromPath(filename, args.Config{})
+	assert.Nil(t, err)
+
+	// ...but not when checking the config.
+	_, err = loadFromPath(filename, args.Config{ExodusConfig: args.ExodusConfig{CheckConfig: true}})
+	if err == nil {
+		t.Fatal("unexpectedly loaded config")
+	}
+	for _, message := range []string{"line 2: field gwbatchsiz not found", "line 5: field gwenvv not found"} {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("missing %q in error: %v", message, err)
+		}
+	}
+}
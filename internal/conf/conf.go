@@ -28,6 +28,10 @@ type Config interface {
 	// Path to private key used to authenticate with exodus-gw.
 	GwKey() string
 
+	// Path to CA certificate(s) trusted for connections to exodus-gw,
+	// or empty to trust the system CAs.
+	GwCACert() string
+
 	// Base URL of exodus-gw service in use.
 	GwURL() string
 
@@ -49,6 +53,10 @@ type Config interface {
 	// Maximum backoff between retried HTTP requests, in milliseconds.
 	GwMaxBackoff() int
 
+	// Maximum time to wait for an exodus-gw task to complete, in seconds,
+	// or 0 to wait indefinitely.
+	GwTaskTimeout() int
+
 	// Execution mode for rsync.
 	RsyncMode() string
 
@@ -67,8 +75,49 @@ type Config interface {
 	// Strips this prefix from the destination path of exodus publish items.
 	Strip() string
 
+	// Rules rewriting the web URIs of exodus publish items, after stripping.
+	// The first matching rule applies.
+	Rewrite() RewriteRules
+
+	// Rules setting the content type of exodus publish items by web URI,
+	// rather than detecting it from file content. The first matching rule
+	// applies.
+	ContentTypes() ContentTypeRules
+
 	// Number of threads used to upload files to the CDN.
 	UploadThreads() int
+
+	// Number of threads used to check for presence of blobs on the CDN.
+	PresenceThreads() int
+
+	// Maximum rate of uploads to the CDN in bytes per second, shared by all
+	// upload threads, or 0 if unlimited.
+	UploadBwLimit() int64
+
+	// Path to the persistent cache of file checksums, or empty if the
+	// cache is disabled.
+	HashCache() string
+
+	// Maximum number of entries kept in the checksum cache.
+	HashCacheSize() int
+
+	// Path to the directory holding journals of runs in progress, or empty
+	// if journals are disabled.
+	JournalDir() string
+
+	// Base URL of the CDN serving published content, used by --exodus-verify.
+	CDNURL() string
+
+	// Number of published items checked by --exodus-verify, or 0 to check
+	// all of them.
+	VerifySample() int
+
+	// Max number of items fetched concurrently by --exodus-verify.
+	VerifyThreads() int
+
+	// Resolved value of every config key, along with any problem with
+	// that value, for --exodus-check-config.
+	Settings() []Setting
 }
 
 // EnvironmentConfig provides configuration specific to one environment.
@@ -76,11 +125,24 @@ type EnvironmentConfig interface {
 	Config
 
 	Prefix() string
+
+	// Path of the config file defining this environment.
+	Source() string
+
+	// Configuration this environment belongs to.
+	Global() GlobalConfig
 }
 
 // GlobalConfig provides configuration applied to all environments.
 type GlobalConfig interface {
 	Config
 
+	// All configured environments, in the order they were loaded.
+	Environments() []EnvironmentConfig
+
 	EnvironmentForDest(context.Context, string) EnvironmentConfig
+
+	// Like EnvironmentForDest, but returns an error if the destination
+	// matches several environments equally.
+	MatchEnvironment(context.Context, string) (EnvironmentConfig, error)
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/release-engineering/exodus-rsync/internal/args"
@@ -31,21 +32,28 @@ gwenv: global-env
 gwurl: $TEST_EXODUS_GW_URL
 gwcert: global-cert
 gwkey: global-key
+gwcacert: $TEST_EXODUS_GW_URL/ca
 gwbatchsize: 100
 gwcommit: abc
 strip: dest:/foo
+cdnurl: https://cdn.example.com
 
 environments:
 - prefix: dest:/foo/bar/baz
   gwenv: $TEST_EXODUS_GW_ENV
   gwkey: override-key
+  gwcacert: override-ca
   gwpollinterval: 123
   gwcommit: cba
   gwmaxattempts: 50
   gwmaxbackoff: 60
+  gwtasktimeout: 3600
   rsyncmode: mixed
   strip: dest:/foo/bar
   uploadthreads: 6
+  presencethreads: 8
+  verifysample: 20
+  verifythreads: 2
 
 `), 0755)
 
@@ -99,30 +107,42 @@ environments:
 	// Global values should be as expected.
 	assertEqual("global gwcert", cfg.GwCert(), "global-cert")
 	assertEqual("global gwkey", cfg.GwKey(), "global-key")
+	assertEqual("global gwcacert", cfg.GwCACert(), "https://exodus-gw.example.com/ca")
 	assertEqual("global gwenv", cfg.GwEnv(), "global-env")
 	assertEqual("global gwpollinterval", cfg.GwPollInterval(), 5000)
 	assertEqual("global gwcommit", cfg.GwCommit(), "abc")
 	assertEqual("global gwmaxattempts", cfg.GwMaxAttempts(), 10)
 	assertEqual("global gwmaxbackoff", cfg.GwMaxBackoff(), 20000)
+	assertEqual("global gwtasktimeout", cfg.GwTaskTimeout(), 0)
 	assertEqual("global rsyncmode", cfg.RsyncMode(), "exodus")
 	assertEqual("global strip", cfg.Strip(), "dest:/foo")
 	assertEqual("global uploadthreads", cfg.UploadThreads(), 4)
+	assertEqual("global presencethreads", cfg.PresenceThreads(), 4)
+	assertEqual("global cdnurl", cfg.CDNURL(), "https://cdn.example.com")
+	assertEqual("global verifysample", cfg.VerifySample(), 0)
+	assertEqual("global verifythreads", cfg.VerifyThreads(), 4)
 
 	// Values can be overridden in environment.
 	assertEqual("env gwenv", env.GwEnv(), "one-env")
 	assertEqual("env gwkey", env.GwKey(), "override-key")
+	assertEqual("env gwcacert", env.GwCACert(), "override-ca")
 	assertEqual("env gwpollinterval", env.GwPollInterval(), 123)
 	assertEqual("env gwcommit", env.GwCommit(), "cba")
 	assertEqual("env gwmaxattempts", env.GwMaxAttempts(), 50)
 	assertEqual("env gwmaxbackoff", env.GwMaxBackoff(), 60)
+	assertEqual("env gwtasktimeout", env.GwTaskTimeout(), 3600)
 	assertEqual("env rsyncmode", env.RsyncMode(), "mixed")
 	assertEqual("env strip", env.Strip(), "dest:/foo/bar")
 	assertEqual("env uploadthreads", env.UploadThreads(), 6)
+	assertEqual("env presencethreads", env.PresenceThreads(), 8)
+	assertEqual("env verifysample", env.VerifySample(), 20)
+	assertEqual("env verifythreads", env.VerifyThreads(), 2)
 
 	// For values which are NOT overridden, they should be equal to global.
 	assertEqual("env gwurl", env.GwURL(), cfg.GwURL())
 	assertEqual("env gwcert", env.GwCert(), cfg.GwCert())
 	assertEqual("env gwbatchsize", env.GwBatchSize(), cfg.GwBatchSize())
+	assertEqual("env cdnurl", env.CDNURL(), cfg.CDNURL())
 
 	t.Cleanup(func() {
 		os.Setenv("TEST_EXODUS_GW_ENV", oldEnv)
@@ -130,6 +150,47 @@ environments:
 	})
 }
 
+func TestOverrideZero(t *testing.T) {
+	cfg, err := loadMatchConfig(t, `
+gwtasktimeout: 60
+verifysample: 10
+
+environments:
+- prefix: zero
+  gwtasktimeout: 0
+  verifysample: 0
+- prefix: unset
+`)
+	if err != nil {
+		t.Fatalf("unexpected error loading config: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	// An explicit 0 in an environment overrides the global value, while
+	// leaving it unset inherits it.
+	zero := cfg.EnvironmentForDest(ctx, "zero:/foo")
+	unset := cfg.EnvironmentForDest(ctx, "unset:/foo")
+	if got := zero.GwTaskTimeout(); got != 0 {
+		t.Errorf("zero gwtasktimeout = %d", got)
+	}
+	if got := unset.GwTaskTimeout(); got != 60 {
+		t.Errorf("unset gwtasktimeout = %d", got)
+	}
+	if got := zero.VerifySample(); got != 0 {
+		t.Errorf("zero verifysample = %d", got)
+	}
+	if got := unset.VerifySample(); got != 10 {
+		t.Errorf("unset verifysample = %d", got)
+	}
+	for _, key := range []string{"gwtasktimeout", "verifysample"} {
+		if settingsByKey(zero.Settings())[key].Inherited {
+			t.Errorf("zero %s reported as inherited", key)
+		}
+	}
+}
+
 func TestDefaultsFromParent(t *testing.T) {
 	cfg := globalConfig{}
 
@@ -149,3 +210,155 @@ func TestDefaultsFromParent(t *testing.T) {
 		t.Errorf("did not get args.Verbose from parent")
 	}
 }
+
+func TestHashCachePaths(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.conf")
+
+	t.Setenv("TEST_EXODUS_CACHE_DIR", "/some/cache")
+
+	err := os.WriteFile(filename, []byte(`
+hashcache: auto
+hashcachesize: 10
+
+environments:
+- prefix: inherit
+
+- prefix: expand
+  hashcache: $TEST_EXODUS_CACHE_DIR/hashes
+  hashcachesize: 20
+
+- prefix: disabled
+  hashcache: none
+`), 0644)
+	if err != nil {
+		t.Fatalf("could not write config file for test: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	cfg, err := loadFromPath(filename, args.Config{})
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	// "auto" should resolve to a path within the cache directory.
+	auto := cfg.HashCache()
+	assert.True(t, filepath.IsAbs(auto), "not an absolute path: %v", auto)
+	assert.Equal(t, "hashcache", filepath.Base(auto))
+	assert.Equal(t, 10, cfg.HashCacheSize())
+
+	inherit := cfg.EnvironmentForDest(ctx, "inherit:/foo")
+	assert.Equal(t, auto, inherit.HashCache())
+	assert.Equal(t, 10, inherit.HashCacheSize())
+
+	expand := cfg.EnvironmentForDest(ctx, "expand:/foo")
+	assert.Equal(t, "/some/cache/hashes", expand.HashCache())
+	assert.Equal(t, 20, expand.HashCacheSize())
+
+	disabled := cfg.EnvironmentForDest(ctx, "disabled:/foo")
+	assert.Equal(t, "", disabled.HashCache())
+}
+
+func TestJournalDirPaths(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.conf")
+
+	t.Setenv("TEST_EXODUS_STATE_DIR", "/some/state")
+
+	err := os.WriteFile(filename, []byte(`
+journaldir: auto
+
+environments:
+- prefix: inherit
+
+- prefix: expand
+  journaldir: $TEST_EXODUS_STATE_DIR/journal
+
+- prefix: disabled
+  journaldir: none
+`), 0644)
+	if err != nil {
+		t.Fatalf("could not write config file for test: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	cfg, err := loadFromPath(filename, args.Config{})
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	// "auto" should resolve to a path within the state directory.
+	auto := cfg.JournalDir()
+	assert.True(t, filepath.IsAbs(auto), "not an absolute path: %v", auto)
+	assert.Equal(t, "journal", filepath.Base(auto))
+
+	assert.Equal(t, auto, cfg.EnvironmentForDest(ctx, "inherit:/foo").JournalDir())
+	assert.Equal(t, "/some/state/journal", cfg.EnvironmentForDest(ctx, "expand:/foo").JournalDir())
+	assert.Equal(t, "", cfg.EnvironmentForDest(ctx, "disabled:/foo").JournalDir())
+}
+
+func TestUploadBwLimit(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.conf")
+
+	err := os.WriteFile(filename, []byte(`
+uploadbwlimit: 10m
+
+environments:
+- prefix: inherit
+
+- prefix: override
+  uploadbwlimit: 500kb
+
+- prefix: unlimited
+  uploadbwlimit: "0"
+`), 0644)
+	if err != nil {
+		t.Fatalf("could not write config file for test: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	cfg, err := loadFromPath(filename, args.Config{})
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	assert.Equal(t, int64(10<<20), cfg.UploadBwLimit())
+	assert.Equal(t, int64(10<<20), cfg.EnvironmentForDest(ctx, "inherit:/foo").UploadBwLimit())
+	assert.Equal(t, int64(500000), cfg.EnvironmentForDest(ctx, "override:/foo").UploadBwLimit())
+	assert.Equal(t, int64(0), cfg.EnvironmentForDest(ctx, "unlimited:/foo").UploadBwLimit())
+
+	// --bwlimit overrides the config for every environment.
+	cfg, err = loadFromPath(filename, args.Config{BwLimit: "100"})
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	assert.Equal(t, int64(102400), cfg.UploadBwLimit())
+	assert.Equal(t, int64(102400), cfg.EnvironmentForDest(ctx, "override:/foo").UploadBwLimit())
+}
+
+func TestUploadBwLimitInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"global": "uploadbwlimit: fast\n",
+		"env":    "environments:\n- prefix: dest\n  uploadbwlimit: 1b\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.conf")
+			if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+				t.Fatalf("could not write config file for test: %v", err)
+			}
+
+			_, err := loadFromPath(filename, args.Config{})
+			if err == nil || !strings.Contains(err.Error(), "invalid uploadbwlimit") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
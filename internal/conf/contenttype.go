@@ -0,0 +1,69 @@
+package conf
+
+import (
+	"fmt"
+	"mime"
+
+	"github.com/release-engineering/exodus-rsync/internal/filter"
+)
+
+// ContentTypeRule sets the content type of published files whose web URI
+// matches a pattern.
+type ContentTypeRule struct {
+	// Pattern matched against web URIs, using the same syntax as rsync
+	// include/exclude patterns.
+	PatternRaw string `yaml:"pattern"`
+
+	TypeRaw string `yaml:"type"`
+
+	pattern filter.Pattern
+}
+
+// ContentTypeRules is an ordered list of rules setting content types.
+type ContentTypeRules []ContentTypeRule
+
+// NewContentTypeRule returns a rule setting the content type of files matching
+// pattern to contentType.
+func NewContentTypeRule(pattern, contentType string) (ContentTypeRule, error) {
+	out := ContentTypeRule{PatternRaw: pattern, TypeRaw: contentType}
+	err := out.compile()
+	return out, err
+}
+
+// compile validates the rule, preparing it for use.
+func (r *ContentTypeRule) compile() error {
+	if r.PatternRaw == "" {
+		return fmt.Errorf("'pattern' must be set")
+	}
+	if _, _, err := mime.ParseMediaType(r.TypeRaw); err != nil {
+		return fmt.Errorf("invalid type '%s': %w", r.TypeRaw, err)
+	}
+
+	r.pattern = filter.NewPattern(r.PatternRaw)
+	return nil
+}
+
+func (r *ContentTypeRule) String() string {
+	return fmt.Sprintf("%s => %s", r.PatternRaw, r.TypeRaw)
+}
+
+// Match returns the content type set by the first rule matching uri, and
+// the rule, or nil if no rule matches.
+func (rules ContentTypeRules) Match(uri string) (string, *ContentTypeRule) {
+	for i := range rules {
+		if rules[i].pattern.Matches(uri) {
+			return rules[i].TypeRaw, &rules[i]
+		}
+	}
+	return "", nil
+}
+
+// compile validates all rules, preparing them for use.
+func (rules ContentTypeRules) compile() error {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return fmt.Errorf("content type rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package conf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentTypeRulesMatch(t *testing.T) {
+	var rules ContentTypeRules
+	for _, rule := range [][2]string{
+		{"*.xml.gz", "application/x-gzip"},
+		{"/content/*/.treeinfo", "text/plain"},
+		{"ks", "text/plain; charset=utf-8"},
+		{"*", "application/octet-stream"},
+	} {
+		compiled, err := NewContentTypeRule(rule[0], rule[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, compiled)
+	}
+
+	tests := map[string]string{
+		"/content/dist/repodata/primary.xml.gz": "application/x-gzip",
+		"/content/dist/.treeinfo":               "text/plain",
+		"/content/dist/os/ks":                   "text/plain; charset=utf-8",
+		"/content/dist/os/.treeinfo":            "application/octet-stream",
+	}
+	for uri, want := range tests {
+		got, rule := rules.Match(uri)
+		if got != want || rule == nil || rule.TypeRaw != want {
+			t.Errorf("Match(%q) = %q, %v; want %q", uri, got, rule, want)
+		}
+	}
+
+	got, rule := rules[:3].Match("/content/dist/other")
+	if got != "" || rule != nil {
+		t.Errorf("unexpected match: %q, %v", got, rule)
+	}
+
+	assert.Equal(t, "*.xml.gz => application/x-gzip", rules[0].String())
+}
+
+func TestContentTypeRuleInvalid(t *testing.T) {
+	tests := []struct {
+		pattern, contentType string
+		message              string
+	}{
+		{"", "text/plain", "'pattern' must be set"},
+		{"*.repo", "", "invalid type ''"},
+		{"*.repo", "text plain", "invalid type 'text plain'"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewContentTypeRule(tt.pattern, tt.contentType)
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("NewContentTypeRule(%q, %q): unexpected error %v", tt.pattern, tt.contentType, err)
+		}
+	}
+}
+
+func TestContentTypesConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.conf")
+
+	err := os.WriteFile(filename, []byte(`
+contenttypes:
+- pattern: "*.repo"
+  type: text/plain
+
+environments:
+- prefix: inherit
+
+- prefix: override
+  contenttypes:
+  - pattern: "*.xml.gz"
+    type: application/x-gzip
+`), 0644)
+	if err != nil {
+		t.Fatalf("could not write config file for test: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	cfg, err := loadFromPath(filename, args.Config{})
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	match := func(rules ContentTypeRules, uri string) string {
+		out, _ := rules.Match(uri)
+		return out
+	}
+
+	assert.Equal(t, "text/plain", match(cfg.ContentTypes(), "/content/x.repo"))
+	assert.Equal(t, "text/plain", match(cfg.EnvironmentForDest(ctx, "inherit:/foo").ContentTypes(), "/content/x.repo"))
+
+	// Rules in an environment replace global rules entirely.
+	override := cfg.EnvironmentForDest(ctx, "override:/foo").ContentTypes()
+	assert.Equal(t, "application/x-gzip", match(override, "/content/x.xml.gz"))
+	assert.Equal(t, "", match(override, "/content/x.repo"))
+}
+
+func TestContentTypesConfigInvalid(t *testing.T) {
+	for name, tt := range map[string]struct{ content, message string }{
+		"global": {
+			"contenttypes:\n- type: text/plain\n",
+			"invalid contenttypes: content type rule 1: 'pattern' must be set",
+		},
+		"env": {
+			"environments:\n- prefix: dest\n  contenttypes:\n  - pattern: '*.repo'\n    type: text/plain\n  - pattern: '*.gz'\n",
+			"invalid contenttypes for 'dest': content type rule 2: invalid type ''",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.conf")
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("could not write config file for test: %v", err)
+			}
+
+			_, err := loadFromPath(filename, args.Config{})
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package conf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfigFiles writes each of files, relative to a new temporary
+// directory, returning the directory.
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatalf("could not write config file for test: %v", err)
+		}
+	}
+	return dir
+}
+
+// setDropInDirs replaces the system-wide and user drop-in directories for the
+// duration of a test, so that any on the host aren't loaded.
+func setDropInDirs(t *testing.T, system string, configHome string) {
+	oldSystem, oldConfigHome := systemDropInDir, xdg.ConfigHome
+	t.Cleanup(func() {
+		systemDropInDir, xdg.ConfigHome = oldSystem, oldConfigHome
+	})
+	systemDropInDir, xdg.ConfigHome = system, configHome
+}
+
+func TestLoadIncludes(t *testing.T) {
+	setDropInDirs(t, t.TempDir(), t.TempDir())
+
+	dir := writeConfigFiles(t, map[string]string{
+		"exodus-rsync.conf": `
+gwenv: global-env
+include:
+- teams/*.yaml
+- other.yaml
+- missing/*.yaml
+
+environments:
+- prefix: main
+`,
+		"teams/b.yaml": "environments:\n- prefix: team-b\n",
+		"teams/a.yaml": "environments:\n- prefix: team-a\n  gwenv: a-env\n",
+		"other.yaml":   "include: [nested/more.yaml]\nenvironments:\n- prefix: other\n",
+
+		"nested/more.yaml": "environments:\n- prefix: nested\n",
+
+		// Drop-ins are loaded after includes, in order of name.
+		"exodus-rsync.conf.d/20-second.conf": "environments:\n- prefix: second\n",
+		"exodus-rsync.conf.d/10-first.conf":  "environments:\n- prefix: first\n",
+
+		// This one is also loaded as a drop-in, but only the first time counts.
+		"exodus-rsync.conf.d/00-included.conf": "include: [../other.yaml]\n",
+
+		// Empty drop-ins are fine, and files not ending in .conf are ignored.
+		"exodus-rsync.conf.d/30-empty.conf":       "# Nothing here yet\n",
+		"exodus-rsync.conf.d/40-ignored.conf.bak": "environments:\n- prefix: first\n",
+	})
+	path := filepath.Join(dir, "exodus-rsync.conf")
+
+	cfg, err := loadFromPath(path, args.Config{})
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	var prefixes, sources []string
+	for _, env := range cfg.Environments() {
+		prefixes = append(prefixes, env.Prefix())
+		sources = append(sources, strings.TrimPrefix(env.Source(), dir+"/"))
+	}
+	assert.Equal(t, []string{"main", "team-a", "team-b", "other", "nested", "first", "second"}, prefixes)
+	assert.Equal(t, []string{
+		"exodus-rsync.conf",
+		"teams/a.yaml",
+		"teams/b.yaml",
+		"other.yaml",
+		"nested/more.yaml",
+		"exodus-rsync.conf.d/10-first.conf",
+		"exodus-rsync.conf.d/20-second.conf",
+	}, sources)
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	// Included environments inherit from the main config file as usual.
+	assert.Equal(t, "global-env", cfg.EnvironmentForDest(ctx, "first:/foo").GwEnv())
+	assert.Equal(t, "a-env", cfg.EnvironmentForDest(ctx, "team-a:/foo").GwEnv())
+	assert.Equal(t, cfg, cfg.EnvironmentForDest(ctx, "nested:/foo").Global())
+}
+
+func TestLoadIncludesInvalid(t *testing.T) {
+	setDropInDirs(t, t.TempDir(), t.TempDir())
+
+	for name, tt := range map[string]struct {
+		files   map[string]string
+		message string
+	}{
+		"missing config": {
+			map[string]string{},
+			"open DIR/exodus-rsync.conf: no such file or directory",
+		},
+		"unparseable config": {
+			map[string]string{"exodus-rsync.conf": "environments: [\n"},
+			"can't parse DIR/exodus-rsync.conf",
+		},
+		"missing include": {
+			map[string]string{"exodus-rsync.conf": "include: [missing.yaml]\n"},
+			"can't include config: open DIR/missing.yaml: no such file or directory",
+		},
+		"invalid glob": {
+			map[string]string{"exodus-rsync.conf": "include: ['[x']\n"},
+			"invalid include 'DIR/[x' in DIR/exodus-rsync.conf: syntax error in pattern",
+		},
+		"duplicate across files": {
+			map[string]string{
+				"exodus-rsync.conf":              "environments:\n- prefix: dest\n",
+				"exodus-rsync.conf.d/other.conf": "environments:\n- prefix: other\n  aliases: [dest]\n",
+			},
+			"duplicate environment definitions for 'dest' (in DIR/exodus-rsync.conf and DIR/exodus-rsync.conf.d/other.conf)",
+		},
+		"invalid environment in include": {
+			map[string]string{
+				"exodus-rsync.conf":              "environments: []\n",
+				"exodus-rsync.conf.d/other.conf": "environments:\n- prefix: dest\n  match: wildcard\n",
+			},
+			"invalid environment 'dest': invalid match 'wildcard'",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := writeConfigFiles(t, tt.files)
+
+			cfg, err := loadFromPath(filepath.Join(dir, "exodus-rsync.conf"), args.Config{})
+			message := strings.ReplaceAll(tt.message, "DIR", dir)
+			if err == nil || !strings.Contains(err.Error(), message) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if cfg != nil {
+				t.Errorf("unexpected config: %v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadIncludesStrict(t *testing.T) {
+	setDropInDirs(t, t.TempDir(), t.TempDir())
+
+	dir := writeConfigFiles(t, map[string]string{
+		"exodus-rsync.conf":              "environments: []\n",
+		"exodus-rsync.conf.d/other.conf": "gwurl: https://example.com\nenvironments:\n- prefix: other\n",
+	})
+	path := filepath.Join(dir, "exodus-rsync.conf")
+
+	// Global keys in included files are ignored like unknown keys...
+	cfg, err := loadFromPath(path, args.Config{})
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+	assert.Equal(t, "", cfg.GwURL())
+	assert.Len(t, cfg.Environments(), 1)
+
+	// ...but not when checking the config.
+	_, err = loadFromPath(path, args.Config{ExodusConfig: args.ExodusConfig{CheckConfig: true}})
+	message := "can't parse " + dir + "/exodus-rsync.conf.d/other.conf: yaml: unmarshal errors:\n  line 1: field gwurl not found"
+	if err == nil || !strings.Contains(err.Error(), message) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadDropInDirs(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"etc/exodus-rsync.conf":                 "environments:\n- prefix: main\n",
+		"etc/exodus-rsync.conf.d/10-sys.conf":   "environments:\n- prefix: sys\n",
+		"home/exodus-rsync.conf.d/00-user.conf": "environments:\n- prefix: user\n",
+		"local/exodus-rsync.conf":               "environments:\n- prefix: local\n",
+		"local/exodus-rsync.conf.d/50.conf":     "environments:\n- prefix: local-dropin\n",
+	})
+	setDropInDirs(t, filepath.Join(dir, "etc/exodus-rsync.conf.d"), filepath.Join(dir, "home"))
+
+	prefixes := func(path string) []string {
+		cfg, err := loadFromPath(filepath.Join(dir, path), args.Config{})
+		if err != nil {
+			t.Fatalf("could not load %s: %v", path, err)
+		}
+		out := []string{}
+		for _, env := range cfg.Environments() {
+			out = append(out, env.Prefix())
+		}
+		return out
+	}
+
+	// The system-wide drop-in directory is next to the system config file,
+	// so it's loaded once, before the user's.
+	assert.Equal(t, []string{"main", "sys", "user"}, prefixes("etc/exodus-rsync.conf"))
+
+	// Any other config file has its own drop-in directory loaded first.
+	assert.Equal(t, []string{"local", "local-dropin", "sys", "user"}, prefixes("local/exodus-rsync.conf"))
+}
@@ -3,7 +3,10 @@ package conf
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/adrg/xdg"
@@ -20,67 +23,261 @@ func candidatePaths() []string {
 	}
 }
 
+// systemDropInDir is the system-wide drop-in directory of environments.
+var systemDropInDir = "/etc/exodus-rsync.conf.d"
+
+// dropInDirs returns the drop-in directories of environments for the config
+// file at path, in the order they're loaded: the one next to that file, then
+// the system-wide one, then the user's.
+func dropInDirs(path string) []string {
+	return []string{
+		path + ".d",
+		systemDropInDir,
+		xdg.ConfigHome + "/exodus-rsync.conf.d",
+	}
+}
+
 func normalizeURL(gwURL string) string {
 	return strings.TrimRight(gwURL, "/")
 }
 
+func normalizeHashCache(path string) string {
+	if path == "auto" {
+		return filepath.Join(xdg.CacheHome, "exodus-rsync", "hashcache")
+	}
+	return os.ExpandEnv(path)
+}
+
+func normalizeJournalDir(path string) string {
+	if path == "auto" {
+		return filepath.Join(xdg.StateHome, "exodus-rsync", "journal")
+	}
+	return os.ExpandEnv(path)
+}
+
+func validateBwLimit(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := args.ParseBwLimit(value); err != nil {
+		return fmt.Errorf("invalid uploadbwlimit: %w", err)
+	}
+	return nil
+}
+
 func loadFromPath(path string, args args.Config) (*globalConfig, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return &globalConfig{}, err
+		return nil, err
 	}
 	defer file.Close()
 
 	dec := yaml.NewDecoder(file)
+	// Unknown keys are usually ignored, so that configs can be shared with
+	// older versions, but are reported when checking the config.
+	dec.KnownFields(args.CheckConfig)
+
 	out := &globalConfig{}
 	out.args = args
 
 	err = dec.Decode(&out)
 	if err != nil {
-		return &globalConfig{}, fmt.Errorf("can't parse %s: %w", path, err)
+		return nil, fmt.Errorf("can't parse %s: %w", path, err)
+	}
+
+	for i := range out.EnvironmentsRaw {
+		out.EnvironmentsRaw[i].source = path
+	}
+	if err := out.loadIncludes(path, args.CheckConfig); err != nil {
+		return nil, err
 	}
 
 	// A few vars support env var expansion for convenience
 	out.GwCertRaw = os.ExpandEnv(out.GwCertRaw)
 	out.GwKeyRaw = os.ExpandEnv(out.GwKeyRaw)
+	out.GwCACertRaw = os.ExpandEnv(out.GwCACertRaw)
 	out.GwURLRaw = normalizeURL(os.ExpandEnv(out.GwURLRaw))
 	out.GwEnvRaw = os.ExpandEnv(out.GwEnvRaw)
+	out.HashCacheRaw = normalizeHashCache(out.HashCacheRaw)
+	out.JournalDirRaw = normalizeJournalDir(out.JournalDirRaw)
 
 	// Command-line arg overrides config from file
 	if args.Commit != "" {
 		out.GwCommitRaw = args.Commit
 	}
+	if args.BwLimit != "" {
+		out.UploadBwLimitRaw = string(args.BwLimit)
+	}
+	if err := validateBwLimit(out.UploadBwLimitRaw); err != nil {
+		return nil, err
+	}
+	if err := out.RewriteRaw.compile(); err != nil {
+		return nil, fmt.Errorf("invalid rewrite: %w", err)
+	}
+	if err := out.ContentTypesRaw.compile(); err != nil {
+		return nil, fmt.Errorf("invalid contenttypes: %w", err)
+	}
 
 	// Fill in the Environment parent references
-	prefs := map[string]bool{}
 	for i := range out.EnvironmentsRaw {
 		env := &out.EnvironmentsRaw[i]
 
 		// A few vars support env var expansion for convenience
 		env.GwCertRaw = os.ExpandEnv(env.GwCertRaw)
 		env.GwKeyRaw = os.ExpandEnv(env.GwKeyRaw)
+		env.GwCACertRaw = os.ExpandEnv(env.GwCACertRaw)
 		env.GwURLRaw = normalizeURL(os.ExpandEnv(env.GwURLRaw))
 		env.GwEnvRaw = os.ExpandEnv(env.GwEnvRaw)
+		env.HashCacheRaw = normalizeHashCache(env.HashCacheRaw)
+		env.JournalDirRaw = normalizeJournalDir(env.JournalDirRaw)
 
 		// Command-line arg overrides config from file
 		if args.Commit != "" {
 			env.GwCommitRaw = args.Commit
 		}
+		if args.BwLimit != "" {
+			env.UploadBwLimitRaw = string(args.BwLimit)
+		}
+		if err := validateBwLimit(env.UploadBwLimitRaw); err != nil {
+			return nil, err
+		}
+		if err := env.RewriteRaw.compile(); err != nil {
+			return nil, fmt.Errorf("invalid rewrite for '%s': %w", env.Prefix(), err)
+		}
+		if err := env.ContentTypesRaw.compile(); err != nil {
+			return nil, fmt.Errorf("invalid contenttypes for '%s': %w", env.Prefix(), err)
+		}
 
-		if !strings.HasPrefix(env.Prefix(), out.Strip()) {
-			return nil, fmt.Errorf("cannot strip '%s' prefix from '%s'", out.Strip(), env.Prefix())
+		if err := env.compile(); err != nil {
+			return nil, fmt.Errorf("invalid environment '%s': %w", env.Prefix(), err)
 		}
-		if prefs[env.Prefix()] {
-			return nil, fmt.Errorf("duplicate environment definitions for '%s'", env.Prefix())
+		for _, pattern := range env.patterns {
+			// Globs and regexes can only be checked once matched.
+			if pattern.kind == "prefix" && !strings.HasPrefix(pattern.text, out.Strip()) {
+				return nil, fmt.Errorf("cannot strip '%s' prefix from '%s'", out.Strip(), pattern.text)
+			}
 		}
-		prefs[env.Prefix()] = true
 		out.EnvironmentsRaw[i].parent = out
 
 	}
 
+	if err := out.checkOverlaps(); err != nil {
+		return nil, err
+	}
+
 	return out, nil
 }
 
+// configFragment is the content of a config file included by another, which
+// may only define environments.
+type configFragment struct {
+	EnvironmentsRaw []environment `yaml:"environments"`
+	IncludeRaw      []string      `yaml:"include"`
+}
+
+// expandIncludes returns the paths of files matching the include patterns
+// of the config file at path. Relative patterns are relative to the
+// directory of that file, and files matching a glob are sorted by name.
+func expandIncludes(path string, patterns []string) ([]string, error) {
+	out := []string{}
+	for _, pattern := range patterns {
+		pattern = os.ExpandEnv(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include '%s' in %s: %w", pattern, path, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[\`) {
+			// A missing file which was explicitly included is an error,
+			// unlike a glob matching nothing.
+			matches = []string{pattern}
+		}
+		sort.Strings(matches)
+		out = append(out, matches...)
+	}
+	return out, nil
+}
+
+// loadIncludes appends the environments defined in files included by the
+// config file at path, followed by those in each of its drop-in directories
+// (see dropInDirs), any *.conf in order of name. Each file is loaded at most
+// once, so a drop-in directory which is also next to the config file in use
+// is only loaded once.
+//
+// Included files are as strict about unknown keys as the main config file.
+func (c *globalConfig) loadIncludes(path string, strict bool) error {
+	paths, err := expandIncludes(path, c.IncludeRaw)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dropInDirs(path) {
+		dropIns, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(dropIns)
+		paths = append(paths, dropIns...)
+	}
+
+	loaded := map[string]bool{}
+	if abs, err := filepath.Abs(path); err == nil {
+		loaded[abs] = true
+	}
+
+	return c.loadFragments(paths, loaded, strict)
+}
+
+// loadFragments appends the environments defined in each of paths, and
+// in any files they include, skipping those already loaded.
+func (c *globalConfig) loadFragments(paths []string, loaded map[string]bool, strict bool) error {
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if loaded[abs] {
+			continue
+		}
+		loaded[abs] = true
+
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("can't include config: %w", err)
+		}
+
+		// Only environments can be defined in included files, so that the
+		// top-level config can't be overridden from several places. Other
+		// keys are ignored like any unknown key.
+		dec := yaml.NewDecoder(file)
+		dec.KnownFields(strict)
+
+		fragment := configFragment{}
+		err = dec.Decode(&fragment)
+		file.Close()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("can't parse %s: %w", path, err)
+		}
+
+		for i := range fragment.EnvironmentsRaw {
+			fragment.EnvironmentsRaw[i].source = path
+		}
+		c.EnvironmentsRaw = append(c.EnvironmentsRaw, fragment.EnvironmentsRaw...)
+
+		nested, err := expandIncludes(path, fragment.IncludeRaw)
+		if err != nil {
+			return err
+		}
+		if err := c.loadFragments(nested, loaded, strict); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (impl) Load(ctx context.Context, args args.Config) (GlobalConfig, error) {
 	logger := log.FromContext(ctx)
 
@@ -93,31 +290,14 @@ func (impl) Load(ctx context.Context, args args.Config) (GlobalConfig, error) {
 		_, err := os.Stat(candidate)
 		if err == nil {
 			logger.F("path", candidate).Debug("loading config")
-			return loadFromPath(candidate, args)
+			cfg, err := loadFromPath(candidate, args)
+			if err != nil {
+				return nil, err
+			}
+			return cfg, nil
 		}
 		logger.F("path", candidate, "error", err).Debug("config file not usable")
 	}
 
 	return nil, &MissingConfigFile{candidates: candidates}
 }
-
-// EnvironmentForDest finds and returns an Environment matching the specified rsync
-// destination, or nil if no Environment matches.
-func (c *globalConfig) EnvironmentForDest(ctx context.Context, dest string) EnvironmentConfig {
-	logger := log.FromContext(ctx)
-
-	for i := range c.EnvironmentsRaw {
-		out := &c.EnvironmentsRaw[i]
-		prefix := out.Prefix()
-		if !strings.Contains(prefix, ":") {
-			prefix = prefix + ":"
-		}
-		if strings.HasPrefix(dest, prefix) {
-			return out
-		}
-	}
-
-	logger.F("dest", dest).Debug("no matching environment in config")
-
-	return nil
-}
@@ -0,0 +1,260 @@
+package conf
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+// destPattern matches the start of rsync destinations, for selecting an
+// environment.
+type destPattern struct {
+	kind string
+	text string
+
+	regex *regexp.Regexp
+}
+
+// withColon returns a prefix which only matches the host part of a
+// destination, if it doesn't include a path.
+func withColon(prefix string) string {
+	if !strings.Contains(prefix, ":") {
+		return prefix + ":"
+	}
+	return prefix
+}
+
+func newDestPattern(kind string, text string) (destPattern, error) {
+	out := destPattern{kind: kind, text: text}
+
+	switch kind {
+	case "prefix":
+	case "glob":
+		if _, err := path.Match(text, ""); err != nil {
+			return out, fmt.Errorf("invalid glob '%s': %w", text, err)
+		}
+	case "regex":
+		// Like other kinds, a regex only needs to match the start of a
+		// destination.
+		regex, err := regexp.Compile("^(?:" + text + ")")
+		if err != nil {
+			return out, fmt.Errorf("invalid regex '%s': %w", text, err)
+		}
+		out.regex = regex
+	default:
+		return out, fmt.Errorf("invalid match '%s', must be one of: prefix, glob, regex", kind)
+	}
+
+	return out, nil
+}
+
+// match returns the prefix of dest matched by the pattern, and whether it
+// matched at all.
+//
+// A glob must match the whole of a prefix ending at a path component, where
+// "*" doesn't match "/". As with a literal prefix, a glob without ":" only
+// matches the host part of a destination.
+func (p destPattern) match(dest string) (string, bool) {
+	switch p.kind {
+	case "glob":
+		pattern := withColon(p.text)
+		for i := len(dest); i > 0; i-- {
+			if i < len(dest) && dest[i] != '/' && dest[i-1] != ':' {
+				continue
+			}
+			if ok, _ := path.Match(pattern, dest[:i]); ok {
+				if pattern != p.text {
+					// Like a literal prefix, the matched prefix
+					// doesn't include the appended ":".
+					return dest[:i-1], true
+				}
+				return dest[:i], true
+			}
+		}
+		return "", false
+
+	case "regex":
+		loc := p.regex.FindStringIndex(dest)
+		if loc == nil {
+			return "", false
+		}
+		return dest[:loc[1]], true
+	}
+
+	if strings.HasPrefix(dest, withColon(p.text)) {
+		return p.text, true
+	}
+	return "", false
+}
+
+func (p destPattern) String() string {
+	if p.kind == "prefix" {
+		return p.text
+	}
+	return p.kind + " " + p.text
+}
+
+// overlaps returns true if both patterns would match some destination at the
+// same length, where this can be determined from the patterns alone.
+func (p destPattern) overlaps(other destPattern) bool {
+	if p.kind == other.kind {
+		if p.kind == "prefix" {
+			return withColon(p.text) == withColon(other.text)
+		}
+		return p.text == other.text
+	}
+
+	if other.kind == "prefix" {
+		p, other = other, p
+	}
+	if p.kind == "prefix" {
+		// A glob or regex matching the whole of a literal prefix would
+		// match any destination starting with that prefix equally well.
+		prefix := withColon(p.text)
+		matched, ok := other.match(prefix)
+		return ok && len(withColon(matched)) == len(prefix)
+	}
+
+	// Overlaps between globs and regexes can only be detected when
+	// matching a destination.
+	return false
+}
+
+// compile validates the patterns selecting the environment, preparing them
+// for use.
+func (e *environment) compile() error {
+	kind := nonEmptyString(e.MatchRaw, "prefix")
+
+	e.patterns = nil
+	for _, text := range append([]string{e.PrefixRaw}, e.AliasesRaw...) {
+		pattern, err := newDestPattern(kind, text)
+		if err != nil {
+			return err
+		}
+		e.patterns = append(e.patterns, pattern)
+	}
+
+	return nil
+}
+
+// match returns the longest prefix of dest matched by any of the patterns
+// selecting the environment, and whether any pattern matched at all.
+func (e *environment) match(dest string) (string, bool) {
+	out, found := "", false
+	for _, pattern := range e.patterns {
+		if matched, ok := pattern.match(dest); ok && (!found || len(matched) > len(out)) {
+			out, found = matched, true
+		}
+	}
+	return out, found
+}
+
+// sources describes where a and b were defined, for errors, if they came from
+// different config files.
+func sources(a, b *environment) string {
+	if a.source == b.source {
+		return ""
+	}
+	return fmt.Sprintf(" (in %s and %s)", a.source, b.source)
+}
+
+// checkOverlaps returns an error if any two environments with the same
+// priority have patterns which would match destinations equally well.
+func (c *globalConfig) checkOverlaps() error {
+	for i := range c.EnvironmentsRaw {
+		env := &c.EnvironmentsRaw[i]
+		for j := range c.EnvironmentsRaw[:i] {
+			other := &c.EnvironmentsRaw[j]
+			if env.PriorityRaw != other.PriorityRaw {
+				continue
+			}
+
+			for _, p := range env.patterns {
+				for _, q := range other.patterns {
+					if !p.overlaps(q) {
+						continue
+					}
+					if p.kind == "prefix" && q.kind == "prefix" {
+						return fmt.Errorf("duplicate environment definitions for '%s'%s",
+							p.text, sources(other, env))
+					}
+					return fmt.Errorf("overlapping environment definitions for '%s' and '%s'%s",
+						q, p, sources(other, env))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// MatchEnvironment finds and returns an Environment matching the specified
+// rsync destination, or nil if no Environment matches.
+//
+// Of the environments matching the destination, the one with the highest
+// priority is used, followed by the one matching the longest prefix of the
+// destination. If several environments match equally, an error is returned.
+func (c *globalConfig) MatchEnvironment(ctx context.Context, dest string) (EnvironmentConfig, error) {
+	logger := log.FromContext(ctx)
+
+	var best []*environment
+	bestMatch := ""
+
+	for i := range c.EnvironmentsRaw {
+		env := &c.EnvironmentsRaw[i]
+		matched, ok := env.match(dest)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case len(best) == 0,
+			env.PriorityRaw > best[0].PriorityRaw,
+			env.PriorityRaw == best[0].PriorityRaw && len(matched) > len(bestMatch):
+			best = []*environment{env}
+			bestMatch = matched
+		case env.PriorityRaw == best[0].PriorityRaw && len(matched) == len(bestMatch):
+			best = append(best, env)
+		}
+	}
+
+	if len(best) == 0 {
+		logger.F("dest", dest).Debug("no matching environment in config")
+		return nil, nil
+	}
+
+	if len(best) > 1 {
+		var prefixes []string
+		for _, env := range best {
+			prefixes = append(prefixes, "'"+env.Prefix()+"'")
+		}
+		sort.Strings(prefixes)
+		return nil, fmt.Errorf("destination '%s' matches environments %s equally",
+			dest, strings.Join(prefixes, ", "))
+	}
+
+	// The environment is copied so that the matched prefix can be used for
+	// this destination only.
+	out := *best[0]
+	out.matched = bestMatch
+
+	logger.F("dest", dest, "prefix", out.Prefix(), "matched", bestMatch).Debug("matched environment")
+
+	return &out, nil
+}
+
+// EnvironmentForDest finds and returns an Environment matching the specified rsync
+// destination, or nil if no Environment matches. If the destination matches
+// several environments equally, an error is logged and nil is returned.
+func (c *globalConfig) EnvironmentForDest(ctx context.Context, dest string) EnvironmentConfig {
+	env, err := c.MatchEnvironment(ctx, dest)
+	if err != nil {
+		log.FromContext(ctx).F("dest", dest, "error", err).Error("can't select environment")
+		return nil
+	}
+	return env
+}
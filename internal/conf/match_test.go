@@ -0,0 +1,213 @@
+package conf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadMatchConfig(t *testing.T, content string) (GlobalConfig, error) {
+	filename := filepath.Join(t.TempDir(), "test.conf")
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatalf("could not write config file for test: %v", err)
+	}
+	return loadFromPath(filename, args.Config{})
+}
+
+func TestDestPatternMatch(t *testing.T) {
+	tests := []struct {
+		kind, text string
+		dest       string
+		matched    string
+		ok         bool
+	}{
+		{"prefix", "exodus", "exodus:/foo", "exodus", true},
+		{"prefix", "exodus", "exodus-other:/foo", "", false},
+		{"prefix", "host:/some/dir", "host:/some/dir/foo", "host:/some/dir", true},
+
+		// Globs match whole path components, and only the host part if
+		// they don't include ":".
+		{"glob", "upload*.example.com", "upload1.example.com:/foo", "upload1.example.com", true},
+		{"glob", "upload*.example.com", "upload1.example.com.other:/foo", "", false},
+		{"glob", "host:/*/dir", "host:/some/dir/foo", "host:/some/dir", true},
+		{"glob", "host:/*/dir", "host:/some/other/dir", "", false},
+		{"glob", "host:/*/di", "host:/some/dir", "", false},
+
+		// Regexes match at the start of the destination, at any length.
+		{"regex", `upload[0-9]+\.example\.com:`, "upload12.example.com:/foo", "upload12.example.com:", true},
+		{"regex", `example\.com:`, "upload.example.com:/foo", "", false},
+		{"regex", `host:/(a|b)/`, "host:/b/foo", "host:/b/", true},
+	}
+
+	for _, tt := range tests {
+		pattern, err := newDestPattern(tt.kind, tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched, ok := pattern.match(tt.dest)
+		if matched != tt.matched || ok != tt.ok {
+			t.Errorf("%s %s: match(%q) = %q, %v", tt.kind, tt.text, tt.dest, matched, ok)
+		}
+	}
+}
+
+func TestMatchEnvironment(t *testing.T) {
+	cfg, err := loadMatchConfig(t, `
+environments:
+- prefix: upload1.example.com
+  aliases: [upload2.example.com]
+  gwenv: uploads
+
+- prefix: upload*.example.com:/pub
+  match: glob
+  gwenv: pub-uploads
+
+- prefix: 'upload[0-9]+\.example\.com:/pub/special'
+  match: regex
+  gwenv: special-uploads
+
+- prefix: upload*.example.com:/pub/override
+  match: glob
+  priority: 10
+  gwenv: override
+`)
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	tests := map[string]struct{ gwenv, strip string }{
+		// Aliases select the same environment.
+		"upload1.example.com:/foo": {"uploads", "upload1.example.com"},
+		"upload2.example.com:/foo": {"uploads", "upload2.example.com"},
+
+		// The longest match is used.
+		"upload1.example.com:/pub/foo":         {"pub-uploads", "upload1.example.com:/pub"},
+		"upload3.example.com:/pub/foo":         {"pub-uploads", "upload3.example.com:/pub"},
+		"upload3.example.com:/pub/special/foo": {"special-uploads", "upload3.example.com:/pub/special"},
+
+		// Higher priorities win over longer matches.
+		"upload3.example.com:/pub/override/special": {"override", "upload3.example.com:/pub/override"},
+	}
+
+	for dest, want := range tests {
+		env, err := cfg.MatchEnvironment(ctx, dest)
+		if err != nil || env == nil {
+			t.Errorf("%s: no environment matched: %v", dest, err)
+			continue
+		}
+		assert.Equal(t, want.gwenv, env.GwEnv(), dest)
+		assert.Equal(t, want.strip, env.Strip(), dest)
+	}
+
+	env, err := cfg.MatchEnvironment(ctx, "upload3.example.com:/foo")
+	assert.Nil(t, env)
+	assert.Nil(t, err)
+}
+
+func TestMatchEnvironmentAmbiguous(t *testing.T) {
+	cfg, err := loadMatchConfig(t, `
+environments:
+- prefix: upload*.example.com
+  match: glob
+  gwenv: glob
+
+- prefix: 'upload[0-9]\.example\.com'
+  match: regex
+  gwenv: regex
+`)
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	env, err := cfg.MatchEnvironment(ctx, "upload1.example.com:/foo")
+	assert.Nil(t, env)
+	assert.EqualError(t, err,
+		`destination 'upload1.example.com:/foo' matches environments 'upload*.example.com', 'upload[0-9]\.example\.com' equally`)
+
+	// Only matching one environment is fine.
+	env, err = cfg.MatchEnvironment(ctx, "upload-x.example.com:/foo")
+	assert.Nil(t, err)
+	assert.Equal(t, "glob", env.GwEnv())
+
+	// Through EnvironmentForDest, ambiguous matches are treated as no match.
+	assert.Nil(t, cfg.EnvironmentForDest(ctx, "upload1.example.com:/foo"))
+}
+
+func TestMatchConfigInvalid(t *testing.T) {
+	for name, tt := range map[string]struct{ content, message string }{
+		"bad match": {
+			"environments:\n- prefix: dest\n  match: wildcard\n",
+			"invalid environment 'dest': invalid match 'wildcard', must be one of: prefix, glob, regex",
+		},
+		"bad glob": {
+			"environments:\n- prefix: 'dest[x'\n  match: glob\n",
+			"invalid environment 'dest[x': invalid glob 'dest[x': syntax error in pattern",
+		},
+		"bad regex": {
+			"environments:\n- prefix: 'dest('\n  match: regex\n",
+			"invalid environment 'dest(': invalid regex 'dest(': error parsing regexp",
+		},
+		"duplicate alias": {
+			"environments:\n- prefix: dest\n- prefix: other\n  aliases: [dest]\n",
+			"duplicate environment definitions for 'dest'",
+		},
+		"duplicate globs": {
+			"environments:\n- prefix: 'dest*'\n  match: glob\n- prefix: 'dest*'\n  match: glob\n",
+			"overlapping environment definitions for 'glob dest*' and 'glob dest*'",
+		},
+		"overlapping glob": {
+			"environments:\n- prefix: dest1\n- prefix: 'dest*'\n  match: glob\n",
+			"overlapping environment definitions for 'dest1' and 'glob dest*'",
+		},
+		"overlapping regex": {
+			"environments:\n- prefix: 'dest[0-9]:'\n  match: regex\n- prefix: dest1\n",
+			"overlapping environment definitions for 'regex dest[0-9]:' and 'dest1'",
+		},
+		"stripped alias": {
+			"strip: dest\nenvironments:\n- prefix: dest1\n  aliases: [other]\n",
+			"cannot strip 'dest' prefix from 'other'",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadMatchConfig(t, tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMatchConfigPriorities(t *testing.T) {
+	// The same patterns are fine with different priorities.
+	cfg, err := loadMatchConfig(t, `
+environments:
+- prefix: dest
+  gwenv: low
+- prefix: 'dest*'
+  match: glob
+  priority: 1
+  gwenv: high
+`)
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	env, err := cfg.MatchEnvironment(ctx, "dest:/foo")
+	assert.Nil(t, err)
+	assert.Equal(t, "high", env.GwEnv())
+}
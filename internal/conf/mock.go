@@ -80,6 +80,34 @@ func (m *MockConfig) EXPECT() *MockConfigMockRecorder {
 	return m.recorder
 }
 
+// CDNURL mocks base method.
+func (m *MockConfig) CDNURL() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CDNURL")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// CDNURL indicates an expected call of CDNURL.
+func (mr *MockConfigMockRecorder) CDNURL() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CDNURL", reflect.TypeOf((*MockConfig)(nil).CDNURL))
+}
+
+// ContentTypes mocks base method.
+func (m *MockConfig) ContentTypes() ContentTypeRules {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ContentTypes")
+	ret0, _ := ret[0].(ContentTypeRules)
+	return ret0
+}
+
+// ContentTypes indicates an expected call of ContentTypes.
+func (mr *MockConfigMockRecorder) ContentTypes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContentTypes", reflect.TypeOf((*MockConfig)(nil).ContentTypes))
+}
+
 // Diag mocks base method.
 func (m *MockConfig) Diag() bool {
 	m.ctrl.T.Helper()
@@ -108,6 +136,20 @@ func (mr *MockConfigMockRecorder) GwBatchSize() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwBatchSize", reflect.TypeOf((*MockConfig)(nil).GwBatchSize))
 }
 
+// GwCACert mocks base method.
+func (m *MockConfig) GwCACert() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GwCACert")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GwCACert indicates an expected call of GwCACert.
+func (mr *MockConfigMockRecorder) GwCACert() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwCACert", reflect.TypeOf((*MockConfig)(nil).GwCACert))
+}
+
 // GwCert mocks base method.
 func (m *MockConfig) GwCert() string {
 	m.ctrl.T.Helper()
@@ -206,6 +248,20 @@ func (mr *MockConfigMockRecorder) GwPollInterval() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwPollInterval", reflect.TypeOf((*MockConfig)(nil).GwPollInterval))
 }
 
+// GwTaskTimeout mocks base method.
+func (m *MockConfig) GwTaskTimeout() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GwTaskTimeout")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GwTaskTimeout indicates an expected call of GwTaskTimeout.
+func (mr *MockConfigMockRecorder) GwTaskTimeout() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwTaskTimeout", reflect.TypeOf((*MockConfig)(nil).GwTaskTimeout))
+}
+
 // GwURL mocks base method.
 func (m *MockConfig) GwURL() string {
 	m.ctrl.T.Helper()
@@ -220,6 +276,48 @@ func (mr *MockConfigMockRecorder) GwURL() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwURL", reflect.TypeOf((*MockConfig)(nil).GwURL))
 }
 
+// HashCache mocks base method.
+func (m *MockConfig) HashCache() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashCache")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// HashCache indicates an expected call of HashCache.
+func (mr *MockConfigMockRecorder) HashCache() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashCache", reflect.TypeOf((*MockConfig)(nil).HashCache))
+}
+
+// HashCacheSize mocks base method.
+func (m *MockConfig) HashCacheSize() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashCacheSize")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// HashCacheSize indicates an expected call of HashCacheSize.
+func (mr *MockConfigMockRecorder) HashCacheSize() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashCacheSize", reflect.TypeOf((*MockConfig)(nil).HashCacheSize))
+}
+
+// JournalDir mocks base method.
+func (m *MockConfig) JournalDir() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JournalDir")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// JournalDir indicates an expected call of JournalDir.
+func (mr *MockConfigMockRecorder) JournalDir() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JournalDir", reflect.TypeOf((*MockConfig)(nil).JournalDir))
+}
+
 // LogLevel mocks base method.
 func (m *MockConfig) LogLevel() string {
 	m.ctrl.T.Helper()
@@ -248,6 +346,34 @@ func (mr *MockConfigMockRecorder) Logger() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logger", reflect.TypeOf((*MockConfig)(nil).Logger))
 }
 
+// PresenceThreads mocks base method.
+func (m *MockConfig) PresenceThreads() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PresenceThreads")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// PresenceThreads indicates an expected call of PresenceThreads.
+func (mr *MockConfigMockRecorder) PresenceThreads() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresenceThreads", reflect.TypeOf((*MockConfig)(nil).PresenceThreads))
+}
+
+// Rewrite mocks base method.
+func (m *MockConfig) Rewrite() RewriteRules {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rewrite")
+	ret0, _ := ret[0].(RewriteRules)
+	return ret0
+}
+
+// Rewrite indicates an expected call of Rewrite.
+func (mr *MockConfigMockRecorder) Rewrite() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rewrite", reflect.TypeOf((*MockConfig)(nil).Rewrite))
+}
+
 // RsyncMode mocks base method.
 func (m *MockConfig) RsyncMode() string {
 	m.ctrl.T.Helper()
@@ -262,6 +388,20 @@ func (mr *MockConfigMockRecorder) RsyncMode() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RsyncMode", reflect.TypeOf((*MockConfig)(nil).RsyncMode))
 }
 
+// Settings mocks base method.
+func (m *MockConfig) Settings() []Setting {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Settings")
+	ret0, _ := ret[0].([]Setting)
+	return ret0
+}
+
+// Settings indicates an expected call of Settings.
+func (mr *MockConfigMockRecorder) Settings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Settings", reflect.TypeOf((*MockConfig)(nil).Settings))
+}
+
 // Strip mocks base method.
 func (m *MockConfig) Strip() string {
 	m.ctrl.T.Helper()
@@ -276,6 +416,20 @@ func (mr *MockConfigMockRecorder) Strip() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Strip", reflect.TypeOf((*MockConfig)(nil).Strip))
 }
 
+// UploadBwLimit mocks base method.
+func (m *MockConfig) UploadBwLimit() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadBwLimit")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// UploadBwLimit indicates an expected call of UploadBwLimit.
+func (mr *MockConfigMockRecorder) UploadBwLimit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadBwLimit", reflect.TypeOf((*MockConfig)(nil).UploadBwLimit))
+}
+
 // UploadThreads mocks base method.
 func (m *MockConfig) UploadThreads() int {
 	m.ctrl.T.Helper()
@@ -304,6 +458,34 @@ func (mr *MockConfigMockRecorder) Verbosity() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verbosity", reflect.TypeOf((*MockConfig)(nil).Verbosity))
 }
 
+// VerifySample mocks base method.
+func (m *MockConfig) VerifySample() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifySample")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// VerifySample indicates an expected call of VerifySample.
+func (mr *MockConfigMockRecorder) VerifySample() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifySample", reflect.TypeOf((*MockConfig)(nil).VerifySample))
+}
+
+// VerifyThreads mocks base method.
+func (m *MockConfig) VerifyThreads() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyThreads")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// VerifyThreads indicates an expected call of VerifyThreads.
+func (mr *MockConfigMockRecorder) VerifyThreads() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyThreads", reflect.TypeOf((*MockConfig)(nil).VerifyThreads))
+}
+
 // MockEnvironmentConfig is a mock of EnvironmentConfig interface.
 type MockEnvironmentConfig struct {
 	ctrl     *gomock.Controller
@@ -328,6 +510,34 @@ func (m *MockEnvironmentConfig) EXPECT() *MockEnvironmentConfigMockRecorder {
 	return m.recorder
 }
 
+// CDNURL mocks base method.
+func (m *MockEnvironmentConfig) CDNURL() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CDNURL")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// CDNURL indicates an expected call of CDNURL.
+func (mr *MockEnvironmentConfigMockRecorder) CDNURL() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CDNURL", reflect.TypeOf((*MockEnvironmentConfig)(nil).CDNURL))
+}
+
+// ContentTypes mocks base method.
+func (m *MockEnvironmentConfig) ContentTypes() ContentTypeRules {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ContentTypes")
+	ret0, _ := ret[0].(ContentTypeRules)
+	return ret0
+}
+
+// ContentTypes indicates an expected call of ContentTypes.
+func (mr *MockEnvironmentConfigMockRecorder) ContentTypes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContentTypes", reflect.TypeOf((*MockEnvironmentConfig)(nil).ContentTypes))
+}
+
 // Diag mocks base method.
 func (m *MockEnvironmentConfig) Diag() bool {
 	m.ctrl.T.Helper()
@@ -342,6 +552,20 @@ func (mr *MockEnvironmentConfigMockRecorder) Diag() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Diag", reflect.TypeOf((*MockEnvironmentConfig)(nil).Diag))
 }
 
+// Global mocks base method.
+func (m *MockEnvironmentConfig) Global() GlobalConfig {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Global")
+	ret0, _ := ret[0].(GlobalConfig)
+	return ret0
+}
+
+// Global indicates an expected call of Global.
+func (mr *MockEnvironmentConfigMockRecorder) Global() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Global", reflect.TypeOf((*MockEnvironmentConfig)(nil).Global))
+}
+
 // GwBatchSize mocks base method.
 func (m *MockEnvironmentConfig) GwBatchSize() int {
 	m.ctrl.T.Helper()
@@ -356,6 +580,20 @@ func (mr *MockEnvironmentConfigMockRecorder) GwBatchSize() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwBatchSize", reflect.TypeOf((*MockEnvironmentConfig)(nil).GwBatchSize))
 }
 
+// GwCACert mocks base method.
+func (m *MockEnvironmentConfig) GwCACert() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GwCACert")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GwCACert indicates an expected call of GwCACert.
+func (mr *MockEnvironmentConfigMockRecorder) GwCACert() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwCACert", reflect.TypeOf((*MockEnvironmentConfig)(nil).GwCACert))
+}
+
 // GwCert mocks base method.
 func (m *MockEnvironmentConfig) GwCert() string {
 	m.ctrl.T.Helper()
@@ -454,6 +692,20 @@ func (mr *MockEnvironmentConfigMockRecorder) GwPollInterval() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwPollInterval", reflect.TypeOf((*MockEnvironmentConfig)(nil).GwPollInterval))
 }
 
+// GwTaskTimeout mocks base method.
+func (m *MockEnvironmentConfig) GwTaskTimeout() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GwTaskTimeout")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GwTaskTimeout indicates an expected call of GwTaskTimeout.
+func (mr *MockEnvironmentConfigMockRecorder) GwTaskTimeout() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwTaskTimeout", reflect.TypeOf((*MockEnvironmentConfig)(nil).GwTaskTimeout))
+}
+
 // GwURL mocks base method.
 func (m *MockEnvironmentConfig) GwURL() string {
 	m.ctrl.T.Helper()
@@ -468,6 +720,48 @@ func (mr *MockEnvironmentConfigMockRecorder) GwURL() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwURL", reflect.TypeOf((*MockEnvironmentConfig)(nil).GwURL))
 }
 
+// HashCache mocks base method.
+func (m *MockEnvironmentConfig) HashCache() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashCache")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// HashCache indicates an expected call of HashCache.
+func (mr *MockEnvironmentConfigMockRecorder) HashCache() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashCache", reflect.TypeOf((*MockEnvironmentConfig)(nil).HashCache))
+}
+
+// HashCacheSize mocks base method.
+func (m *MockEnvironmentConfig) HashCacheSize() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashCacheSize")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// HashCacheSize indicates an expected call of HashCacheSize.
+func (mr *MockEnvironmentConfigMockRecorder) HashCacheSize() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashCacheSize", reflect.TypeOf((*MockEnvironmentConfig)(nil).HashCacheSize))
+}
+
+// JournalDir mocks base method.
+func (m *MockEnvironmentConfig) JournalDir() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JournalDir")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// JournalDir indicates an expected call of JournalDir.
+func (mr *MockEnvironmentConfigMockRecorder) JournalDir() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JournalDir", reflect.TypeOf((*MockEnvironmentConfig)(nil).JournalDir))
+}
+
 // LogLevel mocks base method.
 func (m *MockEnvironmentConfig) LogLevel() string {
 	m.ctrl.T.Helper()
@@ -510,6 +804,34 @@ func (mr *MockEnvironmentConfigMockRecorder) Prefix() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prefix", reflect.TypeOf((*MockEnvironmentConfig)(nil).Prefix))
 }
 
+// PresenceThreads mocks base method.
+func (m *MockEnvironmentConfig) PresenceThreads() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PresenceThreads")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// PresenceThreads indicates an expected call of PresenceThreads.
+func (mr *MockEnvironmentConfigMockRecorder) PresenceThreads() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresenceThreads", reflect.TypeOf((*MockEnvironmentConfig)(nil).PresenceThreads))
+}
+
+// Rewrite mocks base method.
+func (m *MockEnvironmentConfig) Rewrite() RewriteRules {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rewrite")
+	ret0, _ := ret[0].(RewriteRules)
+	return ret0
+}
+
+// Rewrite indicates an expected call of Rewrite.
+func (mr *MockEnvironmentConfigMockRecorder) Rewrite() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rewrite", reflect.TypeOf((*MockEnvironmentConfig)(nil).Rewrite))
+}
+
 // RsyncMode mocks base method.
 func (m *MockEnvironmentConfig) RsyncMode() string {
 	m.ctrl.T.Helper()
@@ -524,6 +846,34 @@ func (mr *MockEnvironmentConfigMockRecorder) RsyncMode() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RsyncMode", reflect.TypeOf((*MockEnvironmentConfig)(nil).RsyncMode))
 }
 
+// Settings mocks base method.
+func (m *MockEnvironmentConfig) Settings() []Setting {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Settings")
+	ret0, _ := ret[0].([]Setting)
+	return ret0
+}
+
+// Settings indicates an expected call of Settings.
+func (mr *MockEnvironmentConfigMockRecorder) Settings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Settings", reflect.TypeOf((*MockEnvironmentConfig)(nil).Settings))
+}
+
+// Source mocks base method.
+func (m *MockEnvironmentConfig) Source() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Source")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Source indicates an expected call of Source.
+func (mr *MockEnvironmentConfigMockRecorder) Source() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Source", reflect.TypeOf((*MockEnvironmentConfig)(nil).Source))
+}
+
 // Strip mocks base method.
 func (m *MockEnvironmentConfig) Strip() string {
 	m.ctrl.T.Helper()
@@ -538,6 +888,20 @@ func (mr *MockEnvironmentConfigMockRecorder) Strip() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Strip", reflect.TypeOf((*MockEnvironmentConfig)(nil).Strip))
 }
 
+// UploadBwLimit mocks base method.
+func (m *MockEnvironmentConfig) UploadBwLimit() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadBwLimit")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// UploadBwLimit indicates an expected call of UploadBwLimit.
+func (mr *MockEnvironmentConfigMockRecorder) UploadBwLimit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadBwLimit", reflect.TypeOf((*MockEnvironmentConfig)(nil).UploadBwLimit))
+}
+
 // UploadThreads mocks base method.
 func (m *MockEnvironmentConfig) UploadThreads() int {
 	m.ctrl.T.Helper()
@@ -566,6 +930,34 @@ func (mr *MockEnvironmentConfigMockRecorder) Verbosity() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verbosity", reflect.TypeOf((*MockEnvironmentConfig)(nil).Verbosity))
 }
 
+// VerifySample mocks base method.
+func (m *MockEnvironmentConfig) VerifySample() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifySample")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// VerifySample indicates an expected call of VerifySample.
+func (mr *MockEnvironmentConfigMockRecorder) VerifySample() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifySample", reflect.TypeOf((*MockEnvironmentConfig)(nil).VerifySample))
+}
+
+// VerifyThreads mocks base method.
+func (m *MockEnvironmentConfig) VerifyThreads() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyThreads")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// VerifyThreads indicates an expected call of VerifyThreads.
+func (mr *MockEnvironmentConfigMockRecorder) VerifyThreads() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyThreads", reflect.TypeOf((*MockEnvironmentConfig)(nil).VerifyThreads))
+}
+
 // MockGlobalConfig is a mock of GlobalConfig interface.
 type MockGlobalConfig struct {
 	ctrl     *gomock.Controller
@@ -590,6 +982,34 @@ func (m *MockGlobalConfig) EXPECT() *MockGlobalConfigMockRecorder {
 	return m.recorder
 }
 
+// CDNURL mocks base method.
+func (m *MockGlobalConfig) CDNURL() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CDNURL")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// CDNURL indicates an expected call of CDNURL.
+func (mr *MockGlobalConfigMockRecorder) CDNURL() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CDNURL", reflect.TypeOf((*MockGlobalConfig)(nil).CDNURL))
+}
+
+// ContentTypes mocks base method.
+func (m *MockGlobalConfig) ContentTypes() ContentTypeRules {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ContentTypes")
+	ret0, _ := ret[0].(ContentTypeRules)
+	return ret0
+}
+
+// ContentTypes indicates an expected call of ContentTypes.
+func (mr *MockGlobalConfigMockRecorder) ContentTypes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContentTypes", reflect.TypeOf((*MockGlobalConfig)(nil).ContentTypes))
+}
+
 // Diag mocks base method.
 func (m *MockGlobalConfig) Diag() bool {
 	m.ctrl.T.Helper()
@@ -618,6 +1038,20 @@ func (mr *MockGlobalConfigMockRecorder) EnvironmentForDest(arg0, arg1 any) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnvironmentForDest", reflect.TypeOf((*MockGlobalConfig)(nil).EnvironmentForDest), arg0, arg1)
 }
 
+// Environments mocks base method.
+func (m *MockGlobalConfig) Environments() []EnvironmentConfig {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Environments")
+	ret0, _ := ret[0].([]EnvironmentConfig)
+	return ret0
+}
+
+// Environments indicates an expected call of Environments.
+func (mr *MockGlobalConfigMockRecorder) Environments() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Environments", reflect.TypeOf((*MockGlobalConfig)(nil).Environments))
+}
+
 // GwBatchSize mocks base method.
 func (m *MockGlobalConfig) GwBatchSize() int {
 	m.ctrl.T.Helper()
@@ -632,6 +1066,20 @@ func (mr *MockGlobalConfigMockRecorder) GwBatchSize() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwBatchSize", reflect.TypeOf((*MockGlobalConfig)(nil).GwBatchSize))
 }
 
+// GwCACert mocks base method.
+func (m *MockGlobalConfig) GwCACert() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GwCACert")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GwCACert indicates an expected call of GwCACert.
+func (mr *MockGlobalConfigMockRecorder) GwCACert() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwCACert", reflect.TypeOf((*MockGlobalConfig)(nil).GwCACert))
+}
+
 // GwCert mocks base method.
 func (m *MockGlobalConfig) GwCert() string {
 	m.ctrl.T.Helper()
@@ -730,6 +1178,20 @@ func (mr *MockGlobalConfigMockRecorder) GwPollInterval() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwPollInterval", reflect.TypeOf((*MockGlobalConfig)(nil).GwPollInterval))
 }
 
+// GwTaskTimeout mocks base method.
+func (m *MockGlobalConfig) GwTaskTimeout() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GwTaskTimeout")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GwTaskTimeout indicates an expected call of GwTaskTimeout.
+func (mr *MockGlobalConfigMockRecorder) GwTaskTimeout() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwTaskTimeout", reflect.TypeOf((*MockGlobalConfig)(nil).GwTaskTimeout))
+}
+
 // GwURL mocks base method.
 func (m *MockGlobalConfig) GwURL() string {
 	m.ctrl.T.Helper()
@@ -744,6 +1206,48 @@ func (mr *MockGlobalConfigMockRecorder) GwURL() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GwURL", reflect.TypeOf((*MockGlobalConfig)(nil).GwURL))
 }
 
+// HashCache mocks base method.
+func (m *MockGlobalConfig) HashCache() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashCache")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// HashCache indicates an expected call of HashCache.
+func (mr *MockGlobalConfigMockRecorder) HashCache() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashCache", reflect.TypeOf((*MockGlobalConfig)(nil).HashCache))
+}
+
+// HashCacheSize mocks base method.
+func (m *MockGlobalConfig) HashCacheSize() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HashCacheSize")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// HashCacheSize indicates an expected call of HashCacheSize.
+func (mr *MockGlobalConfigMockRecorder) HashCacheSize() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HashCacheSize", reflect.TypeOf((*MockGlobalConfig)(nil).HashCacheSize))
+}
+
+// JournalDir mocks base method.
+func (m *MockGlobalConfig) JournalDir() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JournalDir")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// JournalDir indicates an expected call of JournalDir.
+func (mr *MockGlobalConfigMockRecorder) JournalDir() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JournalDir", reflect.TypeOf((*MockGlobalConfig)(nil).JournalDir))
+}
+
 // LogLevel mocks base method.
 func (m *MockGlobalConfig) LogLevel() string {
 	m.ctrl.T.Helper()
@@ -772,6 +1276,49 @@ func (mr *MockGlobalConfigMockRecorder) Logger() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logger", reflect.TypeOf((*MockGlobalConfig)(nil).Logger))
 }
 
+// MatchEnvironment mocks base method.
+func (m *MockGlobalConfig) MatchEnvironment(arg0 context.Context, arg1 string) (EnvironmentConfig, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MatchEnvironment", arg0, arg1)
+	ret0, _ := ret[0].(EnvironmentConfig)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MatchEnvironment indicates an expected call of MatchEnvironment.
+func (mr *MockGlobalConfigMockRecorder) MatchEnvironment(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MatchEnvironment", reflect.TypeOf((*MockGlobalConfig)(nil).MatchEnvironment), arg0, arg1)
+}
+
+// PresenceThreads mocks base method.
+func (m *MockGlobalConfig) PresenceThreads() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PresenceThreads")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// PresenceThreads indicates an expected call of PresenceThreads.
+func (mr *MockGlobalConfigMockRecorder) PresenceThreads() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PresenceThreads", reflect.TypeOf((*MockGlobalConfig)(nil).PresenceThreads))
+}
+
+// Rewrite mocks base method.
+func (m *MockGlobalConfig) Rewrite() RewriteRules {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rewrite")
+	ret0, _ := ret[0].(RewriteRules)
+	return ret0
+}
+
+// Rewrite indicates an expected call of Rewrite.
+func (mr *MockGlobalConfigMockRecorder) Rewrite() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rewrite", reflect.TypeOf((*MockGlobalConfig)(nil).Rewrite))
+}
+
 // RsyncMode mocks base method.
 func (m *MockGlobalConfig) RsyncMode() string {
 	m.ctrl.T.Helper()
@@ -786,6 +1333,20 @@ func (mr *MockGlobalConfigMockRecorder) RsyncMode() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RsyncMode", reflect.TypeOf((*MockGlobalConfig)(nil).RsyncMode))
 }
 
+// Settings mocks base method.
+func (m *MockGlobalConfig) Settings() []Setting {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Settings")
+	ret0, _ := ret[0].([]Setting)
+	return ret0
+}
+
+// Settings indicates an expected call of Settings.
+func (mr *MockGlobalConfigMockRecorder) Settings() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Settings", reflect.TypeOf((*MockGlobalConfig)(nil).Settings))
+}
+
 // Strip mocks base method.
 func (m *MockGlobalConfig) Strip() string {
 	m.ctrl.T.Helper()
@@ -800,6 +1361,20 @@ func (mr *MockGlobalConfigMockRecorder) Strip() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Strip", reflect.TypeOf((*MockGlobalConfig)(nil).Strip))
 }
 
+// UploadBwLimit mocks base method.
+func (m *MockGlobalConfig) UploadBwLimit() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadBwLimit")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// UploadBwLimit indicates an expected call of UploadBwLimit.
+func (mr *MockGlobalConfigMockRecorder) UploadBwLimit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadBwLimit", reflect.TypeOf((*MockGlobalConfig)(nil).UploadBwLimit))
+}
+
 // UploadThreads mocks base method.
 func (m *MockGlobalConfig) UploadThreads() int {
 	m.ctrl.T.Helper()
@@ -827,3 +1402,31 @@ func (mr *MockGlobalConfigMockRecorder) Verbosity() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verbosity", reflect.TypeOf((*MockGlobalConfig)(nil).Verbosity))
 }
+
+// VerifySample mocks base method.
+func (m *MockGlobalConfig) VerifySample() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifySample")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// VerifySample indicates an expected call of VerifySample.
+func (mr *MockGlobalConfigMockRecorder) VerifySample() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifySample", reflect.TypeOf((*MockGlobalConfig)(nil).VerifySample))
+}
+
+// VerifyThreads mocks base method.
+func (m *MockGlobalConfig) VerifyThreads() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyThreads")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// VerifyThreads indicates an expected call of VerifyThreads.
+func (mr *MockGlobalConfigMockRecorder) VerifyThreads() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyThreads", reflect.TypeOf((*MockGlobalConfig)(nil).VerifyThreads))
+}
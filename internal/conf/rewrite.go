@@ -0,0 +1,181 @@
+package conf
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// RewriteRule rewrites web URIs matching either a path prefix or a regular
+// expression.
+type RewriteRule struct {
+	// Path prefix matched against whole path components of a URI, replaced
+	// by Replace.
+	PrefixRaw string `yaml:"prefix"`
+
+	// Regular expression matched against a URI. Replace may refer to
+	// capture groups, e.g. "$1" or "${name}".
+	RegexRaw string `yaml:"regex"`
+
+	ReplaceRaw string `yaml:"replace"`
+
+	regex *regexp.Regexp
+}
+
+// RewriteRules is an ordered list of rules rewriting web URIs.
+type RewriteRules []RewriteRule
+
+// NewRewriteRule returns a rule rewriting URIs matching either prefix or regex,
+// exactly one of which must be non-empty.
+func NewRewriteRule(prefix, regex, replace string) (RewriteRule, error) {
+	out := RewriteRule{PrefixRaw: prefix, RegexRaw: regex, ReplaceRaw: replace}
+	err := out.compile()
+	return out, err
+}
+
+// compile validates the rule, preparing it for use.
+func (r *RewriteRule) compile() error {
+	switch {
+	case r.PrefixRaw != "" && r.RegexRaw != "":
+		return fmt.Errorf("only one of 'prefix' or 'regex' may be set")
+	case r.PrefixRaw == "" && r.RegexRaw == "":
+		return fmt.Errorf("one of 'prefix' or 'regex' must be set")
+	case r.PrefixRaw != "" && !strings.HasPrefix(r.PrefixRaw, "/"):
+		return fmt.Errorf("prefix '%s' is not an absolute path", r.PrefixRaw)
+	case !strings.HasPrefix(r.ReplaceRaw, "/"):
+		return fmt.Errorf("replacement '%s' is not an absolute path", r.ReplaceRaw)
+	}
+
+	if r.RegexRaw != "" {
+		regex, err := regexp.Compile(r.RegexRaw)
+		if err != nil {
+			return err
+		}
+		r.regex = regex
+	}
+
+	return nil
+}
+
+// Apply returns the result of applying the rule to uri, and whether the rule
+// matched. If the rule doesn't match, uri is returned unmodified.
+func (r *RewriteRule) Apply(uri string) (string, bool) {
+	if r.regex != nil {
+		if !r.regex.MatchString(uri) {
+			return uri, false
+		}
+		return path.Clean(r.regex.ReplaceAllString(uri, r.ReplaceRaw)), true
+	}
+
+	prefix := strings.TrimSuffix(r.PrefixRaw, "/")
+	if uri != prefix && !strings.HasPrefix(uri, prefix+"/") {
+		return uri, false
+	}
+	return path.Clean(r.ReplaceRaw + "/" + strings.TrimPrefix(uri, prefix)), true
+}
+
+func (r *RewriteRule) String() string {
+	if r.regex != nil {
+		return fmt.Sprintf("regex %s => %s", r.RegexRaw, r.ReplaceRaw)
+	}
+	return fmt.Sprintf("prefix %s => %s", r.PrefixRaw, r.ReplaceRaw)
+}
+
+// Example returns a URI which would be matched by the rule, for display
+// purposes, or an empty string if one can't be determined.
+func (r *RewriteRule) Example() string {
+	if r.regex == nil {
+		return path.Join(r.PrefixRaw, "example")
+	}
+
+	parsed, err := syntax.Parse(r.RegexRaw, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	if out := exampleMatch(parsed); r.regex.MatchString(out) {
+		return out
+	}
+	return ""
+}
+
+// exampleMatch returns a short string matching re, preferring "example" for
+// any wildcards so the example is easy to follow.
+func exampleMatch(re *syntax.Regexp) string {
+	inClass := func(re *syntax.Regexp, r rune) bool {
+		if re.Op == syntax.OpAnyChar || re.Op == syntax.OpAnyCharNotNL {
+			return true
+		}
+		if re.Op != syntax.OpCharClass {
+			return false
+		}
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			if re.Rune[i] <= r && r <= re.Rune[i+1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch re.Op {
+	case syntax.OpLiteral:
+		return string(re.Rune)
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL, syntax.OpCharClass:
+		for _, r := range "x0X_-" {
+			if inClass(re, r) {
+				return string(r)
+			}
+		}
+		if len(re.Rune) > 0 {
+			return string(re.Rune[0])
+		}
+	case syntax.OpCapture:
+		return exampleMatch(re.Sub[0])
+	case syntax.OpConcat:
+		var out strings.Builder
+		for _, sub := range re.Sub {
+			out.WriteString(exampleMatch(sub))
+		}
+		return out.String()
+	case syntax.OpAlternate:
+		return exampleMatch(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+		if re.Op != syntax.OpRepeat || re.Max == -1 {
+			if strings.IndexFunc("example", func(r rune) bool { return !inClass(re.Sub[0], r) }) == -1 {
+				return "example"
+			}
+		}
+		count := 1
+		if re.Op == syntax.OpStar {
+			count = 0
+		} else if re.Op == syntax.OpRepeat {
+			count = re.Min
+		}
+		return strings.Repeat(exampleMatch(re.Sub[0]), count)
+	}
+
+	// Anchors, empty matches and optional parts.
+	return ""
+}
+
+// Apply returns the result of rewriting uri with the first matching rule,
+// or uri unmodified if no rule matches.
+func (rules RewriteRules) Apply(uri string) string {
+	for i := range rules {
+		if out, ok := rules[i].Apply(uri); ok {
+			return out
+		}
+	}
+	return uri
+}
+
+// compile validates all rules, preparing them for use.
+func (rules RewriteRules) compile() error {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return fmt.Errorf("rewrite rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package conf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteRulesApply(t *testing.T) {
+	newRule := func(prefix, regex, replace string) RewriteRule {
+		out, err := NewRewriteRule(prefix, regex, replace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	rules := RewriteRules{
+		newRule("/pub/mirror/", "", "/content/dist"),
+		newRule("", "^/pub/beta/(?P<rest>.+)$", "/content/beta/${rest}"),
+		newRule("", "^/pub/([^/]+)/iso/(.*)$", "/content/$1/isos/$2"),
+		newRule("/pub", "", "/content/other"),
+	}
+
+	tests := map[string]string{
+		// First matching rule applies.
+		"/pub/mirror/X/file":      "/content/dist/X/file",
+		"/pub/mirror":             "/content/dist",
+		"/pub/beta/X/file":        "/content/beta/X/file",
+		"/pub/beta":               "/content/other/beta",
+		"/pub/rhel/iso/disc1.iso": "/content/rhel/isos/disc1.iso",
+
+		// Prefixes match whole path components only.
+		"/pub/mirrors/X": "/content/other/mirrors/X",
+		"/public/X":      "/public/X",
+
+		// No match leaves the URI unmodified.
+		"/content/dist/X": "/content/dist/X",
+	}
+
+	for uri, want := range tests {
+		if got := rules.Apply(uri); got != want {
+			t.Errorf("Apply(%q) = %q, want %q", uri, got, want)
+		}
+	}
+
+	// Without rules, nothing is rewritten.
+	assert.Equal(t, "/pub/X", RewriteRules(nil).Apply("/pub/X"))
+}
+
+func TestRewriteRuleInvalid(t *testing.T) {
+	tests := []struct {
+		prefix, regex, replace string
+		message                string
+	}{
+		{"", "", "/dest", "one of 'prefix' or 'regex' must be set"},
+		{"/a", "^/b", "/dest", "only one of 'prefix' or 'regex' may be set"},
+		{"a", "", "/dest", "prefix 'a' is not an absolute path"},
+		{"/a", "", "dest", "replacement 'dest' is not an absolute path"},
+		{"", "^/a(", "/dest", "missing closing )"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRewriteRule(tt.prefix, tt.regex, tt.replace)
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("NewRewriteRule(%q, %q, %q): unexpected error %v", tt.prefix, tt.regex, tt.replace, err)
+		}
+	}
+}
+
+func TestRewriteRuleExample(t *testing.T) {
+	tests := []struct {
+		prefix, regex string
+		example       string
+		str           string
+	}{
+		{"/pub/mirror", "", "/pub/mirror/example", "prefix /pub/mirror => /content"},
+		{"", "^/pub/beta/(.*)$", "/pub/beta/example", "regex ^/pub/beta/(.*)$ => /content"},
+		{"", "^/pub/(mirror|beta)/v[0-9]+/(.+)", "/pub/mirror/v0/example", "regex ^/pub/(mirror|beta)/v[0-9]+/(.+) => /content"},
+		{"", "^/pub/[^a-z]+$", "/pub/0", "regex ^/pub/[^a-z]+$ => /content"},
+		{"", "^/pub/a{2}b?c*/x", "/pub/aa/x", "regex ^/pub/a{2}b?c*/x => /content"},
+
+		// Can't find an example for this one.
+		{"", `^/pub/\Bx`, "", `regex ^/pub/\Bx => /content`},
+	}
+
+	for _, tt := range tests {
+		rule, err := NewRewriteRule(tt.prefix, tt.regex, "/content")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tt.example, rule.Example())
+		assert.Equal(t, tt.str, rule.String())
+	}
+}
+
+func TestRewriteConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.conf")
+
+	err := os.WriteFile(filename, []byte(`
+rewrite:
+- prefix: /pub
+  replace: /content/pub
+
+environments:
+- prefix: inherit
+
+- prefix: legacy
+  rewrite:
+  - prefix: /pub/mirror
+    replace: /content/dist
+  - regex: ^/pub/beta/(.*)$
+    replace: /content/beta/$1
+`), 0644)
+	if err != nil {
+		t.Fatalf("could not write config file for test: %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	cfg, err := loadFromPath(filename, args.Config{})
+	if err != nil {
+		t.Fatalf("could not load config file: %v", err)
+	}
+
+	assert.Equal(t, "/content/pub/mirror/X", cfg.Rewrite().Apply("/pub/mirror/X"))
+
+	inherit := cfg.EnvironmentForDest(ctx, "inherit:/foo")
+	assert.Equal(t, "/content/pub/mirror/X", inherit.Rewrite().Apply("/pub/mirror/X"))
+
+	// Rules in an environment replace global rules entirely.
+	legacy := cfg.EnvironmentForDest(ctx, "legacy:/foo")
+	assert.Equal(t, "/content/dist/X", legacy.Rewrite().Apply("/pub/mirror/X"))
+	assert.Equal(t, "/content/beta/X", legacy.Rewrite().Apply("/pub/beta/X"))
+	assert.Equal(t, "/pub/other/X", legacy.Rewrite().Apply("/pub/other/X"))
+}
+
+func TestRewriteConfigInvalid(t *testing.T) {
+	for name, tt := range map[string]struct{ content, message string }{
+		"global": {
+			"rewrite:\n- prefix: /pub\n",
+			"invalid rewrite: rewrite rule 1: replacement '' is not an absolute path",
+		},
+		"env": {
+			"environments:\n- prefix: dest\n  rewrite:\n  - prefix: /a\n    replace: /b\n  - regex: '*'\n    replace: /c\n",
+			"invalid rewrite for 'dest': rewrite rule 2: error parsing regexp",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "test.conf")
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("could not write config file for test: %v", err)
+			}
+
+			_, err := loadFromPath(filename, args.Config{})
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
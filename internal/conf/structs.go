@@ -8,30 +8,55 @@ import (
 )
 
 type sharedConfig struct {
-	GwEnvRaw          string `yaml:"gwenv"`
-	GwCertRaw         string `yaml:"gwcert"`
-	GwKeyRaw          string `yaml:"gwkey"`
-	GwURLRaw          string `yaml:"gwurl"`
-	GwPollIntervalRaw int    `yaml:"gwpollinterval"`
-	GwBatchSizeRaw    int    `yaml:"gwbatchsize"`
-	GwCommitRaw       string `yaml:"gwcommit"`
-	GwMaxAttemptsRaw  int    `yaml:"gwmaxattempts"`
-	GwMaxBackoffRaw   int    `yaml:"gwmaxbackoff"`
-	RsyncModeRaw      string `yaml:"rsyncmode"`
-	LogLevelRaw       string `yaml:"loglevel"`
-	LoggerRaw         string `yaml:"logger"`
-	DiagRaw           bool   `yaml:"diag"`
-	StripRaw          string `yaml:"strip"`
-	UploadThreadsRaw  int    `yaml:"uploadthreads"`
+	GwEnvRaw           string           `yaml:"gwenv"`
+	GwCertRaw          string           `yaml:"gwcert"`
+	GwKeyRaw           string           `yaml:"gwkey"`
+	GwCACertRaw        string           `yaml:"gwcacert"`
+	GwURLRaw           string           `yaml:"gwurl"`
+	GwPollIntervalRaw  int              `yaml:"gwpollinterval"`
+	GwBatchSizeRaw     int              `yaml:"gwbatchsize"`
+	GwCommitRaw        string           `yaml:"gwcommit"`
+	GwMaxAttemptsRaw   int              `yaml:"gwmaxattempts"`
+	GwMaxBackoffRaw    int              `yaml:"gwmaxbackoff"`
+	GwTaskTimeoutRaw   *int             `yaml:"gwtasktimeout"`
+	RsyncModeRaw       string           `yaml:"rsyncmode"`
+	LogLevelRaw        string           `yaml:"loglevel"`
+	LoggerRaw          string           `yaml:"logger"`
+	DiagRaw            bool             `yaml:"diag"`
+	StripRaw           string           `yaml:"strip"`
+	UploadThreadsRaw   int              `yaml:"uploadthreads"`
+	PresenceThreadsRaw int              `yaml:"presencethreads"`
+	UploadBwLimitRaw   string           `yaml:"uploadbwlimit"`
+	HashCacheRaw       string           `yaml:"hashcache"`
+	HashCacheSizeRaw   int              `yaml:"hashcachesize"`
+	JournalDirRaw      string           `yaml:"journaldir"`
+	CDNURLRaw          string           `yaml:"cdnurl"`
+	VerifySampleRaw    *int             `yaml:"verifysample"`
+	VerifyThreadsRaw   int              `yaml:"verifythreads"`
+	RewriteRaw         RewriteRules     `yaml:"rewrite"`
+	ContentTypesRaw    ContentTypeRules `yaml:"contenttypes"`
 }
 
 type environment struct {
 	sharedConfig `yaml:",inline"`
 	args         args.Config `embed:"1"`
 
-	PrefixRaw string `yaml:"prefix"`
+	PrefixRaw   string   `yaml:"prefix"`
+	AliasesRaw  []string `yaml:"aliases"`
+	MatchRaw    string   `yaml:"match"`
+	PriorityRaw int      `yaml:"priority"`
 
 	parent *globalConfig
+
+	// Compiled from the prefix and aliases.
+	patterns []destPattern
+
+	// Prefix of the destination matched by this environment, if selected
+	// for a destination.
+	matched string
+
+	// Path of the config file defining this environment.
+	source string
 }
 
 type globalConfig struct {
@@ -40,6 +65,9 @@ type globalConfig struct {
 
 	// Configuration for each environment.
 	EnvironmentsRaw []environment `yaml:"environments"`
+
+	// Paths or globs of further config files defining environments.
+	IncludeRaw []string `yaml:"include"`
 }
 
 // MissingConfigFile is an error type for cases in which no config file is found.
@@ -60,6 +88,10 @@ func (g *globalConfig) GwKey() string {
 	return g.GwKeyRaw
 }
 
+func (g *globalConfig) GwCACert() string {
+	return g.GwCACertRaw
+}
+
 func (g *globalConfig) GwURL() string {
 	return g.GwURLRaw
 }
@@ -88,10 +120,70 @@ func (g *globalConfig) GwMaxBackoff() int {
 	return nonEmptyInt(g.GwMaxBackoffRaw, 20000)
 }
 
+func (g *globalConfig) GwTaskTimeout() int {
+	return setInt(g.GwTaskTimeoutRaw, 0)
+}
+
 func (g *globalConfig) UploadThreads() int {
 	return nonEmptyInt(g.UploadThreadsRaw, 4)
 }
 
+func (g *globalConfig) PresenceThreads() int {
+	return nonEmptyInt(g.PresenceThreadsRaw, 4)
+}
+
+func (g *globalConfig) UploadBwLimit() int64 {
+	return bwLimit(g.UploadBwLimitRaw)
+}
+
+func (g *globalConfig) HashCache() string {
+	return enabledPath(g.HashCacheRaw)
+}
+
+func (g *globalConfig) HashCacheSize() int {
+	return nonEmptyInt(g.HashCacheSizeRaw, 500000)
+}
+
+func (g *globalConfig) JournalDir() string {
+	return enabledPath(g.JournalDirRaw)
+}
+
+func (g *globalConfig) CDNURL() string {
+	return g.CDNURLRaw
+}
+
+func (g *globalConfig) VerifySample() int {
+	return setInt(g.VerifySampleRaw, 0)
+}
+
+func (g *globalConfig) VerifyThreads() int {
+	return nonEmptyInt(g.VerifyThreadsRaw, 4)
+}
+
+func (g *globalConfig) Rewrite() RewriteRules {
+	return g.RewriteRaw
+}
+
+func (g *globalConfig) ContentTypes() ContentTypeRules {
+	return g.ContentTypesRaw
+}
+
+// enabledPath returns the given path, or an empty string if the path
+// has explicitly disabled the feature.
+func enabledPath(path string) string {
+	if path == "none" {
+		return ""
+	}
+	return path
+}
+
+// bwLimit returns a bandwidth limit in bytes per second. Values were validated
+// when loaded, so any error is ignored.
+func bwLimit(value string) int64 {
+	out, _ := args.ParseBwLimit(value)
+	return out
+}
+
 func nonEmptyString(a, b string) string {
 	if a != "" {
 		return a
@@ -106,6 +198,16 @@ func nonEmptyInt(a, b int) int {
 	return b
 }
 
+// setInt returns a if it was set in config, even if to 0, and otherwise b.
+// It's used for settings where 0 is meaningful, so that an environment can
+// set 0 to override the global value.
+func setInt(a *int, b int) int {
+	if a != nil {
+		return *a
+	}
+	return b
+}
+
 func (g *globalConfig) RsyncMode() string {
 	return nonEmptyString(g.RsyncModeRaw, "exodus")
 }
@@ -126,6 +228,14 @@ func (g *globalConfig) Diag() bool {
 	return g.args.Diag || g.DiagRaw
 }
 
+func (g *globalConfig) Environments() []EnvironmentConfig {
+	out := []EnvironmentConfig{}
+	for i := range g.EnvironmentsRaw {
+		out = append(out, &g.EnvironmentsRaw[i])
+	}
+	return out
+}
+
 func (g *globalConfig) Strip() string {
 	return g.StripRaw
 }
@@ -138,6 +248,10 @@ func (e *environment) GwKey() string {
 	return nonEmptyString(e.GwKeyRaw, e.parent.GwKey())
 }
 
+func (e *environment) GwCACert() string {
+	return nonEmptyString(e.GwCACertRaw, e.parent.GwCACert())
+}
+
 func (e *environment) GwURL() string {
 	return nonEmptyString(e.GwURLRaw, e.parent.GwURL())
 }
@@ -166,6 +280,10 @@ func (e *environment) GwMaxBackoff() int {
 	return nonEmptyInt(e.GwMaxBackoffRaw, e.parent.GwMaxBackoff())
 }
 
+func (e *environment) GwTaskTimeout() int {
+	return setInt(e.GwTaskTimeoutRaw, e.parent.GwTaskTimeout())
+}
+
 func (e *environment) RsyncMode() string {
 	return nonEmptyString(e.RsyncModeRaw, e.parent.RsyncMode())
 }
@@ -190,13 +308,69 @@ func (e *environment) Prefix() string {
 	return e.PrefixRaw
 }
 
+func (e *environment) Source() string {
+	return e.source
+}
+
+func (e *environment) Global() GlobalConfig {
+	return e.parent
+}
+
 func (e *environment) Strip() string {
 	// If the 'strip:' key is defined in the global config, the environment's prefix will not
 	// be stripped from the destination path by default. The prefix is only stripped from the
-	// destination path if the 'strip:' key is undefined.
-	return nonEmptyString(nonEmptyString(e.StripRaw, e.parent.Strip()), e.PrefixRaw)
+	// destination path if the 'strip:' key is undefined. Where the environment was matched
+	// by an alias, glob or regex, the prefix actually matched is stripped.
+	return nonEmptyString(nonEmptyString(e.StripRaw, e.parent.Strip()), nonEmptyString(e.matched, e.PrefixRaw))
 }
 
 func (e *environment) UploadThreads() int {
 	return nonEmptyInt(e.UploadThreadsRaw, e.parent.UploadThreads())
 }
+
+func (e *environment) PresenceThreads() int {
+	return nonEmptyInt(e.PresenceThreadsRaw, e.parent.PresenceThreads())
+}
+
+func (e *environment) UploadBwLimit() int64 {
+	return bwLimit(nonEmptyString(e.UploadBwLimitRaw, e.parent.UploadBwLimitRaw))
+}
+
+func (e *environment) HashCache() string {
+	return enabledPath(nonEmptyString(e.HashCacheRaw, e.parent.HashCacheRaw))
+}
+
+func (e *environment) HashCacheSize() int {
+	return nonEmptyInt(e.HashCacheSizeRaw, e.parent.HashCacheSize())
+}
+
+func (e *environment) JournalDir() string {
+	return enabledPath(nonEmptyString(e.JournalDirRaw, e.parent.JournalDirRaw))
+}
+
+func (e *environment) CDNURL() string {
+	return nonEmptyString(e.CDNURLRaw, e.parent.CDNURL())
+}
+
+func (e *environment) VerifySample() int {
+	return setInt(e.VerifySampleRaw, e.parent.VerifySample())
+}
+
+func (e *environment) VerifyThreads() int {
+	return nonEmptyInt(e.VerifyThreadsRaw, e.parent.VerifyThreads())
+}
+
+func (e *environment) Rewrite() RewriteRules {
+	// Rules aren't merged, since the order of rules matters.
+	if len(e.RewriteRaw) > 0 {
+		return e.RewriteRaw
+	}
+	return e.parent.Rewrite()
+}
+
+func (e *environment) ContentTypes() ContentTypeRules {
+	if len(e.ContentTypesRaw) > 0 {
+		return e.ContentTypesRaw
+	}
+	return e.parent.ContentTypes()
+}
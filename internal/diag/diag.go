@@ -1,7 +1,6 @@
 package diag
 
 import (
-	"bytes"
 	"context"
 	"io/fs"
 	"os"
@@ -44,6 +43,7 @@ func (impl) Run(ctx context.Context, cfg conf.Config, args args.Config) {
 	logger := log.FromContext(ctx)
 
 	logConfig(ctx, cfg)
+	logEnvironments(ctx, cfg)
 	logCommand(ctx, cfg, args)
 	logFilters(ctx, cfg, args)
 	logSrctree(ctx, cfg, args)
@@ -60,6 +60,7 @@ func logConfig(ctx context.Context, cfg conf.Config) {
 	logger.F(
 		"gwcert", cfg.GwCert(),
 		"gwkey", cfg.GwKey(),
+		"gwcacert", cfg.GwCACert(),
 		"gwurl", cfg.GwURL(),
 		"gwenv", cfg.GwEnv(),
 		"gwpollinterval", cfg.GwPollInterval(),
@@ -68,6 +69,11 @@ func logConfig(ctx context.Context, cfg conf.Config) {
 		"gwmaxbackoff", cfg.GwMaxBackoff(),
 	).Warn("exodus-gw")
 
+	logger.F(
+		"hashcache", cfg.HashCache(),
+		"hashcachesize", cfg.HashCacheSize(),
+	).Warn("checksum cache")
+
 	logger.F(
 		"loglevel", cfg.LogLevel(),
 		"logger", cfg.Logger(),
@@ -80,6 +86,26 @@ func logConfig(ctx context.Context, cfg conf.Config) {
 	logger.Error("This is an ERROR log.")
 }
 
+func logEnvironments(ctx context.Context, cfg conf.Config) {
+	logger := log.FromContext(ctx)
+
+	logger.Warn("=============== diagnostics: environments ===========")
+
+	var global conf.GlobalConfig
+	switch c := cfg.(type) {
+	case conf.EnvironmentConfig:
+		global = c.Global()
+	case conf.GlobalConfig:
+		global = c
+	default:
+		return
+	}
+
+	for _, env := range global.Environments() {
+		logger.F("prefix", env.Prefix(), "source", env.Source()).Warn("environment")
+	}
+}
+
 func logGw(ctx context.Context, cfg conf.Config) {
 	logger := log.FromContext(ctx)
 
@@ -121,6 +147,17 @@ func logCommand(ctx context.Context, cfg conf.Config, args args.Config) {
 	logger.F("src", args.Src, "dest", args.Dest, "prefix", prefix,
 		"strip", strip).Warn("paths")
 
+	for i, rule := range cfg.Rewrite() {
+		example := rule.Example()
+		if example == "" {
+			logger.F("rule", i+1, "match", rule.String()).Warn("rewrite")
+			continue
+		}
+		rewritten, _ := rule.Apply(example)
+		logger.F("rule", i+1, "match", rule.String(), "example", example,
+			"result", rewritten).Warn("rewrite")
+	}
+
 	cmd, err := ext.rsync.Command(ctx, rsync.Arguments(ctx, args))
 	if err != nil {
 		logger.F("error", err).Error("Couldn't generate rysnc command")
@@ -170,19 +207,25 @@ func logFilters(ctx context.Context, cfg conf.Config, args args.Config) {
 	logger.Warn("=============== diagnostics: filters ================")
 
 	logger.F("exclude", args.Exclude, "include", args.Include,
-		"filter", args.Filter, "filesfrom", args.FilesFrom).Warn("filter arguments")
+		"excludefrom", args.ExcludeFrom, "includefrom", args.IncludeFrom,
+		"filter", args.Filter, "filters", args.Filters(), "filesfrom", args.FilesFrom, "from0", args.From0).Warn("filter arguments")
+
+	for _, arg := range args.Filters() {
+		for _, pattern := range arg.Patterns {
+			logger.F("file", arg.Value, "pattern", pattern).Warn(arg.Name)
+		}
+	}
 
 	if args.FilesFrom != "" {
-		content, err := os.ReadFile(args.FilesFrom)
+		names, err := args.ReadFilesFrom()
 
 		if err != nil {
 			logger.F("error", err).Error("Can't read 'files-from' file")
 			return
 		}
 
-		lines := bytes.Split(content, []byte("\n"))
-		for _, line := range lines {
-			logger.F("line", string(line)).Warn("files-from")
+		for _, name := range names {
+			logger.F("name", name).Warn("files-from")
 		}
 	}
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/release-engineering/exodus-rsync/internal/args"
@@ -18,8 +19,23 @@ func mockConfig(ctrl *gomock.Controller) conf.Config {
 	out := conf.NewMockEnvironmentConfig(ctrl)
 	e := out.EXPECT()
 
+	prefixRule, err := conf.NewRewriteRule("/pub/mirror", "", "/content/dist")
+	if err != nil {
+		panic(err)
+	}
+	regexRule, err := conf.NewRewriteRule("", "^/pub/(beta|test)/(.+)$", "/content/$1/$2")
+	if err != nil {
+		panic(err)
+	}
+	// No example can be generated for this rule.
+	oddRule, err := conf.NewRewriteRule("", "^/pub/\\Bx", "/content/x")
+	if err != nil {
+		panic(err)
+	}
+
 	e.GwCert().Return("test-cert").AnyTimes()
 	e.GwKey().Return("test-key").AnyTimes()
+	e.GwCACert().Return("test-ca").AnyTimes()
 	e.GwURL().Return("test-url").AnyTimes()
 	e.GwEnv().Return("test-env").AnyTimes()
 	e.GwPollInterval().Return(123).AnyTimes()
@@ -31,8 +47,16 @@ func mockConfig(ctrl *gomock.Controller) conf.Config {
 	e.Logger().Return("syslog").AnyTimes()
 	e.Verbosity().Return(3).AnyTimes()
 	e.Prefix().Return("test-prefix").AnyTimes()
+	e.Source().Return("/etc/exodus-rsync.conf.d/test.conf").AnyTimes()
 	e.Strip().Return("").AnyTimes()
+	e.Rewrite().Return(conf.RewriteRules{prefixRule, regexRule, oddRule}).AnyTimes()
 	e.UploadThreads().Return(4).AnyTimes()
+	e.HashCache().Return("").AnyTimes()
+	e.HashCacheSize().Return(100).AnyTimes()
+
+	global := conf.NewMockGlobalConfig(ctrl)
+	global.EXPECT().Environments().Return([]conf.EnvironmentConfig{out}).AnyTimes()
+	e.Global().Return(global).AnyTimes()
 
 	return out
 }
@@ -81,6 +105,13 @@ func TestDiagRun(t *testing.T) {
 	args.FilesFrom = "/some/non-existent/file"
 	Package.Run(ctx, conf, args)
 
+	// With patterns read from --exclude-from
+	args.ExcludeFrom = []string{"-"}
+	if err := args.ReadFilterFiles(strings.NewReader("*.o\n")); err != nil {
+		t.Fatal(err)
+	}
+	Package.Run(ctx, conf, args)
+
 	// Next tests will use a GW client
 	mockClient := gw.NewMockClient(ctrl)
 	whoAmiI := mockClient.EXPECT().WhoAmI(gomock.Any()).AnyTimes()
@@ -136,3 +167,17 @@ func TestCommandErr(t *testing.T) {
 	// logCommand can run when errors are returned.
 	logCommand(ctx, conf, args)
 }
+
+func TestLogEnvironments(t *testing.T) {
+	ctrl := MockController(t)
+	env := mockConfig(ctrl).(conf.EnvironmentConfig)
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	// Environments can be logged from the global config, as when no
+	// environment matched...
+	logEnvironments(ctx, env.Global())
+
+	// ...or from any other config, where they can't be found.
+	logEnvironments(ctx, conf.NewMockConfig(ctrl))
+}
@@ -0,0 +1,420 @@
+// Package filter implements rsync-compatible filter rules, as used by the
+// --filter, --exclude and --include arguments.
+//
+// Rules are matched in order against paths relative to the top of the
+// transfer, with the first matching rule deciding whether a path is included
+// or excluded. See the "FILTER RULES" section of the rsync man page for the
+// full details of the syntax and semantics of rules.
+package filter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Action is the type of a filter rule.
+type Action int
+
+// Supported filter rule actions.
+const (
+	Exclude  Action = iota // "-": exclude matching paths
+	Include                // "+": include matching paths
+	Hide                   // "H": exclude matching paths on the sending side only
+	Show                   // "S": include matching paths on the sending side only
+	Protect                // "P": protect matching paths from deletion
+	Risk                   // "R": allow deletion of matching paths
+	Merge                  // ".": read rules from a file
+	DirMerge               // ":": read rules from a file in each directory
+	Clear                  // "!": clear the current list of rules
+)
+
+var shortNames = map[byte]Action{
+	'-': Exclude,
+	'+': Include,
+	'H': Hide,
+	'S': Show,
+	'P': Protect,
+	'R': Risk,
+	'.': Merge,
+	':': DirMerge,
+	'!': Clear,
+}
+
+var longNames = map[string]Action{
+	"exclude":   Exclude,
+	"include":   Include,
+	"hide":      Hide,
+	"show":      Show,
+	"protect":   Protect,
+	"risk":      Risk,
+	"merge":     Merge,
+	"dir-merge": DirMerge,
+	"clear":     Clear,
+}
+
+// Modifiers accepted by each type of rule.
+const (
+	patternModifiers = "/!srp"
+	sidedModifiers   = "/!p"
+	mergeModifiers   = "-+enwsr"
+)
+
+// Side is a side of the transfer to which rules may apply.
+type Side int
+
+// Sides of the transfer.
+const (
+	// Sender rules decide which files are transferred.
+	Sender Side = iota
+
+	// Receiver rules decide which files are protected from deletion.
+	Receiver
+)
+
+// Rule is a single parsed filter rule.
+type Rule struct {
+	Action Action
+
+	// The pattern to match, or the file name for merge rules.
+	Pattern string
+
+	text string
+
+	// Modifiers.
+	absPath      bool   // "/": match against the absolute path
+	negate       bool   // "!": match if the pattern does not match
+	senderOnly   bool   // "s"
+	receiverOnly bool   // "r"
+	mergeAction  Action // "+" or "-": merged files contain only patterns
+	patternsOnly bool
+	excludeSelf  bool // "e": exclude the merge file itself
+	noInherit    bool // "n": merged rules are not inherited by subdirectories
+	words        bool // "w": merged files are split on whitespace
+
+	// For anchored rules read from a per-directory merge file, the path of
+	// the directory holding the file, relative to the top of the transfer.
+	base string
+
+	match *pattern
+
+	// For patterns ending in "/***", the pattern matching the directory
+	// itself.
+	stem    *pattern
+	dirOnly bool
+}
+
+// String returns the rule as originally written.
+func (r *Rule) String() string {
+	return r.text
+}
+
+// Excludes returns true if paths matching this rule are excluded.
+func (r *Rule) Excludes() bool {
+	return r.Action == Exclude || r.Action == Hide || r.Action == Protect
+}
+
+// appliesTo returns true if the rule is used on the given side of the
+// transfer.
+func (r *Rule) appliesTo(side Side) bool {
+	switch r.Action {
+	case Hide, Show:
+		return side == Sender
+	case Protect, Risk:
+		return side == Receiver
+	}
+	return !(r.senderOnly && side == Receiver) && !(r.receiverOnly && side == Sender)
+}
+
+// Parse parses a rule in the format accepted by rsync's --filter argument,
+// e.g. "- *.o", "+/ /some/path", "dir-merge .rsync-filter" or "!".
+func Parse(text string) (*Rule, error) {
+	rule := &Rule{text: text}
+	rest := text
+
+	// Long names consist of lowercase letters and "-" and are separated
+	// from modifiers by ",".
+	n := 0
+	for n < len(rest) && ((rest[n] >= 'a' && rest[n] <= 'z') || (n > 0 && rest[n] == '-')) {
+		n++
+	}
+
+	if n > 0 {
+		action, ok := longNames[rest[:n]]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter rule %q", text)
+		}
+		rule.Action = action
+		rest = rest[n:]
+		if len(rest) > 0 && !strings.ContainsRune(", _", rune(rest[0])) {
+			return nil, fmt.Errorf("unknown filter rule %q", text)
+		}
+	} else {
+		if rest == "" {
+			return nil, fmt.Errorf("empty filter rule")
+		}
+		action, ok := shortNames[rest[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter rule %q", text)
+		}
+		rule.Action = action
+		rest = rest[1:]
+	}
+
+	rest = strings.TrimPrefix(rest, ",")
+	end := strings.IndexAny(rest, " _")
+	if end < 0 {
+		end = len(rest)
+	}
+	if err := rule.setModifiers(rest[:end]); err != nil {
+		return nil, fmt.Errorf("%w in filter rule %q", err, text)
+	}
+
+	pattern := ""
+	if end < len(rest) {
+		pattern = rest[end+1:]
+	}
+
+	if rule.Action == Clear {
+		if pattern != "" {
+			return nil, fmt.Errorf("unexpected pattern in filter rule %q", text)
+		}
+		return rule, nil
+	}
+
+	if pattern == "" {
+		return nil, fmt.Errorf("missing pattern in filter rule %q", text)
+	}
+
+	rule.setPattern(pattern)
+	return rule, nil
+}
+
+// ParsePattern parses the value of an --exclude or --include argument, or a
+// line of an --exclude-from or --include-from file, creating a rule with the
+// given action.
+//
+// As in rsync, a leading "- " or "+ " overrides the action, and a single "!"
+// clears the list of rules. An empty pattern returns a nil rule.
+func ParsePattern(text string, action Action) *Rule {
+	rule := &Rule{text: text, Action: action}
+	pattern := text
+
+	switch {
+	case strings.HasPrefix(text, "- "):
+		rule.Action = Exclude
+		pattern = text[2:]
+	case strings.HasPrefix(text, "+ "):
+		rule.Action = Include
+		pattern = text[2:]
+	case text == "!":
+		rule.Action = Clear
+		return rule
+	}
+
+	if pattern == "" {
+		return nil
+	}
+
+	rule.setPattern(pattern)
+	return rule
+}
+
+func (r *Rule) setModifiers(mods string) error {
+	valid := patternModifiers
+	switch r.Action {
+	case Hide, Show, Protect, Risk:
+		valid = sidedModifiers
+	case Merge, DirMerge:
+		valid = mergeModifiers
+	case Clear:
+		valid = ""
+	}
+
+	for _, mod := range mods {
+		if mod == 'C' || mod == 'x' {
+			return fmt.Errorf("unsupported modifier %q", mod)
+		}
+		if !strings.ContainsRune(valid, mod) {
+			return fmt.Errorf("invalid modifier %q", mod)
+		}
+
+		switch mod {
+		case '/':
+			r.absPath = true
+		case '!':
+			r.negate = true
+		case 's':
+			r.senderOnly = true
+		case 'r':
+			r.receiverOnly = true
+		case '-', '+':
+			if r.patternsOnly {
+				return fmt.Errorf("conflicting modifiers \"+\" and \"-\"")
+			}
+			r.patternsOnly = true
+			r.mergeAction = Exclude
+			if mod == '+' {
+				r.mergeAction = Include
+			}
+		case 'e':
+			r.excludeSelf = true
+		case 'n':
+			r.noInherit = true
+		case 'w':
+			r.words = true
+		}
+		// "p" (perishable) is accepted, but has no effect here.
+	}
+
+	return nil
+}
+
+func (r *Rule) setPattern(text string) {
+	r.Pattern = text
+
+	if r.Action == Merge || r.Action == DirMerge {
+		return
+	}
+
+	// A trailing slash matches only directories.
+	if len(text) > 1 && strings.HasSuffix(text, "/") {
+		r.dirOnly = true
+		text = text[:len(text)-1]
+	}
+
+	r.match = newPattern(text)
+
+	// "dir/***" matches both the directory, as if "dir/" had been
+	// specified, and everything within it.
+	if strings.HasSuffix(text, "/***") && len(text) > 4 {
+		r.stem = newPattern(text[:len(text)-4])
+	}
+}
+
+// matches returns true if the rule matches the given path, relative to the top
+// of the transfer. absRoot is the absolute path of the top of the transfer.
+func (r *Rule) matches(name string, isDir bool, absRoot string) bool {
+	return r.matchesName(name, isDir, absRoot) != r.negate
+}
+
+func (r *Rule) matchesName(name string, isDir bool, absRoot string) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	if r.base != "" {
+		if !strings.HasPrefix(name, r.base+"/") {
+			return false
+		}
+		name = name[len(r.base)+1:]
+	}
+
+	if r.absPath {
+		name = strings.TrimPrefix(path.Join(absRoot, name), "/")
+	}
+
+	if r.stem != nil && isDir && r.stem.matches(name) {
+		return true
+	}
+
+	return r.match.matches(name)
+}
+
+// Pattern is a wildcard pattern which can be matched against paths outside of
+// filter rules, with the same semantics as the pattern of a rule.
+type Pattern struct {
+	p *pattern
+}
+
+// NewPattern compiles the given rsync-style wildcard pattern.
+func NewPattern(text string) Pattern {
+	return Pattern{newPattern(text)}
+}
+
+// Matches returns true if the pattern matches name, a slash-separated path
+// relative to the top of the tree. A leading slash on name is ignored.
+func (p Pattern) Matches(name string) bool {
+	return p.p.matches(strings.TrimPrefix(name, "/"))
+}
+
+func (p Pattern) String() string {
+	if p.p.anchored {
+		return "/" + p.p.text
+	}
+	return p.p.text
+}
+
+// pattern is a compiled rsync include/exclude pattern.
+type pattern struct {
+	text string
+
+	anchored    bool // leading "/"
+	wild        bool // contains wildcards
+	wild2       bool // contains "**"
+	wild2Prefix bool // starts with "**"
+	slashes     int
+}
+
+func newPattern(text string) *pattern {
+	out := &pattern{
+		slashes:  strings.Count(text, "/"),
+		wild:     strings.ContainsAny(text, "*?["),
+		anchored: strings.HasPrefix(text, "/"),
+	}
+
+	out.text = strings.TrimPrefix(text, "/")
+	out.wild2 = strings.Contains(out.text, "**")
+	out.wild2Prefix = strings.HasPrefix(out.text, "**")
+
+	return out
+}
+
+// matches implements rsync's rule_matches, for a path relative to the top of
+// the transfer.
+func (p *pattern) matches(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	if p.slashes == 0 && !p.wild2 {
+		// Without slashes or "**", only the final component of the path
+		// is matched.
+		name = name[strings.LastIndex(name, "/")+1:]
+	}
+
+	match := func(text string) bool {
+		if p.wild {
+			return wildmatch(p.text, text)
+		}
+		// Backslashes are only escapes if the pattern contains wildcards.
+		return p.text == text
+	}
+
+	switch {
+	case !p.anchored && p.slashes > 0 && !p.wild2:
+		// A non-anchored pattern with an infix slash and no "**" must match
+		// the last slashes+1 components of the path.
+		idx := len(name)
+		for i := 0; i <= p.slashes && idx > 0; i++ {
+			idx = strings.LastIndex(name[:idx], "/")
+		}
+		return match(name[idx+1:])
+
+	case !p.anchored && p.wild2 && !p.wild2Prefix:
+		// A non-anchored pattern with an infix or trailing "**" is tried
+		// against the path following every slash.
+		for {
+			if result := dowild(p.text, name); result != wmNoMatch {
+				return result == wmMatch
+			}
+			idx := strings.Index(name, "/")
+			if idx < 0 {
+				return false
+			}
+			name = name[idx+1:]
+		}
+	}
+
+	return match(name)
+}
@@ -0,0 +1,602 @@
+package filter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWildmatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "bar", false},
+		{"*", "foo", true},
+		{"*", "foo/bar", false},
+		{"*", "", true},
+		{"f*", "foo", true},
+		{"*o", "foo", true},
+		{"*.c", "foo.c", true},
+		{"*.c", "dir/foo.c", false},
+		{"**", "dir/foo.c", true},
+		{"**.c", "dir/foo.c", true},
+		{"dir/**", "dir/a/b", true},
+		{"dir/**/b", "dir/a/b", true},
+		{"dir/**/b", "dir/b", false},
+		{"dir/*/b", "dir/a/b", true},
+		{"dir/*/b", "dir/a/c/b", false},
+		{"???", "abc", true},
+		{"???", "a/c", false},
+		{"a?c", "abc", true},
+		{"[abc]", "b", true},
+		{"[abc]", "d", false},
+		{"[a-c]x", "bx", true},
+		{"[!a-c]x", "dx", true},
+		{"[!a-c]x", "bx", false},
+		{"[^a-c]x", "bx", false},
+		{"[!a]", "/", false},
+		{"[]]", "]", true},
+		{"[]-]", "-", true},
+		{"[a-]", "-", true},
+		{"[[:digit:]]", "4", true},
+		{"[[:digit:]]", "x", false},
+		{"[[:alpha:][:digit:]]", "x", true},
+		{"[[:upper:]]*", "Foo", true},
+		{"[[:bogus:]]", "x", false},
+		{"[a", "a", false},
+		{"[a", "[a", false},
+		{`\*`, "*", true},
+		{`\*`, "x", false},
+		{`[\]]`, "]", true},
+		{`foo\?`, "foo?", true},
+		{"a(b*", "a(bc", true},
+		{"*/*/*", "a/b/c", true},
+		{"*/*/*", "a/b", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.text, func(t *testing.T) {
+			if got := wildmatch(tt.pattern, tt.text); got != tt.want {
+				t.Errorf("wildmatch(%q, %q) = %v, want %v", tt.pattern, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text    string
+		action  Action
+		pattern string
+	}{
+		{"- *.o", Exclude, "*.o"},
+		{"+ foo bar", Include, "foo bar"},
+		{"-_foo", Exclude, "foo"},
+		{"-/ /abs", Exclude, "/abs"},
+		{"+!_dir/", Include, "dir/"},
+		{"-,s foo", Exclude, "foo"},
+		{"exclude foo", Exclude, "foo"},
+		{"include,/ /foo", Include, "/foo"},
+		{"hide secret", Hide, "secret"},
+		{"S secret", Show, "secret"},
+		{"protect keep", Protect, "keep"},
+		{"R *", Risk, "*"},
+		{". rules.txt", Merge, "rules.txt"},
+		{"merge,- excludes.txt", Merge, "excludes.txt"},
+		{":n- .excludes", DirMerge, ".excludes"},
+		{"dir-merge /.rsync-filter", DirMerge, "/.rsync-filter"},
+		{"!", Clear, ""},
+		{"clear", Clear, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			rule, err := Parse(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule.Action != tt.action || rule.Pattern != tt.pattern {
+				t.Errorf("Parse(%q) = %v %q", tt.text, rule.Action, rule.Pattern)
+			}
+			if rule.String() != tt.text {
+				t.Errorf("String() = %q", rule.String())
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"":            "empty filter rule",
+		"quux":        `unknown filter rule "quux"`,
+		"x foo":       `unknown filter rule "x foo"`,
+		"excludes *":  `unknown filter rule "excludes *"`,
+		"-":           `missing pattern in filter rule "-"`,
+		"+ ":          `missing pattern in filter rule "+ "`,
+		"-z foo":      `invalid modifier 'z' in filter rule "-z foo"`,
+		"Hs foo":      `invalid modifier 's' in filter rule "Hs foo"`,
+		"-C":          `unsupported modifier 'C' in filter rule "-C"`,
+		"-x foo":      `unsupported modifier 'x' in filter rule "-x foo"`,
+		".+- foo":     `conflicting modifiers "+" and "-" in filter rule ".+- foo"`,
+		"! foo":       `unexpected pattern in filter rule "! foo"`,
+		"clear,/ foo": `invalid modifier '/' in filter rule "clear,/ foo"`,
+	}
+
+	for text, want := range tests {
+		t.Run(text, func(t *testing.T) {
+			_, err := Parse(text)
+			if err == nil || err.Error() != want {
+				t.Errorf("Parse(%q) returned %v, want %s", text, err, want)
+			}
+		})
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	tests := []struct {
+		text    string
+		action  Action
+		want    Action
+		pattern string
+	}{
+		{"*.o", Exclude, Exclude, "*.o"},
+		{"*.o", Include, Include, "*.o"},
+		{"+ *.c", Exclude, Include, "*.c"},
+		{"- *.o", Include, Exclude, "*.o"},
+		{"-foo", Exclude, Exclude, "-foo"},
+		{"!", Exclude, Clear, ""},
+	}
+
+	for _, tt := range tests {
+		rule := ParsePattern(tt.text, tt.action)
+		if rule.Action != tt.want || rule.Pattern != tt.pattern {
+			t.Errorf("ParsePattern(%q) = %v %q", tt.text, rule.Action, rule.Pattern)
+		}
+	}
+
+	if rule := ParsePattern("", Exclude); rule != nil {
+		t.Errorf("empty pattern returned %v", rule)
+	}
+}
+
+func TestPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.xml.gz", "/content/dist/repodata/primary.xml.gz", true},
+		{"*.xml.gz", "/content/dist/repodata/primary.xml", false},
+		{"repodata/*", "/content/dist/repodata/repomd.xml", true},
+		{"/content/*/.treeinfo", "/content/dist/.treeinfo", true},
+		{"/content/*/.treeinfo", "/content/dist/os/.treeinfo", false},
+		{"/content/**/ks", "/content/dist/os/ks", true},
+		{".repo", "/content/dist/.repo", true},
+	}
+
+	for _, tt := range tests {
+		pattern := NewPattern(tt.pattern)
+		if got := pattern.Matches(tt.name); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+		if pattern.String() != tt.pattern {
+			t.Errorf("pattern %q has string %q", tt.pattern, pattern.String())
+		}
+	}
+}
+
+// mustParse parses a list of rules, each given as for --filter.
+func mustParse(t *testing.T, texts ...string) []*Rule {
+	t.Helper()
+
+	var out []*Rule
+	for _, text := range texts {
+		rule, err := Parse(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, rule)
+	}
+	return out
+}
+
+// TestRsyncBehavior checks matching against behavior documented by rsync,
+// mostly from the "FILTER RULES" section of its man page.
+func TestRsyncBehavior(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []string
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		// "- *.o" would exclude all names ending in .o
+		{"wildcard name", []string{"- *.o"}, "foo.o", false, true},
+		{"wildcard name in subdir", []string{"- *.o"}, "a/b/foo.o", false, true},
+		{"wildcard name no match", []string{"- *.o"}, "foo.c", false, false},
+
+		// "- /foo" would exclude a file (or directory) named foo in the
+		// transfer-root directory
+		{"anchored", []string{"- /foo"}, "foo", false, true},
+		{"anchored dir", []string{"- /foo"}, "foo", true, true},
+		{"anchored not in subdir", []string{"- /foo"}, "a/foo", false, false},
+
+		// "- foo/" would exclude any directory named foo
+		{"dir only", []string{"- foo/"}, "a/foo", true, true},
+		{"dir only file", []string{"- foo/"}, "a/foo", false, false},
+
+		// "- /foo/*/bar" would exclude any file named bar which is at two
+		// levels below a directory named foo in the transfer-root directory
+		{"anchored star", []string{"- /foo/*/bar"}, "foo/x/bar", false, true},
+		{"anchored star deeper", []string{"- /foo/*/bar"}, "foo/x/y/bar", false, false},
+		{"anchored star not root", []string{"- /foo/*/bar"}, "a/foo/x/bar", false, false},
+
+		// "- /foo/**/bar" would exclude any file named bar two or more
+		// levels below a directory named foo in the transfer-root directory
+		{"anchored double star", []string{"- /foo/**/bar"}, "foo/x/bar", false, true},
+		{"anchored double star deeper", []string{"- /foo/**/bar"}, "foo/x/y/bar", false, true},
+		{"anchored double star one level", []string{"- /foo/**/bar"}, "foo/bar", false, false},
+
+		// A pattern with a slash is matched against the trailing part of
+		// the path, at a directory boundary.
+		{"unanchored slash", []string{"- foo/bar"}, "a/foo/bar", false, true},
+		{"unanchored slash at root", []string{"- foo/bar"}, "foo/bar", false, true},
+		{"unanchored slash partial name", []string{"- foo/bar"}, "afoo/bar", false, false},
+		{"unanchored wild slash", []string{"- sub*/*.c"}, "a/sub1/x.c", false, true},
+		{"unanchored wild slash deeper", []string{"- sub*/*.c"}, "sub1/a/x.c", false, false},
+
+		// "**" matches anywhere, including across slashes.
+		{"double star prefix", []string{"- **/tmp"}, "a/b/tmp", false, true},
+		{"double star infix", []string{"- a/**/z"}, "x/a/b/c/z", false, true},
+		{"double star trailing", []string{"- cache/**"}, "x/cache/y/z", false, true},
+		{"double star trailing dir itself", []string{"- cache/**"}, "x/cache", true, false},
+
+		// "dir_name/***" matches both the directory and everything in it.
+		{"triple star dir", []string{"- /dir/***"}, "dir", true, true},
+		{"triple star content", []string{"- /dir/***"}, "dir/a/b", false, true},
+		{"triple star file of same name", []string{"- /dir/***"}, "dir", false, false},
+		{"triple star other", []string{"- /dir/***"}, "dirt", true, false},
+
+		// The first matching rule wins.
+		{"include before exclude", []string{"+ foo.o", "- *.o"}, "foo.o", false, false},
+		{"exclude before include", []string{"- *.o", "+ foo.o"}, "foo.o", false, true},
+		{"include dirs exclude rest dir", []string{"+ */", "+ *.c", "- *"}, "a/b", true, false},
+		{"include dirs exclude rest c", []string{"+ */", "+ *.c", "- *"}, "a/b.c", false, false},
+		{"include dirs exclude rest other", []string{"+ */", "+ *.c", "- *"}, "a/b.h", false, true},
+
+		// "!" clears the current list of rules.
+		{"clear", []string{"- *.o", "!", "- *.c"}, "foo.o", false, false},
+		{"after clear", []string{"- *.o", "!", "- *.c"}, "foo.c", false, true},
+
+		// The "!" modifier negates the match: "- ! */" excludes all
+		// non-directories.
+		{"negate file", []string{"-! */"}, "a/file", false, true},
+		{"negate dir", []string{"-! */"}, "a/dir", true, false},
+
+		// Character classes and escapes, only when wildcards are present.
+		{"class", []string{"- file[0-9]"}, "file4", false, true},
+		{"class no match", []string{"- file[0-9]"}, "filex", false, false},
+		{"escaped wildcard", []string{`- foo\*`}, "foo*", false, true},
+		{"escaped wildcard literal", []string{`- foo\*`}, "foox", false, false},
+		{"literal backslash", []string{`- foo\bar`}, `foo\bar`, false, true},
+
+		// Hide and protect only apply to one side of the transfer.
+		{"hide", []string{"H secret"}, "secret", false, true},
+		{"protect on sender", []string{"P keep"}, "keep", false, false},
+		{"receiver only", []string{"-r foo"}, "foo", false, false},
+		{"sender only", []string{"-s foo"}, "foo", false, true},
+
+		// The "/" modifier matches against the absolute path.
+		{"absolute", []string{"-/ /src/tree/foo"}, "foo", false, true},
+		{"absolute no match", []string{"-/ /other/foo"}, "foo", false, false},
+		{"absolute unanchored", []string{"-/ tree/foo"}, "foo", false, true},
+
+		// The top of the transfer is never excluded.
+		{"top", []string{"- *"}, "", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := New(Tree{Dir: t.TempDir(), AbsRoot: "/src/tree"}, mustParse(t, tt.rules...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			excluded, _, err := set.Excluded(tt.path, tt.isDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if excluded != tt.excluded {
+				t.Errorf("rules %v: Excluded(%q) = %v, want %v", tt.rules, tt.path, excluded, tt.excluded)
+			}
+		})
+	}
+}
+
+func TestReceiverSide(t *testing.T) {
+	rules := mustParse(t, "H hidden", "P protected", "-s sender", "- excluded")
+
+	set, err := New(Tree{Side: Receiver}, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{
+		"hidden":    false,
+		"protected": true,
+		"sender":    false,
+		"excluded":  true,
+	} {
+		excluded, rule, err := set.Excluded(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if excluded != want {
+			t.Errorf("Excluded(%q) = %v (rule %v), want %v", name, excluded, rule, want)
+		}
+	}
+}
+
+func TestMatchReturnsRule(t *testing.T) {
+	set, err := New(Tree{}, mustParse(t, "+ keep.o", "- *.o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule, err := set.Match("dir/keep.o", false)
+	if err != nil || rule == nil || rule.String() != "+ keep.o" || rule.Excludes() {
+		t.Errorf("Match returned %v, %v", rule, err)
+	}
+
+	rule, err = set.Match("dir/other.c", false)
+	if err != nil || rule != nil {
+		t.Errorf("Match returned %v, %v", rule, err)
+	}
+}
+
+// writeFiles creates files under dir with the given content.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkExcluded checks the result of Excluded for a number of paths, where
+// paths ending in "/" are directories.
+func checkExcluded(t *testing.T, set *Set, want map[string]bool) {
+	t.Helper()
+
+	for name, wantExcluded := range want {
+		isDir := strings.HasSuffix(name, "/")
+		excluded, rule, err := set.Excluded(strings.TrimSuffix(name, "/"), isDir)
+		if err != nil {
+			t.Fatalf("Excluded(%q): %v", name, err)
+		}
+		if excluded != wantExcluded {
+			t.Errorf("Excluded(%q) = %v (rule %v), want %v", name, excluded, rule, wantExcluded)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"rules.txt": "# comment\n; comment\n\n+ keep.o\n- *.o\n. more.txt\n",
+		"more.txt":  "- *.tmp\r\n",
+		"excludes":  "*.log\n+ literal\n",
+		"words":     "- a.txt + b.txt\n- *.txt\n",
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		set, err := New(Tree{}, mustParse(t, ". "+filepath.Join(dir, "rules.txt"), "- keep.*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkExcluded(t, set, map[string]bool{
+			"keep.o":  false,
+			"other.o": true,
+			"x.tmp":   true,
+			"keep.c":  true,
+			"foo.c":   false,
+		})
+	})
+
+	t.Run("patterns only", func(t *testing.T) {
+		set, err := New(Tree{}, mustParse(t, ".- "+filepath.Join(dir, "excludes")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkExcluded(t, set, map[string]bool{
+			"debug.log": true,
+			"+ literal": true,
+			"literal":   false,
+			"other":     false,
+		})
+	})
+
+	t.Run("words", func(t *testing.T) {
+		set, err := New(Tree{}, mustParse(t, ".w "+filepath.Join(dir, "words")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkExcluded(t, set, map[string]bool{
+			"a.txt": true,
+			"b.txt": false,
+			"c.txt": true,
+		})
+	})
+
+	t.Run("sender only", func(t *testing.T) {
+		set, err := New(Tree{Side: Receiver}, mustParse(t, ".s "+filepath.Join(dir, "rules.txt")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkExcluded(t, set, map[string]bool{"other.o": false})
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := New(Tree{}, mustParse(t, ". "+filepath.Join(dir, "missing")))
+		if err == nil {
+			t.Error("merging missing file unexpectedly succeeded")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		writeFiles(t, dir, map[string]string{"invalid": "bogus rule\n"})
+		_, err := New(Tree{}, mustParse(t, ". "+filepath.Join(dir, "invalid")))
+		if err == nil || !strings.Contains(err.Error(), `unknown filter rule "bogus rule"`) {
+			t.Errorf("merging invalid file returned %v", err)
+		}
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		writeFiles(t, dir, map[string]string{"self": ". self\n"})
+		_, err := New(Tree{}, mustParse(t, ". "+filepath.Join(dir, "self")))
+		if err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+			t.Errorf("merging recursive file returned %v", err)
+		}
+	})
+}
+
+func TestDirMerge(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".rsync-filter":         "- *.o\n- /top-only\n",
+		"a/.rsync-filter":       "+ keep.o\n- /local\n",
+		"a/b/.rsync-filter":     "!\n- *.c\n",
+		"n/.rsync-filter":       "- *.h\n",
+		"n/.no-inherit":         "- *.x\n",
+		"n/sub/placeholder":     "",
+		"nested/.rsync-filter":  ": .other\n",
+		"invalid/.rsync-filter": "bogus\n",
+	})
+
+	set, err := New(Tree{Dir: dir}, mustParse(t, ": .rsync-filter", ":n .no-inherit", "- *.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExcluded(t, set, map[string]bool{
+		// Rules from the top directory apply everywhere.
+		"x.o":     true,
+		"a/c/x.o": true,
+		"x.tmp":   true,
+
+		// Anchored rules are relative to the directory of the merge file.
+		"top-only":     true,
+		"a/top-only":   false,
+		"a/local":      true,
+		"local":        false,
+		"a/c/local":    false,
+		"a/b/top-only": false,
+
+		// Rules from subdirectories take precedence.
+		"a/keep.o":   false,
+		"a/c/keep.o": false,
+		"keep.o":     true,
+
+		// Clearing drops inherited rules, but not those outside the
+		// per-directory list.
+		"a/b/x.o":   false,
+		"a/b/x.c":   true,
+		"a/b/x.tmp": true,
+
+		// Rules with "n" aren't inherited.
+		"n/x.x":     true,
+		"n/sub/x.x": false,
+		"n/sub/x.h": true,
+	})
+
+	_, _, err = set.Excluded("nested/file", false)
+	if err == nil || !strings.Contains(err.Error(), "within per-directory merge file") {
+		t.Errorf("nested dir-merge returned %v", err)
+	}
+
+	_, _, err = set.Excluded("invalid/file", false)
+	if err == nil || !strings.Contains(err.Error(), "unknown filter rule") {
+		t.Errorf("invalid merge file returned %v", err)
+	}
+}
+
+func TestDirMergeExcludeSelf(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".rsync-filter": "- *.o\n"})
+
+	set, err := New(Tree{Dir: dir}, mustParse(t, ":e .rsync-filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExcluded(t, set, map[string]bool{
+		".rsync-filter":     true,
+		"sub/.rsync-filter": true,
+		"x.o":               true,
+	})
+}
+
+func TestDirMergePrefix(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"src/.rsync-filter":     "- /anchored\n",
+		"src/sub/.rsync-filter": "- *.o\n",
+	})
+
+	// Transfer of "src" without a trailing slash: paths include "src".
+	set, err := New(Tree{Dir: filepath.Join(dir, "src"), Prefix: "src"}, mustParse(t, ": .rsync-filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExcluded(t, set, map[string]bool{
+		"src/":             false,
+		"src/anchored":     true,
+		"src/sub/anchored": false,
+		"src/sub/x.o":      true,
+		"src/x.o":          false,
+		"other":            false,
+	})
+}
+
+func TestDirMergeParents(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".rsync-filter":       "- *.top\n",
+		"a/.rsync-filter":     "- *.a\n",
+		"a/src/.rsync-filter": "- *.src\n",
+		"a/src/placeholder":   "",
+	})
+
+	// As with -F, the merge file name includes a directory above the
+	// source tree, so files are read from every directory in between.
+	set, err := New(Tree{Dir: filepath.Join(dir, "a", "src")}, mustParse(t, ": "+dir+"/.rsync-filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExcluded(t, set, map[string]bool{
+		"x.top":     true,
+		"x.a":       true,
+		"x.src":     true,
+		"sub/x.top": true,
+		"x.other":   false,
+	})
+
+	// A directory which isn't above the source tree is ignored.
+	set, err = New(Tree{Dir: filepath.Join(dir, "a", "src")}, mustParse(t, ": /nonexistent/.rsync-filter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExcluded(t, set, map[string]bool{"x.top": false})
+}
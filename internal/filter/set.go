@@ -0,0 +1,413 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Limit on the nesting of merge files, to catch files which merge themselves.
+const maxMergeDepth = 20
+
+// Tree describes the transfer to which a Set of rules is applied.
+type Tree struct {
+	// Directory on disk at the top of the source tree, where per-directory
+	// merge files are read from.
+	Dir string
+
+	// Path of Dir relative to the top of the transfer, which is empty
+	// unless the transfer includes the source directory itself (as when
+	// SRC lacks a trailing slash).
+	Prefix string
+
+	// Absolute path of the top of the transfer, matched by rules with the
+	// "/" modifier.
+	AbsRoot string
+
+	// Side of the transfer for which rules are used.
+	Side Side
+
+	// If true, rules in merge files are separated by NUL characters rather
+	// than newlines, as with rsync's --from0.
+	From0 bool
+}
+
+// Set is an ordered list of filter rules, applied to a single transfer.
+//
+// A Set is not safe for concurrent use.
+type Set struct {
+	tree  Tree
+	rules []*Rule
+
+	// Rules in effect for each directory, if there are any per-directory
+	// merge rules.
+	perDir bool
+	top    *scope
+	scopes map[string]*scope
+}
+
+// scope holds the rules read from per-directory merge files which are in effect
+// within a single directory.
+type scope struct {
+	rules map[*Rule][]*Rule
+}
+
+// New returns a Set of rules for the given transfer.
+//
+// Merge files are read immediately, relative to the current directory; per-
+// directory merge files are read from the source tree as needed.
+func New(tree Tree, rules []*Rule) (*Set, error) {
+	out := &Set{
+		tree:   tree,
+		top:    &scope{rules: map[*Rule][]*Rule{}},
+		scopes: map[string]*scope{},
+	}
+
+	var err error
+	out.rules, _, err = out.expand(nil, rules, ".", "", 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range out.rules {
+		if rule.Action == DirMerge {
+			out.perDir = true
+			if err := out.readParents(rule); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// expand appends rules onto out, replacing merge rules with the content of
+// the merged file, applying clear rules and dropping rules not used on this
+// side of the transfer.
+//
+// dir is the directory relative to which merge files are read, base the path
+// of the directory from which per-directory rules were read, and perDir is
+// true when expanding the content of a per-directory merge file. Returns true
+// if a clear rule was encountered.
+func (s *Set) expand(out []*Rule, rules []*Rule, dir string, base string, depth int, perDir bool) ([]*Rule, bool, error) {
+	cleared := false
+
+	for _, rule := range rules {
+		switch rule.Action {
+		case Clear:
+			out = out[:0]
+			cleared = true
+
+		case Merge:
+			if depth >= maxMergeDepth {
+				return nil, false, fmt.Errorf("merge files nested too deeply at %s", rule.Pattern)
+			}
+
+			filename := rule.Pattern
+			if !filepath.IsAbs(filename) {
+				filename = filepath.Join(dir, filename)
+			}
+
+			merged, err := readRules(filename, rule, base, s.tree.From0)
+			if err != nil {
+				return nil, false, err
+			}
+
+			var mergeCleared bool
+			out, mergeCleared, err = s.expand(out, merged, filepath.Dir(filename), base, depth+1, perDir)
+			if err != nil {
+				return nil, false, err
+			}
+			cleared = cleared || mergeCleared
+
+		case DirMerge:
+			if perDir {
+				return nil, false, fmt.Errorf("unsupported dir-merge rule %q within per-directory merge file", rule)
+			}
+			out = append(out, rule)
+
+		default:
+			if rule.appliesTo(s.tree.Side) {
+				out = append(out, rule)
+			}
+		}
+	}
+
+	return out, cleared, nil
+}
+
+// NewScanner returns a scanner reading the lines of a rule file or file list
+// from r. Lines are terminated by newlines, with an optional preceding carriage
+// return, or by NUL characters if from0 is true.
+func NewScanner(r io.Reader, from0 bool) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	if from0 {
+		scanner.Split(scanNul)
+	}
+	return scanner
+}
+
+func scanNul(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// readRules reads and parses the rules from a merge file, applying the
+// modifiers of the merge rule.
+func readRules(filename string, merge *Rule, base string, from0 bool) ([]*Rule, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tokens []string
+	scanner := NewScanner(file, from0)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if merge.words {
+			tokens = append(tokens, strings.Fields(line)...)
+			continue
+		}
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+
+	var out []*Rule
+	if merge.excludeSelf {
+		self := &Rule{text: "- " + path.Base(merge.Pattern), Action: Exclude}
+		self.setPattern(path.Base(merge.Pattern))
+		out = append(out, self)
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		var rule *Rule
+
+		if merge.patternsOnly {
+			rule = &Rule{text: tokens[i], Action: merge.mergeAction}
+			rule.setPattern(tokens[i])
+		} else {
+			text := tokens[i]
+			rule, err = Parse(text)
+			if err != nil && merge.words && i+1 < len(tokens) {
+				// When splitting on whitespace, the rule and its pattern
+				// are separate words.
+				text += " " + tokens[i+1]
+				if rule, err = Parse(text); err == nil {
+					i++
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filename, err)
+			}
+		}
+
+		rule.senderOnly = rule.senderOnly || merge.senderOnly
+		rule.receiverOnly = rule.receiverOnly || merge.receiverOnly
+		rule.noInherit = merge.noInherit
+		if base != "" && rule.match != nil && rule.match.anchored {
+			rule.base = base
+		}
+
+		out = append(out, rule)
+	}
+
+	return out, nil
+}
+
+// readParents reads the per-directory merge files for a rule in directories
+// above the source tree. As in rsync, this happens only if the merge file name
+// includes a directory which is an ancestor of the source tree.
+func (s *Set) readParents(rule *Rule) error {
+	dir, _ := path.Split(rule.Pattern)
+	if dir == "" {
+		return nil
+	}
+
+	top, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	srcDir, err := filepath.Abs(s.tree.Dir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(top, srcDir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+
+	// Read from the top down to the parent of the source tree.
+	dirs := []string{top}
+	components := strings.Split(rel, string(filepath.Separator))
+	for _, component := range components[:len(components)-1] {
+		dirs = append(dirs, filepath.Join(dirs[len(dirs)-1], component))
+	}
+
+	for _, dir := range dirs {
+		rules, err := s.readDir(rule, dir, "", s.top.rules[rule])
+		if err != nil {
+			return err
+		}
+		s.top.rules[rule] = rules
+	}
+
+	return nil
+}
+
+// readDir returns the rules in effect for a dir-merge rule in a directory,
+// given the rules in effect in its parent.
+func (s *Set) readDir(rule *Rule, dir string, base string, parent []*Rule) ([]*Rule, error) {
+	filename := filepath.Join(dir, path.Base(rule.Pattern))
+
+	merged, err := readRules(filename, rule, base, s.tree.From0)
+	if errors.Is(err, fs.ErrNotExist) {
+		merged = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	rules, cleared, err := s.expand(nil, merged, dir, base, 1, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cleared {
+		// Rules from this directory take precedence over those inherited.
+		for _, inherited := range parent {
+			if !inherited.noInherit {
+				rules = append(rules, inherited)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// inTree returns the path of dir relative to Tree.Dir, or false if dir is not
+// within the source tree.
+func (s *Set) inTree(dir string) (string, bool) {
+	prefix := s.tree.Prefix
+	switch {
+	case prefix == "":
+		return dir, true
+	case dir == prefix:
+		return "", true
+	case strings.HasPrefix(dir, prefix+"/"):
+		return dir[len(prefix)+1:], true
+	}
+	return "", false
+}
+
+// scope returns the per-directory rules in effect within dir, a path relative
+// to the top of the transfer.
+func (s *Set) scope(dir string) (*scope, error) {
+	if out, ok := s.scopes[dir]; ok {
+		return out, nil
+	}
+
+	rel, ok := s.inTree(dir)
+	if !ok {
+		return s.top, nil
+	}
+
+	parent := s.top
+	if dir != s.tree.Prefix {
+		parentDir := path.Dir(dir)
+		if parentDir == "." {
+			parentDir = ""
+		}
+
+		var err error
+		if parent, err = s.scope(parentDir); err != nil {
+			return nil, err
+		}
+	}
+
+	out := &scope{rules: map[*Rule][]*Rule{}}
+	for _, rule := range s.rules {
+		if rule.Action != DirMerge {
+			continue
+		}
+
+		rules, err := s.readDir(rule, filepath.Join(s.tree.Dir, rel), dir, parent.rules[rule])
+		if err != nil {
+			return nil, err
+		}
+		out.rules[rule] = rules
+	}
+
+	s.scopes[dir] = out
+	return out, nil
+}
+
+// Match returns the first rule matching a path relative to the top of the
+// transfer, or nil if no rule matches.
+func (s *Set) Match(name string, isDir bool) (*Rule, error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		// The top of the transfer is never filtered.
+		return nil, nil
+	}
+
+	var sc *scope
+	if s.perDir {
+		dir := path.Dir(name)
+		if dir == "." {
+			dir = ""
+		}
+
+		var err error
+		if sc, err = s.scope(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rule := range s.rules {
+		if rule.Action != DirMerge {
+			if rule.matches(name, isDir, s.tree.AbsRoot) {
+				return rule, nil
+			}
+			continue
+		}
+
+		for _, merged := range sc.rules[rule] {
+			if merged.appliesTo(s.tree.Side) && merged.matches(name, isDir, s.tree.AbsRoot) {
+				return merged, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Excluded returns true if a path relative to the top of the transfer is
+// excluded by the rules, along with the rule which matched, if any.
+//
+// Only the path itself is considered; paths within excluded directories must
+// be handled by the caller.
+func (s *Set) Excluded(name string, isDir bool) (bool, *Rule, error) {
+	rule, err := s.Match(name, isDir)
+	if err != nil || rule == nil {
+		return false, nil, err
+	}
+	return rule.Excludes(), rule, nil
+}
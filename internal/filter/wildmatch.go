@@ -0,0 +1,206 @@
+package filter
+
+import "strings"
+
+// Results of wildmatch, as in rsync's lib/wildmatch.c. The abort results allow
+// matching to stop early when no later attempt could succeed.
+const (
+	wmNoMatch = iota
+	wmMatch
+	wmAbortAll
+	wmAbortToStarStar
+)
+
+// wildmatch reports whether text matches the shell-style pattern p, using the
+// same rules as rsync:
+//
+//   - "*" matches anything except a slash
+//   - "**" matches anything, including slashes
+//   - "?" matches any single character except a slash
+//   - "[...]" matches a character class, which never matches a slash
+//   - "\" escapes the following character
+func wildmatch(p string, text string) bool {
+	return dowild(p, text) == wmMatch
+}
+
+func dowild(p string, text string) int {
+	for ; len(p) > 0; p, text = p[1:], text[1:] {
+		pc := p[0]
+		if len(text) == 0 && pc != '*' {
+			return wmAbortAll
+		}
+
+		switch pc {
+		case '\\':
+			// Literal match with the following character.
+			p = p[1:]
+			if len(p) == 0 || text[0] != p[0] {
+				return wmNoMatch
+			}
+
+		case '?':
+			if text[0] == '/' {
+				return wmNoMatch
+			}
+
+		case '*':
+			special := false
+			if len(p) > 1 && p[1] == '*' {
+				for len(p) > 1 && p[1] == '*' {
+					p = p[1:]
+				}
+				special = true
+			}
+			p = p[1:]
+
+			if len(p) == 0 {
+				// Trailing "**" matches everything; trailing "*" matches only
+				// if there are no more slashes.
+				if !special && strings.Contains(text, "/") {
+					return wmNoMatch
+				}
+				return wmMatch
+			}
+
+			for ; len(text) > 0; text = text[1:] {
+				matched := dowild(p, text)
+				if matched != wmNoMatch {
+					if !special || matched != wmAbortToStarStar {
+						return matched
+					}
+				} else if !special && text[0] == '/' {
+					return wmAbortToStarStar
+				}
+			}
+			return wmAbortAll
+
+		case '[':
+			var ok bool
+			if p, ok = matchClass(p, text[0]); !ok {
+				if p == "" {
+					return wmAbortAll
+				}
+				return wmNoMatch
+			}
+
+		default:
+			if text[0] != pc {
+				return wmNoMatch
+			}
+		}
+	}
+
+	if len(text) > 0 {
+		return wmNoMatch
+	}
+	return wmMatch
+}
+
+// matchClass matches character c against the class at the start of p. It
+// returns p advanced to the closing "]" and whether c matched. If the class is
+// malformed, the returned p is empty.
+func matchClass(p string, c byte) (string, bool) {
+	// Skip the opening "[".
+	i := 1
+	at := func(i int) byte {
+		if i < len(p) {
+			return p[i]
+		}
+		return 0
+	}
+
+	negated := false
+	if at(i) == '!' || at(i) == '^' {
+		negated = true
+		i++
+	}
+
+	matched := false
+	var prev byte
+	for first := true; first || at(i) != ']'; first = false {
+		pc := at(i)
+		switch {
+		case pc == 0:
+			return "", false
+
+		case pc == '\\':
+			i++
+			pc = at(i)
+			if pc == 0 {
+				return "", false
+			}
+			if c == pc {
+				matched = true
+			}
+
+		case pc == '-' && prev != 0 && at(i+1) != 0 && at(i+1) != ']':
+			i++
+			pc = at(i)
+			if pc == '\\' {
+				i++
+				pc = at(i)
+				if pc == 0 {
+					return "", false
+				}
+			}
+			if c >= prev && c <= pc {
+				matched = true
+			}
+			pc = 0
+
+		case pc == '[' && at(i+1) == ':':
+			end := strings.IndexByte(p[i+2:], ']')
+			if end < 0 {
+				return "", false
+			}
+			name := p[i+2 : i+2+end]
+			if !strings.HasSuffix(name, ":") {
+				// Not a [:class:], so treat "[" as a normal character.
+				if c == '[' {
+					matched = true
+				}
+				break
+			}
+			class, ok := charClasses[strings.TrimSuffix(name, ":")]
+			if !ok {
+				return "", false
+			}
+			if class(c) {
+				matched = true
+			}
+			i += 2 + end
+			pc = 0
+
+		case c == pc:
+			matched = true
+		}
+
+		prev = pc
+		i++
+	}
+
+	return p[i:], matched != negated && c != '/'
+}
+
+var charClasses = map[string]func(byte) bool{
+	"alnum":  func(c byte) bool { return isAlpha(c) || isDigit(c) },
+	"alpha":  isAlpha,
+	"blank":  func(c byte) bool { return c == ' ' || c == '\t' },
+	"cntrl":  func(c byte) bool { return c < 0x20 || c == 0x7f },
+	"digit":  isDigit,
+	"graph":  func(c byte) bool { return c > 0x20 && c < 0x7f },
+	"lower":  func(c byte) bool { return c >= 'a' && c <= 'z' },
+	"print":  func(c byte) bool { return c >= 0x20 && c < 0x7f },
+	"punct":  func(c byte) bool { return c > 0x20 && c < 0x7f && !isAlpha(c) && !isDigit(c) },
+	"space":  func(c byte) bool { return c == ' ' || (c >= '\t' && c <= '\r') },
+	"upper":  func(c byte) bool { return c >= 'A' && c <= 'Z' },
+	"xdigit": func(c byte) bool { return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') },
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
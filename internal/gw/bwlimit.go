@@ -0,0 +1,142 @@
+package gw
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Maximum bytes sent at once by a rate-limited upload. This is also the
+// capacity of the token bucket, so it bounds how far uploads may burst above
+// the limit.
+const bwLimitChunk = 32 * 1024
+
+// rateLimiter is a token bucket limiting the rate at which bytes are sent.
+//
+// A single rateLimiter is shared by every upload of a client, including each
+// part of multipart uploads, so the limit applies to the client as a whole.
+type rateLimiter struct {
+	rate float64 // bytes per second
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter allowing bytesPerSec, or nil if
+// bytesPerSec is 0 (unlimited).
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:   float64(bytesPerSec),
+		tokens: bwLimitChunk,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n tokens from the bucket, returning how long the caller must
+// wait before sending n bytes.
+//
+// The bucket may go into debt, which later callers wait to repay; this keeps
+// the overall rate correct while letting callers take turns fairly.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, bwLimitChunk)
+	l.last = now
+	l.tokens -= float64(n)
+
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait blocks until n bytes may be sent, or until ctx is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedBody limits the rate at which a request body is read, and therefore
+// sent.
+type limitedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if len(p) > bwLimitChunk {
+		p = p[:bwLimitChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := b.limiter.wait(b.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// limitedHTTPClient sends request bodies no faster than allowed by limiter.
+//
+// The limit is applied as requests are sent, rather than to the body passed
+// into the SDK, since the SDK may read the body more than once; for example,
+// to calculate a checksum or to retry.
+type limitedHTTPClient struct {
+	client  s3.HTTPClient
+	limiter *rateLimiter
+}
+
+func (c limitedHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &limitedBody{req.Body, req.Context(), c.limiter}
+
+		// The body may also be sent again, e.g. when following a redirect
+		// or retrying on a new connection, which must be limited too.
+		if getBody := req.GetBody; getBody != nil {
+			ctx := req.Context()
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil || body == http.NoBody {
+					return body, err
+				}
+				return &limitedBody{body, ctx, c.limiter}, nil
+			}
+		}
+	}
+	return c.client.Do(req)
+}
+
+// withBwLimit returns S3 client options limiting the bandwidth used by requests,
+// or nothing if there's no limit.
+func withBwLimit(limiter *rateLimiter, optFns []func(*s3.Options)) []func(*s3.Options) {
+	if limiter == nil {
+		return optFns
+	}
+	return append(optFns, func(o *s3.Options) {
+		o.HTTPClient = limitedHTTPClient{o.HTTPClient, limiter}
+	})
+}
@@ -0,0 +1,142 @@
+package gw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+func TestNewRateLimiterUnlimited(t *testing.T) {
+	if l := newRateLimiter(0); l != nil {
+		t.Errorf("unexpected limiter for no limit: %v", l)
+	}
+
+	if opts := withBwLimit(nil, nil); len(opts) != 0 {
+		t.Errorf("unexpected options with no limit: %v", opts)
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := newRateLimiter(1024 * 1024)
+
+	// The bucket starts full, so the first chunk is sent immediately.
+	if delay := l.reserve(bwLimitChunk); delay != 0 {
+		t.Errorf("unexpected delay for first chunk: %v", delay)
+	}
+
+	// After that, bytes are sent at the configured rate.
+	delay := l.reserve(512 * 1024)
+	if delay < 450*time.Millisecond || delay > 550*time.Millisecond {
+		t.Errorf("unexpected delay: %v", delay)
+	}
+
+	// Later callers also wait for earlier reservations.
+	delay = l.reserve(512 * 1024)
+	if delay < 950*time.Millisecond || delay > 1050*time.Millisecond {
+		t.Errorf("unexpected delay: %v", delay)
+	}
+}
+
+func TestRateLimiterCancelled(t *testing.T) {
+	l := newRateLimiter(1024)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	body := &limitedBody{io.NopCloser(bytes.NewReader(make([]byte, 2*bwLimitChunk))), ctx, l}
+	_, err := io.ReadAll(body)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// An s3.HTTPClient which only records the request.
+type recordingHTTPClient struct {
+	req *http.Request
+}
+
+func (c *recordingHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.req = req
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestLimitedHTTPClientGetBody(t *testing.T) {
+	l := newRateLimiter(1024)
+	recorder := &recordingHTTPClient{}
+	client := limitedHTTPClient{recorder, l}
+
+	req, err := http.NewRequest(http.MethodPut, "https://example.com/", bytes.NewReader([]byte("content")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// The body is limited both when first sent and when sent again.
+	if _, ok := recorder.req.Body.(*limitedBody); !ok {
+		t.Errorf("body is not limited: %T", recorder.req.Body)
+	}
+	body, err := recorder.req.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body.(*limitedBody); !ok {
+		t.Errorf("replayed body is not limited: %T", body)
+	}
+	if content, _ := io.ReadAll(body); string(content) != "content" {
+		t.Errorf("unexpected replayed body: %q", content)
+	}
+
+	// The original request is left alone.
+	body, _ = req.GetBody()
+	if _, ok := body.(*limitedBody); ok {
+		t.Error("original request was modified")
+	}
+}
+
+func TestClientUploadBwLimit(t *testing.T) {
+	srv := newFakeS3HTTPServer(t, fakeS3ServerConfig{})
+	defer srv.Close()
+
+	client, _ := newClientWithFakeS3(t)
+	client.limiter = newRateLimiter(20 * 1024 * 1024)
+	attachClientToFakeS3(t, client, srv)
+
+	// A multipart upload plus a single part upload, all sharing the limit.
+	dir := t.TempDir()
+	sizes := map[string]int{"large": 2 * s3UploadPartSize, "small": s3UploadPartSize / 2}
+	var items []walk.SyncItem
+	for name, size := range sizes {
+		src := filepath.Join(dir, name)
+		if err := os.WriteFile(src, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, walk.SyncItem{SrcPath: src, Key: name + "-key"})
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	start := time.Now()
+	err := client.EnsureUploaded(ctx, items, ignore, ignore, ignore)
+	if err != nil {
+		t.Fatalf("got unexpected error %v", err)
+	}
+	elapsed := time.Since(start)
+
+	// 12.5MiB at 20MiB/s should take around 0.6s, if the limit is shared.
+	if elapsed < 550*time.Millisecond {
+		t.Errorf("upload was too fast: %v", elapsed)
+	}
+}
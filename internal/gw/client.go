@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PuerkitoBio/rehttp"
@@ -30,12 +33,42 @@ func logConnectionClose(ctx context.Context, url string) {
 	log.FromContext(ctx).F("url", url).Info("Closing connection")
 }
 
+// statusError is returned when exodus-gw responds to a request with
+// an unsuccessful HTTP status.
+type statusError struct {
+	message    string
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// isUnsupported returns true if err indicates that exodus-gw does not implement
+// the requested API, as may be the case for older versions of the service.
+func isUnsupported(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.statusCode {
+		case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			return true
+		}
+	}
+	return false
+}
+
 type client struct {
 	cfg        conf.Config
 	httpClient *http.Client
 	s3         *s3.Client
 	uploader   *transfermanager.Client
+	uploads    multipartUploads
+	limiter    *rateLimiter
 	dryRun     bool
+
+	// Whether exodus-gw supports checking the presence of blobs in bulk;
+	// one of the bulkPresence* constants.
+	bulkPresence atomic.Int32
 }
 
 func (c *client) doJSONRequest(ctx context.Context, method string, url string, body interface{}, target interface{}, headers map[string][]string) error {
@@ -77,15 +110,19 @@ func (c *client) doJSONRequest(ctx context.Context, method string, url string, b
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		out := &statusError{
+			message:    fmt.Sprintf("%s %s: %s", req.Method, req.URL, resp.Status),
+			statusCode: resp.StatusCode,
+		}
 		byteSlice, err := io.ReadAll(io.LimitReader(resp.Body, 2000))
 		if err != nil {
 			log.FromContext(ctx).F("error", err).Debugf(
 				"No body in response for '%s %s'", req.Method, req.URL,
 			)
 		} else if len(byteSlice) > 0 {
-			return fmt.Errorf("%s %s: %s, %s", req.Method, req.URL, resp.Status, byteSlice)
+			out.message = fmt.Sprintf("%s, %s", out.message, byteSlice)
 		}
-		return fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+		return out
 	}
 
 	dec := json.NewDecoder(resp.Body)
@@ -116,7 +153,7 @@ func (c *client) haveBlob(ctx context.Context, item walk.SyncItem) (bool, error)
 	})
 
 	if err == nil {
-		logger.F("key", item.Key).Info("Skipping upload, blob is present")
+		logger.F("key", item.Key).Debug("blob is present")
 		return true, nil
 	}
 
@@ -148,6 +185,11 @@ func (c *client) uploadBlob(ctx context.Context, item walk.SyncItem) error {
 	}
 	defer file.Close()
 
+	var body io.ReadSeeker = file
+	if fn := progressFromContext(ctx); fn != nil {
+		body = &progressReader{file, fn}
+	}
+
 	fullURL := c.cfg.GwURL() + "/upload/" + c.cfg.GwEnv() + "/" + item.Key
 	logConnectionOpen(ctx, fullURL)
 	defer logConnectionClose(ctx, fullURL)
@@ -155,7 +197,7 @@ func (c *client) uploadBlob(ctx context.Context, item walk.SyncItem) error {
 	res, err := c.uploader.UploadObject(ctx, &transfermanager.UploadObjectInput{
 		Bucket: aws.String(c.cfg.GwEnv()),
 		Key:    aws.String(item.Key),
-		Body:   file,
+		Body:   body,
 	})
 
 	if err != nil {
@@ -199,22 +241,6 @@ func (c *client) uploadWorker(
 			continue
 		}
 
-		// Determine if the blob is already present in the bucket
-		have, err := c.haveBlob(ctx, item)
-		if err != nil {
-			results <- uploadResult{
-				failed,
-				fmt.Errorf("checking for presence of %s: %w", item.Key, err),
-				item}
-			return
-		}
-
-		// If so, no need to upload it
-		if have {
-			results <- uploadResult{present, nil, item}
-			continue
-		}
-
 		if err := c.uploadBlob(ctx, item); err != nil {
 			results <- uploadResult{failed, err, item}
 			break
@@ -279,13 +305,42 @@ func (c *client) EnsureUploaded(
 	onPresent func(walk.SyncItem) error,
 	onDuplicate func(walk.SyncItem) error,
 ) error {
-	// Maintain a map of items processed thus far
-	processedItems := make(map[string]walk.SyncItem)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	itemCh := make(chan walk.SyncItem)
+	go func() {
+		defer close(itemCh)
+		for _, item := range items {
+			select {
+			case itemCh <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return c.EnsureUploadedStream(ctx, itemCh, onUploaded, onPresent, onDuplicate)
+}
+
+func (c *client) EnsureUploadedStream(
+	ctx context.Context,
+	items <-chan walk.SyncItem,
+	onUploaded func(walk.SyncItem) error,
+	onPresent func(walk.SyncItem) error,
+	onDuplicate func(walk.SyncItem) error,
+) error {
+	// Maintain a set of keys processed recently. A duplicate of a key which
+	// has since been forgotten is just checked for presence again.
+	processedKeys := newRecentKeys(maxRecentKeys)
 
 	numThreads := c.cfg.UploadThreads()
-	var wg sync.WaitGroup
-	results := make(chan uploadResult, len(items))
-	jobs := make(chan walk.SyncItem, len(items))
+	numPresenceThreads := c.cfg.PresenceThreads()
+	var wg, presenceWg sync.WaitGroup
+	results := make(chan uploadResult, numThreads)
+	jobs := make(chan walk.SyncItem, numThreads)
+	toCheck := make(chan walk.SyncItem, c.cfg.GwBatchSize())
+	batches := make(chan []walk.SyncItem, numPresenceThreads)
 
 	// Maintain a safe map of taken jobs to help reduce duplicate uploads.
 	//
@@ -297,6 +352,17 @@ func (c *client) EnsureUploaded(
 	// Make a child context so we can cancel all uploads at once if an error occurs
 	// in any of them.
 	uploadCtx, uploadCancel := context.WithCancel(ctx)
+	defer uploadCancel()
+
+	// These goroutines determine which items are already present, in batches
+	// collected from 'toCheck'. Items already present are written straight
+	// to 'results', while the rest are sent on to 'jobs' for upload.
+	stats := presenceStats{}
+	go c.batchPresenceChecks(uploadCtx, toCheck, batches)
+	for i := 0; i < numPresenceThreads; i++ {
+		presenceWg.Add(1)
+		go c.presenceWorker(uploadCtx, batches, jobs, results, &stats, &presenceWg)
+	}
 
 	// These goroutines are responsible for handling each item by reading
 	// from 'jobs' and writing a result per item to 'results'.
@@ -316,8 +382,21 @@ func (c *client) EnsureUploaded(
 		out, uploadCancel, results,
 		onUploaded, onPresent, onDuplicate)
 
-	// Now send all the items
-	for _, item := range items {
+	// Now send all the items, until there are no more or something has failed.
+dispatch:
+	for {
+		var item walk.SyncItem
+		var ok bool
+
+		select {
+		case <-uploadCtx.Done():
+			break dispatch
+		case item, ok = <-items:
+			if !ok {
+				break dispatch
+			}
+		}
+
 		if item.Key == "" && item.LinkTo != "" {
 			log.FromContext(ctx).F("uri", item.SrcPath).Debug("Skipping unfollowed symlink")
 			continue
@@ -325,7 +404,7 @@ func (c *client) EnsureUploaded(
 
 		// Determine if the item already exists in the final set of items to upload
 		// If so, ensure we put it on the queue only once
-		if _, ok := processedItems[item.Key]; ok {
+		if processedKeys.seen(item.Key) {
 			log.FromContext(ctx).F("uri", item.SrcPath).Debug("Skipping duplicate item")
 			// This can bypass 'jobs' completely and go straight to 'results' as we
 			// know there's nothing to be done.
@@ -333,22 +412,41 @@ func (c *client) EnsureUploaded(
 			continue
 		}
 
-		processedItems[item.Key] = item
-		jobs <- item
+		select {
+		case toCheck <- item:
+		case <-uploadCtx.Done():
+			break dispatch
+		}
 	}
 
+	// Let the presence checkers know there are no more items to process,
+	// then wait for them to complete.
+	close(toCheck)
+	presenceWg.Wait()
+	stats.log(ctx)
+
 	// Let the uploaders know there are no more items to process.
 	close(jobs)
 
 	// Wait for uploaders to complete.
 	wg.Wait()
 
+	// If anything failed or we were cancelled, uploads may have been left
+	// incomplete.
+	c.abortUploads(ctx)
+
 	// Let the results reader know there are no more results coming.
 	close(results)
 
 	// Block for the result reader to complete and return whatever
 	// error (or nil) it calculated.
-	return <-out
+	if err := <-out; err != nil {
+		return err
+	}
+
+	// If nothing failed, we may still have stopped early due to cancellation
+	// of the parent context.
+	return ctx.Err()
 }
 
 func retryWithLogging(logger *log.Logger, fn rehttp.RetryFn) rehttp.RetryFn {
@@ -423,6 +521,18 @@ func (impl) NewClient(ctx context.Context, cfg conf.Config) (Client, error) {
 		},
 	}
 
+	if path := cfg.GwCACert(); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("can't load CA cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("can't load CA cert: no certificates found in %s", path)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
 	// This client is passed into AWS SDK and it should not add any
 	// retry logic because the AWS SDK already does that:
 	s3HttpClient := &http.Client{Transport: &transport}
@@ -452,7 +562,8 @@ func (impl) NewClient(ctx context.Context, cfg conf.Config) (Client, error) {
 		o.BaseEndpoint = aws.String(cfg.GwURL() + "/upload")
 		o.UsePathStyle = true
 	})
-	out.uploader = newS3Uploader(out.s3)
+	out.limiter = newRateLimiter(cfg.UploadBwLimit())
+	out.uploader = newS3Uploader(out.s3, &out.uploads, out.limiter)
 
 	return out, nil
 }
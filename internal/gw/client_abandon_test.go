@@ -0,0 +1,84 @@
+package gw
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+func TestClientAbandonPublish(t *testing.T) {
+	cfg := testConfig(t)
+
+	clientIface, err := Package.NewClient(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create client, err = %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	gw := newFakeGw(t, clientIface.(*client))
+	gw.createPublishIds = append(gw.createPublishIds, "abc-123-456")
+
+	publish, err := clientIface.NewPublish(ctx)
+	if err != nil {
+		t.Fatalf("failed to create publish, err = %v", err)
+	}
+
+	if err := publish.Abandon(ctx); err != nil {
+		t.Errorf("unexpected error from abandon: %v", err)
+	}
+
+	if !gw.publishes["abc-123-456"].abandoned {
+		t.Error("publish was not abandoned")
+	}
+}
+
+func TestClientAbandonPublishUnsupported(t *testing.T) {
+	cfg := testConfig(t)
+
+	clientIface, err := Package.NewClient(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create client, err = %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	gw := newFakeGw(t, clientIface.(*client))
+	gw.createPublishIds = append(gw.createPublishIds, "abc-123-456")
+
+	publish, err := clientIface.NewPublish(ctx)
+	if err != nil {
+		t.Fatalf("failed to create publish, err = %v", err)
+	}
+
+	// If the publish is unknown to exodus-gw, we get a 404 as if the
+	// API were missing.
+	delete(gw.publishes, "abc-123-456")
+
+	err = publish.Abandon(ctx)
+	if !errors.Is(err, ErrAbandonUnsupported) || !strings.Contains(err.Error(), "404") {
+		t.Errorf("did not get expected error, err = %v", err)
+	}
+}
+
+func TestClientAbandonPublishMissingLink(t *testing.T) {
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	// Without an 'abandon' link, exodus-gw doesn't support abandoning the
+	// publish, so no request should be made.
+	publish := &publish{}
+	publish.raw.ID = "some-id"
+	publish.raw.Links = map[string]string{"self": "/env/publish/some-id"}
+
+	err := publish.Abandon(ctx)
+	if err != ErrAbandonUnsupported {
+		t.Errorf("did not get expected error, err = %v", err)
+	}
+}
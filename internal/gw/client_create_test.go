@@ -35,3 +35,48 @@ func TestNewClientOk(t *testing.T) {
 		t.Errorf("unexpectedly failed to make client, client = %v, err = %v", client, err)
 	}
 }
+
+func TestNewClientCACert(t *testing.T) {
+	tests := []struct {
+		name     string
+		caCert   string
+		errorMsg string
+	}{
+		{"valid", "../../test/data/ca.crt", ""},
+		{"missing", "ca-does-not-exist", "can't load CA cert: open ca-does-not-exist"},
+		{"invalid", "../../test/data/service-key.pem", "can't load CA cert: no certificates found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			cfg := conf.NewMockConfig(ctrl)
+
+			cfg.EXPECT().GwCert().Return("../../test/data/service.pem")
+			cfg.EXPECT().GwKey().Return("../../test/data/service-key.pem")
+			cfg.EXPECT().GwCACert().Return(tt.caCert)
+
+			if tt.errorMsg == "" {
+				// Remaining config is only needed if we get that far.
+				cfg.EXPECT().GwURL().AnyTimes().Return("https://exodus-gw.example.com")
+				cfg.EXPECT().GwMaxAttempts().AnyTimes().Return(3)
+				cfg.EXPECT().GwMaxBackoff().AnyTimes().Return(1)
+				cfg.EXPECT().LogLevel().AnyTimes().Return("info")
+				cfg.EXPECT().Verbosity().AnyTimes().Return(0)
+				cfg.EXPECT().UploadBwLimit().AnyTimes().Return(int64(0))
+			}
+
+			client, err := Package.NewClient(context.Background(), cfg)
+
+			if tt.errorMsg == "" {
+				if client == nil || err != nil {
+					t.Errorf("unexpectedly failed to make client, err = %v", err)
+				}
+				return
+			}
+			if !strings.Contains(fmt.Sprint(err), tt.errorMsg) {
+				t.Error("did not get expected error, err =", err)
+			}
+		})
+	}
+}
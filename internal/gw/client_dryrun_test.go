@@ -92,6 +92,11 @@ func TestDryRunPublish(t *testing.T) {
 			if err != nil {
 				t.Errorf("Commit failed in dry-run mode, err = %v", err)
 			}
+
+			err = p.Abandon(ctx)
+			if err != nil {
+				t.Errorf("Abandon failed in dry-run mode, err = %v", err)
+			}
 		})
 	}
 }
@@ -0,0 +1,240 @@
+package gw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// Returns a client using a fake S3 server created with the given config.
+func newClientWithFakeS3Config(t *testing.T, cfg fakeS3ServerConfig) (*client, *fakeS3HTTPServer) {
+	t.Helper()
+
+	c, _ := newClientWithFakeS3(t)
+	srv := newFakeS3HTTPServer(t, cfg)
+	t.Cleanup(srv.Close)
+	attachClientToFakeS3(t, c, srv)
+
+	return c, srv
+}
+
+// Runs EnsureUploaded over items, returning the keys which were uploaded
+// and present.
+func ensureUploadedKeys(t *testing.T, c *client, items []walk.SyncItem) (uploaded []string, present []string, err error) {
+	t.Helper()
+
+	ctx := log.NewContext(context.Background(), log.Package.NewLogger(args.Config{}))
+
+	err = c.EnsureUploaded(ctx, items, func(item walk.SyncItem) error {
+		uploaded = append(uploaded, item.Key)
+		return nil
+	}, func(item walk.SyncItem) error {
+		present = append(present, item.Key)
+		return nil
+	}, func(item walk.SyncItem) error {
+		return nil
+	})
+
+	sort.Strings(uploaded)
+	sort.Strings(present)
+	return
+}
+
+// Returns the number of requests made with the given method, to paths
+// with the given prefix.
+func countRequests(srv *fakeS3HTTPServer, method string, prefix string) int {
+	out := 0
+	for _, req := range srv.Requests() {
+		if req.Method == method && strings.HasPrefix(req.Path, prefix) {
+			out++
+		}
+	}
+	return out
+}
+
+// Returns sync items for each key, all uploading the same existing file.
+func presenceItems(keys ...string) []walk.SyncItem {
+	out := []walk.SyncItem{}
+	for _, key := range keys {
+		out = append(out, walk.SyncItem{SrcPath: "hello-copy-one", Key: key})
+	}
+	return out
+}
+
+func TestClientBulkPresence(t *testing.T) {
+	c, srv := newClientWithFakeS3Config(t, fakeS3ServerConfig{BulkPresence: true})
+
+	chdirInTest(t, "../../test/data/srctrees/just-files")
+
+	srv.Blobs()["key2"] = nil
+	srv.Blobs()["key4"] = nil
+
+	uploaded, present, err := ensureUploadedKeys(t, c,
+		presenceItems("key1", "key2", "key3", "key4", "key5", "key2"))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(uploaded) != "[key1 key3 key5]" {
+		t.Errorf("unexpected uploaded keys: %v", uploaded)
+	}
+	if fmt.Sprint(present) != "[key2 key4]" {
+		t.Errorf("unexpected present keys: %v", present)
+	}
+
+	// It should not have used any HEAD requests.
+	if heads := countRequests(srv, http.MethodHead, "/"); heads != 0 {
+		t.Errorf("made %d HEAD requests despite bulk presence API", heads)
+	}
+
+	// With a batch size of 3, the 5 unique keys need at least 2 requests.
+	posts := countRequests(srv, http.MethodPost, "/env/blobs/present")
+	if posts < 2 || posts > 5 {
+		t.Errorf("unexpected number of bulk presence requests: %d", posts)
+	}
+
+	if c.bulkPresence.Load() != bulkPresenceSupported {
+		t.Errorf("bulk presence not marked as supported")
+	}
+}
+
+func TestClientBulkPresenceFallback(t *testing.T) {
+	c, srv := newClientWithFakeS3Config(t, fakeS3ServerConfig{})
+
+	chdirInTest(t, "../../test/data/srctrees/just-files")
+
+	srv.Blobs()["key2"] = nil
+
+	uploaded, present, err := ensureUploadedKeys(t, c,
+		presenceItems("key1", "key2", "key3", "key4", "key5"))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(uploaded) != "[key1 key3 key4 key5]" {
+		t.Errorf("unexpected uploaded keys: %v", uploaded)
+	}
+	if fmt.Sprint(present) != "[key2]" {
+		t.Errorf("unexpected present keys: %v", present)
+	}
+
+	// Every key should have been checked via HEAD instead.
+	if heads := countRequests(srv, http.MethodHead, "/env/"); heads != 5 {
+		t.Errorf("unexpected number of HEAD requests: %d", heads)
+	}
+
+	if c.bulkPresence.Load() != bulkPresenceUnsupported {
+		t.Errorf("bulk presence not marked as unsupported")
+	}
+
+	// Now that the API is known to be missing, it should not be tried again.
+	srv.Reset()
+	if _, _, err := ensureUploadedKeys(t, c, presenceItems("key6")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if posts := countRequests(srv, http.MethodPost, "/env/blobs/present"); posts != 0 {
+		t.Errorf("bulk presence API retried after it was found missing")
+	}
+}
+
+func TestClientBulkPresenceError(t *testing.T) {
+	c, srv := newClientWithFakeS3Config(t, fakeS3ServerConfig{
+		BulkPresence:       true,
+		BulkPresenceStatus: http.StatusForbidden,
+	})
+
+	chdirInTest(t, "../../test/data/srctrees/just-files")
+
+	_, _, err := ensureUploadedKeys(t, c, presenceItems("key1", "key2"))
+
+	// Errors other than a missing API should not be hidden by falling back.
+	if err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("did not get expected error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "checking for presence of") {
+		t.Errorf("error is missing context: %v", err)
+	}
+	if heads := countRequests(srv, http.MethodHead, "/"); heads != 0 {
+		t.Errorf("unexpectedly fell back to HEAD requests")
+	}
+}
+
+func TestClientHeadPresenceError(t *testing.T) {
+	c, srv := newClientWithFakeS3Config(t, fakeS3ServerConfig{})
+
+	chdirInTest(t, "../../test/data/srctrees/just-files")
+
+	srv.Blobs()["key1"] = []error{errors.New("simulated error")}
+
+	_, _, err := ensureUploadedKeys(t, c, presenceItems("key1"))
+
+	if err == nil || !strings.Contains(err.Error(), "checking for presence of key1") {
+		t.Errorf("did not get expected error, got: %v", err)
+	}
+
+	// Nothing should be uploaded if presence can't be determined.
+	if puts := countRequests(srv, http.MethodPut, "/env/"); puts != 0 {
+		t.Errorf("unexpectedly made %d PUT requests", puts)
+	}
+}
+
+func TestBatchPresenceChecks(t *testing.T) {
+	c, _ := newClientWithFakeS3(t)
+
+	items := make(chan walk.SyncItem, 10)
+	for i := 0; i < 7; i++ {
+		items <- walk.SyncItem{Key: fmt.Sprint(i)}
+	}
+	close(items)
+
+	batches := make(chan []walk.SyncItem)
+	go c.batchPresenceChecks(context.Background(), items, batches)
+
+	// Exact batch sizes depend on timing, but every item should be
+	// included exactly once and no batch should exceed the batch size,
+	// which is 3 in test config.
+	total := 0
+	for batch := range batches {
+		if len(batch) < 1 || len(batch) > 3 {
+			t.Errorf("unexpected batch size: %v", batch)
+		}
+		for _, item := range batch {
+			if item.Key != fmt.Sprint(total) {
+				t.Errorf("unexpected item %v, expected key %d", item, total)
+			}
+			total++
+		}
+	}
+
+	if total != 7 {
+		t.Errorf("batched %d items, expected 7", total)
+	}
+}
+
+func TestIsUnsupported(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&statusError{"not found", 404}, true},
+		{&statusError{"method not allowed", 405}, true},
+		{&statusError{"not implemented", 501}, true},
+		{fmt.Errorf("wrapped: %w", &statusError{"not found", 404}), true},
+		{&statusError{"server error", 500}, false},
+		{fmt.Errorf("some other error"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isUnsupported(tt.err); got != tt.want {
+			t.Errorf("isUnsupported(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
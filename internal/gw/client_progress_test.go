@@ -0,0 +1,76 @@
+package gw
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+func ignore(walk.SyncItem) error {
+	return nil
+}
+
+func TestClientUploadProgress(t *testing.T) {
+	client, _ := newClientWithFakeS3(t)
+
+	chdirInTest(t, "../../test/data/srctrees/just-files")
+
+	var bytes atomic.Int64
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+	ctx = WithProgress(ctx, func(n int64) { bytes.Add(n) })
+
+	items := []walk.SyncItem{
+		{SrcPath: "hello-copy-one", Key: "abc123"},
+		{SrcPath: "hello-copy-two", Key: "abc123"},
+		{SrcPath: "subdir/some-binary", Key: "aabbcc"},
+	}
+
+	err := client.EnsureUploaded(ctx, items, ignore, ignore, ignore)
+	if err != nil {
+		t.Fatalf("got unexpected error %v", err)
+	}
+
+	// Only one of the duplicates is uploaded, so its bytes are counted once.
+	if got := bytes.Load(); got != 206 {
+		t.Errorf("unexpected bytes counted: %d", got)
+	}
+}
+
+func TestClientUploadProgressMultipart(t *testing.T) {
+	srv := newFakeS3HTTPServer(t, fakeS3ServerConfig{})
+	defer srv.Close()
+
+	client, _ := newClientWithFakeS3(t)
+	attachClientToFakeS3(t, client, srv)
+
+	size := 2*s3UploadPartSize + 1
+	src := filepath.Join(t.TempDir(), "large")
+	if err := os.WriteFile(src, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var bytes atomic.Int64
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+	ctx = WithProgress(ctx, func(n int64) { bytes.Add(n) })
+
+	err := client.EnsureUploaded(ctx, []walk.SyncItem{{SrcPath: src, Key: "large-key"}}, ignore, ignore, ignore)
+	if err != nil {
+		t.Fatalf("got unexpected error %v", err)
+	}
+
+	// Determining the size of the body and splitting it into parts
+	// shouldn't cause anything to be counted twice.
+	if got := bytes.Load(); got != int64(size) {
+		t.Errorf("unexpected bytes counted: %d, want %d", got, size)
+	}
+}
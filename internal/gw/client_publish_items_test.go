@@ -0,0 +1,63 @@
+package gw
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+func TestClientPublishListItems(t *testing.T) {
+	cfg := testConfig(t)
+
+	clientIface, err := Package.NewClient(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	gw := newFakeGw(t, clientIface.(*client))
+	gw.publishes["some-id"] = &fakePublish{id: "some-id", items: []ItemInput{
+		{WebURI: "/dest/a", ObjectKey: "key-a"},
+		{WebURI: "/dest/b", ObjectKey: "key-b", ContentType: "text/plain"},
+		{WebURI: "/dest/link", LinkTo: "/dest/a"},
+	}}
+
+	ctx := log.NewContext(context.Background(), log.Package.NewLogger(args.Config{}))
+
+	p, err := clientIface.GetPublish(ctx, "some-id")
+	if err != nil {
+		t.Fatalf("failed to get publish: %v", err)
+	}
+
+	// State should be as returned by exodus-gw.
+	if p.State() != "PENDING" {
+		t.Errorf("unexpected state %q", p.State())
+	}
+
+	var listed []ItemInput
+	err = p.ListItems(ctx, func(item ItemInput) error {
+		listed = append(listed, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// It should have listed every item.
+	if !reflect.DeepEqual(listed, gw.publishes["some-id"].items) {
+		t.Errorf("unexpected listed items: %v", listed)
+	}
+
+	// Errors from the callback should stop the listing.
+	calls := 0
+	err = p.ListItems(ctx, func(item ItemInput) error {
+		calls++
+		return fmt.Errorf("simulated error")
+	})
+	if err == nil || err.Error() != "simulated error" || calls != 1 {
+		t.Errorf("unexpected result: err %v, calls %d", err, calls)
+	}
+}
@@ -2,6 +2,7 @@ package gw
 
 import (
 	"context"
+	"errors"
 	"reflect"
 	"testing"
 
@@ -64,6 +65,12 @@ func TestClientPublish(t *testing.T) {
 		t.Errorf("got unexpected error = %v", err)
 	}
 
+	// And the error should tell us the final state of the task.
+	taskErr := &TaskError{}
+	if !errors.As(err, &taskErr) || taskErr.State != "FAILED" {
+		t.Errorf("got unexpected error type %T", err)
+	}
+
 	// While if it transitions to COMPLETE...
 	gw.publishes[publish.ID()].taskStates = []string{"NOT_STARTED", "IN_PROGRESS", "COMPLETE"}
 
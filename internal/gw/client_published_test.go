@@ -0,0 +1,93 @@
+package gw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+func TestClientListPublished(t *testing.T) {
+	cfg := testConfig(t)
+
+	clientIface, err := Package.NewClient(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	gw := newFakeGw(t, clientIface.(*client))
+	gw.published = []ItemInput{
+		{WebURI: "/dest/a", ObjectKey: "key-a"},
+		{WebURI: "/other/b", ObjectKey: "key-b"},
+		{WebURI: "/dest/sub/c", ObjectKey: "key-c"},
+		{WebURI: "/dest/link", LinkTo: "/dest/a"},
+		{WebURI: "/dest/sub/d", ObjectKey: "key-d"},
+	}
+
+	ctx := log.NewContext(context.Background(), log.Package.NewLogger(args.Config{}))
+
+	var listed []ItemInput
+	err = clientIface.ListPublished(ctx, "/dest", func(item ItemInput) error {
+		listed = append(listed, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// It should have followed every page, returning only items under the prefix.
+	expected := []ItemInput{gw.published[0], gw.published[2], gw.published[3], gw.published[4]}
+	if !reflect.DeepEqual(listed, expected) {
+		t.Errorf("unexpected listed items: %v", listed)
+	}
+}
+
+func TestClientListPublishedCallbackError(t *testing.T) {
+	cfg := testConfig(t)
+
+	clientIface, _ := Package.NewClient(context.Background(), cfg)
+	gw := newFakeGw(t, clientIface.(*client))
+	gw.published = []ItemInput{{WebURI: "/dest/a"}, {WebURI: "/dest/b"}, {WebURI: "/dest/c"}}
+
+	ctx := log.NewContext(context.Background(), log.Package.NewLogger(args.Config{}))
+
+	calls := 0
+	err := clientIface.ListPublished(ctx, "/dest", func(item ItemInput) error {
+		calls++
+		return fmt.Errorf("simulated error")
+	})
+
+	if err == nil || err.Error() != "simulated error" || calls != 1 {
+		t.Errorf("unexpected result: err %v, calls %d", err, calls)
+	}
+}
+
+func TestClientListPublishedUnsupported(t *testing.T) {
+	cfg := testConfig(t)
+
+	clientIface, _ := Package.NewClient(context.Background(), cfg)
+	gw := newFakeGw(t, clientIface.(*client))
+	gw.nextHTTPResponse = &http.Response{
+		Status:     "404 Not Found",
+		StatusCode: 404,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}
+
+	ctx := log.NewContext(context.Background(), log.Package.NewLogger(args.Config{}))
+
+	err := clientIface.ListPublished(ctx, "/dest", func(item ItemInput) error {
+		t.Error("callback unexpectedly invoked")
+		return nil
+	})
+
+	if !errors.Is(err, ErrListUnsupported) || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("did not get expected error, got: %v", err)
+	}
+}
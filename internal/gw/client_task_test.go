@@ -0,0 +1,135 @@
+package gw
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+// A config with a short task timeout, polling slowly enough that the
+// timeout is reached before the fake runs out of task states.
+type taskTimeoutConfig struct {
+	conf.Config
+}
+
+func (taskTimeoutConfig) GwTaskTimeout() int {
+	return 1
+}
+
+func (taskTimeoutConfig) GwPollInterval() int {
+	return 100
+}
+
+func TestClientStartCommit(t *testing.T) {
+	cfg := testConfig(t)
+
+	clientIface, err := Package.NewClient(context.Background(), cfg)
+	if clientIface == nil {
+		t.Fatalf("failed to create client, err = %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	gw := newFakeGw(t, clientIface.(*client))
+	gw.createPublishIds = append(gw.createPublishIds, "abc-123-456")
+
+	publish, err := clientIface.NewPublish(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create publish, err = %v", err)
+	}
+
+	// Starting the commit should return the task without awaiting it.
+	task, err := publish.StartCommit(ctx, "phase1")
+	if err != nil {
+		t.Fatalf("unexpected error from StartCommit: %v", err)
+	}
+	if task.ID() != "task-abc-123-456" {
+		t.Errorf("got unexpected task id %s", task.ID())
+	}
+	if gw.publishes["abc-123-456"].lastCommit != "phase1" {
+		t.Errorf("commit mode was not passed")
+	}
+	if len(gw.publishes["abc-123-456"].taskStates) != 2 {
+		t.Errorf("task was unexpectedly polled")
+	}
+
+	// A separate handle to the task can be obtained by ID and awaited.
+	task, err = clientIface.GetTask(ctx, "task-abc-123-456")
+	if err != nil {
+		t.Fatalf("unexpected error from GetTask: %v", err)
+	}
+	if task.ID() != "task-abc-123-456" {
+		t.Errorf("got unexpected task id %s", task.ID())
+	}
+
+	err = task.Await(ctx)
+	if err != nil {
+		t.Errorf("unexpected error from Await: %v", err)
+	}
+}
+
+func TestClientGetTaskErrors(t *testing.T) {
+	cfg := testConfig(t)
+
+	clientIface, err := Package.NewClient(context.Background(), cfg)
+	if clientIface == nil {
+		t.Fatalf("failed to create client, err = %v", err)
+	}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	newFakeGw(t, clientIface.(*client))
+
+	task, err := clientIface.GetTask(ctx, "not-a-task")
+	if task != nil {
+		t.Errorf("unexpectedly got a task: %v", task)
+	}
+	if !strings.Contains(err.Error(), "getting task not-a-task: ") {
+		t.Errorf("Did not get expected error, got: %v", err)
+	}
+}
+
+func TestClientTaskTimeout(t *testing.T) {
+	clientIface, err := Package.NewClient(context.Background(), testConfig(t))
+	if clientIface == nil {
+		t.Fatalf("failed to create client, err = %v", err)
+	}
+	clientIface.(*client).cfg = taskTimeoutConfig{clientIface.(*client).cfg}
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	gw := newFakeGw(t, clientIface.(*client))
+	gw.publishes["abc"] = &fakePublish{id: "abc"}
+	for i := 0; i < 100; i++ {
+		gw.publishes["abc"].taskStates = append(gw.publishes["abc"].taskStates, "IN_PROGRESS")
+	}
+
+	task, err := clientIface.GetTask(ctx, "task-abc")
+	if err != nil {
+		t.Fatalf("unexpected error from GetTask: %v", err)
+	}
+
+	start := time.Now()
+	err = task.Await(ctx)
+	elapsed := time.Since(start)
+
+	timeoutErr := &TaskTimeoutError{}
+	if !errors.As(err, &timeoutErr) || timeoutErr.State != "IN_PROGRESS" {
+		t.Errorf("got unexpected error %v", err)
+	}
+	if err.Error() != "timed out awaiting publish task task-abc in state IN_PROGRESS" {
+		t.Errorf("got unexpected error message %v", err)
+	}
+	if elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("unexpected time to time out: %v", elapsed)
+	}
+}
@@ -0,0 +1,74 @@
+package gw
+
+import (
+	"context"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+func TestClientUploadStream(t *testing.T) {
+	client, srv := newClientWithFakeS3(t)
+
+	chdirInTest(t, "../../test/data/srctrees/just-files")
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+
+	items := make(chan walk.SyncItem)
+	uploaded := make(chan walk.SyncItem, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.EnsureUploadedStream(ctx, items, func(item walk.SyncItem) error {
+			uploaded <- item
+			return nil
+		}, nil, nil)
+	}()
+
+	// An item should be uploaded as soon as it is sent, before the
+	// channel is closed.
+	items <- walk.SyncItem{SrcPath: "hello-copy-one", Key: "abc123"}
+	if got := <-uploaded; got.Key != "abc123" {
+		t.Errorf("unexpected uploaded item %v", got)
+	}
+
+	items <- walk.SyncItem{SrcPath: "subdir/some-binary", Key: "aabbcc"}
+	if got := <-uploaded; got.Key != "aabbcc" {
+		t.Errorf("unexpected uploaded item %v", got)
+	}
+
+	close(items)
+
+	if err := <-done; err != nil {
+		t.Errorf("got unexpected error %v", err)
+	}
+
+	if _, ok := srv.Blobs()["abc123"]; !ok {
+		t.Error("blob abc123 was not uploaded")
+	}
+}
+
+func TestClientUploadStreamCancelled(t *testing.T) {
+	client, _ := newClientWithFakeS3(t)
+
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Channel is never closed, so the call can only return due to cancellation.
+	items := make(chan walk.SyncItem)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.EnsureUploadedStream(ctx, items, nil, nil, nil)
+	}()
+
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got unexpected error %v", err)
+	}
+}
@@ -8,6 +8,8 @@ import (
 
 type dryRunPublish struct{}
 
+type dryRunTask struct{}
+
 func (i impl) NewDryRunClient(ctx context.Context, cfg conf.Config) (Client, error) {
 	clientIface, err := i.NewClient(ctx, cfg)
 	if err != nil {
@@ -22,6 +24,14 @@ func (*dryRunPublish) ID() string {
 	return "abcd1234"
 }
 
+func (*dryRunPublish) State() string {
+	return "PENDING"
+}
+
+func (*dryRunPublish) ListItems(ctx context.Context, _ func(ItemInput) error) error {
+	return ctx.Err()
+}
+
 func (*dryRunPublish) AddItems(ctx context.Context, _ []ItemInput) error {
 	return ctx.Err()
 }
@@ -29,3 +39,19 @@ func (*dryRunPublish) AddItems(ctx context.Context, _ []ItemInput) error {
 func (*dryRunPublish) Commit(ctx context.Context, _ string) error {
 	return ctx.Err()
 }
+
+func (*dryRunPublish) StartCommit(ctx context.Context, _ string) (Task, error) {
+	return &dryRunTask{}, ctx.Err()
+}
+
+func (*dryRunPublish) Abandon(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (*dryRunTask) ID() string {
+	return "abcd1234"
+}
+
+func (*dryRunTask) Await(ctx context.Context) error {
+	return ctx.Err()
+}
@@ -3,6 +3,7 @@ package gw
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -52,6 +53,15 @@ type fakeS3ServerConfig struct {
 	// MPUFailComplete makes CompleteMultipartUpload return an S3 InternalError
 	// without committing the object (the MPU session remains until abort).
 	MPUFailComplete bool
+	// MPUUploadPartHook, if set, is invoked on each UploadPart, which then
+	// fails as with MPUFailUploadParts.
+	MPUUploadPartHook func()
+	// BulkPresence enables the exodus-gw bulk presence API; if unset, it
+	// responds with 404 as older versions of exodus-gw would.
+	BulkPresence bool
+	// BulkPresenceStatus, if set, is the HTTP status returned from every
+	// request to the bulk presence API.
+	BulkPresenceStatus int
 }
 
 type fakeS3HTTPServer struct {
@@ -66,6 +76,9 @@ type fakeS3HTTPServer struct {
 
 	mpuFailUploadParts bool
 	mpuFailComplete    bool
+	mpuUploadPartHook  func()
+	bulkPresence       bool
+	bulkPresenceStatus int
 }
 
 func (s *fakeS3HTTPServer) Client() *http.Client {
@@ -105,6 +118,9 @@ func newFakeS3HTTPServer(t *testing.T, cfg fakeS3ServerConfig) *fakeS3HTTPServer
 		mpus:               make(map[string]*fakeMPUSession),
 		mpuFailUploadParts: cfg.MPUFailUploadParts,
 		mpuFailComplete:    cfg.MPUFailComplete,
+		mpuUploadPartHook:  cfg.MPUUploadPartHook,
+		bulkPresence:       cfg.BulkPresence,
+		bulkPresenceStatus: cfg.BulkPresenceStatus,
 	}
 
 	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -118,6 +134,11 @@ func newFakeS3HTTPServer(t *testing.T, cfg fakeS3ServerConfig) *fakeS3HTTPServer
 			Header:   r.Header.Clone(),
 		})
 
+		if r.URL.Path == "/env/blobs/present" && r.Method == http.MethodPost {
+			handleFakeBulkPresence(w, r, fake)
+			return
+		}
+
 		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
 		if len(parts) < 2 {
 			http.Error(w, "bad path", http.StatusBadRequest)
@@ -186,6 +207,36 @@ func handleFakeS3Head(w http.ResponseWriter, key string, blobs blobMap) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// Handles the exodus-gw bulk presence API. A blob is present if a HEAD
+// request for it would currently succeed.
+func handleFakeBulkPresence(w http.ResponseWriter, r *http.Request, fake *fakeS3HTTPServer) {
+	if !fake.bulkPresence {
+		http.Error(w, `{"detail":"Not Found"}`, http.StatusNotFound)
+		return
+	}
+	if fake.bulkPresenceStatus != 0 {
+		http.Error(w, "simulated error", fake.bulkPresenceStatus)
+		return
+	}
+
+	query := presenceQuery{}
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := presenceResponse{Present: []string{}}
+	for _, key := range query.ObjectKeys {
+		errors, haveBlob := fake.blobs[key]
+		if haveBlob && (len(errors) == 0 || errors[0] == nil) {
+			out.Present = append(out.Present, key)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&out)
+}
+
 func handleFakeS3Put(w http.ResponseWriter, r *http.Request, key string, blobs blobMap) {
 	_, _ = io.Copy(io.Discard, r.Body)
 	_ = r.Body.Close()
@@ -240,7 +291,11 @@ func handleFakeS3UploadPart(w http.ResponseWriter, r *http.Request, fake *fakeS3
 		return
 	}
 
-	if fake.mpuFailUploadParts {
+	if fake.mpuUploadPartHook != nil {
+		fake.mpuUploadPartHook()
+	}
+
+	if fake.mpuFailUploadParts || fake.mpuUploadPartHook != nil {
 		writeFakeS3XMLError(w, http.StatusInternalServerError, "InternalError", "simulated part failure")
 		return
 	}
@@ -393,7 +448,31 @@ func attachClientToFakeS3(t *testing.T, c *client, srv *fakeS3HTTPServer) {
 	t.Helper()
 	// Disable SDK retries so queued fake errors are not consumed by retry attempts.
 	c.s3 = newTestS3Client(t, srv.URL, aws.AnonymousCredentials{}, srv.Client(), 1)
-	c.uploader = newS3Uploader(c.s3)
+	c.uploader = newS3Uploader(c.s3, &c.uploads, c.limiter)
+
+	// Requests to exodus-gw outside of the S3 API are also served by the fake.
+	target, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := log.NewContext(context.Background(), log.Package.NewLogger(args.Config{}))
+	c.httpClient = &http.Client{
+		Transport: retryTransport(ctx, c.cfg, redirectTransport{target, srv.Client().Transport}),
+	}
+}
+
+// redirectTransport sends all requests to a single target server.
+type redirectTransport struct {
+	target *url.URL
+	rt     http.RoundTripper
+}
+
+func (r redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = r.target.Scheme
+	req.URL.Host = r.target.Host
+	req.Host = ""
+	return r.rt.RoundTrip(req)
 }
 
 func TestCredentialParityNoSigningHeaders(t *testing.T) {
@@ -448,7 +527,7 @@ func TestPutObjectSendsContentMD5(t *testing.T) {
 	defer srv.Close()
 
 	client := newTestS3ClientAnonymous(t, srv.URL, srv.Client())
-	uploader := newS3Uploader(client)
+	uploader := newS3Uploader(client, nil, nil)
 
 	body := strings.NewReader("exodus-gw smoke payload")
 	_, err := uploader.UploadObject(context.Background(), &transfermanager.UploadObjectInput{
@@ -490,7 +569,7 @@ func TestS3RequestURLPathStyle(t *testing.T) {
 		t.Fatal("expected HEAD miss error")
 	}
 
-	uploader := newS3Uploader(client)
+	uploader := newS3Uploader(client, nil, nil)
 	_, err = uploader.UploadObject(context.Background(), &transfermanager.UploadObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
@@ -534,7 +613,7 @@ func TestMultipartUploadSendsContentMD5(t *testing.T) {
 	defer srv.Close()
 
 	client := newTestS3ClientAnonymous(t, srv.URL, srv.Client())
-	uploader := newS3Uploader(client)
+	uploader := newS3Uploader(client, nil, nil)
 
 	// s3UploadPartSize is 5 MiB; one byte over forces multipart upload.
 	payload := make([]byte, s3UploadPartSize+1)
@@ -623,7 +702,7 @@ func TestMultipartUploadPartFailureAborts(t *testing.T) {
 	defer srv.Close()
 
 	client := newTestS3ClientAnonymous(t, srv.URL, srv.Client())
-	uploader := newS3Uploader(client)
+	uploader := newS3Uploader(client, nil, nil)
 
 	payload := make([]byte, s3UploadPartSize+1)
 	_, err := uploader.UploadObject(context.Background(), &transfermanager.UploadObjectInput{
@@ -660,7 +739,7 @@ func TestMultipartUploadCompleteFailureAborts(t *testing.T) {
 	defer srv.Close()
 
 	client := newTestS3ClientAnonymous(t, srv.URL, srv.Client())
-	uploader := newS3Uploader(client)
+	uploader := newS3Uploader(client, nil, nil)
 
 	payload := make([]byte, s3UploadPartSize+1)
 	_, err := uploader.UploadObject(context.Background(), &transfermanager.UploadObjectInput{
@@ -42,12 +42,41 @@ type Client interface {
 		onDuplicate func(walk.SyncItem) error,
 	) error
 
+	// EnsureUploadedStream is like EnsureUploaded, but receives items from a channel
+	// until it is closed, allowing uploads to begin before all items are known.
+	//
+	// Items are not retained after processing, and only a bounded number of keys
+	// are remembered to detect duplicates, so memory usage does not grow with the
+	// number of items. A duplicate of a key which was seen long ago is handled as
+	// a new item, and so reported as present rather than as a duplicate.
+	// Callbacks may block to apply backpressure.
+	EnsureUploadedStream(ctx context.Context, items <-chan walk.SyncItem,
+		onUploaded func(walk.SyncItem) error,
+		onPresent func(walk.SyncItem) error,
+		onDuplicate func(walk.SyncItem) error,
+	) error
+
 	// NewPublish creates and returns a new publish object within exodus-gw.
 	NewPublish(context.Context) (Publish, error)
 
 	// GetPublish returns a handle to an existing publish object within exodus-gw.
 	GetPublish(ctx context.Context, id string) (Publish, error)
 
+	// ListPublished invokes fn for every item currently published under the
+	// given web URI prefix in the target exodus-gw environment, including both
+	// files and links.
+	//
+	// Returning from the callback with an error will cause ListPublished to stop
+	// and return the same error.
+	//
+	// Not all versions of exodus-gw support this; if not, an error wrapping
+	// ErrListUnsupported is returned.
+	ListPublished(ctx context.Context, prefix string, fn func(ItemInput) error) error
+
+	// GetTask returns a handle to an existing task object within exodus-gw,
+	// such as one returned by Publish.StartCommit during an earlier run.
+	GetTask(ctx context.Context, id string) (Task, error)
+
 	// WhoAmI returns raw authentication & authorization info for this exodus-gw client
 	// in the format provided by the "/whoami" endpoint.
 	//
@@ -60,10 +89,22 @@ type Publish interface {
 	// ID is the unique identifier of a publish.
 	ID() string
 
+	// State is the state of the publish within exodus-gw when it was last
+	// retrieved, e.g. "PENDING", "COMMITTED" or "FAILED".
+	State() string
+
 	// AddItems will add all of the specified items onto this publish.
 	// This may involve multiple requests to exodus-gw.
 	AddItems(context.Context, []ItemInput) error
 
+	// ListItems invokes fn for every item which has been added onto this
+	// publish, as of when the publish was created or retrieved via
+	// GetPublish.
+	//
+	// Returning from the callback with an error will cause ListItems to stop
+	// and return the same error.
+	ListItems(ctx context.Context, fn func(ItemInput) error) error
+
 	// Commit will cause this publish object to become committed, making all of
 	// the included content available from the CDN.
 	//
@@ -74,6 +115,14 @@ type Publish interface {
 	// 'mode' is the desired commit mode (see exodus-gw docs). It can be empty
 	// to not request any particular mode.
 	Commit(ctx context.Context, mode string) error
+
+	// StartCommit is like Commit, but returns the commit task as soon as the
+	// commit has started, without waiting for it to complete.
+	StartCommit(ctx context.Context, mode string) (Task, error)
+
+	// Abandon marks this publish as failed within exodus-gw, so that it
+	// can no longer be committed and its content is discarded.
+	Abandon(context.Context) error
 }
 
 // Task represents a single task object within exodus-gw.
@@ -82,7 +131,8 @@ type Task interface {
 	ID() string
 
 	// Await will repeatedly refresh the state of this task from exodus-gw
-	// and return once the task has reached a terminal state.
+	// and return once the task has reached a terminal state, or once the
+	// timeout from the 'gwtasktimeout' config option has elapsed.
 	//
 	// The return value will be nil if and only if the task succeeded.
 	Await(context.Context) error
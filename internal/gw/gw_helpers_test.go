@@ -1,11 +1,14 @@
 package gw
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -29,6 +32,9 @@ type fakeGw struct {
 
 	// If non-nil, forces next HTTP request to return this response
 	nextHTTPResponse *http.Response
+
+	// Items currently published on the CDN.
+	published []ItemInput
 }
 
 type publishMap map[string]*fakePublish
@@ -37,6 +43,7 @@ type fakePublish struct {
 	id         string
 	items      []ItemInput
 	lastCommit string
+	abandoned  bool
 
 	// If publish is committed, then each time the task state is polled,
 	// we'll pop the next state from here.
@@ -89,6 +96,10 @@ func (f *fakeGw) RoundTrip(r *http.Request) (*http.Response, error) {
 	}
 	route = route[1:]
 
+	if len(route) == 1 && route[0] == "items" && r.Method == "GET" {
+		return f.listPublished(r), nil
+	}
+
 	if len(route) == 1 && route[0] == "publish" && r.Method == "POST" {
 		return f.createPublish(), nil
 	}
@@ -105,6 +116,10 @@ func (f *fakeGw) RoundTrip(r *http.Request) (*http.Response, error) {
 		return f.commitPublish(route[1], r.URL.Query().Get("commit_mode")), nil
 	}
 
+	if len(route) == 3 && route[0] == "publish" && route[2] == "abandon" && r.Method == "POST" {
+		return f.abandonPublish(route[1]), nil
+	}
+
 	return out, nil
 }
 
@@ -145,7 +160,8 @@ func (f *fakeGw) createPublish() *http.Response {
 		"state": "PENDING",
 		"links": {
 			"self": "/env/publish/%[1]s",
-			"commit": "/env/publish/%[1]s/commit"
+			"commit": "/env/publish/%[1]s/commit",
+			"abandon": "/env/publish/%[1]s/abandon"
 		},
 		"items": []
 	}`, id)
@@ -228,6 +244,26 @@ func (f *fakeGw) commitPublish(id string, mode string) *http.Response {
 	return out
 }
 
+func (f *fakeGw) abandonPublish(id string) *http.Response {
+	out := &http.Response{}
+
+	publish, havePublish := f.publishes[id]
+	if !havePublish {
+		f.t.Logf("requested nonexistent publish %s", id)
+		out.Status = "404 Not Found"
+		out.StatusCode = 404
+		out.Body = io.NopCloser(strings.NewReader(""))
+		return out
+	}
+
+	publish.abandoned = true
+
+	out.Status = "200 OK"
+	out.StatusCode = 200
+	out.Body = io.NopCloser(strings.NewReader("{}"))
+	return out
+}
+
 func (f *fakeGw) getTask(id string) *http.Response {
 	out := &http.Response{}
 
@@ -235,6 +271,7 @@ func (f *fakeGw) getTask(id string) *http.Response {
 		f.t.Logf("requested non-task ID %s", id)
 		out.Status = "404 Not Found"
 		out.StatusCode = 404
+		out.Body = io.NopCloser(strings.NewReader(""))
 		return out
 	}
 
@@ -262,10 +299,43 @@ func (f *fakeGw) getTask(id string) *http.Response {
 	return out
 }
 
+// Number of published items returned per page.
+const fakePublishedPageSize = 2
+
+func (f *fakeGw) listPublished(r *http.Request) *http.Response {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	offset, _ := strconv.Atoi(query.Get("offset"))
+
+	var matched []ItemInput
+	for _, item := range f.published {
+		if strings.HasPrefix(item.WebURI, prefix) {
+			matched = append(matched, item)
+		}
+	}
+
+	page := publishedPage{Items: []ItemInput{}, Links: map[string]string{}}
+	for i := offset; i < len(matched) && i < offset+fakePublishedPageSize; i++ {
+		page.Items = append(page.Items, matched[i])
+	}
+	if offset+fakePublishedPageSize < len(matched) {
+		page.Links["next"] = fmt.Sprintf("/env/items?prefix=%s&offset=%d",
+			url.QueryEscape(prefix), offset+fakePublishedPageSize)
+	}
+
+	content, _ := json.Marshal(&page)
+
+	out := &http.Response{}
+	out.Status = "200 OK"
+	out.StatusCode = 200
+	out.Body = io.NopCloser(bytes.NewReader(content))
+	return out
+}
+
 func (f *fakeGw) getPublish(id string) *http.Response {
 	out := &http.Response{}
 
-	_, havePublish := f.publishes[id]
+	publish, havePublish := f.publishes[id]
 	if !havePublish {
 		f.t.Logf("requested nonexistent publish %s", id)
 		out.Status = "404 Not Found"
@@ -273,15 +343,23 @@ func (f *fakeGw) getPublish(id string) *http.Response {
 		return out
 	}
 
+	items := publish.items
+	if items == nil {
+		items = []ItemInput{}
+	}
+	itemsJSON, _ := json.Marshal(items)
+
 	content := fmt.Sprintf(`{
 		"id": "%s",
 		"env": "env",
+		"state": "PENDING",
 		"links": {
 			"self": "/env/publish/%[1]s",
-			"commit": "/env/publish/%[1]s/commit"
+			"commit": "/env/publish/%[1]s/commit",
+			"abandon": "/env/publish/%[1]s/abandon"
 		},
-		"items": []
-	}`, id)
+		"items": %s
+	}`, id, itemsJSON)
 
 	out.Status = "200 OK"
 	out.StatusCode = 200
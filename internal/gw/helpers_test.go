@@ -32,8 +32,10 @@ func testConfig(t *testing.T) conf.Config {
 
 	cfg.EXPECT().GwCert().AnyTimes().Return("../../test/data/service.pem")
 	cfg.EXPECT().GwKey().AnyTimes().Return("../../test/data/service-key.pem")
+	cfg.EXPECT().GwCACert().AnyTimes().Return("")
 	cfg.EXPECT().GwURL().AnyTimes().Return("https://exodus-gw.example.com")
 	cfg.EXPECT().GwPollInterval().AnyTimes().Return(1)
+	cfg.EXPECT().GwTaskTimeout().AnyTimes().Return(0)
 	cfg.EXPECT().GwEnv().AnyTimes().Return("env")
 	cfg.EXPECT().GwBatchSize().AnyTimes().Return(3)
 	cfg.EXPECT().GwMaxAttempts().AnyTimes().Return(3)
@@ -42,6 +44,8 @@ func testConfig(t *testing.T) conf.Config {
 	cfg.EXPECT().LogLevel().AnyTimes().Return("info")
 	cfg.EXPECT().Verbosity().AnyTimes().Return(3)
 	cfg.EXPECT().UploadThreads().AnyTimes().Return(4)
+	cfg.EXPECT().PresenceThreads().AnyTimes().Return(2)
+	cfg.EXPECT().UploadBwLimit().AnyTimes().Return(int64(0))
 
 	return cfg
 }
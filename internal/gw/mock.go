@@ -110,6 +110,20 @@ func (mr *MockClientMockRecorder) EnsureUploaded(ctx, items, onUploaded, onPrese
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureUploaded", reflect.TypeOf((*MockClient)(nil).EnsureUploaded), ctx, items, onUploaded, onPresent, onDuplicate)
 }
 
+// EnsureUploadedStream mocks base method.
+func (m *MockClient) EnsureUploadedStream(ctx context.Context, items <-chan walk.SyncItem, onUploaded, onPresent, onDuplicate func(walk.SyncItem) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnsureUploadedStream", ctx, items, onUploaded, onPresent, onDuplicate)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnsureUploadedStream indicates an expected call of EnsureUploadedStream.
+func (mr *MockClientMockRecorder) EnsureUploadedStream(ctx, items, onUploaded, onPresent, onDuplicate any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureUploadedStream", reflect.TypeOf((*MockClient)(nil).EnsureUploadedStream), ctx, items, onUploaded, onPresent, onDuplicate)
+}
+
 // GetPublish mocks base method.
 func (m *MockClient) GetPublish(ctx context.Context, id string) (Publish, error) {
 	m.ctrl.T.Helper()
@@ -125,6 +139,35 @@ func (mr *MockClientMockRecorder) GetPublish(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublish", reflect.TypeOf((*MockClient)(nil).GetPublish), ctx, id)
 }
 
+// GetTask mocks base method.
+func (m *MockClient) GetTask(ctx context.Context, id string) (Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTask", ctx, id)
+	ret0, _ := ret[0].(Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTask indicates an expected call of GetTask.
+func (mr *MockClientMockRecorder) GetTask(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTask", reflect.TypeOf((*MockClient)(nil).GetTask), ctx, id)
+}
+
+// ListPublished mocks base method.
+func (m *MockClient) ListPublished(ctx context.Context, prefix string, fn func(ItemInput) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPublished", ctx, prefix, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ListPublished indicates an expected call of ListPublished.
+func (mr *MockClientMockRecorder) ListPublished(ctx, prefix, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPublished", reflect.TypeOf((*MockClient)(nil).ListPublished), ctx, prefix, fn)
+}
+
 // NewPublish mocks base method.
 func (m *MockClient) NewPublish(arg0 context.Context) (Publish, error) {
 	m.ctrl.T.Helper()
@@ -179,6 +222,20 @@ func (m *MockPublish) EXPECT() *MockPublishMockRecorder {
 	return m.recorder
 }
 
+// Abandon mocks base method.
+func (m *MockPublish) Abandon(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Abandon", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Abandon indicates an expected call of Abandon.
+func (mr *MockPublishMockRecorder) Abandon(arg0 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Abandon", reflect.TypeOf((*MockPublish)(nil).Abandon), arg0)
+}
+
 // AddItems mocks base method.
 func (m *MockPublish) AddItems(arg0 context.Context, arg1 []ItemInput) error {
 	m.ctrl.T.Helper()
@@ -221,6 +278,49 @@ func (mr *MockPublishMockRecorder) ID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ID", reflect.TypeOf((*MockPublish)(nil).ID))
 }
 
+// ListItems mocks base method.
+func (m *MockPublish) ListItems(ctx context.Context, fn func(ItemInput) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListItems", ctx, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ListItems indicates an expected call of ListItems.
+func (mr *MockPublishMockRecorder) ListItems(ctx, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListItems", reflect.TypeOf((*MockPublish)(nil).ListItems), ctx, fn)
+}
+
+// StartCommit mocks base method.
+func (m *MockPublish) StartCommit(ctx context.Context, mode string) (Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartCommit", ctx, mode)
+	ret0, _ := ret[0].(Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StartCommit indicates an expected call of StartCommit.
+func (mr *MockPublishMockRecorder) StartCommit(ctx, mode any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartCommit", reflect.TypeOf((*MockPublish)(nil).StartCommit), ctx, mode)
+}
+
+// State mocks base method.
+func (m *MockPublish) State() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "State")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// State indicates an expected call of State.
+func (mr *MockPublishMockRecorder) State() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "State", reflect.TypeOf((*MockPublish)(nil).State))
+}
+
 // MockTask is a mock of Task interface.
 type MockTask struct {
 	ctrl     *gomock.Controller
@@ -0,0 +1,92 @@
+package gw
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/syncutil"
+)
+
+// How long to spend aborting incomplete multipart uploads after uploading
+// has been interrupted.
+const abortUploadsTimeout = 30 * time.Second
+
+type multipartUpload struct {
+	bucket string
+	key    string
+}
+
+// multipartUploads tracks multipart uploads which have been created but not
+// yet completed or aborted, so they can be cleaned up if uploading stops
+// partway through.
+type multipartUploads struct {
+	mutex  sync.Mutex
+	active map[string]multipartUpload
+}
+
+func (m *multipartUploads) add(uploadID string, upload multipartUpload) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.active == nil {
+		m.active = make(map[string]multipartUpload)
+	}
+	m.active[uploadID] = upload
+}
+
+func (m *multipartUploads) remove(uploadID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.active, uploadID)
+}
+
+func (m *multipartUploads) pending() map[string]multipartUpload {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	out := make(map[string]multipartUpload, len(m.active))
+	for id, upload := range m.active {
+		out[id] = upload
+	}
+	return out
+}
+
+// abortUploads aborts any multipart uploads left incomplete, so that exodus-gw
+// doesn't keep the uploaded parts.
+//
+// This is expected to be called after uploads were interrupted, so ctx is
+// only used for its values and for cutting cleanup short, not for
+// cancellation.
+func (c *client) abortUploads(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	pending := c.uploads.pending()
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, cancel := syncutil.CleanupContext(ctx, abortUploadsTimeout)
+	defer cancel()
+
+	for uploadID, upload := range pending {
+		_, err := c.s3.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(upload.bucket),
+			Key:      aws.String(upload.key),
+			UploadId: aws.String(uploadID),
+		})
+
+		if err != nil {
+			logger.F("key", upload.key, "upload", uploadID, "error", err).Warn(
+				"Can't abort incomplete multipart upload")
+			continue
+		}
+
+		c.uploads.remove(uploadID)
+		logger.F("key", upload.key, "upload", uploadID).Info("Aborted incomplete multipart upload")
+	}
+}
@@ -0,0 +1,76 @@
+package gw
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+func TestClientUploadStreamCancelledAbortsMPU(t *testing.T) {
+	ctx := context.Background()
+	ctx = log.NewContext(ctx, log.Package.NewLogger(args.Config{}))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Cancel while the upload is in progress, as on SIGINT.
+	srv := newFakeS3HTTPServer(t, fakeS3ServerConfig{MPUUploadPartHook: cancel})
+	defer srv.Close()
+
+	client, _ := newClientWithFakeS3(t)
+	attachClientToFakeS3(t, client, srv)
+
+	// Large enough to need a multipart upload.
+	src := filepath.Join(t.TempDir(), "large")
+	if err := os.WriteFile(src, make([]byte, s3UploadPartSize+1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	items := make(chan walk.SyncItem, 1)
+	items <- walk.SyncItem{SrcPath: src, Key: "large-key"}
+	close(items)
+
+	err := client.EnsureUploadedStream(ctx, items, nil, nil, nil)
+	if err == nil {
+		t.Fatal("expected upload to fail")
+	}
+
+	uploadID := mpuUploadIDFromRequests(srv.Requests())
+	if uploadID == "" {
+		t.Fatalf("expected uploadId in recorded requests, got %#v", srv.Requests())
+	}
+
+	// Even though the context was cancelled, the upload should have been
+	// aborted rather than left for the server to clean up.
+	if !sawMPUAbort(srv.Requests(), uploadID) {
+		t.Fatalf("expected AbortMultipartUpload for %s, got %#v", uploadID, srv.Requests())
+	}
+	if len(srv.mpus) != 0 {
+		t.Errorf("multipart uploads left incomplete: %v", srv.mpus)
+	}
+	if pending := client.uploads.pending(); len(pending) != 0 {
+		t.Errorf("client still tracking uploads: %v", pending)
+	}
+}
+
+func TestMultipartUploadsTracking(t *testing.T) {
+	uploads := multipartUploads{}
+
+	if len(uploads.pending()) != 0 {
+		t.Error("zero value should track nothing")
+	}
+
+	uploads.add("a", multipartUpload{"bucket", "key-a"})
+	uploads.add("b", multipartUpload{"bucket", "key-b"})
+	uploads.remove("a")
+	uploads.remove("unknown")
+
+	pending := uploads.pending()
+	if len(pending) != 1 || pending["b"].key != "key-b" {
+		t.Errorf("unexpected pending uploads %v", pending)
+	}
+}
@@ -0,0 +1,210 @@
+package gw
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+// States for client.bulkPresence.
+const (
+	bulkPresenceUnknown     = iota // not yet attempted
+	bulkPresenceSupported          // exodus-gw answered a bulk query
+	bulkPresenceUnsupported        // exodus-gw lacks the API, use HEAD per blob
+)
+
+type presenceQuery struct {
+	ObjectKeys []string `json:"object_keys"`
+}
+
+type presenceResponse struct {
+	Present []string `json:"present"`
+}
+
+// presenceStats counts the requests made while checking for presence of blobs.
+type presenceStats struct {
+	requests atomic.Int64
+	keys     atomic.Int64
+}
+
+func (s *presenceStats) add(requests, keys int) {
+	s.requests.Add(int64(requests))
+	s.keys.Add(int64(keys))
+}
+
+func (s *presenceStats) log(ctx context.Context) {
+	requests := s.requests.Load()
+	keys := s.keys.Load()
+	if requests == 0 {
+		return
+	}
+
+	log.FromContext(ctx).F(
+		"requests", requests,
+		"keys", keys,
+		"keys_per_request", fmt.Sprintf("%.1f", float64(keys)/float64(requests)),
+	).Info("Checked presence of blobs")
+}
+
+// Returns the max number of keys to include in a single presence query.
+func (c *client) presenceBatchSize() int {
+	if c.bulkPresence.Load() == bulkPresenceUnsupported {
+		// Each HEAD request can only check a single key; handing out larger
+		// batches would only reduce concurrency.
+		return 1
+	}
+	return c.cfg.GwBatchSize()
+}
+
+// batchPresenceChecks reads items from 'items' and writes them in batches to
+// 'batches', until 'items' is closed.
+//
+// Batches are sent as soon as any presence worker is ready to accept them,
+// so items are not held back waiting for a batch to fill; but while all
+// workers are busy, batches keep growing up to the batch size.
+func (c *client) batchPresenceChecks(ctx context.Context, items <-chan walk.SyncItem, batches chan<- []walk.SyncItem) {
+	defer close(batches)
+
+	var batch []walk.SyncItem
+
+	for {
+		recv := items
+		var send chan<- []walk.SyncItem
+
+		if len(batch) > 0 {
+			send = batches
+		}
+		if len(batch) >= c.presenceBatchSize() {
+			recv = nil
+		}
+		if recv == nil && send == nil {
+			// Nothing in hand and nothing more to come.
+			return
+		}
+
+		select {
+		case item, ok := <-recv:
+			if !ok {
+				items = nil
+				continue
+			}
+			batch = append(batch, item)
+		case send <- batch:
+			batch = nil
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// presenceWorker checks whether each batch of items from 'batches' is already
+// present in the bucket. Items already present are written straight to
+// 'results', while the rest are sent on to 'jobs' for upload.
+//
+// A fixed number of these run at once, bounding the number of concurrent
+// requests made to check for presence of blobs.
+func (c *client) presenceWorker(
+	ctx context.Context,
+	batches <-chan []walk.SyncItem,
+	jobs chan<- walk.SyncItem,
+	results chan<- uploadResult,
+	stats *presenceStats,
+	wg *sync.WaitGroup,
+) {
+	defer wg.Done()
+
+	logger := log.FromContext(ctx)
+
+	for batch := range batches {
+		have, err := c.havePresent(ctx, batch, stats)
+		if err != nil {
+			results <- uploadResult{failed, err, batch[0]}
+			return
+		}
+
+		for _, item := range batch {
+			// If present, no need to upload it
+			if have[item.Key] {
+				logger.F("key", item.Key).Info("Skipping upload, blob is present")
+				results <- uploadResult{present, nil, item}
+				continue
+			}
+
+			select {
+			case jobs <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// havePresent returns the set of keys from 'items' which are already present
+// in the bucket.
+//
+// A single bulk query is used when supported by exodus-gw. Otherwise, falls
+// back to a HEAD request per item; from then on, batches only hold a single
+// item, so that HEAD requests are spread across the presence workers.
+func (c *client) havePresent(ctx context.Context, items []walk.SyncItem, stats *presenceStats) (map[string]bool, error) {
+	if c.bulkPresence.Load() != bulkPresenceUnsupported {
+		out, err := c.queryPresent(ctx, items)
+		if err == nil {
+			c.bulkPresence.Store(bulkPresenceSupported)
+			stats.add(1, len(items))
+			return out, nil
+		}
+		if !isUnsupported(err) || c.bulkPresence.Load() == bulkPresenceSupported {
+			return nil, fmt.Errorf("checking for presence of %d blob(s): %w", len(items), err)
+		}
+		if c.bulkPresence.CompareAndSwap(bulkPresenceUnknown, bulkPresenceUnsupported) {
+			log.FromContext(ctx).F("error", err).Info(
+				"exodus-gw does not support bulk presence checks, using HEAD requests")
+		}
+	}
+
+	return c.headEach(ctx, items, stats)
+}
+
+// queryPresent checks the presence of all items via a single request to exodus-gw.
+func (c *client) queryPresent(ctx context.Context, items []walk.SyncItem) (map[string]bool, error) {
+	query := presenceQuery{ObjectKeys: make([]string, 0, len(items))}
+	for _, item := range items {
+		query.ObjectKeys = append(query.ObjectKeys, item.Key)
+	}
+
+	resp := presenceResponse{}
+	url := "/" + c.cfg.GwEnv() + "/blobs/present"
+	if err := c.doJSONRequest(ctx, "POST", url, &query, &resp, nil); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]bool, len(resp.Present))
+	for _, key := range resp.Present {
+		out[key] = true
+	}
+
+	log.FromContext(ctx).F("keys", len(items), "present", len(out)).Info("Checked presence of blobs in bulk")
+
+	return out, nil
+}
+
+// headEach checks the presence of items via a HEAD request per item, one at
+// a time. Concurrency is provided by running several presence workers.
+func (c *client) headEach(ctx context.Context, items []walk.SyncItem, stats *presenceStats) (map[string]bool, error) {
+	out := make(map[string]bool, len(items))
+
+	for _, item := range items {
+		have, err := c.haveBlob(ctx, item)
+		if err != nil {
+			return nil, fmt.Errorf("checking for presence of %s: %w", item.Key, err)
+		}
+		stats.add(1, 1)
+		out[item.Key] = have
+	}
+
+	return out, nil
+}
@@ -0,0 +1,44 @@
+package gw
+
+import (
+	"context"
+	"io"
+)
+
+// ProgressFunc is invoked with the number of bytes read from a file each time
+// some of its content is read for upload.
+//
+// It may be invoked concurrently from multiple uploads.
+type ProgressFunc func(bytes int64)
+
+type progressKey struct{}
+
+// WithProgress returns a context containing fn, which will be invoked as
+// blobs are uploaded by any client using that context.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressFromContext returns the function within a context previously created
+// via WithProgress, or nil if unset.
+func progressFromContext(ctx context.Context) ProgressFunc {
+	out, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return out
+}
+
+// progressReader counts bytes as they're read from an upload body.
+//
+// The uploader only seeks in order to determine the size of the body, and
+// then reads it exactly once, so every byte is counted once.
+type progressReader struct {
+	io.ReadSeeker
+	fn ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	if n > 0 {
+		r.fn(int64(n))
+	}
+	return n, err
+}
@@ -2,12 +2,17 @@ package gw
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 
 	"github.com/release-engineering/exodus-rsync/internal/log"
 )
 
+// ErrAbandonUnsupported is returned from Publish.Abandon if exodus-gw doesn't
+// provide a way to abandon the publish.
+var ErrAbandonUnsupported = errors.New("exodus-gw does not support abandoning publishes")
+
 type publish struct {
 	client *client
 	raw    struct {
@@ -15,6 +20,7 @@ type publish struct {
 		Env   string
 		State string
 		Links map[string]string
+		Items []ItemInput
 	}
 }
 
@@ -66,8 +72,7 @@ func (c *client) GetPublish(ctx context.Context, id string) (Publish, error) {
 	out.raw.Links["commit"] = url + "/commit"
 
 	// Verify that the publish ID is valid before uploading blobs.
-	empty := struct{}{}
-	if err := c.doJSONRequest(ctx, "GET", url, nil, &empty, nil); err != nil {
+	if err := c.doJSONRequest(ctx, "GET", url, nil, &out.raw, nil); err != nil {
 		return nil, err
 	}
 
@@ -78,6 +83,10 @@ func (p *publish) ID() string {
 	return p.raw.ID
 }
 
+func (p *publish) State() string {
+	return p.raw.State
+}
+
 // AddItems will add all of the specified items onto this publish.
 // This may involve multiple requests to exodus-gw.
 func (p *publish) AddItems(ctx context.Context, items []ItemInput) error {
@@ -123,6 +132,20 @@ func (p *publish) AddItems(ctx context.Context, items []ItemInput) error {
 	return nil
 }
 
+// ListItems invokes fn for every item which has been added onto this publish,
+// as included in the publish object returned by exodus-gw.
+func (p *publish) ListItems(ctx context.Context, fn func(ItemInput) error) error {
+	for _, item := range p.raw.Items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	log.FromContext(ctx).F("publish", p.ID(), "items", len(p.raw.Items)).Debug("Listed publish items")
+
+	return nil
+}
+
 // Commit will cause this publish object to become committed, making all of
 // the included content available from the CDN.
 //
@@ -135,25 +158,62 @@ func (p *publish) Commit(ctx context.Context, mode string) error {
 	logger := log.FromContext(ctx)
 	defer logger.F("publish", p.ID(), "mode", mode).Trace("Committing publish").Stop(&err)
 
+	var task Task
+	task, err = p.StartCommit(ctx, mode)
+	if err != nil {
+		return err
+	}
+
+	err = task.Await(ctx)
+	return err
+}
+
+// StartCommit starts committing this publish object and returns the task
+// responsible for the commit, without waiting for it to complete.
+func (p *publish) StartCommit(ctx context.Context, mode string) (Task, error) {
 	c := p.client
 	url, ok := p.raw.Links["commit"]
 	if !ok {
-		err = fmt.Errorf("publish not eligible for commit: %+v", p.raw)
-		return err
+		return nil, fmt.Errorf("publish not eligible for commit: %+v", p.raw)
 	}
 
 	if mode != "" {
 		url = url + "?commit_mode=" + mode
 	}
 
-	task := task{}
+	out := &task{}
 	headers := map[string][]string{"X-Idempotency-Key": {}}
-	if err := c.doJSONRequest(ctx, "POST", url, nil, &task.raw, headers); err != nil {
+	if err := c.doJSONRequest(ctx, "POST", url, nil, &out.raw, headers); err != nil {
+		return nil, err
+	}
+
+	out.client = c
+
+	return out, nil
+}
+
+// Abandon marks this publish as failed within exodus-gw, so that it can no
+// longer be committed and its content is discarded.
+//
+// This is only possible if exodus-gw provides an 'abandon' link on the
+// publish; otherwise, ErrAbandonUnsupported is returned without making any
+// request.
+func (p *publish) Abandon(ctx context.Context) error {
+	url, ok := p.raw.Links["abandon"]
+	if !ok {
+		return ErrAbandonUnsupported
+	}
+
+	empty := struct{}{}
+	headers := map[string][]string{"X-Idempotency-Key": {}}
+	if err := p.client.doJSONRequest(ctx, "POST", url, nil, &empty, headers); err != nil {
+		if isUnsupported(err) {
+			return fmt.Errorf("%w: %w", ErrAbandonUnsupported, err)
+		}
 		return err
 	}
 
-	task.client = c
+	log.FromContext(ctx).F("publish", p.ID()).Info("Abandoned publish")
 
-	err = task.Await(ctx)
-	return err
+	return nil
 }
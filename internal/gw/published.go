@@ -0,0 +1,59 @@
+package gw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+// AbsentObjectKey is the object key used for items which should be deleted
+// from the CDN when a publish is committed.
+//
+// This is part of the exodus-gw publish API: the object_key of an item may be
+// "absent" to indicate that no content shall be exposed at its web URI.
+const AbsentObjectKey = "absent"
+
+// ErrListUnsupported is returned from ListPublished if exodus-gw doesn't
+// provide an API for listing published content, which is needed to determine
+// what to delete.
+var ErrListUnsupported = errors.New("exodus-gw does not support listing published content")
+
+type publishedPage struct {
+	Items []ItemInput
+	Links map[string]string
+}
+
+// ListPublished invokes fn for every item currently published under the
+// given web URI prefix in the target exodus-gw environment.
+func (c *client) ListPublished(ctx context.Context, prefix string, fn func(ItemInput) error) error {
+	logger := log.FromContext(ctx)
+
+	next := "/" + c.cfg.GwEnv() + "/items?prefix=" + url.QueryEscape(prefix)
+	count := 0
+
+	for next != "" {
+		page := publishedPage{}
+		if err := c.doJSONRequest(ctx, "GET", next, nil, &page, nil); err != nil {
+			if isUnsupported(err) {
+				return fmt.Errorf("%w: %w", ErrListUnsupported, err)
+			}
+			return err
+		}
+
+		for _, item := range page.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+
+		count += len(page.Items)
+		logger.F("prefix", prefix, "items", count).Debug("Listed published items")
+
+		next = page.Links["next"]
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package gw
+
+import "container/list"
+
+// maxRecentKeys limits how many keys EnsureUploadedStream remembers in order
+// to detect duplicate items, so that memory usage is bounded regardless of
+// the number of items.
+const maxRecentKeys = 100000
+
+// recentKeys is a set of the most recently added keys, holding at most size
+// keys. Once full, adding a key forgets the least recently seen one.
+//
+// Not safe for concurrent use.
+type recentKeys struct {
+	size  int
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+func newRecentKeys(size int) *recentKeys {
+	return &recentKeys{size: size, order: list.New(), keys: make(map[string]*list.Element)}
+}
+
+// seen returns true if key was among the most recently seen keys, and records
+// that key has been seen now.
+func (r *recentKeys) seen(key string) bool {
+	if elem, ok := r.keys[key]; ok {
+		r.order.MoveToFront(elem)
+		return true
+	}
+
+	r.keys[key] = r.order.PushFront(key)
+	if r.order.Len() > r.size {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.keys, oldest.Value.(string))
+	}
+	return false
+}
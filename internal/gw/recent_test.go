@@ -0,0 +1,29 @@
+package gw
+
+import "testing"
+
+func TestRecentKeys(t *testing.T) {
+	keys := newRecentKeys(2)
+
+	for _, tt := range []struct {
+		key  string
+		seen bool
+	}{
+		{"a", false},
+		{"b", false},
+		{"a", true},
+		// Forgets "b", which is now the least recently seen.
+		{"c", false},
+		{"a", true},
+		{"b", false},
+		{"c", false},
+	} {
+		if got := keys.seen(tt.key); got != tt.seen {
+			t.Errorf("seen(%q) = %v, expected %v", tt.key, got, tt.seen)
+		}
+	}
+
+	if len(keys.keys) != 2 || keys.order.Len() != 2 {
+		t.Errorf("holding %d keys, expected 2", len(keys.keys))
+	}
+}
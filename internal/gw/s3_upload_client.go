@@ -27,8 +27,55 @@ func exodusGWChecksumConfig(cfg *aws.Config) {
 
 // contentMD5UploadClient wraps *s3.Client so PutObject and UploadPart always
 // include Content-MD5, which the gateway requires for single-part and MPU uploads.
+//
+// If uploads is non-nil, multipart uploads are tracked there until completed
+// or aborted.
+//
+// If limiter is non-nil, the content of every upload is sent no faster than it
+// allows.
 type contentMD5UploadClient struct {
 	*s3.Client
+	uploads *multipartUploads
+	limiter *rateLimiter
+}
+
+func (c *contentMD5UploadClient) CreateMultipartUpload(
+	ctx context.Context,
+	params *s3.CreateMultipartUploadInput,
+	optFns ...func(*s3.Options),
+) (*s3.CreateMultipartUploadOutput, error) {
+	out, err := c.Client.CreateMultipartUpload(ctx, params, optFns...)
+	if err == nil && c.uploads != nil && out.UploadId != nil {
+		c.uploads.add(*out.UploadId, multipartUpload{
+			bucket: aws.ToString(params.Bucket),
+			key:    aws.ToString(params.Key),
+		})
+	}
+	return out, err
+}
+
+func (c *contentMD5UploadClient) CompleteMultipartUpload(
+	ctx context.Context,
+	params *s3.CompleteMultipartUploadInput,
+	optFns ...func(*s3.Options),
+) (*s3.CompleteMultipartUploadOutput, error) {
+	out, err := c.Client.CompleteMultipartUpload(ctx, params, optFns...)
+	if err == nil && c.uploads != nil {
+		c.uploads.remove(aws.ToString(params.UploadId))
+	}
+	return out, err
+}
+
+func (c *contentMD5UploadClient) AbortMultipartUpload(
+	ctx context.Context,
+	params *s3.AbortMultipartUploadInput,
+	optFns ...func(*s3.Options),
+) (*s3.AbortMultipartUploadOutput, error) {
+	out, err := c.Client.AbortMultipartUpload(ctx, params, optFns...)
+	if err == nil && c.uploads != nil {
+		c.uploads.remove(aws.ToString(params.UploadId))
+	}
+	return out, err
 }
 
 func (c *contentMD5UploadClient) PutObject(
@@ -43,7 +90,7 @@ func (c *contentMD5UploadClient) PutObject(
 		}
 		params.ContentMD5 = aws.String(md5Sum)
 	}
-	return c.Client.PutObject(ctx, params, optFns...)
+	return c.Client.PutObject(ctx, params, withBwLimit(c.limiter, optFns)...)
 }
 
 func (c *contentMD5UploadClient) UploadPart(
@@ -58,7 +105,7 @@ func (c *contentMD5UploadClient) UploadPart(
 		}
 		params.ContentMD5 = aws.String(md5Sum)
 	}
-	return c.Client.UploadPart(ctx, params, optFns...)
+	return c.Client.UploadPart(ctx, params, withBwLimit(c.limiter, optFns)...)
 }
 
 func seekableMD5Base64(body io.Reader) (string, error) {
@@ -83,8 +130,8 @@ func seekableMD5Base64(body io.Reader) (string, error) {
 	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
 }
 
-func newS3Uploader(s3Client *s3.Client) *transfermanager.Client {
-	return transfermanager.New(&contentMD5UploadClient{Client: s3Client}, func(o *transfermanager.Options) {
+func newS3Uploader(s3Client *s3.Client, uploads *multipartUploads, limiter *rateLimiter) *transfermanager.Client {
+	return transfermanager.New(&contentMD5UploadClient{Client: s3Client, uploads: uploads, limiter: limiter}, func(o *transfermanager.Options) {
 		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
 		o.PartSizeBytes = s3UploadPartSize
 		o.MultipartUploadThreshold = s3UploadPartSize
@@ -8,6 +8,27 @@ import (
 	"github.com/release-engineering/exodus-rsync/internal/log"
 )
 
+// TaskError is returned when a task within exodus-gw ends unsuccessfully.
+type TaskError struct {
+	ID    string
+	State string
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("publish task %s failed", e.ID)
+}
+
+// TaskTimeoutError is returned when a task within exodus-gw doesn't end within
+// the configured timeout. The task may still be in progress.
+type TaskTimeoutError struct {
+	ID    string
+	State string
+}
+
+func (e *TaskTimeoutError) Error() string {
+	return fmt.Sprintf("timed out awaiting publish task %s in state %s", e.ID, e.State)
+}
+
 type task struct {
 	client *client
 	raw    struct {
@@ -31,6 +52,21 @@ func (t *task) refresh(ctx context.Context) error {
 	return t.client.doJSONRequest(ctx, "GET", url, nil, &t.raw, nil)
 }
 
+// GetTask returns a handle to an existing task object within exodus-gw.
+func (c *client) GetTask(ctx context.Context, id string) (Task, error) {
+	out := &task{client: c}
+	out.raw.ID = id
+	out.raw.Links = map[string]string{"self": "/task/" + id}
+
+	// Get the current state of the task, which also verifies that the
+	// task exists.
+	if err := out.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("getting task %v: %w", id, err)
+	}
+
+	return out, nil
+}
+
 func (t *task) ID() string {
 	return t.raw.ID
 }
@@ -39,6 +75,14 @@ func (t *task) Await(ctx context.Context) error {
 	logger := log.FromContext(ctx)
 	pollDuration := time.Millisecond * time.Duration(t.client.cfg.GwPollInterval())
 
+	// Without a timeout, this channel is never ready.
+	var timeout <-chan time.Time
+	if seconds := t.client.cfg.GwTaskTimeout(); seconds > 0 {
+		timer := time.NewTimer(time.Duration(seconds) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
 	for {
 		if t.raw.State == "COMPLETE" {
 			// succeeded
@@ -48,13 +92,16 @@ func (t *task) Await(ctx context.Context) error {
 
 		if t.raw.State == "FAILED" {
 			logger.F("task", t.raw.ID).Info("Task failed")
-			return fmt.Errorf("publish task %s failed", t.raw.ID)
+			return &TaskError{ID: t.raw.ID, State: t.raw.State}
 		}
 
 		// Not in a terminal state - query it again soon
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-timeout:
+			logger.F("task", t.raw.ID, "state", t.raw.State).Info("Timed out awaiting task")
+			return &TaskTimeoutError{ID: t.raw.ID, State: t.raw.State}
 		case <-time.After(pollDuration):
 		}
 
@@ -0,0 +1,252 @@
+package gwtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Number of items returned per page when listing published content.
+const itemsPageSize = 100
+
+type publishResponse struct {
+	ID    string            `json:"id"`
+	Env   string            `json:"env"`
+	State string            `json:"state"`
+	Links map[string]string `json:"links"`
+	Items []Item            `json:"items"`
+}
+
+type taskResponse struct {
+	ID        string            `json:"id"`
+	PublishID string            `json:"publish_id"`
+	State     string            `json:"state"`
+	Links     map[string]string `json:"links"`
+}
+
+func (p *publish) response() publishResponse {
+	self := "/" + p.Env + "/publish/" + p.ID
+	return publishResponse{
+		ID:    p.ID,
+		Env:   p.Env,
+		State: p.State,
+		Links: map[string]string{"self": self, "commit": self + "/commit", "abandon": self + "/abandon"},
+		Items: append([]Item{}, p.Items...),
+	}
+}
+
+func (t *task) response() taskResponse {
+	return taskResponse{
+		ID:        t.id,
+		PublishID: t.publishID,
+		State:     t.state,
+		Links:     map[string]string{"self": "/task/" + t.id},
+	}
+}
+
+func (s *Server) whoami(w http.ResponseWriter, r *http.Request) {
+	subject := ""
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		subject = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"client": map[string]interface{}{
+			"roles":          []string{},
+			"authenticated":  true,
+			"serviceaccount": map[string]string{"subject": subject},
+		},
+	})
+}
+
+// Must be called with mutex held.
+func (s *Server) findPublish(w http.ResponseWriter, env string, id string) *publish {
+	p, ok := s.publishes[id]
+	if !ok || p.Env != env {
+		writeError(w, http.StatusNotFound, "No publish found for ID "+id)
+		return nil
+	}
+	return p
+}
+
+func (s *Server) createPublish(w http.ResponseWriter, env string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := &publish{Publish: Publish{ID: s.newID(), Env: env, State: "PENDING"}}
+	s.publishes[p.ID] = p
+
+	writeJSON(w, http.StatusOK, p.response())
+}
+
+func (s *Server) getPublish(w http.ResponseWriter, env string, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if p := s.findPublish(w, env, id); p != nil {
+		writeJSON(w, http.StatusOK, p.response())
+	}
+}
+
+func (s *Server) addItems(w http.ResponseWriter, r *http.Request, env string, id string) {
+	items := []Item{}
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.findPublish(w, env, id)
+	if p == nil {
+		return
+	}
+	if p.State != "PENDING" {
+		writeError(w, http.StatusConflict, "Publish "+id+" in unexpected state, '"+p.State+"'")
+		return
+	}
+
+	for _, item := range items {
+		if item.WebURI == "" || (item.ObjectKey == "") == (item.LinkTo == "") {
+			writeError(w, http.StatusBadRequest, "invalid item: "+item.WebURI)
+			return
+		}
+		if item.ObjectKey == "" || item.ObjectKey == AbsentObjectKey {
+			continue
+		}
+		if _, ok := s.blobs[env][item.ObjectKey]; !ok {
+			writeError(w, http.StatusBadRequest, "No object with key "+item.ObjectKey)
+			return
+		}
+	}
+
+	p.Items = append(p.Items, items...)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) commitPublish(w http.ResponseWriter, r *http.Request, env string, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.findPublish(w, env, id)
+	if p == nil {
+		return
+	}
+
+	if p.task != nil {
+		// Committing again returns the same task, as exodus-gw would
+		// for a retried request.
+		writeJSON(w, http.StatusOK, p.task.response())
+		return
+	}
+	if p.State != "PENDING" {
+		writeError(w, http.StatusConflict, "Publish "+id+" in unexpected state, '"+p.State+"'")
+		return
+	}
+
+	p.CommitMode = r.URL.Query().Get("commit_mode")
+	p.State = "COMMITTING"
+	p.task = &task{id: s.newID(), publishID: p.ID, state: "NOT_STARTED"}
+	s.tasks[p.task.id] = p.task
+
+	writeJSON(w, http.StatusOK, p.task.response())
+}
+
+func (s *Server) abandonPublish(w http.ResponseWriter, env string, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.findPublish(w, env, id)
+	if p == nil {
+		return
+	}
+	if p.State != "PENDING" {
+		writeError(w, http.StatusConflict, "Publish "+id+" in unexpected state, '"+p.State+"'")
+		return
+	}
+
+	p.State = "FAILED"
+
+	writeJSON(w, http.StatusOK, p.response())
+}
+
+func (s *Server) getTask(w http.ResponseWriter, id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	t, ok := s.tasks[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No task found for ID "+id)
+		return
+	}
+
+	// Tasks complete as soon as they're polled.
+	if t.state == "NOT_STARTED" {
+		t.state = s.taskState
+		p := s.publishes[t.publishID]
+
+		if t.state == "COMPLETE" {
+			p.State = "COMMITTED"
+			s.publishItems(p.Env, p.Items)
+		} else {
+			p.State = "FAILED"
+		}
+	}
+
+	writeJSON(w, http.StatusOK, t.response())
+}
+
+func (s *Server) blobsPresent(w http.ResponseWriter, r *http.Request, env string) {
+	query := struct {
+		ObjectKeys []string `json:"object_keys"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	present := []string{}
+	for _, key := range query.ObjectKeys {
+		if _, ok := s.blobs[env][key]; ok {
+			present = append(present, key)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]string{"present": present})
+}
+
+func (s *Server) items(w http.ResponseWriter, r *http.Request, env string) {
+	prefix := r.URL.Query().Get("prefix")
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	writeItemsPage(w, r, s.listPublished(env, prefix))
+}
+
+// writeItemsPage writes a single page of items, with a link to the next page
+// if there are more items.
+func writeItemsPage(w http.ResponseWriter, r *http.Request, matched []Item) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	page := struct {
+		Items []Item            `json:"items"`
+		Links map[string]string `json:"links"`
+	}{Items: []Item{}, Links: map[string]string{}}
+
+	for i := offset; i < len(matched) && i < offset+itemsPageSize; i++ {
+		page.Items = append(page.Items, matched[i])
+	}
+	if offset+itemsPageSize < len(matched) {
+		next := r.URL.Query()
+		next.Set("offset", strconv.Itoa(offset+itemsPageSize))
+		page.Links["next"] = r.URL.Path + "?" + next.Encode()
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
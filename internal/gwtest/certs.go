@@ -0,0 +1,129 @@
+package gwtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Certificates used by the server and its clients, generated for each server.
+type certs struct {
+	server tls.Certificate
+	caPool *x509.CertPool
+
+	// Paths to PEM files for use by clients.
+	caCertPath     string
+	clientCertPath string
+	clientKeyPath  string
+}
+
+func newCerts(dir string) (*certs, error) {
+	ca, caKey, err := newCert(nil, nil, "exodus-gw fake CA", func(tmpl *x509.Certificate) {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	serverCert, serverKey, err := newCert(ca, caKey, "localhost", func(tmpl *x509.Certificate) {
+		tmpl.DNSNames = []string{"localhost"}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	clientCert, clientKey, err := newCert(ca, caKey, ClientSubject, func(tmpl *x509.Certificate) {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := &certs{
+		server: tls.Certificate{
+			Certificate: [][]byte{serverCert.Raw},
+			PrivateKey:  serverKey,
+		},
+		caPool:         x509.NewCertPool(),
+		caCertPath:     filepath.Join(dir, "ca.crt"),
+		clientCertPath: filepath.Join(dir, "client.crt"),
+		clientKeyPath:  filepath.Join(dir, "client.key"),
+	}
+	out.caPool.AddCert(ca)
+
+	files := []struct {
+		path  string
+		block pem.Block
+	}{
+		{out.caCertPath, pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}},
+		{out.clientCertPath, pem.Block{Type: "CERTIFICATE", Bytes: clientCert.Raw}},
+		{out.clientKeyPath, pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(clientKey)}},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(file.path, pem.EncodeToMemory(&file.block), 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func (c *certs) serverTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.server},
+		ClientCAs:    c.caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// newCert generates a certificate signed by parent, or self-signed if parent
+// is nil.
+func newCert(
+	parent *x509.Certificate,
+	parentKey *rsa.PrivateKey,
+	commonName string,
+	customize func(*x509.Certificate),
+) (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	customize(tmpl)
+
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
@@ -0,0 +1,265 @@
+package gwtest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+// serveS3 handles requests to the S3-compatible upload API, where path is of
+// the form "{env}/{key}".
+func (s *Server) serveS3(w http.ResponseWriter, r *http.Request, path string) {
+	env, key, ok := strings.Cut(path, "/")
+	if !ok || env == "" || key == "" {
+		writeS3Error(w, http.StatusBadRequest, "InvalidRequest", "bad path "+path)
+		return
+	}
+
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+
+	switch {
+	case r.Method == http.MethodHead:
+		s.headObject(w, env, key)
+	case r.Method == http.MethodPut && uploadID != "":
+		s.uploadPart(w, r, uploadID, query.Get("partNumber"))
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, env, key)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createMultipartUpload(w, env, key)
+	case r.Method == http.MethodPost && uploadID != "":
+		s.completeMultipartUpload(w, r, uploadID)
+	case r.Method == http.MethodDelete && uploadID != "":
+		s.abortMultipartUpload(w, uploadID)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" not allowed")
+	}
+}
+
+func (s *Server) headObject(w http.ResponseWriter, env string, key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, ok := s.blobs[env][key]
+	if !ok {
+		// exodus-gw responds to HEAD of a missing object without a body.
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(http.StatusOK)
+}
+
+// readBody reads the body of a request, verifying its Content-MD5 if present.
+// It writes an error response and returns false if the body can't be read or
+// doesn't match.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return nil, false
+	}
+
+	if want := r.Header.Get("Content-MD5"); want != "" {
+		sum := md5.Sum(content)
+		if base64.StdEncoding.EncodeToString(sum[:]) != want {
+			writeS3Error(w, http.StatusBadRequest, "BadDigest", "Content-MD5 does not match")
+			return nil, false
+		}
+	}
+
+	return content, true
+}
+
+func etag(content []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(content))
+}
+
+// Must be called with mutex held.
+func (s *Server) storeObject(w http.ResponseWriter, env string, key string, content []byte) bool {
+	// As in exodus-gw, objects must be stored under their SHA256 checksum.
+	if fmt.Sprintf("%x", sha256.Sum256(content)) != key {
+		writeS3Error(w, http.StatusBadRequest, "BadDigest", "content does not match key "+key)
+		return false
+	}
+
+	s.putBlob(env, key, content)
+	return true
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, env string, key string) {
+	content, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.storeObject(w, env, key, content) {
+		return
+	}
+
+	w.Header().Set("ETag", etag(content))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) createMultipartUpload(w http.ResponseWriter, env string, key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := s.newID()
+	s.uploads[id] = &multipartUpload{env: env, key: key, parts: make(map[int][]byte)}
+
+	writeXML(w, initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   env,
+		Key:      key,
+		UploadID: id,
+	})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, uploadID string, partNumber string) {
+	number, err := strconv.Atoi(partNumber)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument", "bad partNumber")
+		return
+	}
+
+	content, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "upload not found")
+		return
+	}
+
+	upload.parts[number] = content
+
+	w.Header().Set("ETag", etag(content))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	_, _ = io.Copy(io.Discard, r.Body)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "upload not found")
+		return
+	}
+
+	numbers := []int{}
+	for number := range upload.parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	content := []byte{}
+	for _, number := range numbers {
+		content = append(content, upload.parts[number]...)
+	}
+
+	if !s.storeObject(w, upload.env, upload.key, content) {
+		return
+	}
+	delete(s.uploads, uploadID)
+
+	writeXML(w, completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/upload/" + upload.env + "/" + upload.key,
+		Bucket:   upload.env,
+		Key:      upload.key,
+		ETag:     etag(content),
+	})
+}
+
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, uploadID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.uploads[uploadID]; !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "upload not found")
+		return
+	}
+
+	delete(s.uploads, uploadID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PendingUploads returns the number of multipart uploads which have been
+// created and neither completed nor aborted.
+func (s *Server) PendingUploads() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.uploads)
+}
+
+func writeXML(w http.ResponseWriter, value interface{}) {
+	body, err := xml.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	body = append([]byte(xml.Header), body...)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string, message string) {
+	body, err := xml.Marshal(s3Error{Code: code, Message: message})
+	if err != nil {
+		panic(err)
+	}
+	body = append([]byte(xml.Header), body...)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,381 @@
+// Package gwtest provides an in-process fake of the exodus-gw service, for
+// testing exodus-rsync end-to-end without a real deployment.
+//
+// The fake serves the publish, task, whoami and S3-compatible upload APIs
+// over HTTPS, requiring clients to authenticate with a certificate. All state
+// is kept in memory and may be inspected by tests, and faults may be injected
+// to test the handling of errors.
+package gwtest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ClientSubject is the common name of the certificate used by clients.
+const ClientSubject = "exodus-rsync-test"
+
+// AbsentObjectKey is the object key used for items deleting content.
+const AbsentObjectKey = "absent"
+
+// Item is a single item on a publish, or published to the CDN.
+type Item struct {
+	WebURI      string `json:"web_uri"`
+	ObjectKey   string `json:"object_key"`
+	ContentType string `json:"content_type"`
+	LinkTo      string `json:"link_to"`
+}
+
+// Publish is a snapshot of a publish object held by the server.
+type Publish struct {
+	ID    string
+	Env   string
+	State string
+
+	// Commit mode requested when the publish was committed, if any.
+	CommitMode string
+
+	Items []Item
+}
+
+// Request records a single request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+}
+
+// Fault describes a failure to be injected into the responses of the server.
+type Fault struct {
+	// Method of affected requests; empty matches any method.
+	Method string
+
+	// Prefix of the path of affected requests; empty matches any path.
+	Path string
+
+	// If non-zero, requests receive a response with this status rather
+	// than being handled.
+	Status int
+
+	// Responses to affected requests are delayed by this long.
+	Delay time.Duration
+
+	// Number of requests affected, after which the fault is removed;
+	// if zero, the fault is never removed.
+	Count int
+}
+
+func (f *Fault) matches(r *http.Request) bool {
+	return (f.Method == "" || f.Method == r.Method) && strings.HasPrefix(r.URL.Path, f.Path)
+}
+
+type publish struct {
+	Publish
+	task *task
+}
+
+type task struct {
+	id        string
+	publishID string
+	state     string
+}
+
+type multipartUpload struct {
+	env   string
+	key   string
+	parts map[int][]byte
+}
+
+// Server is a fake exodus-gw server.
+//
+// All methods are safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	certs *certs
+
+	mutex     sync.Mutex
+	blobs     map[string]map[string][]byte
+	published map[string]map[string]Item
+	publishes map[string]*publish
+	tasks     map[string]*task
+	uploads   map[string]*multipartUpload
+	requests  []Request
+	faults    []*Fault
+	taskState string
+	nextID    int
+}
+
+// NewServer starts a new fake exodus-gw server, which is closed when the test
+// completes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	certs, err := newCerts(t.TempDir())
+	if err != nil {
+		t.Fatalf("generating certificates for fake exodus-gw: %v", err)
+	}
+
+	out := &Server{
+		certs:     certs,
+		blobs:     make(map[string]map[string][]byte),
+		published: make(map[string]map[string]Item),
+		publishes: make(map[string]*publish),
+		tasks:     make(map[string]*task),
+		uploads:   make(map[string]*multipartUpload),
+		taskState: "COMPLETE",
+	}
+
+	out.Server = httptest.NewUnstartedServer(http.HandlerFunc(out.serveHTTP))
+	out.Server.TLS = certs.serverTLSConfig()
+	out.Server.StartTLS()
+
+	t.Cleanup(out.Close)
+
+	return out
+}
+
+// Config returns exodus-rsync configuration for connecting to this server,
+// suitable for the top of a config file.
+func (s *Server) Config() string {
+	return fmt.Sprintf(`gwurl: %s
+gwcert: %s
+gwkey: %s
+gwcacert: %s
+gwpollinterval: 10
+gwmaxbackoff: 10
+`, s.URL, s.certs.clientCertPath, s.certs.clientKeyPath, s.certs.caCertPath)
+}
+
+// InjectFault causes the server to fail requests as described by f.
+func (s *Server) InjectFault(f Fault) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// SetTaskState sets the final state of tasks for publishes committed from now
+// on, e.g. "FAILED". The default is "COMPLETE".
+func (s *Server) SetTaskState(state string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.taskState = state
+}
+
+// AddBlob stores a blob with the given content in env, returning its key.
+func (s *Server) AddBlob(env string, content []byte) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := fmt.Sprintf("%x", sha256.Sum256(content))
+	s.putBlob(env, key, content)
+	return key
+}
+
+// Blob returns the content of a blob in env, if present.
+func (s *Server) Blob(env string, key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, ok := s.blobs[env][key]
+	return content, ok
+}
+
+// BlobKeys returns the sorted keys of all blobs in env.
+func (s *Server) BlobKeys(env string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	out := []string{}
+	for key := range s.blobs[env] {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// AddPublished adds items to the content published in env, as if they had
+// been published previously.
+func (s *Server) AddPublished(env string, items ...Item) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.publishItems(env, items)
+}
+
+// Published returns the content currently published in env, sorted by web URI.
+func (s *Server) Published(env string) []Item {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.listPublished(env, "")
+}
+
+// Publishes returns all publishes created on the server, in order of creation.
+func (s *Server) Publishes() []Publish {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	out := []Publish{}
+	for _, p := range s.publishes {
+		snapshot := p.Publish
+		snapshot.Items = append([]Item{}, p.Items...)
+		out = append(out, snapshot)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Requests returns all requests received by the server, in order.
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Request{}, s.requests...)
+}
+
+// newID returns a new UUID for a publish or task. IDs are sequential, so
+// sort in order of creation.
+//
+// Must be called with mutex held.
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012x", s.nextID)
+}
+
+// Must be called with mutex held.
+func (s *Server) putBlob(env string, key string, content []byte) {
+	if s.blobs[env] == nil {
+		s.blobs[env] = make(map[string][]byte)
+	}
+	s.blobs[env][key] = content
+}
+
+// Must be called with mutex held.
+func (s *Server) publishItems(env string, items []Item) {
+	if s.published[env] == nil {
+		s.published[env] = make(map[string]Item)
+	}
+	for _, item := range items {
+		if item.ObjectKey == AbsentObjectKey {
+			delete(s.published[env], item.WebURI)
+			continue
+		}
+		s.published[env][item.WebURI] = item
+	}
+}
+
+// Must be called with mutex held.
+func (s *Server) listPublished(env string, prefix string) []Item {
+	out := []Item{}
+	for uri, item := range s.published[env] {
+		if strings.HasPrefix(uri, prefix) {
+			out = append(out, item)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].WebURI < out[j].WebURI })
+	return out
+}
+
+// fault returns the fault to apply to a request, if any.
+func (s *Server) fault(r *http.Request) *Fault {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = append(s.requests, Request{r.Method, r.URL.Path, r.URL.RawQuery})
+
+	for i, f := range s.faults {
+		if !f.matches(r) {
+			continue
+		}
+		if f.Count > 0 {
+			f.Count--
+			if f.Count == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		copied := *f
+		return &copied
+	}
+
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if f := s.fault(r); f != nil {
+		select {
+		case <-time.After(f.Delay):
+		case <-r.Context().Done():
+			return
+		}
+		if f.Status != 0 {
+			writeFault(w, r, f.Status)
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+
+	if upload, ok := strings.CutPrefix(path, "upload/"); ok {
+		s.serveS3(w, r, upload)
+		return
+	}
+
+	route := strings.Split(path, "/")
+
+	switch {
+	case len(route) == 1 && route[0] == "whoami" && r.Method == http.MethodGet:
+		s.whoami(w, r)
+	case len(route) == 2 && route[0] == "task" && r.Method == http.MethodGet:
+		s.getTask(w, route[1])
+	case len(route) == 2 && route[1] == "publish" && r.Method == http.MethodPost:
+		s.createPublish(w, route[0])
+	case len(route) == 3 && route[1] == "publish" && r.Method == http.MethodGet:
+		s.getPublish(w, route[0], route[2])
+	case len(route) == 3 && route[1] == "publish" && r.Method == http.MethodPut:
+		s.addItems(w, r, route[0], route[2])
+	case len(route) == 4 && route[1] == "publish" && route[3] == "commit" && r.Method == http.MethodPost:
+		s.commitPublish(w, r, route[0], route[2])
+	case len(route) == 4 && route[1] == "publish" && route[3] == "abandon" && r.Method == http.MethodPost:
+		s.abandonPublish(w, route[0], route[2])
+	case len(route) == 3 && route[1] == "blobs" && route[2] == "present" && r.Method == http.MethodPost:
+		s.blobsPresent(w, r, route[0])
+	case len(route) == 2 && route[1] == "items" && r.Method == http.MethodGet:
+		s.items(w, r, route[0])
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// writeFault writes a response for an injected fault, in the format used by
+// the API being requested.
+func writeFault(w http.ResponseWriter, r *http.Request, status int) {
+	switch {
+	case !strings.HasPrefix(r.URL.Path, "/upload/"):
+		writeError(w, status, "injected fault")
+	case r.Method == http.MethodHead:
+		w.WriteHeader(status)
+	default:
+		writeS3Error(w, status, http.StatusText(status), "injected fault")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]string{"detail": detail})
+}
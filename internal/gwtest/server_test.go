@@ -0,0 +1,456 @@
+package gwtest_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/conf"
+	"github.com/release-engineering/exodus-rsync/internal/gw"
+	"github.com/release-engineering/exodus-rsync/internal/gwtest"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+	"github.com/release-engineering/exodus-rsync/internal/walk"
+)
+
+func testContext() context.Context {
+	return log.NewContext(context.Background(), log.Package.NewLogger(args.Config{}))
+}
+
+// newClient returns a real exodus-gw client connected to srv.
+func newClient(t *testing.T, srv *gwtest.Server) gw.Client {
+	t.Helper()
+
+	ctx := testContext()
+	path := filepath.Join(t.TempDir(), "exodus-rsync.conf")
+	config := srv.Config() + "environments:\n- prefix: exodus\n  gwenv: test\n"
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := conf.Package.Load(ctx, args.Config{ExodusConfig: args.ExodusConfig{Conf: path}})
+	if err != nil {
+		t.Fatal("loading config:", err)
+	}
+
+	client, err := gw.Package.NewClient(ctx, cfg.EnvironmentForDest(ctx, "exodus:/dest"))
+	if err != nil {
+		t.Fatal("creating client:", err)
+	}
+	return client
+}
+
+// newItem writes content to a file and returns an item for syncing it.
+func newItem(t *testing.T, content []byte) walk.SyncItem {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return walk.SyncItem{SrcPath: path, Key: fmt.Sprintf("%x", sha256.Sum256(content))}
+}
+
+func upload(t *testing.T, client gw.Client, items ...walk.SyncItem) (uploaded []string, present []string) {
+	t.Helper()
+
+	err := client.EnsureUploaded(testContext(), items,
+		func(item walk.SyncItem) error {
+			uploaded = append(uploaded, item.Key)
+			return nil
+		},
+		func(item walk.SyncItem) error {
+			present = append(present, item.Key)
+			return nil
+		},
+		func(walk.SyncItem) error { return nil },
+	)
+	if err != nil {
+		t.Fatal("uploading:", err)
+	}
+	return
+}
+
+func TestWhoAmI(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+
+	out, err := client.WhoAmI(testContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := out["client"].(map[string]interface{})["serviceaccount"].(map[string]interface{})["subject"]
+	if subject != gwtest.ClientSubject {
+		t.Errorf("got subject %v, want %v", subject, gwtest.ClientSubject)
+	}
+}
+
+func TestClientCertRequired(t *testing.T) {
+	srv := gwtest.NewServer(t)
+
+	// The server's own client trusts the server but presents no certificate.
+	_, err := srv.Client().Get(srv.URL + "/whoami")
+	if err == nil {
+		t.Fatal("request without client certificate unexpectedly succeeded")
+	}
+}
+
+func TestUploadAndPublish(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+	ctx := testContext()
+
+	small := newItem(t, []byte("hello world"))
+	// Large enough to use a multipart upload.
+	large := newItem(t, []byte(strings.Repeat("0123456789abcdef", 400000)))
+
+	uploaded, present := upload(t, client, small, large)
+	if len(uploaded) != 2 || len(present) != 0 {
+		t.Errorf("uploaded %v, present %v", uploaded, present)
+	}
+
+	for _, item := range []walk.SyncItem{small, large} {
+		want, _ := os.ReadFile(item.SrcPath)
+		got, ok := srv.Blob("test", item.Key)
+		if !ok || string(got) != string(want) {
+			t.Errorf("blob %s missing or has wrong content", item.Key)
+		}
+	}
+	if srv.PendingUploads() != 0 {
+		t.Errorf("%d multipart uploads left pending", srv.PendingUploads())
+	}
+
+	// Uploading again finds everything present.
+	uploaded, present = upload(t, client, small, large)
+	if len(uploaded) != 0 || len(present) != 2 {
+		t.Errorf("second upload: uploaded %v, present %v", uploaded, present)
+	}
+
+	publish, err := client.NewPublish(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []gw.ItemInput{
+		{WebURI: "/dest/small", ObjectKey: small.Key, ContentType: "text/plain"},
+		{WebURI: "/dest/large", ObjectKey: large.Key},
+		{WebURI: "/dest/link", LinkTo: "/dest/small"},
+	}
+	if err := publish.AddItems(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := srv.Published("test"); len(got) != 0 {
+		t.Errorf("content published before commit: %v", got)
+	}
+
+	if err := publish.Commit(ctx, "phase1"); err != nil {
+		t.Fatal(err)
+	}
+
+	wantPublished := []gwtest.Item{
+		{WebURI: "/dest/large", ObjectKey: large.Key},
+		{WebURI: "/dest/link", LinkTo: "/dest/small"},
+		{WebURI: "/dest/small", ObjectKey: small.Key, ContentType: "text/plain"},
+	}
+	if got := srv.Published("test"); !reflect.DeepEqual(got, wantPublished) {
+		t.Errorf("published %v, want %v", got, wantPublished)
+	}
+
+	publishes := srv.Publishes()
+	if len(publishes) != 1 {
+		t.Fatalf("got publishes %v", publishes)
+	}
+	if publishes[0].ID != publish.ID() || publishes[0].State != "COMMITTED" ||
+		publishes[0].CommitMode != "phase1" || len(publishes[0].Items) != 3 {
+		t.Errorf("unexpected publish %v", publishes[0])
+	}
+}
+
+func TestAddItemsMissingBlob(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+	ctx := testContext()
+
+	publish, err := client.NewPublish(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = publish.AddItems(ctx, []gw.ItemInput{{WebURI: "/dest/file", ObjectKey: "abc123"}})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("AddItems with missing blob returned %v", err)
+	}
+}
+
+func TestDeleteAndList(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+	ctx := testContext()
+
+	key := srv.AddBlob("test", []byte("old"))
+	want := []gw.ItemInput{}
+	for i := 0; i < 250; i++ {
+		item := gwtest.Item{WebURI: fmt.Sprintf("/dest/%03d", i), ObjectKey: key}
+		srv.AddPublished("test", item)
+		want = append(want, gw.ItemInput{WebURI: item.WebURI, ObjectKey: key})
+	}
+	srv.AddPublished("test", gwtest.Item{WebURI: "/other/file", ObjectKey: key})
+
+	// Listing pages through everything under the prefix.
+	got := []gw.ItemInput{}
+	err := client.ListPublished(ctx, "/dest/", func(item gw.ItemInput) error {
+		got = append(got, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %d items, want %d", len(got), len(want))
+	}
+
+	publish, err := client.NewPublish(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = publish.AddItems(ctx, []gw.ItemInput{{WebURI: "/other/file", ObjectKey: gwtest.AbsentObjectKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publish.Commit(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range srv.Published("test") {
+		if item.WebURI == "/other/file" {
+			t.Error("deleted item is still published")
+		}
+	}
+}
+
+func TestFaultRetried(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+
+	srv.InjectFault(gwtest.Fault{Method: http.MethodPost, Path: "/test/publish", Status: 503, Count: 2})
+
+	if _, err := client.NewPublish(testContext()); err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for _, req := range srv.Requests() {
+		if req.Method == http.MethodPost && req.Path == "/test/publish" {
+			count++
+		}
+	}
+	if count != 3 {
+		t.Errorf("got %d requests to create publish, want 3", count)
+	}
+}
+
+func TestFaultPersistent(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+
+	srv.InjectFault(gwtest.Fault{Path: "/test/publish", Status: 400})
+
+	_, err := client.NewPublish(testContext())
+	if err == nil || !strings.Contains(err.Error(), "injected fault") {
+		t.Errorf("NewPublish returned %v", err)
+	}
+}
+
+func TestFaultDelay(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+
+	srv.InjectFault(gwtest.Fault{Path: "/whoami", Delay: time.Minute})
+
+	ctx, cancel := context.WithTimeout(testContext(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := client.WhoAmI(ctx)
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("WhoAmI returned %v", err)
+	}
+}
+
+func TestFaultHeadNotFound(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+
+	item := newItem(t, []byte("some content"))
+	srv.AddBlob("test", []byte("some content"))
+
+	// Pretend the blob is missing, even though it's stored.
+	srv.InjectFault(gwtest.Fault{Path: "/test/blobs/present", Status: 404})
+	srv.InjectFault(gwtest.Fault{Method: http.MethodHead, Path: "/upload/test/" + item.Key, Status: 404})
+
+	uploaded, present := upload(t, client, item)
+	if len(uploaded) != 1 || len(present) != 0 {
+		t.Errorf("uploaded %v, present %v", uploaded, present)
+	}
+}
+
+// countMethod returns the number of requests to srv with the given method.
+func countMethod(srv *gwtest.Server, method string) int {
+	out := 0
+	for _, req := range srv.Requests() {
+		if req.Method == method {
+			out++
+		}
+	}
+	return out
+}
+
+func TestBlobsPresent(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+
+	stored := newItem(t, []byte("stored"))
+	srv.AddBlob("test", []byte("stored"))
+	missing := newItem(t, []byte("missing"))
+
+	uploaded, present := upload(t, client, stored, missing)
+	if fmt.Sprint(uploaded) != fmt.Sprint([]string{missing.Key}) || fmt.Sprint(present) != fmt.Sprint([]string{stored.Key}) {
+		t.Errorf("uploaded %v, present %v", uploaded, present)
+	}
+
+	// Presence is checked in bulk, without any HEAD requests.
+	if heads := countMethod(srv, http.MethodHead); heads != 0 {
+		t.Errorf("made %d HEAD requests", heads)
+	}
+}
+
+func TestBlobsPresentUnsupported(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+
+	stored := newItem(t, []byte("stored"))
+	srv.AddBlob("test", []byte("stored"))
+	missing := newItem(t, []byte("missing"))
+
+	// As with older versions of exodus-gw, which lack the bulk API.
+	srv.InjectFault(gwtest.Fault{Path: "/test/blobs/present", Status: 404})
+
+	uploaded, present := upload(t, client, stored, missing)
+	if fmt.Sprint(uploaded) != fmt.Sprint([]string{missing.Key}) || fmt.Sprint(present) != fmt.Sprint([]string{stored.Key}) {
+		t.Errorf("uploaded %v, present %v", uploaded, present)
+	}
+
+	// Presence is checked with a HEAD request per blob instead.
+	if heads := countMethod(srv, http.MethodHead); heads != 2 {
+		t.Errorf("made %d HEAD requests", heads)
+	}
+}
+
+func TestTaskFailed(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+	ctx := testContext()
+
+	srv.SetTaskState("FAILED")
+
+	publish, err := client.NewPublish(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = publish.Commit(ctx, "")
+	taskErr := &gw.TaskError{}
+	if !errors.As(err, &taskErr) || taskErr.State != "FAILED" {
+		t.Errorf("Commit returned %v", err)
+	}
+
+	if state := srv.Publishes()[0].State; state != "FAILED" {
+		t.Errorf("publish in state %s", state)
+	}
+}
+
+func TestAbandon(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+	ctx := testContext()
+
+	publish, err := client.NewPublish(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := publish.Abandon(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if state := srv.Publishes()[0].State; state != "FAILED" {
+		t.Errorf("publish in state %s", state)
+	}
+
+	// An abandoned publish can't be committed.
+	if err := publish.Commit(ctx, ""); err == nil {
+		t.Error("committing abandoned publish unexpectedly succeeded")
+	}
+}
+
+func TestGetPublishAndListItems(t *testing.T) {
+	srv := gwtest.NewServer(t)
+	client := newClient(t, srv)
+	ctx := testContext()
+
+	item := newItem(t, []byte("hello world"))
+	upload(t, client, item)
+
+	created, err := client.NewPublish(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []gw.ItemInput{
+		{WebURI: "/dest/file", ObjectKey: item.Key, ContentType: "text/plain"},
+		{WebURI: "/dest/link", LinkTo: "/dest/file"},
+	}
+	if err := created.AddItems(ctx, items); err != nil {
+		t.Fatal(err)
+	}
+
+	publish, err := client.GetPublish(ctx, created.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publish.State() != "PENDING" {
+		t.Errorf("unexpected state %s", publish.State())
+	}
+
+	var listed []gw.ItemInput
+	err = publish.ListItems(ctx, func(item gw.ItemInput) error {
+		listed = append(listed, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(listed, items) {
+		t.Errorf("listed %v, want %v", listed, items)
+	}
+
+	if err := publish.Commit(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	publish, err = client.GetPublish(ctx, created.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publish.State() != "COMMITTED" {
+		t.Errorf("unexpected state %s", publish.State())
+	}
+}
@@ -0,0 +1,294 @@
+// Package hashcache implements a persistent on-disk cache of file checksums,
+// allowing unchanged files to be skipped when hashing a source tree.
+//
+// Entries are keyed by device and inode, and are only considered valid while
+// the size, mtime and ctime of the file are unchanged.
+package hashcache
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Version of the on-disk format. Cache files written with any other version
+// are discarded.
+const formatVersion = 1
+
+// Files changed this recently, relative to the time the cache was opened, are
+// never stored in the cache. This avoids trusting a checksum computed while
+// the file may still have been written within the same timestamp granularity.
+const racyWindow = 2 * time.Second
+
+// The last use of an entry is only recorded on disk to this resolution, so
+// that runs which only hit the cache rewrite it at most once a day, while
+// entries used on every run are still never the least recently used.
+const usedResolution = 24 * time.Hour
+
+type fileID struct {
+	Dev uint64
+	Ino uint64
+}
+
+type fileStat struct {
+	ID    fileID
+	Size  int64
+	Mtime int64
+	Ctime int64
+}
+
+type entry struct {
+	Stat fileStat
+	Key  string
+
+	// Unix timestamp of the most recent run which made use of this entry;
+	// used to evict the least recently used entries when the cache is full.
+	// Only updated on disk to within usedResolution of the last use.
+	Used int64
+}
+
+type cacheFile struct {
+	Version int
+	Entries []entry
+}
+
+// Cache is a persistent cache of file checksums.
+//
+// A Cache is safe for concurrent use by multiple goroutines. Multiple processes
+// may also share a single cache file; entries are merged when saving.
+type Cache struct {
+	path       string
+	maxEntries int
+	rebuild    bool
+	started    time.Time
+
+	mutex   sync.Mutex
+	entries map[fileID]entry
+	dirty   bool
+}
+
+type cacheKey struct{}
+
+// NewContext returns a context containing the given cache, which can later
+// be accessed via FromContext.
+func NewContext(ctx context.Context, c *Cache) context.Context {
+	return context.WithValue(ctx, cacheKey{}, c)
+}
+
+// FromContext returns the cache within a context previously created via
+// NewContext, or nil if unset.
+func FromContext(ctx context.Context) *Cache {
+	out, _ := ctx.Value(cacheKey{}).(*Cache)
+	return out
+}
+
+// Open loads the cache stored at path, keeping at most maxEntries entries.
+//
+// A missing, corrupt or incompatible cache file is not an error; the returned
+// cache is simply empty in that case.
+//
+// If rebuild is true, the existing content of the cache file is ignored and
+// will be replaced when the cache is saved.
+func Open(path string, maxEntries int, rebuild bool) (*Cache, error) {
+	out := &Cache{
+		path:       path,
+		maxEntries: maxEntries,
+		rebuild:    rebuild,
+		started:    time.Now(),
+		entries:    make(map[fileID]entry),
+	}
+
+	if rebuild {
+		out.dirty = true
+		return out, nil
+	}
+
+	entries, err := readEntries(path)
+	if err != nil {
+		return nil, err
+	}
+	out.entries = entries
+
+	return out, nil
+}
+
+// Path returns the path of the file backing this cache.
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// Len returns the number of entries currently held in the cache.
+func (c *Cache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.entries)
+}
+
+// Lookup returns the previously stored checksum of the file described by info,
+// if the file is known to be unchanged since the checksum was stored.
+func (c *Cache) Lookup(info fs.FileInfo) (string, bool) {
+	st, ok := statOf(info)
+	if !ok {
+		return "", false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[st.ID]
+	if !ok || e.Stat != st {
+		return "", false
+	}
+
+	// Usage is recorded in memory and saved with any other changes, but
+	// only forces the cache to be rewritten once it's out of date by more
+	// than usedResolution.
+	now := c.started.Unix()
+	if now-e.Used >= int64(usedResolution/time.Second) {
+		c.dirty = true
+	}
+	e.Used = now
+	c.entries[st.ID] = e
+
+	return e.Key, true
+}
+
+// Store records the checksum of the file described by info, which must have
+// been obtained before the file was read.
+func (c *Cache) Store(info fs.FileInfo, key string) {
+	st, ok := statOf(info)
+	if !ok {
+		return
+	}
+
+	threshold := c.started.Add(-racyWindow).UnixNano()
+	if st.Mtime >= threshold || st.Ctime >= threshold {
+		// Recently modified, can't be sure the checksum is stable.
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[st.ID] = entry{Stat: st, Key: key, Used: c.started.Unix()}
+	c.dirty = true
+}
+
+// Save writes the cache back to disk.
+//
+// The cache file is locked while saving, and any entries written by other
+// processes since the cache was opened are merged in. If the number of
+// entries exceeds the size limit, the least recently used are discarded.
+func (c *Cache) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(c.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	unlock, err := lockFile(lock)
+	if err != nil {
+		return fmt.Errorf("locking %s: %w", lock.Name(), err)
+	}
+	defer unlock()
+
+	if !c.rebuild {
+		onDisk, err := readEntries(c.path)
+		if err != nil {
+			return err
+		}
+		for id, e := range onDisk {
+			if mine, ok := c.entries[id]; !ok || mine.Used < e.Used {
+				c.entries[id] = e
+			}
+		}
+	}
+
+	out := cacheFile{Version: formatVersion, Entries: c.trimmed()}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = gob.NewEncoder(tmp).Encode(&out)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", c.path, err)
+	}
+
+	c.dirty = false
+	return nil
+}
+
+// Returns all entries, with the least recently used dropped if needed
+// to respect the size limit.
+func (c *Cache) trimmed() []entry {
+	out := make([]entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		out = append(out, e)
+	}
+
+	if c.maxEntries > 0 && len(out) > c.maxEntries {
+		sort.Slice(out, func(i, j int) bool {
+			return out[i].Used > out[j].Used
+		})
+		out = out[:c.maxEntries]
+	}
+
+	return out
+}
+
+func readEntries(path string) (map[fileID]entry, error) {
+	out := make(map[fileID]entry)
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content := cacheFile{}
+	if err := gob.NewDecoder(file).Decode(&content); err != nil || content.Version != formatVersion {
+		// Unusable cache, start again from empty.
+		return out, nil
+	}
+
+	for _, e := range content.Entries {
+		out[e.Stat.ID] = e
+	}
+
+	return out, nil
+}
@@ -0,0 +1,247 @@
+package hashcache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Returns a cache at a temporary path which considers every file
+// old enough to be cached.
+func testCache(t *testing.T, path string, maxEntries int, rebuild bool) *Cache {
+	t.Helper()
+
+	c, err := Open(path, maxEntries, rebuild)
+	if err != nil {
+		t.Fatal("open cache:", err)
+	}
+	c.started = time.Now().Add(time.Hour)
+	return c
+}
+
+func writeFile(t *testing.T, path string, content string) os.FileInfo {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestLookupStore(t *testing.T) {
+	dir := t.TempDir()
+	c := testCache(t, filepath.Join(dir, "cache"), 10, false)
+
+	info := writeFile(t, filepath.Join(dir, "file"), "hello")
+
+	if _, ok := c.Lookup(info); ok {
+		t.Fatal("unexpected hit on empty cache")
+	}
+
+	c.Store(info, "abc123")
+
+	key, ok := c.Lookup(info)
+	if !ok || key != "abc123" {
+		t.Fatalf("lookup after store: got %v, %v", key, ok)
+	}
+
+	// Any change to the file should invalidate the entry.
+	info = writeFile(t, filepath.Join(dir, "file"), "hello world")
+	if _, ok := c.Lookup(info); ok {
+		t.Error("unexpected hit after file was modified")
+	}
+}
+
+func TestStoreRecentlyModified(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := Open(filepath.Join(dir, "cache"), 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := writeFile(t, filepath.Join(dir, "file"), "hello")
+	c.Store(info, "abc123")
+
+	// File was modified just now, so it should not have been cached.
+	if _, ok := c.Lookup(info); ok {
+		t.Error("recently modified file was cached")
+	}
+}
+
+func TestSaveAndReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "subdir", "cache")
+
+	info1 := writeFile(t, filepath.Join(dir, "file1"), "one")
+	info2 := writeFile(t, filepath.Join(dir, "file2"), "two")
+
+	// Two caches opened at the same time, as if by concurrent processes.
+	c1 := testCache(t, path, 10, false)
+	c2 := testCache(t, path, 10, false)
+
+	c1.Store(info1, "key1")
+	c2.Store(info2, "key2")
+
+	if err := c1.Save(); err != nil {
+		t.Fatal("save c1:", err)
+	}
+	if err := c2.Save(); err != nil {
+		t.Fatal("save c2:", err)
+	}
+
+	// Reloaded cache should have the entries from both.
+	reloaded := testCache(t, path, 10, false)
+	if key, _ := reloaded.Lookup(info1); key != "key1" {
+		t.Errorf("missing entry from first cache, got %q", key)
+	}
+	if key, _ := reloaded.Lookup(info2); key != "key2" {
+		t.Errorf("missing entry from second cache, got %q", key)
+	}
+
+	// Rebuilding should discard everything.
+	rebuilt := testCache(t, path, 10, true)
+	if err := rebuilt.Save(); err != nil {
+		t.Fatal("save rebuilt:", err)
+	}
+	reloaded = testCache(t, path, 10, false)
+	if reloaded.Len() != 0 {
+		t.Errorf("cache has %d entries after rebuild", reloaded.Len())
+	}
+}
+
+func TestSaveUnmodified(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache")
+
+	info := writeFile(t, filepath.Join(dir, "file"), "hello")
+	c := testCache(t, path, 10, false)
+	c.Store(info, "abc123")
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A later run which only hits the cache shouldn't rewrite it.
+	c = testCache(t, path, 10, false)
+	c.started = c.started.Add(time.Minute)
+	if _, ok := c.Lookup(info); !ok {
+		t.Fatal("missing cached entry")
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) || !after.ModTime().Equal(before.ModTime()) {
+		t.Error("cache was rewritten without changes")
+	}
+}
+
+func TestSaveRecordsUse(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache")
+
+	info := writeFile(t, filepath.Join(dir, "file"), "hello")
+	c := testCache(t, path, 10, false)
+	c.Store(info, "abc123")
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the recorded use is out of date, a run which only hits the
+	// cache saves the new time of use, so the entry isn't evicted.
+	c = testCache(t, path, 10, false)
+	c.started = c.started.Add(2 * usedResolution)
+	if _, ok := c.Lookup(info); !ok {
+		t.Fatal("missing cached entry")
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := testCache(t, path, 10, false)
+	for _, e := range reloaded.entries {
+		if e.Used != c.started.Unix() {
+			t.Errorf("entry used at %d, expected %d", e.Used, c.started.Unix())
+		}
+	}
+}
+
+func TestSaveTrims(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache")
+
+	old := testCache(t, path, 2, false)
+	old.started = old.started.Add(-time.Minute)
+	oldInfo := writeFile(t, filepath.Join(dir, "old"), "old")
+	old.Store(oldInfo, "old-key")
+	if err := old.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := testCache(t, path, 2, false)
+	c.Store(writeFile(t, filepath.Join(dir, "new1"), "new1"), "new-key1")
+	c.Store(writeFile(t, filepath.Join(dir, "new2"), "new2"), "new-key2")
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the two most recently used entries should have been kept.
+	reloaded := testCache(t, path, 2, false)
+	if reloaded.Len() != 2 {
+		t.Errorf("cache has %d entries, expected 2", reloaded.Len())
+	}
+	if _, ok := reloaded.Lookup(oldInfo); ok {
+		t.Error("least recently used entry was not evicted")
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(path, []byte("not a cache"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(path, 10, false)
+	if err != nil {
+		t.Fatalf("corrupt cache should not be an error, got %v", err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("corrupt cache has %d entries", c.Len())
+	}
+}
+
+func TestOpenUnreadable(t *testing.T) {
+	// A cache path beneath a regular file can't be read.
+	file := filepath.Join(t.TempDir(), "file")
+	writeFile(t, file, "")
+
+	_, err := Open(filepath.Join(file, "cache"), 10, false)
+	if err == nil {
+		t.Error("unexpectedly opened unreadable cache")
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if FromContext(ctx) != nil {
+		t.Error("unexpected cache in empty context")
+	}
+
+	c := testCache(t, filepath.Join(t.TempDir(), "cache"), 10, false)
+	if FromContext(NewContext(ctx, c)) != c {
+		t.Error("cache not returned from context")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package hashcache
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on file, blocking until it's available,
+// and returns a function to release it.
+func lockFile(file *os.File) (func(), error) {
+	fd := int(file.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	return func() { syscall.Flock(fd, syscall.LOCK_UN) }, nil
+}
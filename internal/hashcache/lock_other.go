@@ -0,0 +1,11 @@
+//go:build !linux
+
+package hashcache
+
+import "os"
+
+// Nothing is stored in the cache on other platforms (see stat_other.go), so
+// saving doesn't need to be protected against other processes.
+func lockFile(*os.File) (func(), error) {
+	return func() {}, nil
+}
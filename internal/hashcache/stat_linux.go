@@ -0,0 +1,25 @@
+//go:build linux
+
+package hashcache
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// statOf returns the identity and change times of a regular file, which
+// require the Linux layout of syscall.Stat_t; see stat_other.go for other
+// platforms.
+func statOf(info fs.FileInfo) (fileStat, bool) {
+	sys, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() {
+		return fileStat{}, false
+	}
+
+	return fileStat{
+		ID:    fileID{Dev: uint64(sys.Dev), Ino: uint64(sys.Ino)},
+		Size:  sys.Size,
+		Mtime: sys.Mtim.Nano(),
+		Ctime: sys.Ctim.Nano(),
+	}, true
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package hashcache
+
+import "io/fs"
+
+// The cache is only supported on Linux; elsewhere, every lookup misses
+// and nothing is stored.
+func statOf(fs.FileInfo) (fileStat, bool) {
+	return fileStat{}, false
+}
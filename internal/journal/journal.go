@@ -0,0 +1,402 @@
+// Package journal implements a record of progress made by a single run of
+// exodus-rsync, allowing an interrupted run to be resumed.
+//
+// A journal is a file of JSON records, one per line, appended as the run
+// progresses. It records the publish in use, each file found by walking the
+// source tree, each blob confirmed present in exodus-gw and each batch of
+// items accepted onto the publish.
+package journal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Item identifies a single item added onto a publish.
+type Item struct {
+	WebURI    string `json:"web_uri"`
+	ObjectKey string `json:"object_key,omitempty"`
+	LinkTo    string `json:"link_to,omitempty"`
+}
+
+// File is a single file or symlink found by walking the source tree, so that
+// it needn't be walked or checksummed again by a resumed run.
+type File struct {
+	SrcPath string `json:"src_path"`
+	Key     string `json:"key,omitempty"`
+	LinkTo  string `json:"link_to,omitempty"`
+
+	// Size and mtime (in nanoseconds) of the file when its key was
+	// calculated; the key can't be trusted if either has changed since.
+	Size  int64 `json:"size,omitempty"`
+	Mtime int64 `json:"mtime,omitempty"`
+}
+
+type record struct {
+	// Set only in the first record.
+	PublishID string `json:"publish_id,omitempty"`
+	Created   bool   `json:"created,omitempty"`
+
+	Walked   *File  `json:"walked,omitempty"`
+	WalkDone bool   `json:"walk_done,omitempty"`
+	Uploaded string `json:"uploaded,omitempty"`
+	Added    []Item `json:"added,omitempty"`
+}
+
+// Journal records the progress of a run.
+//
+// All methods are safe for concurrent use, and may be called on a nil
+// *Journal, in which case nothing is recorded and nothing is known.
+type Journal struct {
+	path string
+
+	mutex    sync.Mutex
+	file     *os.File
+	err      error
+	uploaded map[string]struct{}
+	added    map[Item]struct{}
+
+	// Files walked by the journaled run, in order, as read by Load; files
+	// walked since aren't held in memory.
+	walked      []File
+	walkedPaths map[string]struct{}
+	walkDone    bool
+
+	publishID string
+	created   bool
+
+	// Size of the journal up to the end of the last complete record, as
+	// read by Load.
+	size int64
+}
+
+// PathFor returns the path of the journal within dir used for runs identified
+// by the given values, which should include everything distinguishing one
+// run from another (e.g. source and destination).
+func PathFor(dir string, identity ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(identity, "\x00")))
+	return filepath.Join(dir, fmt.Sprintf("%x.journal", hash[:16]))
+}
+
+// Load reads the journal at path, as written by a previous run.
+//
+// If the journal does not exist, returns nil without an error.
+func Load(path string) (*Journal, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	out := newJournal(path)
+
+	reader := bufio.NewReader(file)
+
+	for line := 1; ; line++ {
+		content, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// The previous run may have been killed partway through writing
+			// a record, so the last record may be incomplete; only records
+			// written in full can be trusted.
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		rec := record{}
+		if err := json.Unmarshal(content, &rec); err != nil {
+			break
+		}
+		out.size += int64(len(content))
+
+		if line == 1 {
+			out.publishID = rec.PublishID
+			out.created = rec.Created
+		}
+		if rec.Walked != nil {
+			if _, ok := out.walkedPaths[rec.Walked.SrcPath]; !ok {
+				out.walkedPaths[rec.Walked.SrcPath] = struct{}{}
+				out.walked = append(out.walked, *rec.Walked)
+			}
+		}
+		if rec.WalkDone {
+			out.walkDone = true
+		}
+		if rec.Uploaded != "" {
+			out.uploaded[rec.Uploaded] = struct{}{}
+		}
+		for _, item := range rec.Added {
+			out.added[item] = struct{}{}
+		}
+	}
+
+	if out.publishID == "" {
+		return nil, fmt.Errorf("%s: journal does not record a publish", path)
+	}
+
+	return out, nil
+}
+
+// Create starts a new journal at path for a run using the given publish,
+// replacing any existing journal. 'created' should be true if the publish
+// was created by this run rather than joined.
+func Create(path string, publishID string, created bool) (*Journal, error) {
+	out := newJournal(path)
+	out.publishID = publishID
+	out.created = created
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	out.file = file
+
+	if err := out.write(record{PublishID: publishID, Created: created}); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Continue reopens a journal previously returned by Load, so that further
+// progress is appended onto it.
+//
+// Anything following the last complete record, such as a record only
+// partially written by an interrupted run, is discarded first.
+func (j *Journal) Continue() error {
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := file.Truncate(j.size); err != nil {
+		file.Close()
+		return err
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.file = file
+	return nil
+}
+
+func newJournal(path string) *Journal {
+	return &Journal{
+		path:        path,
+		uploaded:    make(map[string]struct{}),
+		added:       make(map[Item]struct{}),
+		walkedPaths: make(map[string]struct{}),
+	}
+}
+
+// Path returns the path of the file backing this journal.
+func (j *Journal) Path() string {
+	if j == nil {
+		return ""
+	}
+	return j.path
+}
+
+// PublishID returns the ID of the publish used by the journaled run.
+func (j *Journal) PublishID() string {
+	if j == nil {
+		return ""
+	}
+	return j.publishID
+}
+
+// Created returns true if the publish was created, rather than joined,
+// by the journaled run.
+func (j *Journal) Created() bool {
+	return j != nil && j.created
+}
+
+// WalkedFiles returns the files walked by the journaled run, in the order
+// they were found. The returned slice must not be modified.
+func (j *Journal) WalkedFiles() []File {
+	if j == nil {
+		return nil
+	}
+	return j.walked
+}
+
+// IsWalked returns true if the file at srcPath was walked by the journaled run.
+func (j *Journal) IsWalked(srcPath string) bool {
+	if j == nil {
+		return false
+	}
+	_, ok := j.walkedPaths[srcPath]
+	return ok
+}
+
+// WalkDone returns true if the journaled run walked the entire source tree.
+func (j *Journal) WalkDone() bool {
+	if j == nil {
+		return false
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.walkDone
+}
+
+// IsUploaded returns true if the blob with the given key was previously
+// confirmed present in exodus-gw.
+func (j *Journal) IsUploaded(key string) bool {
+	if j == nil {
+		return false
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	_, ok := j.uploaded[key]
+	return ok
+}
+
+// IsAdded returns true if the given item was previously accepted onto the publish.
+func (j *Journal) IsAdded(item Item) bool {
+	if j == nil {
+		return false
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	_, ok := j.added[item]
+	return ok
+}
+
+// Walked records that the given file was found by walking the source tree.
+func (j *Journal) Walked(file File) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.write(record{Walked: &file})
+}
+
+// FinishedWalk records that the entire source tree has been walked.
+func (j *Journal) FinishedWalk() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.walkDone = true
+	return j.write(record{WalkDone: true})
+}
+
+// Uploaded records that the blob with the given key is present in exodus-gw.
+func (j *Journal) Uploaded(key string) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if _, ok := j.uploaded[key]; ok {
+		return nil
+	}
+	j.uploaded[key] = struct{}{}
+
+	return j.write(record{Uploaded: key})
+}
+
+// Added records that the given items were accepted onto the publish.
+func (j *Journal) Added(items []Item) error {
+	if j == nil || len(items) == 0 {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for _, item := range items {
+		j.added[item] = struct{}{}
+	}
+
+	return j.write(record{Added: items})
+}
+
+// Must be called with mutex held.
+func (j *Journal) write(rec record) error {
+	if j.err != nil {
+		// Don't keep retrying after a failure; the journal is now
+		// incomplete anyway.
+		return j.err
+	}
+	if j.file == nil {
+		return fmt.Errorf("journal %s is not open for writing", j.path)
+	}
+
+	content, err := json.Marshal(&rec)
+	if err == nil {
+		_, err = j.file.Write(append(content, '\n'))
+	}
+	if err != nil {
+		j.err = fmt.Errorf("writing %s: %w", j.path, err)
+	}
+
+	return j.err
+}
+
+// Close closes the journal, leaving it on disk so the run can be resumed.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// Remove closes and deletes the journal, once the run has completed and
+// there is nothing left to resume.
+func (j *Journal) Remove() error {
+	if j == nil {
+		return nil
+	}
+
+	j.Close()
+
+	err := os.Remove(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,264 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subdir", "run.journal")
+
+	j, err := Create(path, "publish-1", true)
+	if err != nil {
+		t.Fatal("create:", err)
+	}
+
+	item := Item{WebURI: "/dest/file", ObjectKey: "key1"}
+	link := Item{WebURI: "/dest/link", LinkTo: "/dest/file"}
+
+	if err := j.Uploaded("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Uploaded("key1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Added([]Item{item, link}); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal("load:", err)
+	}
+
+	if loaded.PublishID() != "publish-1" || !loaded.Created() {
+		t.Errorf("unexpected publish: %v, %v", loaded.PublishID(), loaded.Created())
+	}
+	if !loaded.IsUploaded("key1") || loaded.IsUploaded("key2") {
+		t.Error("uploaded keys not recorded as expected")
+	}
+	if !loaded.IsAdded(item) || !loaded.IsAdded(link) {
+		t.Error("added items not recorded")
+	}
+
+	// The same path with different content is a different item.
+	if loaded.IsAdded(Item{WebURI: "/dest/file", ObjectKey: "key2"}) {
+		t.Error("item with changed content unexpectedly considered added")
+	}
+
+	// Continuing should append further progress.
+	if err := loaded.Continue(); err != nil {
+		t.Fatal("continue:", err)
+	}
+	if err := loaded.Uploaded("key2"); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Close()
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal("reload:", err)
+	}
+	if !reloaded.IsUploaded("key1") || !reloaded.IsUploaded("key2") {
+		t.Error("progress lost after continuing journal")
+	}
+
+	if err := reloaded.Remove(); err != nil {
+		t.Fatal("remove:", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal still exists after remove: %v", err)
+	}
+}
+
+func TestWalked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.journal")
+
+	j, err := Create(path, "publish-1", true)
+	if err != nil {
+		t.Fatal("create:", err)
+	}
+
+	file := File{SrcPath: "/src/file", Key: "key1", Size: 5, Mtime: 123}
+	link := File{SrcPath: "/src/link", LinkTo: "file"}
+	for _, f := range []File{file, link, file} {
+		if err := j.Walked(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal("load:", err)
+	}
+
+	// Each file is only replayed once, in the order walked.
+	if walked := loaded.WalkedFiles(); len(walked) != 2 || walked[0] != file || walked[1] != link {
+		t.Errorf("unexpected walked files: %v", walked)
+	}
+	if !loaded.IsWalked("/src/link") || loaded.IsWalked("/src/other") {
+		t.Error("walked files not recorded as expected")
+	}
+	if loaded.WalkDone() {
+		t.Error("walk unexpectedly done")
+	}
+
+	if err := loaded.Continue(); err != nil {
+		t.Fatal("continue:", err)
+	}
+	if err := loaded.FinishedWalk(); err != nil {
+		t.Fatal(err)
+	}
+	loaded.Close()
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal("load:", err)
+	}
+	if !reloaded.WalkDone() || len(reloaded.WalkedFiles()) != 2 {
+		t.Errorf("unexpected walk state: done %v, files %v", reloaded.WalkDone(), reloaded.WalkedFiles())
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	j, err := Load(filepath.Join(t.TempDir(), "missing"))
+	if j != nil || err != nil {
+		t.Errorf("unexpected result for missing journal: %v, %v", j, err)
+	}
+}
+
+func TestLoadTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.journal")
+
+	content := `{"publish_id":"publish-1"}
+{"uploaded":"key1"}
+{"uploaded":"ke`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := Load(path)
+	if err != nil {
+		t.Fatal("load:", err)
+	}
+
+	// Everything up to the incomplete record should be usable.
+	if !j.IsUploaded("key1") || j.Created() {
+		t.Error("complete records were not loaded")
+	}
+
+	// Continuing should discard the incomplete record, so that progress
+	// recorded from now on can be loaded again.
+	if err := j.Continue(); err != nil {
+		t.Fatal("continue:", err)
+	}
+	if err := j.Uploaded("key2"); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"publish_id":"publish-1"}
+{"uploaded":"key1"}
+{"uploaded":"key2"}
+`
+	if string(written) != expected {
+		t.Errorf("unexpected journal content: %q", written)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal("reload:", err)
+	}
+	if !reloaded.IsUploaded("key1") || !reloaded.IsUploaded("key2") {
+		t.Error("progress lost after continuing truncated journal")
+	}
+}
+
+func TestLoadMissingNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.journal")
+
+	// The last record is valid, but wasn't written in full.
+	content := `{"publish_id":"publish-1"}
+{"uploaded":"key1"}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := Load(path)
+	if err != nil {
+		t.Fatal("load:", err)
+	}
+	if j.IsUploaded("key1") {
+		t.Error("incomplete record was loaded")
+	}
+
+	if err := j.Continue(); err != nil {
+		t.Fatal("continue:", err)
+	}
+	if err := j.Uploaded("key2"); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatal("reload:", err)
+	}
+	if reloaded.IsUploaded("key1") || !reloaded.IsUploaded("key2") {
+		t.Error("unexpected progress after continuing journal")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.journal")
+	if err := os.WriteFile(path, []byte("garbage\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "does not record a publish") {
+		t.Errorf("did not get expected error, got: %v", err)
+	}
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *Journal
+
+	// Every method should be usable on a nil journal.
+	if j.IsUploaded("key") || j.IsAdded(Item{}) || j.Created() || j.PublishID() != "" || j.Path() != "" ||
+		j.IsWalked("path") || j.WalkDone() || len(j.WalkedFiles()) != 0 {
+		t.Error("nil journal unexpectedly knows something")
+	}
+	if j.Uploaded("key") != nil || j.Added([]Item{{}}) != nil || j.Close() != nil || j.Remove() != nil ||
+		j.Walked(File{}) != nil || j.FinishedWalk() != nil {
+		t.Error("nil journal returned error")
+	}
+}
+
+func TestPathFor(t *testing.T) {
+	a := PathFor("/dir", "src", "dest")
+	b := PathFor("/dir", "src", "dest")
+	c := PathFor("/dir", "srcdest")
+
+	if a != b {
+		t.Errorf("path is not stable: %v, %v", a, b)
+	}
+	if a == c {
+		t.Errorf("distinct identities share a path: %v", a)
+	}
+	if filepath.Dir(a) != "/dir" || !strings.HasSuffix(a, ".journal") {
+		t.Errorf("unexpected path: %v", a)
+	}
+}
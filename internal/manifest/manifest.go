@@ -0,0 +1,132 @@
+// Package manifest implements a machine-readable record of the content
+// published by a single run of exodus-rsync.
+//
+// A manifest is a JSON document listing every item placed onto the publish,
+// sorted by web URI so that manifests of different runs can easily be
+// compared.
+//
+// A manifest may also be used as input, listing the items to be published.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Outcome describes how the content of an item came to be present in exodus-gw.
+type Outcome string
+
+const (
+	// Uploaded means the content was uploaded by this run.
+	Uploaded Outcome = "uploaded"
+
+	// Present means the content was already present, so was not uploaded.
+	Present Outcome = "present"
+
+	// Duplicate means the content was the same as some other item in
+	// this run, so was uploaded only once.
+	Duplicate Outcome = "duplicate"
+)
+
+// Entry describes a single item placed onto a publish.
+type Entry struct {
+	WebURI      string  `json:"web_uri"`
+	ObjectKey   string  `json:"object_key,omitempty"`
+	ContentType string  `json:"content_type,omitempty"`
+	LinkTo      string  `json:"link_to,omitempty"`
+	SrcPath     string  `json:"src_path,omitempty"`
+	Size        int64   `json:"size"`
+	Outcome     Outcome `json:"outcome,omitempty"`
+}
+
+// Manifest describes the content published by a run.
+//
+// Entries may be added concurrently.
+type Manifest struct {
+	PublishID string `json:"publish_id"`
+	Env       string `json:"env"`
+
+	// Whether the run committed the publish, and how.
+	Committed  bool   `json:"committed"`
+	CommitMode string `json:"commit_mode,omitempty"`
+
+	// ID of the commit task, if the run didn't wait for it to complete.
+	TaskID string `json:"task_id,omitempty"`
+
+	// Final state of the commit task, if known.
+	TaskState string `json:"task_state,omitempty"`
+
+	Items []Entry `json:"items"`
+
+	mutex sync.Mutex
+}
+
+// Add records entries in the manifest.
+func (m *Manifest) Add(entries ...Entry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.Items = append(m.Items, entries...)
+}
+
+// Write writes the manifest to path, replacing any existing file.
+//
+// The file is replaced atomically, so readers never see a partially
+// written manifest.
+func (m *Manifest) Write(path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sort.SliceStable(m.Items, func(i, j int) bool {
+		return m.Items[i].WebURI < m.Items[j].WebURI
+	})
+	if m.Items == nil {
+		m.Items = []Entry{}
+	}
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".manifest-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(append(content, '\n'))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp uses 0600, but the manifest is not sensitive and is
+	// intended for use by other tools.
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// Read reads a manifest from path, as written by Write.
+func Read(path string) (*Manifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Manifest{}
+	if err := json.Unmarshal(content, out); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,132 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	m := Manifest{PublishID: "some-publish", Env: "some-env", Committed: true, TaskState: "COMPLETE"}
+
+	// Entries may be added concurrently and in any order.
+	wg := sync.WaitGroup{}
+	for _, uri := range []string{"/c", "/a", "/b"} {
+		wg.Add(1)
+		go func(uri string) {
+			defer wg.Done()
+			m.Add(Entry{WebURI: uri, ObjectKey: "key" + uri, SrcPath: "src" + uri, Size: 3, Outcome: Uploaded})
+		}(uri)
+	}
+	wg.Wait()
+
+	if err := m.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := Manifest{}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.PublishID != "some-publish" || got.Env != "some-env" || !got.Committed || got.TaskState != "COMPLETE" {
+		t.Errorf("unexpected manifest content: %s", content)
+	}
+
+	// Entries should be sorted for easy comparison.
+	var uris []string
+	for _, item := range got.Items {
+		uris = append(uris, item.WebURI)
+	}
+	if !reflect.DeepEqual(uris, []string{"/a", "/b", "/c"}) {
+		t.Errorf("unexpected items: %v", got.Items)
+	}
+	if got.Items[0] != (Entry{WebURI: "/a", ObjectKey: "key/a", SrcPath: "src/a", Size: 3, Outcome: Uploaded}) {
+		t.Errorf("unexpected item: %v", got.Items[0])
+	}
+
+	// No temporary files should be left behind.
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	if len(files) != 1 {
+		t.Errorf("unexpected files: %v", files)
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	m := Manifest{PublishID: "some-publish"}
+	if err := m.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Items should be an empty list rather than null.
+	if !strings.Contains(string(content), `"items": []`) {
+		t.Errorf("unexpected manifest content: %s", content)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	m := Manifest{}
+
+	err := m.Write(filepath.Join(t.TempDir(), "no-such-dir", "manifest.json"))
+	if err == nil {
+		t.Error("unexpectedly succeeded writing to nonexistent directory")
+	}
+}
+
+func TestRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+
+	written := Manifest{PublishID: "some-publish", Env: "some-env"}
+	written.Add(
+		Entry{WebURI: "/b", SrcPath: "b", Size: 1, Outcome: Present},
+		Entry{WebURI: "/a", LinkTo: "/b"},
+	)
+	if err := written.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// It should read back what was written.
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PublishID != "some-publish" || !reflect.DeepEqual(got.Items, written.Items) {
+		t.Errorf("unexpected manifest: %+v", got)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := Read(filepath.Join(dir, "nonexistent")); err == nil {
+		t.Error("unexpectedly read nonexistent manifest")
+	}
+
+	path := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(path, []byte("[not a manifest"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Read(path)
+	if err == nil || !strings.Contains(err.Error(), "parsing "+path) {
+		t.Errorf("did not get expected error, err = %v", err)
+	}
+}
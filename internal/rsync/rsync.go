@@ -134,24 +134,39 @@ func Arguments(ctx context.Context, args args.Config) []string {
 	if args.Compress {
 		argv = append(argv, "--compress")
 	}
-	for _, rule := range args.Filter {
-		argv = append(argv, "--filter", fmt.Sprint(rule))
-	}
-	for _, ex := range args.Exclude {
-		argv = append(argv, "--exclude", fmt.Sprint(ex))
-	}
-	for _, in := range args.Include {
-		argv = append(argv, "--include", fmt.Sprint(in))
+	for _, arg := range args.Filters() {
+		// Order matters, since the first matching rule wins.
+		if arg.Value == "-" && arg.Patterns != nil {
+			// Patterns were already read from stdin, so rsync can't read
+			// them again; pass them individually instead.
+			for _, pattern := range arg.Patterns {
+				argv = append(argv, "--"+strings.TrimSuffix(arg.Name, "-from"), pattern)
+			}
+			continue
+		}
+		argv = append(argv, "--"+arg.Name, arg.Value)
 	}
 	if args.FilesFrom != "" {
 		argv = append(argv, "--files-from", fmt.Sprint(args.FilesFrom))
 	}
+	if args.From0 {
+		argv = append(argv, "--from0")
+	}
 	if args.Stats {
 		argv = append(argv, "--stats")
 	}
 	if args.ItemizeChanges {
 		argv = append(argv, "--itemize-changes")
 	}
+	if args.Progress {
+		argv = append(argv, "--progress")
+	}
+	if len(args.Info) > 0 {
+		argv = append(argv, "--info="+strings.Join(args.Info, ","))
+	}
+	if args.BwLimit != "" {
+		argv = append(argv, "--bwlimit="+string(args.BwLimit))
+	}
 
 	argv = append(argv, args.Src, args.Dest)
 
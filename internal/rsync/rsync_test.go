@@ -96,6 +96,45 @@ func TestExec(t *testing.T) {
 			[]string{testBinPath(t) + "/rsync", "some-src", "some-dest"},
 		},
 
+		{"ordered filters",
+			args.Config{
+				Src:             "some-src",
+				Dest:            "some-dest",
+				Include:         []string{"keep.o"},
+				Exclude:         []string{"*.o"},
+				FilterShorthand: 1,
+				FilterArgs: []args.FilterArg{
+					{Name: "include", Value: "keep.o"},
+					{Name: "exclude", Value: "*.o"},
+					{Name: "filter", Value: "dir-merge /.rsync-filter"},
+				},
+			},
+			[]string{
+				testBinPath(t) + "/rsync",
+				"--include", "keep.o", "--exclude", "*.o", "--filter", "dir-merge /.rsync-filter",
+				"some-src", "some-dest",
+			},
+		},
+
+		{"filter files",
+			args.Config{
+				Src:  "some-src",
+				Dest: "some-dest",
+				FilterArgs: []args.FilterArg{
+					{Name: "exclude-from", Value: "excludes.txt", Patterns: []string{"*.o"}},
+					{Name: "include-from", Value: "-", Patterns: []string{"keep.o", "- *.c"}},
+					{Name: "exclude-from", Value: "-"},
+				},
+			},
+			[]string{
+				testBinPath(t) + "/rsync",
+				"--exclude-from", "excludes.txt",
+				"--include", "keep.o", "--include", "- *.c",
+				"--exclude-from", "-",
+				"some-src", "some-dest",
+			},
+		},
+
 		{"all args",
 			args.Config{
 				Src:     "src",
@@ -121,20 +160,24 @@ func TestExec(t *testing.T) {
 					Crtimes:        true,
 					OmitDirTimes:   true,
 					Rsh:            "some-rsh",
-					Delete:         true,
 					PruneEmptyDirs: true,
 					Timeout:        1234,
 					Compress:       true,
-					Stats:          true,
-					ItemizeChanges: true,
 				},
+				Stats:          true,
+				ItemizeChanges: true,
+				Progress:       true,
+				Info:           []string{"progress2", "stats2"},
+				BwLimit:        "1.5m",
 				Relative:       true,
 				Links:          true,
 				IgnoreExisting: true,
+				Delete:         true,
 				Filter:         []string{"some-filter"},
 				Exclude:        []string{".*"},
 				Include:        []string{"**/dir"},
 				FilesFrom:      "sources.txt",
+				From0:          true,
 			},
 			[]string{
 				testBinPath(t) + "/rsync", "-vvv",
@@ -144,7 +187,8 @@ func TestExec(t *testing.T) {
 				"--atimes", "--crtimes", "--omit-dir-times", "--dry-run", "--rsh", "some-rsh",
 				"--ignore-existing", "--delete", "--prune-empty-dirs", "--timeout", "1234",
 				"--compress", "--filter", "some-filter", "--exclude", ".*", "--include", "**/dir",
-				"--files-from", "sources.txt", "--stats", "--itemize-changes",
+				"--files-from", "sources.txt", "--from0", "--stats", "--itemize-changes",
+				"--progress", "--info=progress2,stats2", "--bwlimit=1.5m",
 				"src", "dest",
 			},
 		},
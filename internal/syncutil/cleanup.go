@@ -0,0 +1,14 @@
+package syncutil
+
+import (
+	"context"
+	"time"
+)
+
+// CleanupContext returns a context for cleaning up after ctx was cancelled.
+//
+// The returned context carries the values of ctx, but isn't cancelled along
+// with it. Instead, it's cancelled once timeout has elapsed.
+func CleanupContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), timeout)
+}
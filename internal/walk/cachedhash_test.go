@@ -0,0 +1,49 @@
+package walk
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apex/log/handlers/cli"
+	"github.com/release-engineering/exodus-rsync/internal/hashcache"
+	"github.com/release-engineering/exodus-rsync/internal/log"
+)
+
+func TestCachedFileHash(t *testing.T) {
+	ctx := context.Background()
+	logger := log.Logger{}
+	logger.Handler = cli.New(os.Stdout)
+	ctx = log.NewContext(ctx, &logger)
+
+	dir := t.TempDir()
+	cache, err := hashcache.Open(filepath.Join(dir, "cache"), 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = hashcache.NewContext(ctx, cache)
+
+	expected, err := fileHash("walk.go", sha256.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With a cache present, it should calculate the same checksum as without.
+	for i := 0; i < 2; i++ {
+		key, err := cachedFileHash(ctx, "walk.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != expected {
+			t.Errorf("attempt %d: got checksum %v, expected %v", i, key, expected)
+		}
+	}
+
+	// Errors from stat should be propagated.
+	_, err = cachedFileHash(ctx, filepath.Join(dir, "nonexistent"))
+	if !os.IsNotExist(err) {
+		t.Errorf("did not get expected error, err = %v", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"runtime"
 
 	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/hashcache"
 	"github.com/release-engineering/exodus-rsync/internal/log"
 	"github.com/release-engineering/exodus-rsync/internal/syncutil"
 )
@@ -33,6 +34,22 @@ type SyncItem struct {
 	Key     string
 	LinkTo  string
 	Info    fs.FileInfo
+
+	// If set, the destination of this item, used as-is rather than derived
+	// from the source path.
+	WebURI string
+
+	// If set, the content type of this item, used rather than detecting it.
+	ContentType string
+}
+
+type skipKey struct{}
+
+// WithSkip returns a context in which Walk skips every file for which skip
+// returns true, without checksumming it or invoking the handler; for example,
+// files already handled by an earlier run.
+func WithSkip(ctx context.Context, skip func(srcPath string) bool) context.Context {
+	return context.WithValue(ctx, skipKey{}, skip)
 }
 
 type syncItemPrivate struct {
@@ -54,6 +71,39 @@ func fileHash(path string, hasher hash.Hash) (string, error) {
 	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
 
+// cachedFileHash is like fileHash, but consults and updates the checksum cache
+// in ctx, if any.
+func cachedFileHash(ctx context.Context, path string) (string, error) {
+	cache := hashcache.FromContext(ctx)
+	if cache == nil {
+		return fileHash(path, sha256.New())
+	}
+
+	// Stat again rather than reusing the walked entry's info, since that
+	// describes the link rather than the target when following symlinks.
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if key, ok := cache.Lookup(info); ok {
+		log.FromContext(ctx).F("path", path, "key", key).Debug("checksum cache hit")
+		return key, nil
+	}
+
+	key, err := fileHash(path, sha256.New())
+	if err == nil {
+		cache.Store(info, key)
+	}
+	return key, err
+}
+
+// FileKey returns the key for the content of the file at path, i.e. its
+// SHA256 checksum, consulting and updating the checksum cache in ctx, if any.
+func FileKey(ctx context.Context, path string) (string, error) {
+	return cachedFileHash(ctx, path)
+}
+
 func fillItem(ctx context.Context, c chan<- syncItemPrivate, w walkItem, links bool) error {
 	logger := log.FromContext(ctx)
 
@@ -73,6 +123,11 @@ func fillItem(ctx context.Context, c chan<- syncItemPrivate, w walkItem, links b
 		return nil
 	}
 
+	if skip, ok := ctx.Value(skipKey{}).(func(string) bool); ok && skip(w.SrcPath) {
+		logger.F("path", w.SrcPath).Debug("Skipping file")
+		return nil
+	}
+
 	var (
 		key    string
 		linkTo string
@@ -84,7 +139,7 @@ func fillItem(ctx context.Context, c chan<- syncItemPrivate, w walkItem, links b
 			return err
 		}
 	} else {
-		key, err = fileHash(w.SrcPath, sha256.New())
+		key, err = cachedFileHash(ctx, w.SrcPath)
 		if err != nil {
 			return fmt.Errorf("checksum %s: %w", w.SrcPath, err)
 		}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/apex/log/handlers/cli"
 	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/filter"
 	"github.com/release-engineering/exodus-rsync/internal/log"
 )
 
@@ -89,7 +94,7 @@ func TestWalkHandlerError(t *testing.T) {
 	}
 }
 
-func TestWalkExcludeMatchError(t *testing.T) {
+func TestWalkFilterError(t *testing.T) {
 	ctx := context.Background()
 	logger := log.Logger{}
 	logger.Handler = cli.New(os.Stdout)
@@ -100,113 +105,312 @@ func TestWalkExcludeMatchError(t *testing.T) {
 		return nil
 	}
 
-	err := Walk(ctx, args.Config{Src: ".", Exclude: []string{"a(b*"}}, []string{}, handler)
+	err := Walk(ctx, args.Config{Src: ".", Filter: []string{". no-such-file"}}, []string{}, handler)
 
-	// It should have caused a regexp error
-	msg := "could not process --exclude `a(b*`: error parsing regexp: missing closing ): `^a(b[^/]+$`"
-	if err.Error() != msg {
-		t.Errorf("unexpected success")
+	// It should have failed to read the merge file
+	if err == nil || !strings.Contains(err.Error(), "no-such-file") {
+		t.Errorf("unexpected error %v", err)
 	}
 }
 
-func TestWalkIncludeMatchError(t *testing.T) {
+func TestWalkFilter(t *testing.T) {
 	ctx := context.Background()
 	logger := log.Logger{}
 	logger.Handler = cli.New(os.Stdout)
 
 	ctx = log.NewContext(ctx, &logger)
 
-	handler := func(item SyncItem) error {
-		return nil
+	dir := t.TempDir()
+	for _, name := range []string{"a/keep.c", "a/drop.o", "b/keep.c", "top.c", "top.o"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  args.Config
+		want []string
+	}{
+		{"no rules",
+			args.Config{Src: dir + "/"},
+			[]string{"a/drop.o", "a/keep.c", "b/keep.c", "link/drop.o", "link/keep.c", "top.c", "top.o"}},
+
+		{"anchored exclude",
+			args.Config{Src: dir + "/", Exclude: []string{"/a", "/b/"}},
+			[]string{"link/drop.o", "link/keep.c", "top.c", "top.o"}},
+
+		{"include dirs and matching files",
+			args.Config{Src: dir + "/", Filter: []string{"+ */", "+ *.c", "- *"}},
+			[]string{"a/keep.c", "b/keep.c", "link/keep.c", "top.c"}},
+
+		{"first match wins",
+			args.Config{Src: dir + "/", FilterArgs: []args.FilterArg{
+				{Name: "include", Value: "/top.o"},
+				{Name: "exclude", Value: "*.o"},
+			}},
+			[]string{"a/keep.c", "b/keep.c", "link/keep.c", "top.c", "top.o"}},
+
+		{"patterns from files",
+			args.Config{Src: dir + "/", FilterArgs: []args.FilterArg{
+				{Name: "include-from", Value: "-", Patterns: []string{"keep.c", "- /top.c"}},
+				{Name: "exclude-from", Value: "excludes", Patterns: []string{"*.c", "+ /a/"}},
+				{Name: "exclude-from", Value: "unread"},
+			}},
+			[]string{"a/drop.o", "a/keep.c", "b/keep.c", "link/drop.o", "link/keep.c", "top.o"}},
+
+		{"exclude with contents",
+			args.Config{Src: dir + "/", Filter: []string{"- /a/***", "- /link/***"}},
+			[]string{"b/keep.c", "top.c", "top.o"}},
+
+		// Without a trailing slash, the source directory's name is part of
+		// the matched path.
+		{"source directory name",
+			args.Config{Src: dir, Exclude: []string{"/" + filepath.Base(dir) + "/top.*"}},
+			[]string{"a/drop.o", "a/keep.c", "b/keep.c", "link/drop.o", "link/keep.c"}},
+
+		{"source directory name unmatched",
+			args.Config{Src: dir, Exclude: []string{"/top.*"}},
+			[]string{"a/drop.o", "a/keep.c", "b/keep.c", "link/drop.o", "link/keep.c", "top.c", "top.o"}},
 	}
 
-	err := Walk(ctx, args.Config{Src: ".", Exclude: []string{"*"}, Include: []string{"a(b*"}}, []string{}, handler)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			handler := func(item SyncItem) error {
+				rel, _ := filepath.Rel(dir, item.SrcPath)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
+			}
 
-	// It should have caused a regexp error
-	msg := "could not process --include `a(b*`: error parsing regexp: missing closing ): `^a(b[^/]+$`"
-	if err.Error() != msg {
-		t.Errorf("unexpected success")
+			if err := Walk(ctx, tt.cfg, []string{}, handler); err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("walked %v, want %v", got, tt.want)
+			}
+		})
 	}
 }
 
-func TestWalkLinksMatchPattern(t *testing.T) {
+func TestWalkFilesFrom(t *testing.T) {
+	ctx := context.Background()
+	logger := log.Logger{}
+	logger.Handler = cli.New(os.Stdout)
+
+	ctx = log.NewContext(ctx, &logger)
+
+	dir := t.TempDir()
+	for _, name := range []string{"a/b/c", "a/d", "a/ spaced ", "a/new\nline", "e/f", "g"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
 	tests := []struct {
-		path    string
-		pattern string
-		isDir   bool
-		result  bool
+		name      string
+		listed    []string
+		recursive bool
+		want      []string
 	}{
-		// Should match
-		{"foo/app.c", `app.*`, false, true},
-		{"foo/.some-conf", `.*`, false, true},
-		{"foo/bar", `*`, false, true},
-		{"/foo/bar", `/foo`, false, true},
-		{"foo/bar", `bar`, false, true},
-		{"foo/bar", `bar/`, true, true},
-		{"foo/bar/baz", `foo/***`, false, true},
-		{"test.txt", `*.txt`, false, true},
-		{"foo/bars", `bar?`, false, true},
-		{"foo/bar/baz.dat", `foo/*/baz.dat`, false, true},
-		{"foo/bar/baz/buz/bats.oog", `foo/**/bats.oog`, false, true},
-		{"foo/4/bar", `foo/[0-9]/bar`, false, true},
-		{"foo/d/bar", `foo/[a-z]/bar`, false, true},
-		{"foo/?/bar", `foo/\?/bar`, false, true},
-		// Should not match
-		{"foo/some.conf", `.*`, false, false},
-		{"foo/bar/baz", `.`, false, false},
-		{"foo/bar/baz", `bar/`, false, false},
-		{"foo/bar/baz", `baz/`, false, false},
-		{"foo/4/baz", `foo/\d/baz`, false, false},
-		{"foo/bar/bar", `foo/[a-z]+/baz`, false, false},
+		{"files", []string{"a/ spaced ", "a/new\nline", "g"}, false,
+			[]string{"a/ spaced ", "a/new\nline", "g"}},
+
+		{"directory", []string{"a", "e/f"}, false,
+			[]string{"e/f"}},
+
+		{"directory recursive", []string{"a/b", "e"}, true,
+			[]string{"a/b/c", "e/f"}},
+
+		{"via link", []string{"link/b/c"}, false,
+			[]string{"link/b/c"}},
+
+		{"link recursive", []string{"link/b"}, true,
+			[]string{"link/b/c"}},
+
+		{"nothing", []string{}, true, nil},
 	}
+
 	for _, tt := range tests {
-		t.Run(tt.path, func(t *testing.T) {
-			var errMsg string
-			if tt.result {
-				errMsg = "pattern `%s` did not match path, '%s'"
-			} else {
-				errMsg = "pattern `%s` matched path, '%s'"
+		t.Run(tt.name, func(t *testing.T) {
+			var onlyThese []string
+			for _, name := range tt.listed {
+				onlyThese = append(onlyThese, filepath.Join(dir, name))
 			}
 
-			matched, err := matchPattern(tt.path, tt.pattern, tt.isDir)
-			if err != nil {
-				t.Errorf("Unexpected error, %v", err)
+			var got []string
+			handler := func(item SyncItem) error {
+				rel, _ := filepath.Rel(dir, item.SrcPath)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
 			}
 
-			if matched != tt.result {
-				t.Errorf(errMsg, tt.pattern, tt.path)
+			cfg := args.Config{Src: dir + "/", FilesFrom: "list", IgnoredConfig: args.IgnoredConfig{Recursive: tt.recursive}}
+			if err := Walk(ctx, cfg, onlyThese, handler); err != nil {
+				t.Fatal(err)
+			}
+
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("walked %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	ctx := context.Background()
+	logger := log.Logger{}
+	logger.Handler = cli.New(os.Stdout)
+
+	ctx = log.NewContext(ctx, &logger)
+
+	cfg := args.Config{
+		Exclude: []string{"*.log", "cache/"},
+		Include: []string{"keep.log"},
+	}
+
+	tests := []struct {
+		path     string
+		excluded bool
+	}{
+		{"/file.txt", false},
+		{"/sub/file.txt", false},
+		{"/debug.log", true},
+		{"/sub/debug.log", true},
+		// Excludes come before includes, so this is excluded.
+		{"/sub/keep.log", true},
+		{"/cache/file.txt", true},
+		{"/sub/cache/deep/file.txt", true},
+		{"/sub/cache", false},
+		{"sub/debug.log", true},
+	}
+
+	rules, err := NewFilter(cfg, filter.Receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			excluded, err := rules.Excluded(ctx, tt.path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if excluded != tt.excluded {
+				t.Errorf("Excluded(%q) = %v, want %v", tt.path, excluded, tt.excluded)
 			}
 		})
 	}
 }
 
-func TestWalkLinksFilterPathAll(t *testing.T) {
+func TestExcludedSide(t *testing.T) {
 	ctx := context.Background()
 	logger := log.Logger{}
 	logger.Handler = cli.New(os.Stdout)
 
 	ctx = log.NewContext(ctx, &logger)
 
-	err := filter(log.FromContext(ctx), "file", []string{"*"}, []string{}, false)
-	if err != nil && err.Error() != "filtered 'file'" {
-		t.Errorf("failed to filter 'file' for exclude pattern `*`")
+	cfg := args.Config{
+		Src:    "src",
+		Dest:   "host:/dest",
+		Filter: []string{"P protected", "H hidden", "-/ /dest/src/abs"},
+	}
+
+	sender, err := NewFilter(cfg, filter.Sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewFilter(cfg, filter.Receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		sender   bool
+		receiver bool
+	}{
+		{"protected", false, true},
+		{"hidden", true, false},
+		{"abs", false, true},
+	}
+
+	for _, tt := range tests {
+		if excluded, _ := sender.Excluded(ctx, tt.path); excluded != tt.sender {
+			t.Errorf("sender Excluded(%q) = %v", tt.path, excluded)
+		}
+		if excluded, _ := receiver.Excluded(ctx, tt.path); excluded != tt.receiver {
+			t.Errorf("receiver Excluded(%q) = %v", tt.path, excluded)
+		}
 	}
+}
 
-	err = filter(log.FromContext(ctx), "some/dir", []string{"*"}, []string{}, true)
-	if err != nil && err.Error() != "skip this directory" {
-		t.Errorf("failed to filter 'some/dir' for exclude pattern `*`")
+func TestNewFilterError(t *testing.T) {
+	_, err := NewFilter(args.Config{Filter: []string{"quux"}}, filter.Sender)
+	if err == nil {
+		t.Error("unexpectedly succeeded with invalid rule")
 	}
 }
 
-func TestWalkLinksFilterPathInclude(t *testing.T) {
+func TestFileKey(t *testing.T) {
 	ctx := context.Background()
 	logger := log.Logger{}
 	logger.Handler = cli.New(os.Stdout)
+	ctx = log.NewContext(ctx, &logger)
+
+	key, err := FileKey(ctx, "../../test/data/srctrees/just-files/hello-copy-one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" {
+		t.Errorf("unexpected key %s", key)
+	}
 
+	if _, err := FileKey(ctx, "nonexistent"); err == nil {
+		t.Error("unexpectedly got key for nonexistent file")
+	}
+}
+
+func TestWalkSkip(t *testing.T) {
+	ctx := context.Background()
+	logger := log.Logger{}
+	logger.Handler = cli.New(os.Stdout)
 	ctx = log.NewContext(ctx, &logger)
 
-	err := filter(log.FromContext(ctx), "/some/dir", []string{"*"}, []string{"*/", "**/dir"}, true)
+	src := "../../test/data/srctrees/just-files"
+	skipped := filepath.Join(src, "hello-copy-one")
+	ctx = WithSkip(ctx, func(path string) bool { return path == skipped })
+
+	var got []string
+	err := Walk(ctx, args.Config{Src: src}, nil, func(item SyncItem) error {
+		got = append(got, item.SrcPath)
+		return nil
+	})
 	if err != nil {
-		t.Errorf("unexpected error `%s`", err)
+		t.Fatal(err)
+	}
+
+	for _, path := range got {
+		if path == skipped {
+			t.Errorf("skipped file was walked: %v", got)
+		}
+	}
+	if len(got) == 0 {
+		t.Error("no files walked")
 	}
 }
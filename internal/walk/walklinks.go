@@ -5,11 +5,12 @@ import (
 	"fmt"
 	fs "io/fs"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/release-engineering/exodus-rsync/internal/args"
+	"github.com/release-engineering/exodus-rsync/internal/filter"
 	"github.com/release-engineering/exodus-rsync/internal/log"
 )
 
@@ -22,127 +23,222 @@ func pathRewriter(src string, dest string, fn fs.WalkDirFunc) fs.WalkDirFunc {
 	}
 }
 
-func makeRegexp(pattern string) (*regexp.Regexp, error) {
-	converted := ""
-	chars := []rune(pattern)
-	for i := 0; i < len(chars); i++ {
-		char := string(chars[i])
-		switch char {
-		case `\`:
-			// Escape; skip this and following wildcard character.
-			i++
-			next := string(chars[i])
-			if strings.ContainsAny(next, "*?[]") {
-				converted += (char + next)
-			}
-		case `.`:
-			// Always treat as literal.
-			converted += `\.`
-		case `*`:
-			// Matches any path component, but it stops at forward slashes (/).
-			converted += `[^/]+`
-		case `?`:
-			// Matches any character except a forward slash (/).
-			converted += `[^/]`
-		default:
-			converted += char
-		}
-	}
+// fileList is the set of paths given by --files-from.
+type fileList struct {
+	// Paths listed in the file.
+	listed map[string]struct{}
 
-	pattern = strings.Replace(converted, `[^/]+[^/]+`, `.*`, -1)
+	// Directories above the listed paths, which must be walked to reach them.
+	parents map[string]struct{}
 
-	pattern = "^" + pattern + "$"
+	// Top of the source tree.
+	src string
 
-	return regexp.Compile(pattern)
+	// If true, everything within a listed directory is included.
+	recursive bool
 }
 
-// Determines if path matches pattern, striving for parity with rsync,
-// ("Include/Exclude Pattern Rules", https://linux.die.net/man/1/rsync).
-func matchPattern(path string, pattern string, isDir bool) (bool, error) {
-	if strings.HasSuffix(pattern, "/") {
-		// If pattern ends with a forward slash (/), only match a directory.
-		if isDir {
-			pattern = strings.TrimRight(pattern, "/")
-		} else {
-			return false, nil
-		}
+func newFileList(src string, paths []string, recursive bool) *fileList {
+	out := &fileList{
+		listed:    make(map[string]struct{}, len(paths)),
+		parents:   make(map[string]struct{}),
+		src:       filepath.Clean(src),
+		recursive: recursive,
 	}
 
-	if strings.ContainsAny(pattern, "*?[]") {
-		// Use regex for wildcard matching.
-		re, err := makeRegexp(pattern)
-		if err != nil {
-			return false, err
-		}
+	for _, p := range paths {
+		p = filepath.Clean(p)
+		out.listed[p] = struct{}{}
 
-		components := strings.SplitAfter(path, "/")
-		for c := range components {
-			match := re.MatchString(components[c])
-			if match {
-				return match, nil
+		for dir := filepath.Dir(p); dir != p && dir != out.src; p, dir = dir, filepath.Dir(dir) {
+			if _, ok := out.parents[dir]; ok {
+				break
 			}
+			out.parents[dir] = struct{}{}
 		}
-		return re.MatchString(path), nil
 	}
 
-	// Default to simple string matching.
-	return strings.Contains(path, pattern), nil
+	return out
 }
 
-func contains(s []string, str string) bool {
-	for _, v := range s {
-		if v == str {
-			return true
+// includes returns true if path should be walked.
+func (l *fileList) includes(path string) bool {
+	path = filepath.Clean(path)
+	if path == l.src {
+		return true
+	}
+	if _, ok := l.listed[path]; ok {
+		return true
+	}
+	if _, ok := l.parents[path]; ok {
+		return true
+	}
+
+	if l.recursive {
+		// As with rsync -r, include everything within a listed directory.
+		for dir := filepath.Dir(path); dir != path && dir != l.src; path, dir = dir, filepath.Dir(dir) {
+			if _, ok := l.listed[dir]; ok {
+				return true
+			}
 		}
 	}
+
 	return false
 }
 
-func filter(logger *log.Logger, path string, exclude []string, include []string, isDir bool) error {
-	filtErr := fmt.Errorf("filtered '%s'", path)
+// Filter applies the filter rules given on the command-line (--filter,
+// --exclude, --include and -F) to paths within the source tree.
+type Filter struct {
+	set *filter.Set
+
+	// Path of the source tree relative to the top of the transfer, i.e. the
+	// name against which rules match SRC itself.
+	root string
+}
 
-	for _, ex := range exclude {
-		isExcluded, matchErr := matchPattern(path, ex, isDir)
-		if matchErr != nil {
-			return fmt.Errorf("could not process --exclude `%s`: %w", ex, matchErr)
+// NewFilter returns a Filter for the rules in args, as applied on the given
+// side of the transfer. Patterns from --exclude-from and --include-from are
+// used only once read by args.Config.ReadFilterFiles.
+//
+// As in rsync, rules match paths relative to the top of the transfer, so
+// whether SRC has a trailing slash and whether -R is used both affect which
+// paths are matched.
+func NewFilter(args args.Config, side filter.Side) (*Filter, error) {
+	var rules []*filter.Rule
+	addPattern := func(pattern string, action filter.Action) {
+		if rule := filter.ParsePattern(pattern, action); rule != nil {
+			rules = append(rules, rule)
 		}
+	}
 
-		if isExcluded {
-			for _, in := range include {
-				if in == "*/" {
-					// Automatically include dirs, do not apply pattern otherwise.
-					if isDir {
-						return nil
-					}
-					continue
-				}
+	for _, arg := range args.Filters() {
+		switch arg.Name {
+		case "filter":
+			rule, err := filter.Parse(arg.Value)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		case "exclude":
+			addPattern(arg.Value, filter.Exclude)
+		case "include":
+			addPattern(arg.Value, filter.Include)
+		case "exclude-from":
+			for _, pattern := range arg.Patterns {
+				addPattern(pattern, filter.Exclude)
+			}
+		case "include-from":
+			for _, pattern := range arg.Patterns {
+				addPattern(pattern, filter.Include)
+			}
+		}
+	}
 
-				isIncluded, err := matchPattern(path, in, isDir)
-				if err != nil {
-					return fmt.Errorf("could not process --include `%s`: %w", in, err)
-				}
+	src := filepath.Clean(args.Src)
+	srcIsDir := true
+	if info, err := os.Stat(src); err == nil {
+		srcIsDir = info.IsDir()
+	}
 
-				if isIncluded {
-					logger.F("path", path, "include", in).Debug("path included")
-					return nil
-				}
-			}
+	out := &Filter{}
+	switch {
+	case args.FilesFrom != "":
+		// Listed files are relative to SRC.
+	case args.Relative:
+		out.root = strings.TrimPrefix(filepath.ToSlash(src), "/")
+	case src != "." && !strings.HasSuffix(args.Src, "/"):
+		out.root = filepath.Base(src)
+	}
+	if out.root == "." {
+		out.root = ""
+	}
 
-			logger.F("path", path, "exclude", ex).Debug("path excluded")
+	tree := filter.Tree{Dir: src, Prefix: out.root, Side: side, From0: args.From0}
+	if !srcIsDir {
+		tree.Dir = filepath.Dir(src)
+		tree.Prefix = strings.Trim(path.Dir("/"+out.root), "/")
+	}
 
-			if isDir {
-				return fs.SkipDir
-			}
-			return filtErr
+	if side == filter.Receiver {
+		tree.AbsRoot = args.Dest
+		if idx := strings.Index(args.Dest, ":"); idx >= 0 {
+			tree.AbsRoot = args.Dest[idx+1:]
+		}
+	} else if abs, err := filepath.Abs(tree.Dir); err == nil {
+		// Strip the components of the tree which are part of transfer paths.
+		tree.AbsRoot = filepath.ToSlash(abs)
+		if tree.Prefix != "" {
+			tree.AbsRoot = strings.TrimSuffix(tree.AbsRoot, "/"+tree.Prefix)
 		}
 	}
-	return nil
+
+	var err error
+	out.set, err = filter.New(tree, rules)
+	return out, err
+}
+
+// name returns the path of a file in the source tree relative to the top of
+// the transfer.
+func (f *Filter) name(relPath string) string {
+	return strings.TrimPrefix(path.Join(f.root, filepath.ToSlash(relPath)), "/")
+}
+
+// excludes returns true if the path, relative to the top of the source tree,
+// is directly excluded by the rules.
+func (f *Filter) excludes(ctx context.Context, relPath string, isDir bool) (bool, error) {
+	name := f.name(relPath)
+
+	excluded, rule, err := f.set.Excluded(name, isDir)
+	if err != nil || rule == nil {
+		return false, err
+	}
+
+	msg := "path included"
+	if excluded {
+		msg = "path excluded"
+	}
+	log.FromContext(ctx).F("path", name, "rule", rule.String()).Debug(msg)
+
+	return excluded, nil
+}
+
+// Excluded determines whether a file at relPath, relative to the top of the
+// source tree, is excluded by filter rules either directly or by exclusion of
+// any parent directory.
+//
+// Like rsync, this can be used to protect files on the receiving side from
+// deletion.
+func (f *Filter) Excluded(ctx context.Context, relPath string) (bool, error) {
+	relPath = strings.TrimPrefix(path.Clean("/"+relPath), "/")
+
+	// Check each parent directory, from the top down.
+	components := strings.Split(relPath, "/")
+	dir := ""
+	for _, component := range components[:len(components)-1] {
+		dir = path.Join(dir, component)
+		if excluded, err := f.excludes(ctx, dir, true); excluded || err != nil {
+			return excluded, err
+		}
+	}
+
+	return f.excludes(ctx, relPath, false)
 }
 
 // Like filepath.WalkDir but resolves symlinks to directories.
 func walkDirWithLinks(ctx context.Context, args args.Config, onlyThese []string, fn fs.WalkDirFunc) error {
 	logger := log.FromContext(ctx)
 
+	rules, err := NewFilter(args, filter.Sender)
+	if err != nil {
+		return err
+	}
+
+	// With --files-from, only the listed paths are walked.
+	var only *fileList
+	if args.FilesFrom != "" {
+		only = newFileList(args.Src, onlyThese, args.Recursive)
+	}
+
 	var walkFunc fs.WalkDirFunc
 
 	walkFunc = func(path string, d fs.DirEntry, err error) error {
@@ -153,43 +249,54 @@ func walkDirWithLinks(ctx context.Context, args args.Config, onlyThese []string,
 			return fn(path, d, err)
 		}
 
-		if len(onlyThese) > 0 && !contains(onlyThese, path) {
+		if only != nil && !only.includes(path) {
 			logger.F("path", path).Debug("skipping; not included in --files-from file")
-			return nil
-		}
-
-		// The path filtered should be relative.
-		filterPath := strings.TrimPrefix(filepath.Clean(path), filepath.Clean(args.Src+"/"))
-		filterErr := filter(logger, filterPath, args.Excluded(), args.Included(), d.IsDir())
-		if filterErr != nil {
-			if strings.Contains(filterErr.Error(), fmt.Sprintf("filtered '%s'", filterPath)) {
-				return nil
+			if d.IsDir() {
+				return fs.SkipDir
 			}
-			return filterErr
+			return nil
 		}
 
+		var (
+			resolved    string
+			info        fs.FileInfo
+			resolvedErr error
+		)
+		isDir := d.IsDir()
 		if d.Type()&fs.ModeSymlink != 0 && !args.Links {
-			var info fs.FileInfo
-
-			resolved, err := filepath.EvalSymlinks(path)
-			if err == nil {
-				info, err = os.Stat(resolved)
+			resolved, resolvedErr = filepath.EvalSymlinks(path)
+			if resolvedErr == nil {
+				info, resolvedErr = os.Stat(resolved)
 			}
+			isDir = resolvedErr == nil && info.IsDir()
+		}
 
+		if relPath, err := filepath.Rel(args.Src, path); err == nil {
+			excluded, err := rules.excludes(ctx, relPath, isDir)
 			if err != nil {
-				return fn(path, d, fmt.Errorf("resolving link %s: %w", path, err))
+				return err
+			}
+			if excluded {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
 			}
+		}
+
+		if resolvedErr != nil {
+			return fn(path, d, fmt.Errorf("resolving link %s: %w", path, resolvedErr))
+		}
 
-			if info.IsDir() {
-				// Walk this entire directory too.
-				logger.F("path", resolved).Debug("walking dir via link")
+		if isDir && resolved != "" {
+			// Walk this entire directory too.
+			logger.F("path", resolved).Debug("walking dir via link")
 
-				// We need to call WalkDir on the target of the symlink, but we want
-				// the callback function to receive the pre-resolution paths, so we
-				// rewrite on the fly.
-				thisWalker := pathRewriter(resolved, path, walkFunc)
-				return filepath.WalkDir(resolved, thisWalker)
-			}
+			// We need to call WalkDir on the target of the symlink, but we want
+			// the callback function to receive the pre-resolution paths, so we
+			// rewrite on the fly.
+			thisWalker := pathRewriter(resolved, path, walkFunc)
+			return filepath.WalkDir(resolved, thisWalker)
 		}
 
 		// We are not looking at a symlink-to-dir, just call the real handler.